@@ -0,0 +1,158 @@
+/*
+Package cdc implements content defined chunking. A stream is split into chunks
+at positions picked by a rolling hash over its content, so inserting or
+removing bytes only changes the chunks around the edit. Files that share most
+of their bytes end up sharing most of their chunks, which are identified by
+their SHA-256 hash.
+
+The boundaries depend only on the content and the Options, so the client and
+server will always agree on them.
+*/
+package cdc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Options control the size of the chunks.
+type Options struct {
+	Min int // No chunk is smaller than Min, except the last one.
+	Avg int // The average chunk size. It must be a power of 2.
+	Max int // No chunk is larger than Max.
+}
+
+// DefaultOptions are the options used for uploads.
+var DefaultOptions = Options{
+	Min: 256 * 1024,
+	Avg: 1024 * 1024,
+	Max: 4 * 1024 * 1024,
+}
+
+// MaxChunkSize is the largest chunk a server will accept.
+const MaxChunkSize = 16 * 1024 * 1024
+
+// Chunk describes a single chunk of a stream.
+type Chunk struct {
+	Hash string // Hex encoded SHA-256 hash of the chunk
+	Size int64  // Number of bytes in the chunk
+}
+
+// gear is the table of random values the rolling hash uses for each byte
+// value. It is generated from a fixed seed so it is the same everywhere.
+var gear [256]uint64
+
+func init() {
+	// splitmix64
+	seed := uint64(0x6d63667363646321)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker splits a stream into content defined chunks.
+type Chunker struct {
+	r    io.Reader
+	opts Options
+	mask uint64
+	buf  []byte
+	n    int   // number of valid bytes in buf
+	eof  bool  // r has been read to the end
+	err  error // error from r, other than io.EOF
+}
+
+// NewChunker creates a new Chunker reading from r.
+func NewChunker(r io.Reader, opts Options) (*Chunker, error) {
+	if opts.Min < 1 || opts.Avg < opts.Min || opts.Max < opts.Avg || opts.Avg&(opts.Avg-1) != 0 {
+		return nil, fmt.Errorf("invalid chunker options %+v", opts)
+	}
+
+	return &Chunker{
+		r:    r,
+		opts: opts,
+		mask: uint64(opts.Avg - 1),
+		buf:  make([]byte, opts.Max),
+	}, nil
+}
+
+// Next returns the next chunk. The returned slice is only valid until the next
+// call to Next. It returns io.EOF when there are no more chunks.
+func (c *Chunker) Next() ([]byte, error) {
+	c.fill()
+	if c.n == 0 {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, io.EOF
+	}
+
+	cut := c.cut(c.buf[:c.n])
+	chunk := make([]byte, cut)
+	copy(chunk, c.buf[:cut])
+	c.n = copy(c.buf, c.buf[cut:c.n])
+	return chunk, nil
+}
+
+// fill reads until the buffer is full or the stream ends.
+func (c *Chunker) fill() {
+	for c.n < len(c.buf) && !c.eof {
+		n, err := c.r.Read(c.buf[c.n:])
+		c.n += n
+		switch {
+		case err == io.EOF:
+			c.eof = true
+		case err != nil:
+			c.eof = true
+			c.err = err
+		}
+	}
+}
+
+// cut finds the end of the chunk at the start of data.
+func (c *Chunker) cut(data []byte) int {
+	if len(data) <= c.opts.Min {
+		return len(data)
+	}
+
+	var hash uint64
+	for i := c.opts.Min; i < len(data); i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.mask == 0 {
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
+
+// Sum returns the hex encoded SHA-256 hash that identifies a chunk.
+func Sum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Split reads r to the end and returns the chunks it is made of.
+func Split(r io.Reader, opts Options) ([]Chunk, error) {
+	c, err := NewChunker(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for {
+		data, err := c.Next()
+		switch {
+		case err == io.EOF:
+			return chunks, nil
+		case err != nil:
+			return nil, err
+		}
+		chunks = append(chunks, Chunk{Hash: Sum(data), Size: int64(len(data))})
+	}
+}
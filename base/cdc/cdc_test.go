@@ -0,0 +1,79 @@
+package cdc
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+var testOptions = Options{Min: 256, Avg: 1024, Max: 4096}
+
+func randomBytes(n int, seed int64) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestSplitSizes(t *testing.T) {
+	data := randomBytes(200*1024, 1)
+	chunks, err := Split(bytes.NewReader(data), testOptions)
+	if err != nil {
+		t.Fatalf("Split failed: %s", err)
+	}
+
+	var total int64
+	for i, chunk := range chunks {
+		total += chunk.Size
+		if chunk.Size > int64(testOptions.Max) {
+			t.Errorf("Chunk %d is larger than max: %d", i, chunk.Size)
+		}
+		if i != len(chunks)-1 && chunk.Size < int64(testOptions.Min) {
+			t.Errorf("Chunk %d is smaller than min: %d", i, chunk.Size)
+		}
+	}
+
+	if total != int64(len(data)) {
+		t.Fatalf("Chunks add up to %d bytes, expected %d", total, len(data))
+	}
+
+	if avg := total / int64(len(chunks)); avg < int64(testOptions.Min) || avg > int64(testOptions.Max) {
+		t.Errorf("Unexpected average chunk size %d", avg)
+	}
+}
+
+func TestSplitSharesChunksAfterInsert(t *testing.T) {
+	data := randomBytes(200*1024, 2)
+	edited := append(append(append([]byte{}, data[:1000]...), []byte("inserted bytes")...), data[1000:]...)
+
+	original, _ := Split(bytes.NewReader(data), testOptions)
+	modified, _ := Split(bytes.NewReader(edited), testOptions)
+
+	known := make(map[string]bool)
+	for _, chunk := range original {
+		known[chunk.Hash] = true
+	}
+
+	shared := 0
+	for _, chunk := range modified {
+		if known[chunk.Hash] {
+			shared++
+		}
+	}
+
+	if shared < len(modified)-3 {
+		t.Fatalf("Only %d of %d chunks shared after a small insert", shared, len(modified))
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	chunks, err := Split(bytes.NewReader(nil), testOptions)
+	if err != nil || len(chunks) != 0 {
+		t.Fatalf("Expected no chunks for empty input, got %v (%v)", chunks, err)
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	if _, err := NewChunker(bytes.NewReader(nil), Options{Min: 10, Avg: 1000, Max: 4000}); err == nil {
+		t.Fatalf("Accepted an average that isn't a power of 2")
+	}
+}
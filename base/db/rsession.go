@@ -1,29 +1,160 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	r "github.com/dancannon/gorethink"
 )
 
-var dbAddress = ""
-var dbName = ""
+var (
+	rOpts r.ConnectOpts
+
+	// rSession is shared by everyone. A session holds a pool of connections
+	// and is safe for concurrent use. It is replaced when it fails a health
+	// check, so hold on to the session only for the duration of a query.
+	rSession *r.Session
+
+	// rErr is the error from the last connect or health check, or nil if
+	// the session is healthy.
+	rErr error
+
+	// rDialed is set once the first connect was tried. After that only
+	// RCheck connects.
+	rDialed bool
+
+	// rRetired holds the sessions that were replaced. Queries may still be
+	// running on them, so they are closed by the next health check.
+	rRetired []*r.Session
+
+	rMux sync.Mutex
+)
 
 // SetAddress sets the address to connect to the RethinkDB database.
 func SetAddress(address string) {
-	dbAddress = address
+	setROpt(func() { rOpts.Address = address })
 }
 
 // SetDatabase sets the default database to use.
 func SetDatabase(db string) {
-	dbName = db
+	setROpt(func() { rOpts.Database = db })
+}
+
+// RDatabase returns the default database.
+func RDatabase() string {
+	rMux.Lock()
+	defer rMux.Unlock()
+	return rOpts.Database
+}
+
+// SetAuthKey sets the key used to authenticate with the RethinkDB server.
+func SetAuthKey(key string) {
+	setROpt(func() { rOpts.AuthKey = key })
+}
+
+// SetTimeout sets how long a query can take. A timeout of 0 means queries
+// never time out.
+func SetTimeout(timeout time.Duration) {
+	setROpt(func() { rOpts.Timeout = timeout })
 }
 
-// RSession creates a new RethinkDB session.
+// setROpt changes a connection option. The shared session is retired so the
+// next call to RSession connects with the new options.
+func setROpt(set func()) {
+	rMux.Lock()
+	defer rMux.Unlock()
+	set()
+	retireRSession()
+	rSession = nil
+	rErr = nil
+	rDialed = false
+}
+
+// RSession returns the RethinkDB session shared by the server, connecting
+// on first use. After that it never dials the database itself: it returns
+// the current session along with the error from the last connect or health
+// check, and leaves replacing a bad session to RCheck.
 func RSession() (*r.Session, error) {
-	return r.Connect(
-		r.ConnectOpts{
-			Address:  dbAddress,
-			Database: dbName,
-			//			MaxIdle:   10,
-			//			MaxActive: 20,
-		})
+	rMux.Lock()
+	defer rMux.Unlock()
+	if !rDialed {
+		rDialed = true
+		rConnect()
+	}
+	return rSession, rErr
+}
+
+// RCheck checks that the shared session can still run queries. When it
+// can't, a new session is connected and replaces it. It is meant to be
+// called periodically by a single caller, such as the dbcheck server, which
+// sets the rate at which a lost database is reconnected to. Sessions replaced
+// by the previous check are closed first.
+func RCheck() error {
+	rMux.Lock()
+	closeRetired()
+	session := rSession
+	rMux.Unlock()
+
+	err := errors.New("no session")
+	if session != nil {
+		var cursor *r.Cursor
+		if cursor, err = r.Expr(1).Run(session); err == nil {
+			err = cursor.Close()
+		}
+	}
+
+	rMux.Lock()
+	defer rMux.Unlock()
+	switch {
+	case session != rSession:
+		// The options changed during the check, the next RSession connects.
+	case err == nil:
+		rErr = nil
+	default:
+		rDialed = true
+		rErr = err
+		rConnect()
+	}
+	return err
+}
+
+// rConnect connects a new session and makes it the shared session. When the
+// connect fails the current session is kept, unless there isn't one, and its
+// error is saved for RSession to return. The caller must hold rMux.
+func rConnect() {
+	session, err := r.Connect(rOpts)
+	if err != nil {
+		rErr = fmt.Errorf("unable to connect to RethinkDB at %s: %s", rOpts.Address, err)
+		if rSession == nil {
+			rSession = session
+		} else {
+			rRetired = append(rRetired, session)
+		}
+		return
+	}
+
+	retireRSession()
+	rSession = session
+	rErr = nil
+}
+
+// retireRSession sets aside the shared session to be closed by the next
+// health check. The caller must hold rMux.
+func retireRSession() {
+	if rSession != nil {
+		rRetired = append(rRetired, rSession)
+	}
+}
+
+// closeRetired closes the sessions retired before the current health check.
+// The caller must hold rMux.
+func closeRetired() {
+	for _, session := range rRetired {
+		if session != nil {
+			session.Close()
+		}
+	}
+	rRetired = nil
 }
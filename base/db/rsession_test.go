@@ -0,0 +1,36 @@
+package db
+
+import "testing"
+
+func TestRSessionOnlyDialsOnce(t *testing.T) {
+	// Nothing listens on port 1, so connects fail straight away.
+	SetAddress("127.0.0.1:1")
+	defer SetAddress("")
+
+	first, err := RSession()
+	if err == nil {
+		t.Fatalf("Expected connect to fail")
+	}
+
+	// Later calls don't dial again, and get the same session and error.
+	if session, err2 := RSession(); session != first || err2 != err {
+		t.Fatalf("Expected the same session and error, got %v", err2)
+	}
+
+	rMux.Lock()
+	if len(rRetired) != 0 {
+		t.Fatalf("A call after the first connect tried to connect")
+	}
+	rMux.Unlock()
+
+	// Only a health check reconnects, and it reports the failure.
+	if err := RCheck(); err == nil {
+		t.Fatalf("Expected the check to fail")
+	}
+
+	rMux.Lock()
+	if len(rRetired) != 1 {
+		t.Fatalf("Expected the check to connect a new session, retired %d", len(rRetired))
+	}
+	rMux.Unlock()
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" // Implicit import of driver
+)
+
+var (
+	sqlDriver = "sqlite3"
+	sqlDSN    = ""
+
+	// sqlDB is shared by everyone. A *sqlx.DB is a connection pool and is
+	// safe for concurrent use, so there is no reason to open more than one.
+	sqlDB  *sqlx.DB
+	sqlMux sync.Mutex
+)
+
+// SetSQL sets the driver and data source name used to connect to a SQL
+// database. An empty driver leaves the driver unchanged.
+func SetSQL(driver, dsn string) {
+	sqlMux.Lock()
+	defer sqlMux.Unlock()
+	if driver != "" {
+		sqlDriver = driver
+	}
+	sqlDSN = dsn
+	if sqlDB != nil {
+		sqlDB.Close()
+		sqlDB = nil
+	}
+}
+
+// SQLSession returns the connection pool for the SQL database, opening
+// it on first use.
+func SQLSession() (*sqlx.DB, error) {
+	sqlMux.Lock()
+	defer sqlMux.Unlock()
+	if sqlDB != nil {
+		return sqlDB, nil
+	}
+
+	db, err := sqlx.Connect(sqlDriver, sqlDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if sqlDriver == "sqlite3" {
+		// SQLite only allows a single writer. Serializing access through one
+		// connection avoids "database is locked" errors between connections.
+		db.SetMaxOpenConns(1)
+	}
+
+	sqlDB = db
+	return sqlDB, nil
+}
@@ -0,0 +1,148 @@
+/*
+Package digest computes and compares file digests across multiple hash
+algorithms. A file can carry digests for any of the supported algorithms.
+Two sets of digests are compared using the strongest algorithm they have in
+common.
+*/
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// Names of the supported algorithms.
+const (
+	MD5    = "md5"
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+// algorithms lists the supported algorithms from weakest to strongest.
+var algorithms = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{MD5, md5.New},
+	{SHA1, sha1.New},
+	{SHA256, sha256.New},
+	{SHA512, sha512.New},
+}
+
+// strength returns the rank of an algorithm, or -1 if it isn't supported.
+func strength(alg string) int {
+	for i, a := range algorithms {
+		if a.name == alg {
+			return i
+		}
+	}
+	return -1
+}
+
+// Supported returns true if alg is a supported algorithm.
+func Supported(alg string) bool {
+	return strength(alg) != -1
+}
+
+// New returns a new hash.Hash for alg.
+func New(alg string) (hash.Hash, error) {
+	if i := strength(alg); i != -1 {
+		return algorithms[i].new(), nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %s", alg)
+}
+
+// Set maps algorithm names to hex encoded digests.
+type Set map[string]string
+
+// Algorithms returns the supported algorithms in the set, from weakest to strongest.
+func (s Set) Algorithms() []string {
+	var algs []string
+	for _, a := range algorithms {
+		if s[a.name] != "" {
+			algs = append(algs, a.name)
+		}
+	}
+	return algs
+}
+
+// Strongest returns the strongest algorithm in the set, or "" if the set has
+// no supported algorithms.
+func (s Set) Strongest() string {
+	algs := s.Algorithms()
+	if len(algs) == 0 {
+		return ""
+	}
+	return algs[len(algs)-1]
+}
+
+// StrongestCommon returns the strongest algorithm both sets have a digest for,
+// or "" if they have none in common.
+func (s Set) StrongestCommon(other Set) string {
+	algs := s.Algorithms()
+	for i := len(algs) - 1; i >= 0; i-- {
+		if other[algs[i]] != "" {
+			return algs[i]
+		}
+	}
+	return ""
+}
+
+// Matches returns true if both sets have the same digest for the strongest
+// algorithm they have in common. Sets with no algorithms in common don't match.
+func (s Set) Matches(other Set) bool {
+	alg := s.StrongestCommon(other)
+	return alg != "" && s[alg] == other[alg]
+}
+
+// Verify checks that every digest in expected is in s with the same value. It
+// returns the first algorithm that doesn't match, or "" if all do.
+func (s Set) Verify(expected Set) string {
+	for _, alg := range expected.Algorithms() {
+		if s[alg] != expected[alg] {
+			return alg
+		}
+	}
+	return ""
+}
+
+// Compute reads r to the end, computing digests for each of algs in a single pass.
+func Compute(r io.Reader, algs ...string) (Set, error) {
+	hashes := make(map[string]hash.Hash, len(algs))
+	writers := make([]io.Writer, 0, len(algs))
+	for _, alg := range algs {
+		h, err := New(alg)
+		if err != nil {
+			return nil, err
+		}
+		hashes[alg] = h
+		writers = append(writers, h)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return nil, err
+	}
+
+	set := make(Set, len(hashes))
+	for alg, h := range hashes {
+		set[alg] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return set, nil
+}
+
+// File computes the digests of the file at path for each of algs.
+func File(path string, algs ...string) (Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Compute(f, algs...)
+}
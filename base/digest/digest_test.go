@@ -0,0 +1,63 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	set, err := Compute(strings.NewReader("hello"), MD5, SHA256)
+	if err != nil {
+		t.Fatalf("Compute failed: %s", err)
+	}
+
+	if set[MD5] != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("Wrong md5 %s", set[MD5])
+	}
+
+	if set[SHA256] != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("Wrong sha256 %s", set[SHA256])
+	}
+
+	if _, err := Compute(strings.NewReader("hello"), "crc"); err == nil {
+		t.Errorf("Compute accepted an unsupported algorithm")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	md5Only := Set{MD5: "a"}
+	both := Set{MD5: "a", SHA256: "b"}
+	otherSHA256 := Set{MD5: "a", SHA256: "c"}
+	sha256Only := Set{SHA256: "b"}
+
+	if !md5Only.Matches(both) {
+		t.Errorf("Sets should match on md5")
+	}
+
+	if both.Matches(otherSHA256) {
+		t.Errorf("Sets should not match when the strongest common hash differs")
+	}
+
+	if !both.Matches(sha256Only) {
+		t.Errorf("Sets should match on sha256")
+	}
+
+	if md5Only.Matches(sha256Only) {
+		t.Errorf("Sets with nothing in common should not match")
+	}
+
+	if alg := both.StrongestCommon(otherSHA256); alg != SHA256 {
+		t.Errorf("Expected strongest common sha256, got %s", alg)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	computed := Set{MD5: "a", SHA256: "b"}
+	if alg := computed.Verify(Set{MD5: "a", SHA256: "b"}); alg != "" {
+		t.Errorf("Verify failed on %s", alg)
+	}
+
+	if alg := computed.Verify(Set{MD5: "a", SHA256: "x"}); alg != SHA256 {
+		t.Errorf("Expected sha256 to fail verification, got '%s'", alg)
+	}
+}
@@ -3,16 +3,19 @@ package dir
 import (
 	"os"
 	"time"
+
+	"github.com/materials-commons/mcfs/base/schema"
 )
 
 // FileInfo describes a file or directory entry
 type FileInfo struct {
-	ID       string    // ID of file/directory
-	Path     string    // Full path including name
-	Size     int64     // Size valid only for file
-	Checksum string    // MD5 Hash - valid only for files
-	MTime    time.Time // Modification time
-	IsDir    bool      // True if this entry represents a directory
+	ID       string       // ID of file/directory
+	Path     string       // Full path including name
+	Size     int64        // Size valid only for file
+	Checksum string       // MD5 Hash - valid only for files
+	MTime    time.Time    // Modification time
+	IsDir    bool         // True if this entry represents a directory
+	Tags     []schema.Tag // Tags on the file or directory - only filled in for server entries
 }
 
 // newFile creates a new File entry.
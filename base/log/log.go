@@ -2,18 +2,39 @@ package log
 
 import (
 	"fmt"
-	"github.com/inconshreveable/log15"
 	"os"
+	"sync"
+
+	"github.com/inconshreveable/log15"
 )
 
+// Logger is the interface of the loggers returned by New.
+type Logger log15.Logger
+
 var (
 	// Global log variable.
 	L = log15.New()
 
-	// Default handler used in the package.
-	defaultHandler log15.Handler
+	// Default handler used in the package. It passes records on to the
+	// handler set by SetDefaultHandler, so loggers created before the
+	// handler changes use the new handler.
+	defaultHandler = &proxyHandler{}
 )
 
+// proxyHandler passes records to a handler that can be changed.
+type proxyHandler struct {
+	mutex   sync.RWMutex
+	handler log15.Handler
+}
+
+// Log implements log15.Handler.
+func (h *proxyHandler) Log(r *log15.Record) error {
+	h.mutex.RLock()
+	handler := h.handler
+	h.mutex.RUnlock()
+	return handler.Log(r)
+}
+
 func init() {
 	stdoutHandler := log15.StreamHandler(os.Stdout, log15.LogfmtFormat())
 	SetDefaultHandler(log15.LvlFilterHandler(log15.LvlInfo, stdoutHandler))
@@ -36,8 +57,9 @@ func Msg(format string, args ...interface{}) string {
 // SetDefaultHandler sets the handler for the logger. It wraps handlers in a SyncHandler. You
 // should not pass in handlers that are already wrapped in a SyncHandler.
 func SetDefaultHandler(handler log15.Handler) {
-	defaultHandler = log15.SyncHandler(handler)
-	L.SetHandler(defaultHandler)
+	defaultHandler.mutex.Lock()
+	defer defaultHandler.mutex.Unlock()
+	defaultHandler.handler = log15.SyncHandler(handler)
 }
 
 // DefaultHandler returns the current handler. It can be used to create additional
@@ -45,3 +67,29 @@ func SetDefaultHandler(handler log15.Handler) {
 func DefaultHandler() log15.Handler {
 	return defaultHandler
 }
+
+// Configure sets the default handler to write to stdout, filtering out
+// messages below level. The level is one of debug, info, warn, error or crit.
+// The format is logfmt or json. Empty values use info and logfmt.
+func Configure(level, format string) error {
+	if level == "" {
+		level = "info"
+	}
+	lvl, err := log15.LvlFromString(level)
+	if err != nil {
+		return err
+	}
+
+	var fmtr log15.Format
+	switch format {
+	case "", "logfmt":
+		fmtr = log15.LogfmtFormat()
+	case "json":
+		fmtr = log15.JsonFormat()
+	default:
+		return fmt.Errorf("Unknown log format: %s", format)
+	}
+
+	SetDefaultHandler(log15.LvlFilterHandler(lvl, log15.StreamHandler(os.Stdout, fmtr)))
+	return nil
+}
@@ -0,0 +1,50 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// records is a handler that keeps the records logged to it.
+type records []*log15.Record
+
+func (r *records) Log(record *log15.Record) error {
+	*r = append(*r, record)
+	return nil
+}
+
+func TestSetDefaultHandler(t *testing.T) {
+	defer Configure("", "")
+
+	// Loggers created before the handler is set use the new handler.
+	l := New("server", "Test")
+	var logged records
+	SetDefaultHandler(&logged)
+	l.Info("message")
+	if len(logged) != 1 || logged[0].Msg != "message" {
+		t.Fatalf("Message not sent to the new handler: %#v", logged)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer Configure("", "")
+
+	var tests = []struct {
+		level, format string
+		ok            bool
+	}{
+		{"", "", true},
+		{"debug", "json", true},
+		{"warn", "logfmt", true},
+		{"verbose", "", false},
+		{"info", "xml", false},
+	}
+
+	for _, test := range tests {
+		err := Configure(test.level, test.format)
+		if (err == nil) != test.ok {
+			t.Errorf("Configure(%q, %q) returned %v", test.level, test.format, err)
+		}
+	}
+}
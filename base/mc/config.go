@@ -0,0 +1,25 @@
+package mc
+
+import (
+	"time"
+
+	"github.com/materials-commons/config"
+	"github.com/materials-commons/mcfs/base/log"
+)
+
+// ConfigDuration reads a duration in time.ParseDuration format (eg, "72h") from
+// the configuration. It returns defaultValue if key isn't set, or isn't a valid
+// positive duration.
+func ConfigDuration(key string, defaultValue time.Duration) time.Duration {
+	value := config.GetString(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.New().Warn(log.Msg("Invalid duration '%s' for %s, using %s", value, key, defaultValue))
+		return defaultValue
+	}
+	return d
+}
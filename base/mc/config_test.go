@@ -0,0 +1,27 @@
+package mc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/materials-commons/config"
+)
+
+func TestConfigDuration(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", time.Hour},
+		{"10m", 10 * time.Minute},
+		{"not a duration", time.Hour},
+		{"-1s", time.Hour},
+	}
+
+	for _, test := range tests {
+		config.Set("MCFS_TEST_DURATION", test.value)
+		if d := ConfigDuration("MCFS_TEST_DURATION", time.Hour); d != test.expected {
+			t.Errorf("Expected %s for '%s', got %s", test.expected, test.value, d)
+		}
+	}
+}
@@ -60,6 +60,26 @@ const (
 	ErrorCodeUnknown
 )
 
+var errorCodeNames = map[ErrorCode]string{
+	ErrorCodeSuccess:  "Success",
+	ErrorCodeNotFound: "NotFound",
+	ErrorCodeInvalid:  "Invalid",
+	ErrorCodeExists:   "Exists",
+	ErrorCodeNoAccess: "NoAccess",
+	ErrorCodeCreate:   "Create",
+	ErrorCodeInternal: "Internal",
+	ErrorCodeInUse:    "InUse",
+	ErrorCodeUnknown:  "Unknown",
+}
+
+// String returns the name of an ErrorCode, such as NotFound.
+func (ec ErrorCode) String() string {
+	if name, found := errorCodeNames[ec]; found {
+		return name
+	}
+	return "Unknown"
+}
+
 var errorCodeMapping = map[ErrorCode]error{
 	ErrorCodeSuccess:  nil,
 	ErrorCodeNotFound: ErrNotFound,
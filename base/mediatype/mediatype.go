@@ -0,0 +1,166 @@
+/*
+Package mediatype determines the media (MIME) type of a file from its name and
+its first few bytes. The standard library knows the common formats. This
+package adds the scientific formats that materials researchers upload, which
+the standard library treats as plain text or unknown binary data.
+*/
+package mediatype
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// SniffLen is the number of bytes at the start of a file that Detect looks at.
+// Passing more is harmless, they are ignored.
+const SniffLen = 512
+
+// Mime types for the formats the standard library doesn't know, or reports
+// inconsistently across systems.
+const (
+	CIF     = "chemical/x-cif"
+	HDF5    = "application/x-hdf5"
+	VASP    = "application/x-vasp"
+	SPE     = "application/x-spe"
+	DM3     = "application/x-dm3"
+	TIFF    = "image/tiff"
+	BMP     = "image/x-ms-bmp"
+	Unknown = "application/octet-stream"
+)
+
+// signatures identify formats by the bytes they start with.
+var signatures = []struct {
+	prefix []byte
+	mime   string
+}{
+	{[]byte("\x89HDF\r\n\x1a\n"), HDF5},
+	{[]byte("#\\#CIF_"), CIF},
+	{[]byte("II*\x00"), TIFF},
+	{[]byte("MM\x00*"), TIFF},
+}
+
+// extensions identify formats by the extension of the file name.
+var extensions = map[string]string{
+	".cif":  CIF,
+	".h5":   HDF5,
+	".hdf5": HDF5,
+	".he5":  HDF5,
+	".spe":  SPE,
+	".dm3":  DM3,
+	".dm4":  DM3,
+	".tif":  TIFF,
+	".tiff": TIFF,
+	".bmp":  BMP,
+}
+
+// vaspFiles are the fixed names VASP uses for its input and output files.
+// Users often add a suffix, such as POSCAR.relaxed or OUTCAR_300K.
+var vaspFiles = []string{
+	"INCAR", "POSCAR", "CONTCAR", "KPOINTS", "POTCAR", "OUTCAR", "OSZICAR",
+	"CHGCAR", "CHG", "DOSCAR", "EIGENVAL", "PROCAR", "WAVECAR", "XDATCAR",
+	"VASPRUN.XML",
+}
+
+// descriptions are the human readable names for media types.
+var descriptions = map[string]string{
+	CIF:                  "Crystallographic Information File",
+	HDF5:                 "HDF5 Data",
+	VASP:                 "VASP Input/Output",
+	SPE:                  "Princeton Instruments SPE Image",
+	DM3:                  "Gatan Digital Micrograph Image",
+	TIFF:                 "TIFF Image",
+	BMP:                  "Bitmap Image",
+	"image/bmp":          "Bitmap Image",
+	"image/jpeg":         "JPEG Image",
+	"image/png":          "PNG Image",
+	"image/gif":          "GIF Image",
+	"application/pdf":    "PDF Document",
+	"application/zip":    "ZIP Archive",
+	"application/x-gzip": "GZIP Archive",
+	"application/json":   "JSON Data",
+	"text/csv":           "Comma Separated Values",
+	"text/html":          "HTML Document",
+	"text/xml":           "XML Document",
+	"text/plain":         "Text",
+	Unknown:              "Unknown",
+}
+
+// Detect determines the media type of a file. name is the file's name, and head
+// holds the start of its contents, at least SniffLen bytes unless the file is
+// shorter. Known signatures in head are checked first, then the name, and last
+// the standard library's content sniffing and extension table.
+func Detect(name string, head []byte) schema.MediaType {
+	mimeType := detect(name, head)
+	return schema.MediaType{
+		Mime:        mimeType,
+		Description: Description(mimeType),
+	}
+}
+
+// detect returns the mime type for a file.
+func detect(name string, head []byte) string {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+
+	for _, signature := range signatures {
+		if bytes.HasPrefix(head, signature.prefix) {
+			return signature.mime
+		}
+	}
+
+	if mimeType := byName(name); mimeType != "" {
+		return mimeType
+	}
+
+	sniffed := baseType(http.DetectContentType(head))
+	if sniffed != Unknown && sniffed != "text/plain" {
+		return sniffed
+	}
+
+	// Sniffing can only tell text from binary. The extension is more specific.
+	if byExtension := baseType(mime.TypeByExtension(filepath.Ext(name))); byExtension != "" {
+		return byExtension
+	}
+
+	return sniffed
+}
+
+// byName looks a file name up in the scientific formats tables.
+func byName(name string) string {
+	base := filepath.Base(name)
+	if mimeType, found := extensions[strings.ToLower(filepath.Ext(base))]; found {
+		return mimeType
+	}
+
+	upper := strings.ToUpper(base)
+	for _, vaspFile := range vaspFiles {
+		if upper == vaspFile || strings.HasPrefix(upper, vaspFile+".") || strings.HasPrefix(upper, vaspFile+"_") {
+			return VASP
+		}
+	}
+
+	return ""
+}
+
+// baseType strips the parameters, such as the charset, from a mime type.
+func baseType(mimeType string) string {
+	if i := strings.Index(mimeType, ";"); i != -1 {
+		mimeType = mimeType[:i]
+	}
+	return strings.TrimSpace(mimeType)
+}
+
+// Description returns a human readable description of a mime type. Types that
+// aren't in the table are described by their mime type.
+func Description(mimeType string) string {
+	if description, found := descriptions[mimeType]; found {
+		return description
+	}
+	return mimeType
+}
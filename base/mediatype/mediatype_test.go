@@ -0,0 +1,53 @@
+package mediatype
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     string
+		expected string
+	}{
+		// Signatures win over the name
+		{"data.bin", "\x89HDF\r\n\x1a\n\x00\x00", HDF5},
+		{"sample", "II*\x00\x08\x00\x00\x00", TIFF},
+		{"sample.dat", "#\\#CIF_2.0\ndata_test\n", CIF},
+
+		// Scientific formats by name
+		{"Fe2O3.cif", "data_Fe2O3\n_cell_length_a 5.03\n", CIF},
+		{"scan.SPE", "\x00\x01\x02\x03", SPE},
+		{"grain.dm3", "\x00\x00\x00\x03\x00\x00", DM3},
+		{"POSCAR", "Fe2O3\n1.0\n", VASP},
+		{"run1/OUTCAR_300K", " vasp.5.4.4\n", VASP},
+		{"vasprun.xml", "<?xml version=\"1.0\"?>\n<modeling>", VASP},
+		{"notes_POSCAR.txt", "some text\n", "text/plain"},
+
+		// Standard library sniffing and extensions
+		{"photo", "\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"R38_03085 Sample Info.txt", "Sample Info\n", "text/plain"},
+		{"empty", "", "text/plain"},
+		{"random", "\x00\x01\x02\x03\x04", Unknown},
+	}
+
+	for _, test := range tests {
+		mt := Detect(test.name, []byte(test.head))
+		if mt.Mime != test.expected {
+			t.Errorf("Detect(%q) = %s, expected %s", test.name, mt.Mime, test.expected)
+		}
+		if mt.Description == "" {
+			t.Errorf("Detect(%q) has no description", test.name)
+		}
+	}
+}
+
+func TestDescription(t *testing.T) {
+	if d := Description(HDF5); d != "HDF5 Data" {
+		t.Errorf("Wrong description for HDF5: %s", d)
+	}
+
+	if d := Description("application/x-made-up"); d != "application/x-made-up" {
+		t.Errorf("Unknown types should be described by their mime type, got %s", d)
+	}
+}
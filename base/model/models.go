@@ -39,3 +39,15 @@ var Projects = &Model{
 	schema: schema.Project{},
 	table:  "projects",
 }
+
+// Jobs is a default model for the jobs table
+var Jobs = &Model{
+	schema: schema.Job{},
+	table:  "jobs",
+}
+
+// ShareLinks is a default model for the sharelinks table
+var ShareLinks = &Model{
+	schema: schema.ShareLink{},
+	table:  "sharelinks",
+}
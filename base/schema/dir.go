@@ -16,6 +16,7 @@ type Directory struct {
 	MTime     time.Time `gorethink:"mtime"`
 	ATime     time.Time `gorethink:"atime"`
 	DataFiles []string  `gorethink:"datafiles"`
+	Tags      []Tag     `gorethink:"tags"`
 }
 
 // NewDirectory creates a new Directory instance.
@@ -0,0 +1,40 @@
+package schema
+
+import (
+	"time"
+)
+
+// The states a Job can be in.
+const (
+	JobQueued = "queued" // Waiting to run, or to be retried.
+	JobDone   = "done"   // The processor succeeded.
+	JobFailed = "failed" // The processor failed too many times, or doesn't exist.
+)
+
+// Job is a single run of a post upload processor on a datafile. Jobs are kept
+// after they finish as the record of what each processor did to a file.
+type Job struct {
+	ID        string    `gorethink:"id,omitempty"`
+	FileID    string    `gorethink:"datafile_id"` // The datafile to process.
+	Processor string    `gorethink:"processor"`   // Name of the processor to run.
+	Status    string    `gorethink:"status"`      // One of JobQueued, JobDone or JobFailed.
+	Attempts  int       `gorethink:"attempts"`    // Number of times the processor has run.
+	Result    string    `gorethink:"result"`      // What the processor did, when it succeeded.
+	Error     string    `gorethink:"error"`       // Why the last attempt failed.
+	Birthtime time.Time `gorethink:"birthtime"`   // When the job was queued.
+	MTime     time.Time `gorethink:"mtime"`       // Last time the job ran.
+	RunAfter  time.Time `gorethink:"run_after"`   // Don't run before this time, used to delay retries.
+}
+
+// NewJob creates a new queued Job for running processor on a datafile.
+func NewJob(fileID, processor string) Job {
+	now := time.Now()
+	return Job{
+		FileID:    fileID,
+		Processor: processor,
+		Status:    JobQueued,
+		Birthtime: now,
+		MTime:     now,
+		RunAfter:  now,
+	}
+}
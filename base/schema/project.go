@@ -15,7 +15,7 @@ type Project struct {
 	Birthtime   time.Time `gorethink:"birthtime"`
 	MTime       time.Time `gorethink:"mtime"`
 	Notes       []Note    `gorethink:"notes" db:"-"`
-	Tags        []string  `gorethink:"tags" db:"-"`
+	Tags        []Tag     `gorethink:"tags" db:"-"`
 	Reviews     []string  `gorethink:"reviews" db:"-"`
 	MyTags      []string  `gorethink:"mytags" db:"-"`
 }
@@ -0,0 +1,33 @@
+package schema
+
+import (
+	"time"
+)
+
+// ShareLink lets anyone holding a signed url download a file, or the files
+// in a directory, without an apikey. Links are kept after they expire or are
+// revoked so their owner can see how they were used.
+type ShareLink struct {
+	ID           string    `gorethink:"id,omitempty"`
+	Owner        string    `gorethink:"owner"`         // User who created the link.
+	FileID       string    `gorethink:"datafile_id"`   // The shared file, empty when a directory is shared.
+	DirID        string    `gorethink:"datadir_id"`    // The shared directory, empty when a file is shared.
+	Birthtime    time.Time `gorethink:"birthtime"`     // When the link was created.
+	Expires      time.Time `gorethink:"expires"`       // The link can't be used after this time.
+	MaxDownloads int       `gorethink:"max_downloads"` // Number of downloads allowed, 0 for no limit.
+	Downloads    int       `gorethink:"downloads"`     // Number of times the link was used.
+	Revoked      bool      `gorethink:"revoked"`       // The owner revoked the link.
+}
+
+// NewShareLink creates a new ShareLink for a file or a directory. Exactly one of
+// fileID and dirID should be set.
+func NewShareLink(owner, fileID, dirID string, expires time.Time, maxDownloads int) ShareLink {
+	return ShareLink{
+		Owner:        owner,
+		FileID:       fileID,
+		DirID:        dirID,
+		Birthtime:    time.Now(),
+		Expires:      expires,
+		MaxDownloads: maxDownloads,
+	}
+}
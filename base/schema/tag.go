@@ -0,0 +1,66 @@
+package schema
+
+// Tag is a piece of key/value metadata attached to a file, directory or project.
+// A tag without a User is public and seen by everyone who can see the item. A
+// tag with a User is private to that user. An item has at most one tag with a
+// given key for each user, plus one public tag with that key.
+type Tag struct {
+	Key   string `gorethink:"key"`
+	Value string `gorethink:"value"`
+	User  string `gorethink:"user"`
+}
+
+// private type to hang methods off of
+type tgs struct{}
+
+// Tags gives access to help routines that work on lists of tags.
+var Tags tgs
+
+// Set returns a copy of tags with tag added. It replaces any existing tag with the
+// same key and user.
+func (t tgs) Set(tags []Tag, tag Tag) []Tag {
+	newTags, _ := t.Remove(tags, tag.Key, tag.User)
+	return append(newTags, tag)
+}
+
+// Remove returns a copy of tags without the tag matching key and user. It reports
+// whether a tag was removed.
+func (t tgs) Remove(tags []Tag, key, user string) ([]Tag, bool) {
+	var (
+		kept    []Tag
+		removed bool
+	)
+	for _, tag := range tags {
+		if tag.Key == key && tag.User == user {
+			removed = true
+			continue
+		}
+		kept = append(kept, tag)
+	}
+
+	return kept, removed
+}
+
+// Visible returns the tags that user can see: the public tags and the user's own.
+func (t tgs) Visible(tags []Tag, user string) []Tag {
+	var visible []Tag
+	for _, tag := range tags {
+		if tag.User == "" || tag.User == user {
+			visible = append(visible, tag)
+		}
+	}
+
+	return visible
+}
+
+// Match returns true if one of the tags user can see has the given key. When value
+// is not blank the tag must also have that value.
+func (t tgs) Match(tags []Tag, key, value, user string) bool {
+	for _, tag := range t.Visible(tags, user) {
+		if tag.Key == key && (value == "" || tag.Value == value) {
+			return true
+		}
+	}
+
+	return false
+}
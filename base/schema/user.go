@@ -19,6 +19,7 @@ type User struct {
 	Affiliation string    `gorethink:"affiliation"`
 	HomePage    string    `gorethink:"homepage"`
 	Notes       []string  `gorethink:"notes"`
+	Disabled    bool      `gorethink:"disabled"` // Disabled users can't login
 }
 
 // NewUser creates a new User instance.
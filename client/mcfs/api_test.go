@@ -1,16 +1,17 @@
 package mcfs
 
 import (
-	"crypto/md5"
 	"fmt"
 	r "github.com/dancannon/gorethink"
-	"github.com/materials-commons/gohandy/file"
 	"github.com/materials-commons/gohandy/marshaling"
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/base/mc"
 	"github.com/materials-commons/mcfs/base/model"
 	"github.com/materials-commons/mcfs/client/util"
 	"github.com/materials-commons/mcfs/server"
 	"github.com/materials-commons/mcfs/server/request"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -86,8 +87,8 @@ func TestUploadNewFile(t *testing.T) {
 		t.Fatalf("File sizes did not match %d/%d", dataFileSize, fileSize)
 	}
 
-	if dataFileChecksum != fileChecksum {
-		t.Fatalf("Checksums did not match %s/%s", dataFileChecksum, fileChecksum)
+	if dataFileChecksum.Verify(fileChecksum) != "" {
+		t.Fatalf("Checksums did not match %v/%v", dataFileChecksum, fileChecksum)
 	}
 
 	defer cleanup(dataFileID)
@@ -99,8 +100,7 @@ func TestRestartFileUpload(t *testing.T) {
 	ioutil.WriteFile(filePath, []byte(fileData), 0777)
 	filePathPartial := filepath.Join(MCDir, "testnewfilerestartpartial.txt")
 	ioutil.WriteFile(filePathPartial, []byte(fileData[:10]), 0777)
-	realChecksum, err := file.HashStr(md5.New(), filePath)
-	var _ = realChecksum
+	realChecksums, err := digest.File(filePath, uploadDigests...)
 	realSize := len(fileData)
 	var _ = realSize
 	projectID := "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3"
@@ -119,9 +119,10 @@ func TestRestartFileUpload(t *testing.T) {
 	// to update the database with the real size, checksum and name. Then we
 	// can "restart" the download.
 	r.Table("datafiles").Get(dataFileID).Update(map[string]interface{}{
-		"checksum": realChecksum,
-		"size":     realSize,
-		"name":     "testnewfilerestart.txt",
+		"checksum":  realChecksums[digest.MD5],
+		"checksums": realChecksums,
+		"size":      realSize,
+		"name":      "testnewfilerestart.txt",
 	}).RunWrite(session)
 
 	n, err := c.RestartFileUpload(dataFileID, filePath)
@@ -150,8 +151,8 @@ func TestRestartFileUpload(t *testing.T) {
 		t.Fatalf("File sizes did not match %d/%d", dataFileSize, fileSize)
 	}
 
-	if dataFileChecksum != fileChecksum {
-		t.Fatalf("Checksums did not match %s/%s", dataFileChecksum, fileChecksum)
+	if dataFileChecksum.Verify(fileChecksum) != "" {
+		t.Fatalf("Checksums did not match %v/%v", dataFileChecksum, fileChecksum)
 	}
 	defer cleanup(dataFileID)
 }
@@ -162,7 +163,7 @@ func cleanup(dataFileID string) {
 }
 
 func mcfsServer(m marshaling.MarshalUnmarshaler) {
-	h := request.NewReqHandler(m, MCDir)
+	h := request.NewReqHandler(m, service.New(service.RethinkDB), store.NewMCDir(MCDir))
 	os.MkdirAll("/tmp/mcdir", 0777)
 	h.Run()
 }
@@ -0,0 +1,112 @@
+package mcfs
+
+import (
+	"fmt"
+	"github.com/materials-commons/gohandy/file"
+	"github.com/materials-commons/mcfs/base/cdc"
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/protocol"
+	"os"
+	"path/filepath"
+)
+
+// UploadNewFileChunked uploads a new file to the server as content defined chunks.
+// Only the chunks the server doesn't already have are sent. If the server doesn't
+// support chunked uploads the file is uploaded with UploadNewFile.
+func (c *Client) UploadNewFileChunked(projectID, dataDirID, path string) (bytesUploaded int64, dataFileID string, err error) {
+	checksums, size, err := fileInfo(path)
+	if err != nil {
+		return 0, "", err
+	}
+
+	createFileReq := &protocol.CreateFileReq{
+		ProjectID: projectID,
+		DataDirID: dataDirID,
+		Name:      file.NormalizePath(filepath.Base(path)),
+		Checksum:  checksums[digest.MD5],
+		Checksums: checksums,
+		Size:      size,
+	}
+
+	dataFileID, err = c.createFile(createFileReq)
+	if err != nil {
+		return 0, "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	chunks, err := cdc.Split(f, cdc.DefaultOptions)
+	if err != nil {
+		return 0, "", err
+	}
+
+	uploadResp, err := c.startChunkedUpload(&protocol.UploadChunksReq{
+		DataFileID: dataFileID,
+		Checksum:   checksums[digest.MD5],
+		Checksums:  checksums,
+		Size:       size,
+		Chunks:     chunks,
+	})
+
+	switch {
+	case mcerr.Is(err, mcerr.ErrInvalid):
+		// Server doesn't do chunked uploads.
+		n, err := c.uploadFile(dataFileID, path, checksums, size)
+		return n, dataFileID, err
+	case err != nil:
+		return 0, "", err
+	default:
+		n, err := c.sendChunks(f, chunks, uploadResp)
+		return n, dataFileID, err
+	}
+}
+
+func (c *Client) startChunkedUpload(req *protocol.UploadChunksReq) (*protocol.UploadChunksResp, error) {
+	resp, err := c.doRequest(*req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case protocol.UploadChunksResp:
+		return &t, nil
+	default:
+		fmt.Printf("%s %T\n", ErrBadResponseType, t)
+		return nil, ErrBadResponseType
+	}
+}
+
+// sendChunks sends the chunks the server asked for and finishes the upload.
+func (c *Client) sendChunks(f *os.File, chunks []cdc.Chunk, uploadResp *protocol.UploadChunksResp) (bytesUploaded int64, err error) {
+	offsets := make([]int64, len(chunks))
+	for i := 1; i < len(chunks); i++ {
+		offsets[i] = offsets[i-1] + chunks[i-1].Size
+	}
+
+	for _, i := range uploadResp.Missing {
+		buf := make([]byte, chunks[i].Size)
+		if _, err := f.ReadAt(buf, offsets[i]); err != nil {
+			c.endUpload()
+			return bytesUploaded, err
+		}
+
+		sendReq := protocol.SendChunkReq{
+			DataFileID: uploadResp.DataFileID,
+			Hash:       chunks[i].Hash,
+			Bytes:      buf,
+		}
+		if _, err := c.doRequest(sendReq); err != nil {
+			c.endUpload()
+			return bytesUploaded, err
+		}
+		bytesUploaded += chunks[i].Size
+	}
+
+	_, err = c.doRequest(protocol.DoneReq{})
+	return bytesUploaded, err
+}
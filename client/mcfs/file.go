@@ -1,9 +1,9 @@
 package mcfs
 
 import (
-	"crypto/md5"
 	"fmt"
 	"github.com/materials-commons/gohandy/file"
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/protocol"
 	"io"
 	"os"
@@ -12,17 +12,17 @@ import (
 
 // RestartFileUpload restarts a partially completed upload.
 func (c *Client) RestartFileUpload(dataFileID, path string) (bytesUploaded int64, err error) {
-	checksum, size, err := fileInfo(path)
+	checksums, size, err := fileInfo(path)
 	if err != nil {
 		return 0, err
 	}
 
-	return c.uploadFile(dataFileID, path, checksum, size)
+	return c.uploadFile(dataFileID, path, checksums, size)
 }
 
 // UploadNewFile uploads a new file to the server.
 func (c *Client) UploadNewFile(projectID, dataDirID, path string) (bytesUploaded int64, dataFileID string, err error) {
-	checksum, size, err := fileInfo(path)
+	checksums, size, err := fileInfo(path)
 	if err != nil {
 		return 0, "", err
 	}
@@ -31,7 +31,8 @@ func (c *Client) UploadNewFile(projectID, dataDirID, path string) (bytesUploaded
 		ProjectID: projectID,
 		DataDirID: dataDirID,
 		Name:      file.NormalizePath(filepath.Base(path)),
-		Checksum:  checksum,
+		Checksum:  checksums[digest.MD5],
+		Checksums: checksums,
 		Size:      size,
 	}
 
@@ -40,12 +41,16 @@ func (c *Client) UploadNewFile(projectID, dataDirID, path string) (bytesUploaded
 		return 0, "", err
 	}
 
-	n, err := c.uploadFile(dataFileID, path, checksum, size)
+	n, err := c.uploadFile(dataFileID, path, checksums, size)
 	return n, dataFileID, err
 }
 
-func fileInfo(path string) (checksum string, size int64, err error) {
-	checksum, err = file.HashStr(md5.New(), path)
+// uploadDigests are the hashes computed for each uploaded file. MD5 is
+// needed by servers that predate multiple hashes.
+var uploadDigests = []string{digest.MD5, digest.SHA256}
+
+func fileInfo(path string) (checksums digest.Set, size int64, err error) {
+	checksums, err = digest.File(path, uploadDigests...)
 	if err != nil {
 		return
 	}
@@ -73,10 +78,11 @@ func (c *Client) createFile(req *protocol.CreateFileReq) (dataFileID string, err
 	}
 }
 
-func (c *Client) uploadFile(dataFileID, path, checksum string, size int64) (bytesUploaded int64, err error) {
+func (c *Client) uploadFile(dataFileID, path string, checksums digest.Set, size int64) (bytesUploaded int64, err error) {
 	uploadReq := &protocol.UploadReq{
 		DataFileID: dataFileID,
-		Checksum:   checksum,
+		Checksum:   checksums[digest.MD5],
+		Checksums:  checksums,
 		Size:       size,
 	}
 
@@ -1,11 +1,46 @@
 package mcfs
 
 import (
-//"github.com/materials-commons/mcfs/protocol"
-//"github.com/materials-commons/mcfs/client/mcfs"
+	"github.com/materials-commons/mcfs/protocol"
 )
 
 // LookupProject placeholder.
 func (c *Client) LookupProject() {
 
 }
+
+// Search returns a page of the entries matching req. When the response has a
+// Cursor, setting req.Cursor to it and searching again returns the next page.
+func (c *Client) Search(req protocol.LookupReq) (*protocol.LookupResp, error) {
+	if req.PageSize == 0 {
+		req.PageSize = protocol.DefaultPageSize
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case protocol.LookupResp:
+		return &t, nil
+	default:
+		return nil, ErrBadResponseType
+	}
+}
+
+// TextSearch searches the words in the names, descriptions, notes and tags of
+// the entries the user has access to. The best matches are returned first.
+func (c *Client) TextSearch(req protocol.TextSearchReq) (*protocol.TextSearchResp, error) {
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case protocol.TextSearchResp:
+		return &t, nil
+	default:
+		return nil, ErrBadResponseType
+	}
+}
@@ -0,0 +1,78 @@
+package mcfs
+
+import (
+	"github.com/materials-commons/mcfs/base/dir"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/protocol"
+)
+
+// AddTag adds a tag to a datafile, datadir or project. A private tag is only seen by
+// the user who added it. It returns the tags on the item.
+func (c *Client) AddTag(itemType protocol.ItemType, id, key, value string, private bool) ([]schema.Tag, error) {
+	req := protocol.AddTagReq{
+		Type:    itemType,
+		ID:      id,
+		Key:     key,
+		Value:   value,
+		Private: private,
+	}
+	return c.tagsRequest(req)
+}
+
+// RemoveTag removes a tag from a datafile, datadir or project. It returns the tags
+// left on the item.
+func (c *Client) RemoveTag(itemType protocol.ItemType, id, key string, private bool) ([]schema.Tag, error) {
+	req := protocol.RemoveTagReq{
+		Type:    itemType,
+		ID:      id,
+		Key:     key,
+		Private: private,
+	}
+	return c.tagsRequest(req)
+}
+
+// Tags returns the tags on a datafile, datadir or project.
+func (c *Client) Tags(itemType protocol.ItemType, id string) ([]schema.Tag, error) {
+	req := protocol.TagsReq{
+		Type: itemType,
+		ID:   id,
+	}
+	return c.tagsRequest(req)
+}
+
+// FindTag returns the datafiles and datadirs in a project that have a tag with the
+// given key. When value is not blank the tag must also have that value.
+func (c *Client) FindTag(projectID, key, value string) ([]dir.FileInfo, error) {
+	req := protocol.FindTagReq{
+		ProjectID: projectID,
+		Key:       key,
+		Value:     value,
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case protocol.FindTagResp:
+		return t.Entries, nil
+	default:
+		return nil, ErrBadResponseType
+	}
+}
+
+// tagsRequest sends a request that is answered with a TagsResp.
+func (c *Client) tagsRequest(req interface{}) ([]schema.Tag, error) {
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case protocol.TagsResp:
+		return t.Tags, nil
+	default:
+		return nil, ErrBadResponseType
+	}
+}
@@ -0,0 +1,94 @@
+package mcfs
+
+import (
+	"os"
+
+	"github.com/materials-commons/mcfs/protocol"
+)
+
+// Versions returns the version history for a datafile, newest first.
+func (c *Client) Versions(dataFileID string) ([]protocol.Version, error) {
+	req := protocol.VersionsReq{
+		DataFileID: dataFileID,
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case protocol.VersionsResp:
+		return t.Versions, nil
+	default:
+		return nil, ErrBadResponseType
+	}
+}
+
+// RestoreVersion makes a previous version of a datafile current again. It returns
+// the id of the new current version.
+func (c *Client) RestoreVersion(dataFileID string) (string, error) {
+	req := protocol.RestoreVersionReq{
+		DataFileID: dataFileID,
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	switch t := resp.(type) {
+	case protocol.CreateResp:
+		return t.ID, nil
+	default:
+		return "", ErrBadResponseType
+	}
+}
+
+// DownloadFile downloads a datafile, which can be any version of a file, to path.
+// It returns the number of bytes written.
+func (c *Client) DownloadFile(dataFileID, path string) (bytesDownloaded int64, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	req := protocol.DownloadReq{
+		Type:   protocol.DataFile,
+		ID:     dataFileID,
+		Length: readBufSize,
+	}
+
+	for {
+		req.Offset = bytesDownloaded
+		bytes, err := c.downloadBytes(req)
+		switch {
+		case err != nil:
+			return bytesDownloaded, err
+		case len(bytes) == 0:
+			return bytesDownloaded, nil
+		}
+
+		n, err := f.Write(bytes)
+		bytesDownloaded += int64(n)
+		if err != nil {
+			return bytesDownloaded, err
+		}
+	}
+}
+
+// downloadBytes requests a single range of bytes.
+func (c *Client) downloadBytes(req protocol.DownloadReq) ([]byte, error) {
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := resp.(type) {
+	case protocol.DownloadResp:
+		return t.Bytes, nil
+	default:
+		return nil, ErrBadResponseType
+	}
+}
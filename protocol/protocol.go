@@ -5,6 +5,8 @@ package protocol
 
 import (
 	"encoding/gob"
+	"github.com/materials-commons/mcfs/base/cdc"
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/base/dir"
 	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/schema"
@@ -30,9 +32,25 @@ func init() {
 	gob.Register(SendReq{})
 	gob.Register(SendResp{})
 
+	gob.Register(UploadChunksReq{})
+	gob.Register(UploadChunksResp{})
+	gob.Register(SendChunkReq{})
+	gob.Register(SendChunkResp{})
+
 	gob.Register(StatReq{})
 	gob.Register(StatResp{})
 
+	gob.Register(VersionsReq{})
+	gob.Register(VersionsResp{})
+	gob.Register(RestoreVersionReq{})
+
+	gob.Register(AddTagReq{})
+	gob.Register(RemoveTagReq{})
+	gob.Register(TagsReq{})
+	gob.Register(TagsResp{})
+	gob.Register(FindTagReq{})
+	gob.Register(FindTagResp{})
+
 	gob.Register(EndReq{})
 	gob.Register(EndResp{})
 
@@ -56,6 +74,11 @@ func init() {
 	gob.Register(DoneResp{})
 
 	gob.Register(LookupReq{})
+	gob.Register(LookupResp{})
+
+	gob.Register(TextSearchReq{})
+	gob.Register(TextSearchResp{})
+	gob.Register(TextSearchHit{})
 
 	gob.Register(schema.File{})
 	gob.Register(schema.Directory{})
@@ -107,10 +130,12 @@ type Response struct {
 	Resp          interface{}
 }
 
-// UploadReq is an upload request.
+// UploadReq is an upload request. Checksum is the MD5 hash, Checksums holds the
+// hashes for any other algorithms the client computed.
 type UploadReq struct {
 	DataFileID string
 	Checksum   string
+	Checksums  digest.Set
 	Size       int64
 }
 
@@ -120,15 +145,21 @@ type UploadResp struct {
 	Offset     int64
 }
 
-// DownloadReq is an download request.
+// DownloadReq is an download request. Only DataFile items can be downloaded. Up to
+// Length bytes starting at Offset are returned, so a file is downloaded with a
+// series of requests.
 type DownloadReq struct {
-	Type ItemType
-	ID   string
+	Type   ItemType
+	ID     string
+	Offset int64
+	Length int
 }
 
-// DownloadResp is an download response.
+// DownloadResp is an download response. Ok is true when the download request
+// succeeded. Bytes is empty when Offset is at or past the end of the file.
 type DownloadResp struct {
-	Ok bool
+	Ok    bool
+	Bytes []byte
 }
 
 // MoveReq is a file or directory move request.
@@ -158,6 +189,35 @@ type SendResp struct {
 	BytesWritten int
 }
 
+// UploadChunksReq is a request to upload a file as a list of content defined
+// chunks (see package cdc). It is validated the same way as an UploadReq. The
+// server responds with the chunks it doesn't have yet.
+type UploadChunksReq struct {
+	DataFileID string
+	Checksum   string
+	Checksums  digest.Set
+	Size       int64
+	Chunks     []cdc.Chunk
+}
+
+// UploadChunksResp is the response to an UploadChunksReq. Missing holds the
+// indexes into the requests Chunks that need to be sent with SendChunkReq. The
+// upload is finished with a DoneReq.
+type UploadChunksResp struct {
+	DataFileID string
+	Missing    []int
+}
+
+// SendChunkReq is a request to send the bytes for a single chunk.
+type SendChunkReq struct {
+	DataFileID string
+	Hash       string
+	Bytes      []byte
+}
+
+// SendChunkResp is the response to a SendChunkReq.
+type SendChunkResp struct{}
+
 // StatReq is a status request to get information on a datafile.
 type StatReq struct {
 	DataFileID string
@@ -169,11 +229,90 @@ type StatResp struct {
 	Name       string
 	DataDirs   []string
 	Checksum   string
+	Checksums  digest.Set
 	Size       int64
 	Birthtime  time.Time
 	MTime      time.Time
 }
 
+// VersionsReq is a request for the version history of a datafile.
+type VersionsReq struct {
+	DataFileID string
+}
+
+// Version describes one version of a datafile.
+type Version struct {
+	DataFileID string
+	Name       string
+	Current    bool
+	Owner      string
+	Checksum   string
+	Checksums  digest.Set
+	Size       int64
+	Birthtime  time.Time
+	MTime      time.Time
+}
+
+// VersionsResp is the response to a VersionsReq. It lists the datafile and all the
+// versions before it, newest first.
+type VersionsResp struct {
+	Versions []Version
+}
+
+// RestoreVersionReq is a request to make a previous version of a datafile the current
+// version again. The server responds with a CreateResp containing the id of the new
+// current version. The bytes of the previous version are reused, not uploaded again.
+type RestoreVersionReq struct {
+	DataFileID string
+}
+
+// AddTagReq is a request to tag a datafile, datadir or project. A private tag is only
+// seen by the user who added it. Adding a tag replaces the users existing tag with the
+// same key. The server responds with a TagsResp.
+type AddTagReq struct {
+	Type    ItemType
+	ID      string
+	Key     string
+	Value   string
+	Private bool
+}
+
+// RemoveTagReq is a request to remove a tag from a datafile, datadir or project. Private
+// selects between the public tag and the users private tag with that key. The server
+// responds with a TagsResp.
+type RemoveTagReq struct {
+	Type    ItemType
+	ID      string
+	Key     string
+	Private bool
+}
+
+// TagsReq is a request for the tags on a datafile, datadir or project.
+type TagsReq struct {
+	Type ItemType
+	ID   string
+}
+
+// TagsResp lists the tags on an item that the user can see. These are the public
+// tags and the users private tags.
+type TagsResp struct {
+	Tags []schema.Tag
+}
+
+// FindTagReq is a request for the datafiles and datadirs in a project that have a tag
+// with the given key. When Value is not blank the tag must also have that value.
+type FindTagReq struct {
+	ProjectID string
+	Key       string
+	Value     string
+}
+
+// FindTagResp is the response to a FindTagReq. Entries are in the same form as the
+// entries in a StatProjectResp.
+type FindTagResp struct {
+	Entries []dir.FileInfo
+}
+
 // EndReq specifies that no more requests are coming.
 type EndReq struct {
 }
@@ -183,12 +322,15 @@ type EndResp struct {
 	Ok bool
 }
 
-// CreateFileReq requests the creation of a new file on the server.
+// CreateFileReq requests the creation of a new file on the server. Checksum is the
+// MD5 hash, Checksums holds the hashes for any other algorithms the client computed.
+// At least one of them must be given.
 type CreateFileReq struct {
 	ProjectID string
 	DataDirID string
 	Name      string
 	Checksum  string
+	Checksums digest.Set
 	Size      int64
 }
 
@@ -247,12 +389,103 @@ type DoneReq struct{}
 // DoneResp done response.
 type DoneResp struct{}
 
-// LookupReq lookup request.
+// LookupReq looks up a project, datadir or datafile. Type is one of project,
+// datadir or datafile. When only Field, Value and LimitToID are set the single
+// entry whose Field equals Value is returned. Field is id, tag, or the database
+// name of any other field. LimitToID is where the entry is looked for:
+//
+//	project   ignored, projects are looked for in the user's projects
+//	datadir   the id of the project the datadir is in
+//	datafile  the id of the datadir the datafile is in, or of the project
+//	          when looking up by tag
+//
+// When Where, PageSize or Cursor is set the request searches for every entry
+// that matches all the predicates in Where, plus Field and Value when Field is
+// set, and is answered with a LookupResp. In a search LimitToID is always the
+// id of a project: datadirs and datafiles are searched for in the project
+// LimitToID, and projects in the user's projects. Entries are returned in order
+// of their path, and then their id, a page at a time.
 type LookupReq struct {
 	Field     string
 	Value     string
 	Type      string
 	LimitToID string
+	Where     []Predicate // Conditions the entries must all match
+	PageSize  int         // Number of entries to return, DefaultPageSize when 0
+	Cursor    string      // Opaque Cursor from the previous page, blank for the first page
+}
+
+// Predicate is a condition on a field of the entries searched for by a LookupReq.
+// The fields are:
+//
+//	id, name, path  compared with OpEq, OpGlob or OpRegex
+//	size, mtime     compared with OpEq, OpLt, OpLe, OpGt or OpGe
+//	tag             a key or key=value, compared with OpEq
+//
+// Sizes are in bytes, and times are in RFC3339 format. Projects don't have a
+// size, and their path is their name.
+type Predicate struct {
+	Field string
+	Op    string // Blank is the same as OpEq
+	Value string
+}
+
+// Predicate operators.
+const (
+	OpEq    = "eq"
+	OpGlob  = "glob"
+	OpRegex = "regex"
+	OpLt    = "lt"
+	OpLe    = "le"
+	OpGt    = "gt"
+	OpGe    = "ge"
+)
+
+// Page sizes for searches. Larger page sizes are reduced to MaxPageSize.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// LookupResp is the response to a LookupReq that searches. Only the entries of
+// the type searched for are filled in. When there may be more entries Cursor is
+// set and is passed in the next LookupReq to get them. The last page can be
+// empty.
+type LookupResp struct {
+	Projects []schema.Project
+	Dirs     []schema.Directory
+	Files    []schema.File
+	Cursor   string
+}
+
+// TextSearchReq searches the words in the names, descriptions, notes and tags
+// of the projects, datadirs and datafiles the user has access to. Every word in
+// Query must match. Type is blank for all entries, or one of project, datadir
+// or datafile. It is answered with a TextSearchResp.
+type TextSearchReq struct {
+	Query     string
+	Type      string
+	ProjectID string // Only search this project, blank for all projects
+	Limit     int    // Maximum number of hits, DefaultPageSize when 0
+}
+
+// TextSearchHit is an entry matching a TextSearchReq.
+type TextSearchHit struct {
+	ID      string
+	Type    string // project, datadir or datafile
+	Name    string
+	Owner   string
+	Score   float64 // How well the entry matches, higher is better
+	Field   string  // The field the snippet is from: name, description, notes or tag
+	Snippet string  // Text around the words that matched
+}
+
+// TextSearchResp is the response to a TextSearchReq. Hits are ordered best match
+// first. Total is the number of entries that matched, which can be more than
+// the number of hits returned.
+type TextSearchResp struct {
+	Hits  []TextSearchHit
+	Total int
 }
 
 // StatProjectReq project entries request.
@@ -0,0 +1,287 @@
+/*
+Package admin implements the operations used to run the server: managing users,
+their apikeys and the admin group, reporting project usage, checking the
+database against the stored datafiles, and expiring partial uploads. All of
+them go through service.Service, so they work with every database backend.
+The mcfsadmin command in admin/main is the command line interface to them.
+*/
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/servers/reaper"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Admin performs administrative operations against a service and store.
+type Admin struct {
+	service *service.Service
+	store   store.Store
+}
+
+// New creates a new Admin.
+func New(svc *service.Service, st store.Store) *Admin {
+	return &Admin{
+		service: svc,
+		store:   st,
+	}
+}
+
+// newAPIKey creates a random apikey.
+func newAPIKey() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("Unable to generate apikey: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// CreateUser creates a user identified by email with a new apikey.
+func (a *Admin) CreateUser(email, name string) (*schema.User, error) {
+	if email == "" {
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "An email is required")
+	}
+
+	if _, err := a.service.User.ByID(email); err == nil {
+		return nil, mcerr.Errorf(mcerr.ErrExists, "User %s already exists", email)
+	}
+
+	if name == "" {
+		name = email
+	}
+	user := schema.NewUser(name, email, "", newAPIKey())
+	return a.service.User.Insert(&user)
+}
+
+// updateUser looks up a user, applies change to it and saves it.
+func (a *Admin) updateUser(email string, change func(u *schema.User) error) (*schema.User, error) {
+	u, err := a.service.User.ByID(email)
+	if err != nil {
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "No such user %s", email)
+	}
+
+	if err := change(u); err != nil {
+		return nil, err
+	}
+	u.MTime = time.Now()
+	if err := a.service.User.Update(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// DisableUser stops a user from logging in. Their apikey is revoked.
+func (a *Admin) DisableUser(email string) error {
+	_, err := a.updateUser(email, func(u *schema.User) error {
+		u.Disabled = true
+		u.APIKey = ""
+		return nil
+	})
+	return err
+}
+
+// EnableUser allows a disabled user to login again once they are issued
+// an apikey.
+func (a *Admin) EnableUser(email string) error {
+	_, err := a.updateUser(email, func(u *schema.User) error {
+		u.Disabled = false
+		return nil
+	})
+	return err
+}
+
+// IssueAPIKey gives a user a new apikey, replacing their current one. Disabled
+// users must be enabled first.
+func (a *Admin) IssueAPIKey(email string) (string, error) {
+	u, err := a.updateUser(email, func(u *schema.User) error {
+		if u.Disabled {
+			return mcerr.Errorf(mcerr.ErrInvalid, "User %s is disabled", email)
+		}
+		u.APIKey = newAPIKey()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return u.APIKey, nil
+}
+
+// RevokeAPIKey removes a user's apikey. They can't login until they are
+// issued a new one.
+func (a *Admin) RevokeAPIKey(email string) error {
+	_, err := a.updateUser(email, func(u *schema.User) error {
+		u.APIKey = ""
+		return nil
+	})
+	return err
+}
+
+// AddAdmin adds a user to the admin group, creating the group if it doesn't
+// exist. Admins have access to every project.
+func (a *Admin) AddAdmin(email string) error {
+	if _, err := a.service.User.ByID(email); err != nil {
+		return mcerr.Errorf(mcerr.ErrNotFound, "No such user %s", email)
+	}
+
+	group, err := a.service.Group.ByID(service.AdminGroup)
+	if err != nil {
+		g := schema.NewGroup(email, service.AdminGroup)
+		g.ID = service.AdminGroup
+		g.Users = []string{email}
+		_, err = a.service.Group.Insert(&g)
+		return err
+	}
+
+	for _, u := range group.Users {
+		if u == email {
+			return nil
+		}
+	}
+	group.Users = append(group.Users, email)
+	group.MTime = time.Now()
+	return a.service.Group.Update(group)
+}
+
+// ProjectUsage is the number of files in a project and the bytes they use.
+type ProjectUsage struct {
+	ID    string
+	Name  string
+	Owner string
+	Files int
+	Bytes int64
+}
+
+// Usage returns the usage of each project owned by owner, or of every project
+// when owner is empty.
+func (a *Admin) Usage(owner string) ([]ProjectUsage, error) {
+	projects, err := a.projects(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []ProjectUsage
+	for _, p := range projects {
+		entries, err := a.service.Project.Files(p.ID, "")
+		if err != nil {
+			return nil, err
+		}
+
+		u := ProjectUsage{ID: p.ID, Name: p.Name, Owner: p.Owner}
+		for _, entry := range entries {
+			if !entry.IsDir {
+				u.Files++
+				u.Bytes += entry.Size
+			}
+		}
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// projects returns the projects owned by owner, or every user's projects when
+// owner is empty.
+func (a *Admin) projects(owner string) ([]schema.Project, error) {
+	if owner != "" {
+		return a.service.Project.ByOwner(owner)
+	}
+
+	users, err := a.service.User.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []schema.Project
+	for _, u := range users {
+		owned, err := a.service.Project.ByOwner(u.ID)
+		if err != nil && !mcerr.Is(err, mcerr.ErrNotFound) {
+			return nil, err
+		}
+		projects = append(projects, owned...)
+	}
+	return projects, nil
+}
+
+// Problem is an inconsistency found by Check.
+type Problem struct {
+	ID   string // Id of the project, directory or file with the problem
+	Path string // Path of the item in its project
+	What string // Description of the problem
+}
+
+// Check looks for inconsistencies between the database and the stored datafiles
+// in the projects owned by owner, or in every project when owner is empty. It
+// reports projects without a directory, files missing from the database, files
+// that point at missing files, and current files whose stored bytes are missing
+// or the wrong size.
+func (a *Admin) Check(owner string) ([]Problem, error) {
+	projects, err := a.projects(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	for _, p := range projects {
+		if _, err := a.service.Dir.ByID(p.DataDir); err != nil {
+			problems = append(problems, Problem{p.ID, p.Name, "Project directory is missing"})
+		}
+
+		entries, err := a.service.Project.Files(p.ID, "")
+		if err != nil {
+			problems = append(problems, Problem{p.ID, p.Name, "Unable to list files: " + err.Error()})
+			continue
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir {
+				if what := a.checkFile(entry.ID); what != "" {
+					problems = append(problems, Problem{entry.ID, entry.Path, what})
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+// checkFile checks a single file. It returns a description of the problem,
+// or "" if the file is ok.
+func (a *Admin) checkFile(id string) string {
+	file, err := a.service.File.ByID(id)
+	if err != nil {
+		return "File is missing from the database"
+	}
+
+	if file.UsesID != "" {
+		if _, err := a.service.File.ByID(file.UsesID); err != nil {
+			return "File uses missing file " + file.UsesID
+		}
+	}
+
+	if !file.Current {
+		return ""
+	}
+
+	info, err := a.store.Stat(file.FileID())
+	switch {
+	case err != nil:
+		return "Stored bytes are missing"
+	case info.Size != file.Size:
+		return "Stored size doesn't match the file size"
+	default:
+		return ""
+	}
+}
+
+// ExpirePartials reclaims the partial uploads that haven't been written to in
+// maxAge. It returns the files that were reclaimed. Partials being uploaded to
+// a running server are only skipped because of their age, so maxAge shouldn't
+// be short. Partials stored as chunks are skipped when the store is external,
+// and are left for the server to reclaim.
+func (a *Admin) ExpirePartials(maxAge time.Duration) []schema.File {
+	return reaper.Reap(a.service.File, a.store, maxAge)
+}
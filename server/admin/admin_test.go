@@ -0,0 +1,160 @@
+package admin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+const testUser = "test@mc.org"
+
+// newTestAdmin creates an Admin on an in memory database with test@mc.org.
+func newTestAdmin() (*Admin, *service.Service, store.Store) {
+	svc := service.NewMemory(schema.NewUser("test", testUser, "", "test"))
+	st := store.NewMemory()
+	return New(svc, st), svc, st
+}
+
+// addFile adds a current file with size bytes to the project's directory.
+func addFile(t *testing.T, svc *service.Service, st store.Store, dirID, name string, size int) *schema.File {
+	file := schema.NewFile(name, testUser)
+	file.DataDirs = []string{dirID}
+	file.Size = int64(size)
+	file.Uploaded = int64(size)
+	f, err := svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert file %s: %s", name, err)
+	}
+
+	w, _ := st.Append(f.FileID(), 0)
+	w.Write(make([]byte, size))
+	w.Close()
+	return f
+}
+
+func TestUsers(t *testing.T) {
+	a, svc, _ := newTestAdmin()
+
+	u, err := a.CreateUser("new@mc.org", "")
+	if err != nil {
+		t.Fatalf("Unable to create user: %s", err)
+	}
+	if u.Name != "new@mc.org" || u.APIKey == "" {
+		t.Fatalf("Wrong user created %#v", u)
+	}
+	if _, err := a.CreateUser("new@mc.org", ""); !mcerr.Is(err, mcerr.ErrExists) {
+		t.Fatalf("Created an existing user: %v", err)
+	}
+
+	apikey, err := a.IssueAPIKey("new@mc.org")
+	if err != nil || apikey == u.APIKey {
+		t.Fatalf("Key not replaced %s %v", apikey, err)
+	}
+	if _, err := svc.User.ByAPIKey(u.APIKey); err == nil {
+		t.Fatalf("Old key still works")
+	}
+	if found, err := svc.User.ByAPIKey(apikey); err != nil || found.ID != "new@mc.org" {
+		t.Fatalf("New key doesn't work %#v %v", found, err)
+	}
+
+	if err := a.RevokeAPIKey("new@mc.org"); err != nil {
+		t.Fatalf("Unable to revoke key: %s", err)
+	}
+	if _, err := svc.User.ByAPIKey(apikey); err == nil {
+		t.Fatalf("Revoked key still works")
+	}
+
+	if err := a.DisableUser(testUser); err != nil {
+		t.Fatalf("Unable to disable user: %s", err)
+	}
+	if _, err := svc.User.ByAPIKey("test"); err == nil {
+		t.Fatalf("Disabled user can still login")
+	}
+	if _, err := a.IssueAPIKey(testUser); err == nil {
+		t.Fatalf("Issued a key to a disabled user")
+	}
+	if err := a.EnableUser(testUser); err != nil {
+		t.Fatalf("Unable to enable user: %s", err)
+	}
+	if _, err := a.IssueAPIKey(testUser); err != nil {
+		t.Fatalf("Unable to issue a key to an enabled user: %s", err)
+	}
+
+	if err := a.DisableUser("nobody@mc.org"); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Disabled a user that doesn't exist: %v", err)
+	}
+}
+
+func TestAddAdmin(t *testing.T) {
+	a, svc, _ := newTestAdmin()
+	a.CreateUser("other@mc.org", "")
+
+	if svc.Group.HasAccess("other@mc.org", testUser) {
+		t.Fatalf("Access before being made an admin")
+	}
+
+	// The first admin creates the group, adding an admin twice is a no-op.
+	for _, email := range []string{testUser, "other@mc.org", testUser} {
+		if err := a.AddAdmin(email); err != nil {
+			t.Fatalf("Unable to add admin %s: %s", email, err)
+		}
+	}
+
+	group, _ := svc.Group.ByID(service.AdminGroup)
+	if len(group.Users) != 2 {
+		t.Fatalf("Wrong admins %#v", group.Users)
+	}
+	if !svc.Group.HasAccess("other@mc.org", testUser) {
+		t.Fatalf("Admin doesn't have access")
+	}
+
+	if err := a.AddAdmin("nobody@mc.org"); err == nil {
+		t.Fatalf("Made a user that doesn't exist an admin")
+	}
+}
+
+func TestUsageAndCheck(t *testing.T) {
+	a, svc, st := newTestAdmin()
+	proj := schema.NewProject("Test", "", testUser)
+	p, _ := svc.Project.Insert(&proj)
+	addFile(t, svc, st, p.DataDir, "a.txt", 10)
+	missing := addFile(t, svc, st, p.DataDir, "b.txt", 5)
+
+	usage, err := a.Usage("")
+	if err != nil {
+		t.Fatalf("Usage failed: %s", err)
+	}
+	if len(usage) != 1 || usage[0].Files != 2 || usage[0].Bytes != 15 {
+		t.Fatalf("Wrong usage %#v", usage)
+	}
+
+	if problems, _ := a.Check(testUser); len(problems) != 0 {
+		t.Fatalf("Problems found in a consistent project %#v", problems)
+	}
+
+	st.Delete(missing.FileID())
+	problems, _ := a.Check("")
+	if len(problems) != 1 || problems[0].ID != missing.ID {
+		t.Fatalf("Missing bytes not found %#v", problems)
+	}
+}
+
+func TestExpirePartials(t *testing.T) {
+	a, svc, _ := newTestAdmin()
+	partial := schema.NewFile("partial.txt", testUser)
+	partial.Size = 10
+	partial.Current = false
+	partial.MTime = time.Now().Add(-2 * time.Hour)
+	f, _ := svc.File.Insert(&partial)
+
+	if reclaimed := a.ExpirePartials(3 * time.Hour); len(reclaimed) != 0 {
+		t.Fatalf("Reclaimed a partial that isn't old enough %#v", reclaimed)
+	}
+	if reclaimed := a.ExpirePartials(time.Hour); len(reclaimed) != 1 || reclaimed[0].ID != f.ID {
+		t.Fatalf("Partial not reclaimed %#v", reclaimed)
+	}
+}
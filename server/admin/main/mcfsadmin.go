@@ -0,0 +1,276 @@
+/*
+This package implements mcfsadmin, the command used to administer the
+Materials Commons File Server. It works directly against the server's
+database and datafile storage, so it uses the same database and storage
+options as mcfs. The commands are:
+
+	create-user      Create a user and print their apikey
+	disable-user     Stop a user from logging in
+	enable-user      Allow a disabled user to login again
+	issue-key        Give a user a new apikey
+	revoke-key       Remove a user's apikey
+	add-admin        Add a user to the admin group
+	usage            List projects and their usage
+	check            Check the database against the stored datafiles
+	expire-partials  Reclaim abandoned partial uploads
+
+A running server picks up changes to users and apikeys the next time it
+reloads its apikeys.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/materials-commons/config"
+	"github.com/materials-commons/mcfs/base/db"
+	"github.com/materials-commons/mcfs/server/admin"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Options for the database
+type databaseOptions struct {
+	Connection string `long:"db-connect" description:"The database connection string"`
+	Name       string `long:"db" description:"Database to use"`
+	Type       string `long:"db-type" description:"The type of database to connect to: rethinkdb or sql"`
+	SQLDriver  string `long:"db-sql-driver" description:"The database/sql driver to use when db-type is sql"`
+}
+
+// Options for datafile storage
+type storeOptions struct {
+	MCDir  string `long:"mcdir" description:"Directory path to materials commons file storage"`
+	Store  string `long:"store" description:"Where datafiles are stored: mcdir or s3"`
+	Chunks bool   `long:"chunks" description:"Datafiles are stored as chunks"`
+}
+
+// Break the options into option groups.
+type options struct {
+	Database databaseOptions `group:"Database Options"`
+	Store    storeOptions    `group:"Storage Options"`
+}
+
+var opts options
+
+// newAdmin connects to the configured database and storage. A server may be
+// running on the same storage, so files stored as chunks are left to it.
+func newAdmin() *admin.Admin {
+	setupConfig()
+	return admin.New(service.New(service.Configured()), store.NewExternal())
+}
+
+// userArg returns the single email argument of a command.
+func userArg(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected a single user email")
+	}
+	return args[0], nil
+}
+
+// ownerArg returns the optional owner argument of a command.
+func ownerArg(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
+	default:
+		return "", fmt.Errorf("expected at most one owner")
+	}
+}
+
+type createUserCommand struct {
+	Name string `long:"name" description:"The user's name, defaults to their email"`
+}
+
+func (c *createUserCommand) Execute(args []string) error {
+	email, err := userArg(args)
+	if err != nil {
+		return err
+	}
+
+	u, err := newAdmin().CreateUser(email, c.Name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created %s with apikey %s\n", u.ID, u.APIKey)
+	return nil
+}
+
+type disableUserCommand struct{}
+
+func (c *disableUserCommand) Execute(args []string) error {
+	email, err := userArg(args)
+	if err != nil {
+		return err
+	}
+	return newAdmin().DisableUser(email)
+}
+
+type enableUserCommand struct{}
+
+func (c *enableUserCommand) Execute(args []string) error {
+	email, err := userArg(args)
+	if err != nil {
+		return err
+	}
+	return newAdmin().EnableUser(email)
+}
+
+type issueKeyCommand struct{}
+
+func (c *issueKeyCommand) Execute(args []string) error {
+	email, err := userArg(args)
+	if err != nil {
+		return err
+	}
+
+	apikey, err := newAdmin().IssueAPIKey(email)
+	if err != nil {
+		return err
+	}
+	fmt.Println(apikey)
+	return nil
+}
+
+type revokeKeyCommand struct{}
+
+func (c *revokeKeyCommand) Execute(args []string) error {
+	email, err := userArg(args)
+	if err != nil {
+		return err
+	}
+	return newAdmin().RevokeAPIKey(email)
+}
+
+type addAdminCommand struct{}
+
+func (c *addAdminCommand) Execute(args []string) error {
+	email, err := userArg(args)
+	if err != nil {
+		return err
+	}
+	return newAdmin().AddAdmin(email)
+}
+
+type usageCommand struct{}
+
+func (c *usageCommand) Execute(args []string) error {
+	owner, err := ownerArg(args)
+	if err != nil {
+		return err
+	}
+
+	usage, err := newAdmin().Usage(owner)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range usage {
+		fmt.Printf("%s\t%s\t%s\t%d files\t%d bytes\n", u.ID, u.Owner, u.Name, u.Files, u.Bytes)
+	}
+	return nil
+}
+
+type checkCommand struct{}
+
+func (c *checkCommand) Execute(args []string) error {
+	owner, err := ownerArg(args)
+	if err != nil {
+		return err
+	}
+
+	problems, err := newAdmin().Check(owner)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		fmt.Printf("%s\t%s\t%s\n", p.ID, p.Path, p.What)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	return nil
+}
+
+type expirePartialsCommand struct {
+	MaxAge string `long:"max-age" description:"How long a partial upload can sit idle before it is reclaimed" default:"168h"`
+}
+
+func (c *expirePartialsCommand) Execute(args []string) error {
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil || maxAge <= 0 {
+		return fmt.Errorf("invalid max-age %s", c.MaxAge)
+	}
+
+	for _, f := range newAdmin().ExpirePartials(maxAge) {
+		fmt.Printf("%s\t%s\t%d of %d bytes\n", f.ID, f.Name, f.Uploaded, f.Size)
+	}
+	return nil
+}
+
+func configErrorHandler(key string, err error, args ...interface{}) {
+
+}
+
+func init() {
+	config.Init(config.TwelveFactorWithOverride)
+	config.SetErrorHandler(configErrorHandler)
+}
+
+func main() {
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.AddCommand("create-user", "Create a user", "Create a user with a new apikey. The user is identified by their email.", &createUserCommand{})
+	parser.AddCommand("disable-user", "Disable a user", "Stop a user from logging in. Their apikey is revoked.", &disableUserCommand{})
+	parser.AddCommand("enable-user", "Enable a user", "Allow a disabled user to login once they are issued an apikey.", &enableUserCommand{})
+	parser.AddCommand("issue-key", "Issue an apikey", "Give a user a new apikey, replacing their current one.", &issueKeyCommand{})
+	parser.AddCommand("revoke-key", "Revoke an apikey", "Remove a user's apikey.", &revokeKeyCommand{})
+	parser.AddCommand("add-admin", "Add an admin", "Add a user to the admin group, which has access to every project.", &addAdminCommand{})
+	parser.AddCommand("usage", "List project usage", "List the files and bytes in each project, optionally only for one owner.", &usageCommand{})
+	parser.AddCommand("check", "Check consistency", "Check the database against the stored datafiles, optionally only for one owner.", &checkCommand{})
+	parser.AddCommand("expire-partials", "Expire partial uploads", "Reclaim partial uploads that haven't been written to in max-age.", &expirePartialsCommand{})
+
+	// The parser prints the errors returned by commands.
+	if _, err := parser.Parse(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func setupConfig() {
+	if opts.Database.Connection != "" {
+		config.Set("MCDB_CONNECTION", opts.Database.Connection)
+	}
+
+	if opts.Database.Name != "" {
+		config.Set("MCDB_NAME", opts.Database.Name)
+	}
+
+	if opts.Database.Type != "" {
+		config.Set("MCDB_TYPE", opts.Database.Type)
+	}
+
+	if opts.Database.SQLDriver != "" {
+		config.Set("MCDB_SQL_DRIVER", opts.Database.SQLDriver)
+	}
+
+	if opts.Store.MCDir != "" {
+		config.Set("MCDIR", opts.Store.MCDir)
+	}
+
+	if opts.Store.Store != "" {
+		config.Set("MCFS_STORE", opts.Store.Store)
+	}
+
+	if opts.Store.Chunks {
+		config.Set("MCFS_CHUNKS", true)
+	}
+
+	db.SetAddress(config.GetString("MCDB_CONNECTION"))
+	db.SetDatabase(config.GetString("MCDB_NAME"))
+	db.SetAuthKey(config.GetString("MCDB_AUTHKEY"))
+	db.SetSQL(config.GetString("MCDB_SQL_DRIVER"), config.GetString("MCDB_CONNECTION"))
+}
@@ -0,0 +1,283 @@
+/*
+Package archive streams a project, or a directory subtree, as a zip or tar
+archive. The archive is built on the fly from the project's entries and the
+bytes in the store, so nothing is staged on disk. A manifest of checksums,
+computed from the bytes as they are written, is added as the last entry so
+the download can be verified with md5sum -c or sha256sum -c.
+*/
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Archive formats.
+const (
+	Zip = "zip"
+	Tar = "tar"
+)
+
+// ManifestPrefix starts the name of the manifest. It is followed by the digest
+// algorithm, as in MANIFEST.md5.
+const ManifestPrefix = "MANIFEST."
+
+// ContentType returns the Content-Type of an archive format.
+func ContentType(format string) string {
+	if format == Zip {
+		return "application/zip"
+	}
+	return "application/x-tar"
+}
+
+// ValidFormat returns true if format is a supported archive format.
+func ValidFormat(format string) bool {
+	return format == Zip || format == Tar
+}
+
+// Entry is a directory or file in an archive.
+type Entry struct {
+	Path  string       // Path in the archive, using / as the separator
+	File  *schema.File // File to write, nil for directories
+	MTime time.Time    // Modification time
+}
+
+// Project returns the entries for a whole project. Paths start with the project name.
+func Project(svc *service.Service, projectID string) ([]Entry, error) {
+	project, err := svc.Project.ByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return entries(svc, projectID, project.Name)
+}
+
+// Dir returns the entries for a directory and everything below it. Paths
+// start with the name of the directory.
+func Dir(svc *service.Service, dirID string) ([]Entry, error) {
+	datadir, err := svc.Dir.ByID(dirID)
+	if err != nil {
+		return nil, err
+	}
+	return entries(svc, datadir.Project, datadir.Name)
+}
+
+// entries builds the entries below root, a directory path in the project. Files
+// that haven't finished uploading are left out, as are entries whose path
+// would be extracted outside of the archive's directory.
+func entries(svc *service.Service, projectID, root string) ([]Entry, error) {
+	infos, err := svc.Project.Files(projectID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	root = path.Clean(toSlash(root))
+	trim := path.Dir(root) + "/"
+	if trim == "./" {
+		trim = ""
+	}
+
+	var entries []Entry
+	for _, info := range infos {
+		p := toSlash(info.Path)
+		if p != root && !strings.HasPrefix(p, root+"/") {
+			continue
+		}
+
+		entry := Entry{
+			Path:  strings.TrimPrefix(p, trim),
+			MTime: info.MTime,
+		}
+		if !safePath(entry.Path) {
+			l.Warn(log.Msg("Leaving %s out of the archive of project %s, its path is unsafe", entry.Path, projectID))
+			continue
+		}
+		if !info.IsDir {
+			file, err := svc.File.ByID(info.ID)
+			switch {
+			case err != nil:
+				return nil, err
+			case file.Size != file.Uploaded:
+				continue
+			}
+			entry.File = file
+			entry.MTime = file.MTime
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "No directory %s in project %s", root, projectID)
+	}
+
+	sort.Sort(byPath(entries))
+	return entries, nil
+}
+
+// safePath returns true if p stays below the directory an archive is
+// extracted to. Names are sent by clients, so a path may climb out with ..,
+// or be absolute or start with a drive letter.
+func safePath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") {
+		return false
+	}
+
+	elems := strings.Split(p, "/")
+	if strings.Contains(elems[0], ":") {
+		return false
+	}
+
+	for _, elem := range elems {
+		if elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// toSlash turns the path separators in a project path into /. Paths are stored
+// as they were sent by the client, which may have been running on Windows.
+func toSlash(p string) string {
+	return strings.Replace(p, "\\", "/", -1)
+}
+
+type byPath []Entry
+
+func (e byPath) Len() int           { return len(e) }
+func (e byPath) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byPath) Less(i, j int) bool { return e[i].Path < e[j].Path }
+
+// archiveWriter hides the differences between the zip and tar writers.
+type archiveWriter interface {
+	// create starts an entry, returning the writer for its contents.
+	create(name string, size int64, mtime time.Time, isDir bool) (io.Writer, error)
+	Close() error
+}
+
+type zipWriter struct {
+	*zip.Writer
+}
+
+func (z zipWriter) create(name string, size int64, mtime time.Time, isDir bool) (io.Writer, error) {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: mtime,
+	}
+	if isDir {
+		header.Name += "/"
+		header.Method = zip.Store
+	}
+	return z.CreateHeader(header)
+}
+
+type tarWriter struct {
+	*tar.Writer
+}
+
+func (t tarWriter) create(name string, size int64, mtime time.Time, isDir bool) (io.Writer, error) {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  mtime,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	}
+	if isDir {
+		header.Name += "/"
+		header.Mode = 0755
+		header.Size = 0
+		header.Typeflag = tar.TypeDir
+	}
+	return t, t.WriteHeader(header)
+}
+
+// Write writes an archive of entries to w in format. The file contents are read
+// from st and checksummed using alg as they are written. The manifest is
+// written last.
+func Write(w io.Writer, format, alg string, entries []Entry, st store.Store) error {
+	var aw archiveWriter
+	switch format {
+	case Zip:
+		aw = zipWriter{zip.NewWriter(w)}
+	case Tar:
+		aw = tarWriter{tar.NewWriter(w)}
+	default:
+		return mcerr.Errorf(mcerr.ErrInvalid, "Unknown archive format %s", format)
+	}
+
+	if !digest.Supported(alg) {
+		return mcerr.Errorf(mcerr.ErrInvalid, "Unknown digest %s", alg)
+	}
+
+	var manifest []string
+	for _, entry := range entries {
+		if entry.File == nil {
+			if _, err := aw.create(entry.Path, 0, entry.MTime, true); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sum, err := writeFile(aw, entry, alg, st)
+		if err != nil {
+			return err
+		}
+		manifest = append(manifest, fmt.Sprintf("%s  %s\n", sum, entry.Path))
+	}
+
+	contents := strings.Join(manifest, "")
+	mw, err := aw.create(ManifestPrefix+alg, int64(len(contents)), time.Now(), false)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mw, contents); err != nil {
+		return err
+	}
+
+	return aw.Close()
+}
+
+// writeFile writes a file's bytes to the archive, returning their checksum.
+func writeFile(aw archiveWriter, entry Entry, alg string, st store.Store) (string, error) {
+	id := entry.File.FileID()
+	info, err := st.Stat(id)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := st.ReadRange(id, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	fw, err := aw.create(entry.Path, info.Size, entry.MTime, false)
+	if err != nil {
+		return "", err
+	}
+
+	h, _ := digest.New(alg)
+	n, err := io.Copy(io.MultiWriter(fw, h), r)
+	switch {
+	case err != nil:
+		return "", err
+	case n != info.Size:
+		return "", mcerr.Errorf(mcerr.ErrInternal, "Read %d bytes of %s, expected %d", n, id, info.Size)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,341 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/share"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// testArchive is a project with a nested directory and a partially uploaded file:
+//
+//	Proj/top.txt
+//	Proj/a/x.txt
+//	Proj/a/b/y.txt
+//	Proj/a/b/partial.txt (still uploading)
+type testArchive struct {
+	svc       *service.Service
+	st        store.Store
+	projectID string
+	dirID     string
+	otherID   string // project owned by another user
+}
+
+func newTestArchive(t *testing.T) *testArchive {
+	ta := &testArchive{
+		svc: service.NewMemory(
+			schema.NewUser("test", "test@mc.org", "", "testkey"),
+			schema.NewUser("test2", "test2@mc.org", "", "test2key"),
+		),
+		st: store.NewMemory(),
+	}
+
+	proj := schema.NewProject("Proj", "", "test@mc.org")
+	p, err := ta.svc.Project.Insert(&proj)
+	if err != nil {
+		t.Fatalf("Unable to create project: %s", err)
+	}
+	ta.projectID = p.ID
+
+	ta.dirID = ta.addDir(t, p, "Proj/a", p.DataDir)
+	bID := ta.addDir(t, p, "Proj/a/b", ta.dirID)
+	ta.addFile(t, "top.txt", "top level\n", p.DataDir, true)
+	ta.addFile(t, "x.txt", "x contents\n", ta.dirID, true)
+	ta.addFile(t, "y.txt", "y contents\n", bID, true)
+	ta.addFile(t, "partial.txt", "partial", bID, false)
+
+	other := schema.NewProject("Other", "", "test2@mc.org")
+	o, _ := ta.svc.Project.Insert(&other)
+	ta.otherID = o.ID
+
+	return ta
+}
+
+func (ta *testArchive) addDir(t *testing.T, p *schema.Project, name, parent string) string {
+	d := schema.NewDirectory(name, p.Owner, p.ID, parent)
+	dir, err := ta.svc.Dir.Insert(&d)
+	if err != nil {
+		t.Fatalf("Unable to create dir %s: %s", name, err)
+	}
+	ta.svc.Project.AddDirectories(p, dir.ID)
+	return dir.ID
+}
+
+func (ta *testArchive) addFile(t *testing.T, name, contents, dirID string, complete bool) {
+	file := schema.NewFile(name, "test@mc.org")
+	file.DataDirs = []string{dirID}
+	file.Size = int64(len(contents))
+	if complete {
+		file.Uploaded = file.Size
+	}
+	f, err := ta.svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to create file %s: %s", name, err)
+	}
+
+	wc, _ := ta.st.Append(f.FileID(), 0)
+	io.WriteString(wc, contents)
+	wc.Close()
+}
+
+// readZip returns the contents of each entry in a zip archive.
+func readZip(t *testing.T, b []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("Invalid zip archive: %s", err)
+	}
+
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		r, _ := f.Open()
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		contents[f.Name] = string(data)
+	}
+	return contents
+}
+
+// readTar returns the contents of each entry in a tar archive.
+func readTar(t *testing.T, b []byte) map[string]string {
+	tr := tar.NewReader(bytes.NewReader(b))
+	contents := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid tar archive: %s", err)
+		}
+		data, _ := ioutil.ReadAll(tr)
+		contents[header.Name] = string(data)
+	}
+	return contents
+}
+
+func checkContents(t *testing.T, contents map[string]string, expected map[string]string) {
+	if len(contents) != len(expected) {
+		t.Errorf("Expected %d entries, got %d: %v", len(expected), len(contents), contents)
+	}
+	for name, data := range expected {
+		got, found := contents[name]
+		switch {
+		case !found:
+			t.Errorf("Missing entry %s", name)
+		case got != data:
+			t.Errorf("Entry %s = %q, expected %q", name, got, data)
+		}
+	}
+}
+
+func TestWriteProjectZip(t *testing.T) {
+	ta := newTestArchive(t)
+	entries, err := Project(ta.svc, ta.projectID)
+	if err != nil {
+		t.Fatalf("Unable to list project: %s", err)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, Zip, "md5", entries, ta.st); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	sum := func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+	checkContents(t, readZip(t, b.Bytes()), map[string]string{
+		"Proj/":          "",
+		"Proj/a/":        "",
+		"Proj/a/b/":      "",
+		"Proj/top.txt":   "top level\n",
+		"Proj/a/x.txt":   "x contents\n",
+		"Proj/a/b/y.txt": "y contents\n",
+		"MANIFEST.md5": sum("y contents\n") + "  Proj/a/b/y.txt\n" +
+			sum("x contents\n") + "  Proj/a/x.txt\n" +
+			sum("top level\n") + "  Proj/top.txt\n",
+	})
+}
+
+func TestWriteDirTar(t *testing.T) {
+	ta := newTestArchive(t)
+	entries, err := Dir(ta.svc, ta.dirID)
+	if err != nil {
+		t.Fatalf("Unable to list dir: %s", err)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, Tar, "sha256", entries, ta.st); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	sum := func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+	checkContents(t, readTar(t, b.Bytes()), map[string]string{
+		"a/":        "",
+		"a/b/":      "",
+		"a/x.txt":   "x contents\n",
+		"a/b/y.txt": "y contents\n",
+		"MANIFEST.sha256": sum("y contents\n") + "  a/b/y.txt\n" +
+			sum("x contents\n") + "  a/x.txt\n",
+	})
+}
+
+func TestWriteErrors(t *testing.T) {
+	ta := newTestArchive(t)
+	entries, _ := Project(ta.svc, ta.projectID)
+
+	if err := Write(ioutil.Discard, "rar", "md5", entries, ta.st); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+
+	if err := Write(ioutil.Discard, Zip, "crc", entries, ta.st); err == nil {
+		t.Errorf("Expected error for unknown digest")
+	}
+
+	if err := Write(ioutil.Discard, Zip, "md5", entries, store.NewMemory()); err == nil {
+		t.Errorf("Expected error when file bytes are missing")
+	}
+
+	if _, err := Dir(ta.svc, "no-such-dir"); err == nil {
+		t.Errorf("Expected error for unknown directory")
+	}
+}
+
+func TestUnsafePaths(t *testing.T) {
+	ta := newTestArchive(t)
+	p, _ := ta.svc.Project.ByID(ta.projectID)
+	ta.addFile(t, "../../escape.txt", "escaped\n", p.DataDir, true)
+
+	entries, err := Project(ta.svc, ta.projectID)
+	if err != nil {
+		t.Fatalf("Unable to list project: %s", err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Path, "escape.txt") {
+			t.Errorf("Entry with an unsafe path was archived: %s", entry.Path)
+		}
+	}
+
+	for _, p := range []string{"../x", "a/../../x", "/etc/passwd", "C:/x", "c:x", ""} {
+		if safePath(p) {
+			t.Errorf("Expected %q to be unsafe", p)
+		}
+	}
+
+	for _, p := range []string{"Proj/a/x.txt", "a..b/x", "Proj/a:b"} {
+		if !safePath(p) {
+			t.Errorf("Expected %q to be safe", p)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ta := newTestArchive(t)
+	server := httptest.NewServer(&Handler{Service: ta.svc, Store: ta.st})
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		status  int
+		comment string
+	}{
+		{"/projects/archive/" + ta.projectID, http.StatusUnauthorized, "No apikey"},
+		{"/projects/archive/" + ta.projectID + "?apikey=bad", http.StatusUnauthorized, "Bad apikey"},
+		{"/projects/archive/" + ta.otherID + "?apikey=testkey", http.StatusUnauthorized, "No access"},
+		{"/projects/archive/no-such-project?apikey=testkey", http.StatusNotFound, "Unknown project"},
+		{"/projects/archive/" + ta.projectID + "?apikey=testkey&format=rar", http.StatusBadRequest, "Bad format"},
+		{"/projects/archive/" + ta.projectID + "?apikey=testkey", http.StatusOK, "Project zip"},
+		{"/datadirs/archive/" + ta.dirID + "?apikey=testkey&format=tar", http.StatusOK, "Dir tar"},
+		{"/projects/archive/" + ta.otherID + "?apikey=test2key&format=tar&digest=sha256", http.StatusOK, "Other users project"},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("%s: request failed: %s", test.comment, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.comment, test.status, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		disposition := resp.Header.Get("Content-Disposition")
+		switch {
+		case strings.Contains(test.path, "format=tar"):
+			if resp.Header.Get("Content-Type") != "application/x-tar" {
+				t.Errorf("%s: wrong content type %s", test.comment, resp.Header.Get("Content-Type"))
+			}
+			readTar(t, body)
+		default:
+			if disposition != `attachment; filename="Proj.zip"` {
+				t.Errorf("%s: wrong disposition %s", test.comment, disposition)
+			}
+			if _, found := readZip(t, body)["MANIFEST.md5"]; !found {
+				t.Errorf("%s: archive has no manifest", test.comment)
+			}
+		}
+	}
+}
+
+func TestHandlerShareLink(t *testing.T) {
+	ta := newTestArchive(t)
+	links := share.New(ta.svc, []byte("secret"))
+	server := httptest.NewServer(&Handler{Service: ta.svc, Store: ta.st, Links: links})
+	defer server.Close()
+
+	link, err := links.Create("test@mc.org", "", ta.dirID, 0, 1)
+	if err != nil {
+		t.Fatalf("Unable to create share link: %s", err)
+	}
+	u := links.URL(link)
+	query := u[strings.Index(u, "?"):]
+
+	tests := []struct {
+		path    string
+		status  int
+		comment string
+	}{
+		{"/projects/archive/" + ta.projectID + query, http.StatusUnauthorized, "Project"},
+		{u + "&format=tar", http.StatusOK, "Directory"},
+		{u, http.StatusUnauthorized, "Past download limit"},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("%s: request failed: %s", test.comment, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.comment, test.status, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusOK {
+			checkContents(t, readTar(t, body), map[string]string{
+				"a/":        "",
+				"a/b/":      "",
+				"a/x.txt":   "x contents\n",
+				"a/b/y.txt": "y contents\n",
+				"MANIFEST.md5": fmt.Sprintf("%x  a/b/y.txt\n%x  a/x.txt\n",
+					md5.Sum([]byte("y contents\n")), md5.Sum([]byte("x contents\n"))),
+			})
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/share"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+var l = log.New("server", "Archive")
+
+// Handler serves archives over http. It is registered for /projects/archive/
+// and /datadirs/archive/, followed by the id of the project or directory:
+//
+//	/projects/archive/<id>?apikey=<key>&format=zip|tar&digest=md5|sha256
+//
+// The format defaults to zip and the digest to md5. The user with the apikey
+// must have access to the project or directory. Directories can also be
+// downloaded with a share link from Links in place of the apikey.
+type Handler struct {
+	Service *service.Service
+	Store   store.Store
+	Links   *share.Links
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	var (
+		user   string
+		shared = h.Links != nil && req.FormValue(share.LinkParam) != ""
+	)
+	if !shared {
+		apikey := req.FormValue("apikey")
+		if apikey == "" {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		u, err := h.Service.User.ByAPIKey(apikey)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		user = u.Email
+	}
+
+	format := formValue(req, "format", Zip)
+	alg := formValue(req, "digest", digest.MD5)
+	if !ValidFormat(format) || !digest.Supported(alg) {
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	id := path.Base(req.URL.Path)
+	var (
+		owner string
+		name  string
+		list  func(svc *service.Service, id string) ([]Entry, error)
+	)
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/projects/"):
+		project, err := h.Service.Project.ByID(id)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		owner, name, list = project.Owner, project.Name, Project
+
+	case strings.HasPrefix(req.URL.Path, "/datadirs/"):
+		datadir, err := h.Service.Dir.ByID(id)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		owner, name, list = datadir.Owner, path.Base(toSlash(datadir.Name)), Dir
+
+	default:
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case shared:
+		if err := h.authorizeShare(req, id); err != nil {
+			l.Info(log.Msg("Share link refused for %s: %s", id, err))
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		user = "share link " + req.FormValue(share.LinkParam)
+
+	case !h.Service.Group.HasAccess(owner, user):
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	entries, err := list(h.Service, id)
+	if err != nil {
+		l.Error(log.Msg("Unable to list %s for archive: %s", id, err))
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	writer.Header().Set("Content-Type", ContentType(format))
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+
+	// Once the archive starts the status can't be changed, so a failure part
+	// way through can only be logged. The client sees a truncated archive.
+	if err := Write(writer, format, alg, entries, h.Store); err != nil {
+		l.Error(log.Msg("Archive of %s for %s failed: %s", id, user, err))
+	}
+}
+
+// authorizeShare checks that the share link in req allows downloading the
+// item id. Share links are only for directories.
+func (h *Handler) authorizeShare(req *http.Request, id string) error {
+	if !strings.HasPrefix(req.URL.Path, "/datadirs/") {
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Share links can't be used for projects")
+	}
+	return h.Links.AuthorizeDir(req.Form, id, share.RequestUse(req))
+}
+
+// formValue returns a form value, or def when it isn't set.
+func formValue(req *http.Request, key, def string) string {
+	if value := req.FormValue(key); value != "" {
+		return value
+	}
+	return def
+}
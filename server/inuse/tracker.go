@@ -46,6 +46,11 @@ func (t *Tracker) Is(id string) bool {
 	return t.tracking[id]
 }
 
+// Default returns the global tracking list used by the package level functions.
+func Default() *Tracker {
+	return tracker
+}
+
 // Mark uses the global tracking list. It marks a particular item
 // as in use. It returns true if the item wasn't already inuse.
 func Mark(id string) bool {
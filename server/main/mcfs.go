@@ -27,19 +27,29 @@ package main
 
 import (
 	"fmt"
-	"net"
-	"net/http"
 	"os"
-	"path/filepath"
-	"runtime/debug"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/materials-commons/config"
 	"github.com/materials-commons/mcfs/base/db"
-	"github.com/materials-commons/mcfs/base/mc"
-	"github.com/materials-commons/mcfs/client/util"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mediatype"
 	_ "github.com/materials-commons/mcfs/protocol"
-	"github.com/materials-commons/mcfs/server/request"
+	"github.com/materials-commons/mcfs/server/process"
+	"github.com/materials-commons/mcfs/server/process/convert"
+	"github.com/materials-commons/mcfs/server/process/extract"
+	"github.com/materials-commons/mcfs/server/search"
+	"github.com/materials-commons/mcfs/server/servers"
+	"github.com/materials-commons/mcfs/server/servers/access"
+	"github.com/materials-commons/mcfs/server/servers/dbcheck"
+	"github.com/materials-commons/mcfs/server/servers/reaper"
+	"github.com/materials-commons/mcfs/server/servers/recover"
+	"github.com/materials-commons/mcfs/server/servers/tcp"
+	"github.com/materials-commons/mcfs/server/servers/tlog"
+	"github.com/materials-commons/mcfs/server/servers/web"
 	"github.com/materials-commons/mcfs/server/service"
 )
 
@@ -50,13 +60,22 @@ type serverOptions struct {
 	MCDir    string `long:"mcdir" description:"Directory path to materials commons file storage"`
 	PrintPid bool   `long:"print-pid" description:"Prints the server pid to stdout"`
 	HTTPPort uint   `long:"http-port" description:"Port webserver listens on" default:"5010"`
+	MaxAge   string `long:"partials-max-age" description:"How long a partial upload can sit idle before it is reclaimed (eg, 168h)"`
+	Store    string `long:"store" description:"Where datafiles are stored: mcdir or s3"`
+	Chunks   bool   `long:"chunks" description:"Enable chunk level deduplication of uploads"`
+	Secret   string `long:"share-secret" description:"Secret used to sign share links, a random secret is used when not set"`
+	LogLevel string `long:"log-level" description:"Lowest level of messages to log: debug, info, warn, error or crit"`
+	LogFmt   string `long:"log-format" description:"Format of log messages: logfmt or json"`
 }
 
 // Options for the database
 type databaseOptions struct {
 	Connection string `long:"db-connect" description:"The database connection string"`
 	Name       string `long:"db" description:"Database to use"`
-	Type       string `long:"db-type" description:"The type of database to connect to"`
+	Type       string `long:"db-type" description:"The type of database to connect to: rethinkdb, sql or memory"`
+	SQLDriver  string `long:"db-sql-driver" description:"The database/sql driver to use when db-type is sql"`
+	User       string `long:"db-user" description:"The single user allowed to login when db-type is memory"`
+	APIKey     string `long:"db-apikey" description:"The apikey for db-user"`
 }
 
 // Break the options into option groups.
@@ -69,20 +88,26 @@ func configErrorHandler(key string, err error, args ...interface{}) {
 
 }
 
-var s *service.Service
-
 func setupRethinkDB() {
 	dbConn := config.GetString("MCDB_CONNECTION")
 	dbName := config.GetString("MCDB_NAME")
 	db.SetAddress(dbConn)
 	db.SetDatabase(dbName)
+	db.SetAuthKey(config.GetString("MCDB_AUTHKEY"))
+	if timeout, err := time.ParseDuration(config.GetString("MCDB_TIMEOUT")); err == nil {
+		db.SetTimeout(timeout)
+	}
+}
+
+func setupSQL() {
+	dbConn := config.GetString("MCDB_CONNECTION")
+	driver := config.GetString("MCDB_SQL_DRIVER")
+	db.SetSQL(driver, dbConn)
 }
 
 func init() {
 	config.Init(config.TwelveFactorWithOverride)
 	config.SetErrorHandler(configErrorHandler)
-	setupRethinkDB()
-	s = service.New(service.RethinkDB)
 }
 
 func main() {
@@ -93,8 +118,19 @@ func main() {
 		os.Exit(1)
 	}
 
-	listener, err := createListener(opts.Server.Bind, opts.Server.Port)
-	if err != nil {
+	setupConfig(opts.Database, opts.Server)
+	if err := log.Configure(config.GetString("MCFS_LOG_LEVEL"), config.GetString("MCFS_LOG_FORMAT")); err != nil {
+		fmt.Println("Log setup error:", err)
+		os.Exit(1)
+	}
+	setupRethinkDB()
+	setupSQL()
+	setupProcessors()
+
+	// Open the listener before starting anything so a port that is in use
+	// stops the server straight away.
+	if err := tcp.Server().Listen(); err != nil {
+		fmt.Println("Listen error:", err)
 		os.Exit(1)
 	}
 
@@ -102,20 +138,36 @@ func main() {
 		fmt.Println(os.Getpid())
 	}
 
-	setupConfig(opts.Database, opts.Server)
-
-	defer func() {
-		if e := recover(); e != nil {
-			fmt.Printf("%s: %s\n", e, debug.Stack())
-		}
-	}()
+	registerServers()
+	servers.Start()
 
-	go webserver(opts.Server.HTTPPort)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	servers.Stop()
+}
 
-	acceptConnections(listener)
+// registerServers registers the servers that make up mcfs. They are started
+// and restarted by the servers package.
+func registerServers() {
+	servers.Register("TCP", tcp.Server())
+	servers.Register("Web", web.Server())
+	servers.Register("Access", access.Server())
+	servers.Register("TransactionLog", tlog.Server())
+	servers.Register("Recovery", recover.Server())
+	servers.Register("PartialsReaper", reaper.Server())
+	servers.Register("Processor", process.Server())
+	servers.Register("Search", search.Server())
+	if service.Configured() == service.RethinkDB {
+		servers.Register("DBCheck", dbcheck.Server())
+	}
 }
 
 func setupConfig(dbOpts databaseOptions, serverOpts serverOptions) {
+	config.Set("MCFS_BIND", serverOpts.Bind)
+	config.Set("MCFS_PORT", int(serverOpts.Port))
+	config.Set("MCFS_HTTP_PORT", int(serverOpts.HTTPPort))
+
 	if dbOpts.Connection != "" {
 		config.Set("MCDB_CONNECTION", dbOpts.Connection)
 	}
@@ -128,112 +180,52 @@ func setupConfig(dbOpts databaseOptions, serverOpts serverOptions) {
 		config.Set("MCDB_TYPE", dbOpts.Type)
 	}
 
-	if serverOpts.MCDir != "" {
-		config.Set("MCDIR", serverOpts.MCDir)
+	if dbOpts.SQLDriver != "" {
+		config.Set("MCDB_SQL_DRIVER", dbOpts.SQLDriver)
 	}
-}
 
-// webserver starts an http server that serves out datafile.
-func webserver(port uint) {
-	http.HandleFunc("/datafiles/static/", datafileHandler)
-	fmt.Println(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
-}
-
-// datafileHandler serves data files.
-func datafileHandler(writer http.ResponseWriter, req *http.Request) {
-	apikey := req.FormValue("apikey")
-	if apikey == "" {
-		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
+	if dbOpts.User != "" {
+		config.Set("MCDB_USER", dbOpts.User)
 	}
 
-	download := req.FormValue("download")
-
-	// Verify key
-	u, err := s.User.ByAPIKey(apikey)
-	if err != nil {
-		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
-	}
-
-	// Get datafile from db and check access
-	dataFileID := filepath.Base(req.URL.Path)
-	df, err := s.File.ByID(dataFileID)
-	switch {
-	case err != nil:
-		fmt.Printf("Failed looking up fileID %s: %s\n", dataFileID, err)
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-	case !s.Group.HasAccess(df.Owner, u.Email):
-		fmt.Printf("No access owner: %s, accessed by: %s\n", df.Owner, u.Email)
-		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-	default:
-		var path string
-		if isConvertedImage(df.MediaType.Mime) && download == "" {
-			path = imageConversionPath(df.FileID())
-		} else {
-			path = mc.FilePath(df.FileID())
-		}
-		writer.Header().Set("Content-Type", df.MediaType.Mime)
-		fmt.Printf("Serving path: %s\n", path)
-		http.ServeFile(writer, req, path)
+	if dbOpts.APIKey != "" {
+		config.Set("MCDB_APIKEY", dbOpts.APIKey)
 	}
-}
 
-// isTiff checks a name to see if it is for a TIFF file.
-func isConvertedImage(mime string) bool {
-	switch mime {
-	case "image/tiff":
-		return true
-	case "image/x-ms-bmp":
-		return true
-	default:
-		return false
+	if serverOpts.MCDir != "" {
+		config.Set("MCDIR", serverOpts.MCDir)
 	}
-}
 
-func imageConversionPath(id string) string {
-	return filepath.Join(mc.FileDir(id), ".conversion", id+".jpg")
-}
+	if serverOpts.MaxAge != "" {
+		config.Set("MCFS_PARTIALS_MAX_AGE", serverOpts.MaxAge)
+	}
 
-// createListener creates the net connection. It connects to the specified host
-// and port.
-func createListener(host string, port uint) (*net.TCPListener, error) {
-	service := fmt.Sprintf("%s:%d", host, port)
-	tcpAddr, err := net.ResolveTCPAddr("tcp", service)
-	if err != nil {
-		fmt.Println("Resolve error:", err)
-		return nil, err
+	if serverOpts.Store != "" {
+		config.Set("MCFS_STORE", serverOpts.Store)
 	}
 
-	listener, err := net.ListenTCP("tcp", tcpAddr)
-	if err != nil {
-		fmt.Println("Listen error:", err)
-		return nil, err
+	if serverOpts.Chunks {
+		config.Set("MCFS_CHUNKS", true)
 	}
 
-	return listener, nil
-}
+	if serverOpts.LogLevel != "" {
+		config.Set("MCFS_LOG_LEVEL", serverOpts.LogLevel)
+	}
 
-// acceptConnections listens on the the TCPListener. When a new connection comes
-// in it is dispatched in a separate go routine. For each new connection a new
-// connection the to database is created.
-func acceptConnections(listener *net.TCPListener) {
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			continue
-		}
+	if serverOpts.LogFmt != "" {
+		config.Set("MCFS_LOG_FORMAT", serverOpts.LogFmt)
+	}
 
-		m := util.NewGobMarshaler(conn)
-		r := request.NewReqHandler(m, config.GetString("MCDIR"))
-		go handleConnection(r, conn)
+	if serverOpts.Secret != "" {
+		config.Set("MCFS_SHARE_SECRET", serverOpts.Secret)
 	}
 }
 
-// handleConnection handles connection requests by running the state machine. It also
-// takes care of book keeping like shutting down the net and database connections when
-// the connection is terminated.
-func handleConnection(reqHandler *request.ReqHandler, conn net.Conn) {
-	defer conn.Close()
-	reqHandler.Run()
+// setupProcessors registers the processors that run on files once their upload
+// completes.
+func setupProcessors() {
+	process.Register(convert.New(""), convert.MediaTypes...)
+	process.Register(extract.CIF(), mediatype.CIF)
+	process.Register(extract.VASP(), mediatype.VASP)
+	process.Register(extract.HDF5(), mediatype.HDF5)
 }
@@ -0,0 +1,47 @@
+package metrics
+
+// The metrics kept by the server.
+var (
+	// ActiveConnections is the number of open connections from mcfs clients.
+	ActiveConnections = NewGauge("mcfs_active_connections",
+		"Open connections from mcfs clients.")
+
+	// Requests counts the responses sent to mcfs clients by request type,
+	// such as UploadReq, and mcerr.ErrorCode.
+	Requests = NewCounterVec("mcfs_requests_total",
+		"Requests from mcfs clients by request type and response status.", "type", "status")
+
+	// BytesUploaded counts the datafile bytes written by uploads.
+	BytesUploaded = NewCounter("mcfs_uploaded_bytes_total",
+		"Datafile bytes written by uploads.")
+
+	// BytesDownloaded counts the datafile bytes sent to clients, including
+	// archives and http downloads.
+	BytesDownloaded = NewCounter("mcfs_downloaded_bytes_total",
+		"Datafile bytes sent to clients.")
+
+	// UploadDuration is how long upload sessions took, from when the file
+	// was opened until it was closed.
+	UploadDuration = NewHistogram("mcfs_upload_duration_seconds",
+		"How long upload sessions took, from opening the file until closing it.",
+		[]float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600})
+
+	// Resumes counts upload sessions that continued a partial upload.
+	Resumes = NewCounter("mcfs_upload_resumes_total",
+		"Upload sessions that continued a partial upload.")
+
+	// DedupHits counts new files whose bytes were already stored for another
+	// file, so the new file's UsesID was set.
+	DedupHits = NewCounter("mcfs_dedup_hits_total",
+		"New files that reuse the stored bytes of an existing file.")
+
+	// ChecksumFailures counts completed uploads whose checksums didn't match,
+	// so their bytes were discarded.
+	ChecksumFailures = NewCounter("mcfs_checksum_failures_total",
+		"Completed uploads discarded because their checksums didn't match.")
+
+	// DBErrors counts failed database operations by error, such as
+	// mcfs.ErrDBRelatedUpdateFailed.
+	DBErrors = NewCounterVec("mcfs_db_errors_total",
+		"Failed database operations by error.", "error")
+)
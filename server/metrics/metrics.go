@@ -0,0 +1,356 @@
+/*
+Package metrics keeps counters, gauges and histograms for the server, and
+writes them in the Prometheus text format. The metrics the server keeps are
+defined in mcfs.go. They are served on the http port under /metrics.
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metric is a metric that can write itself in the text format.
+type metric interface {
+	write(w io.Writer)
+}
+
+// registry holds every metric in the order it was created.
+var registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+// register adds m to the metrics that are written out.
+func register(m metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// WriteText writes all metrics to w in the Prometheus text format.
+func WriteText(w io.Writer) {
+	registry.mutex.Lock()
+	metrics := append([]metric(nil), registry.metrics...)
+	registry.mutex.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler returns an http handler that serves all metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteText(writer)
+	})
+}
+
+// desc is the name, help text and label names of a metric.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// header writes the HELP and TYPE lines for a metric.
+func (d *desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, d.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// labelPairs formats the label names and values as name="value" pairs.
+func (d *desc) labelPairs(values []string) []string {
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, d.labels[i], labelEscaper.Replace(value))
+	}
+	return pairs
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sample writes a single line of a metric.
+func sample(w io.Writer, name string, pairs []string, value float64) {
+	if len(pairs) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, formatValue(value))
+		return
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatValue(value))
+}
+
+// formatValue formats a value the way Prometheus expects.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case value == math.Trunc(value) && math.Abs(value) < 1e15:
+		return fmt.Sprintf("%d", int64(value))
+	default:
+		return fmt.Sprintf("%g", value)
+	}
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	mutex sync.Mutex
+	value float64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta, which must not be negative, to the counter.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.mutex.Lock()
+	c.value += delta
+	c.mutex.Unlock()
+}
+
+// Value returns the counter's value.
+func (c *Counter) Value() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.value
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	mutex sync.Mutex
+	value float64
+}
+
+// Inc adds one to the gauge.
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec subtracts one from the gauge.
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Add adds delta to the gauge.
+func (g *Gauge) Add(delta float64) {
+	g.mutex.Lock()
+	g.value += delta
+	g.mutex.Unlock()
+}
+
+// Value returns the gauge's value.
+func (g *Gauge) Value() float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.value
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64 // Upper bounds, in increasing order.
+	counts  []uint64  // Observations in each bucket, not cumulative.
+	count   uint64
+	sum     float64
+}
+
+// newHistogram creates a histogram with the given bucket upper bounds.
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe adds an observation to the histogram.
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += value
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count
+}
+
+// write writes the buckets, sum and count of the histogram.
+func (h *Histogram) write(w io.Writer, name string, pairs []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		sample(w, name+"_bucket", append(pairs, `le="`+formatValue(bound)+`"`), float64(cumulative))
+	}
+	sample(w, name+"_bucket", append(pairs, `le="+Inf"`), float64(h.count))
+	sample(w, name+"_sum", pairs, h.sum)
+	sample(w, name+"_count", pairs, float64(h.count))
+}
+
+// vec holds the children of a metric with labels, one for each set of label
+// values.
+type vec struct {
+	desc
+	mutex    sync.Mutex
+	children map[string]interface{}
+	values   map[string][]string
+	create   func() interface{}
+}
+
+func newVec(d desc, create func() interface{}) *vec {
+	return &vec{
+		desc:     d,
+		children: make(map[string]interface{}),
+		values:   make(map[string][]string),
+		create:   create,
+	}
+}
+
+// with returns the child for values, creating it the first time. Missing
+// values are empty, and extra values are ignored.
+func (v *vec) with(values []string) interface{} {
+	labelValues := make([]string, len(v.labels))
+	copy(labelValues, values)
+	key := strings.Join(labelValues, "\xff")
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	child, found := v.children[key]
+	if !found {
+		child = v.create()
+		v.children[key] = child
+		v.values[key] = labelValues
+	}
+	return child
+}
+
+// each calls fn for each child, sorted by label values so the output is stable.
+func (v *vec) each(fn func(pairs []string, child interface{})) {
+	v.mutex.Lock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	v.mutex.Unlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.mutex.Lock()
+		child, values := v.children[key], v.values[key]
+		v.mutex.Unlock()
+		fn(v.labelPairs(values), child)
+	}
+}
+
+// CounterVec is a counter with labels.
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec creates and registers a counter with the given labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(desc{name, help, "counter", labels}, func() interface{} { return &Counter{} })}
+	register(c)
+	return c
+}
+
+// With returns the counter for the label values, in the order the labels
+// were given.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values).(*Counter)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w)
+	c.each(func(pairs []string, child interface{}) {
+		sample(w, c.name, pairs, child.(*Counter).Value())
+	})
+}
+
+// NewCounter creates and registers a counter without labels.
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).With()
+}
+
+// GaugeVec is a gauge with labels.
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec creates and registers a gauge with the given labels.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(desc{name, help, "gauge", labels}, func() interface{} { return &Gauge{} })}
+	register(g)
+	return g
+}
+
+// With returns the gauge for the label values, in the order the labels were
+// given.
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.with(values).(*Gauge)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.header(w)
+	g.each(func(pairs []string, child interface{}) {
+		sample(w, g.name, pairs, child.(*Gauge).Value())
+	})
+}
+
+// NewGauge creates and registers a gauge without labels.
+func NewGauge(name, help string) *Gauge {
+	return NewGaugeVec(name, help).With()
+}
+
+// HistogramVec is a histogram with labels.
+type HistogramVec struct {
+	*vec
+}
+
+// NewHistogramVec creates and registers a histogram with the given bucket
+// upper bounds and labels.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{newVec(desc{name, help, "histogram", labels}, func() interface{} { return newHistogram(sorted) })}
+	register(h)
+	return h
+}
+
+// With returns the histogram for the label values, in the order the labels
+// were given.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values).(*Histogram)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w)
+	h.each(func(pairs []string, child interface{}) {
+		child.(*Histogram).write(w, h.name, pairs)
+	})
+}
+
+// NewHistogram creates and registers a histogram without labels.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
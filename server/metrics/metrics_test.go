@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// text returns everything WriteText writes.
+func text() string {
+	var buf bytes.Buffer
+	WriteText(&buf)
+	return buf.String()
+}
+
+// expectLines fails if any of lines is missing from the text output.
+func expectLines(t *testing.T, lines ...string) {
+	out := text()
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Missing line %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	c := NewCounter("test_counter_total", "A test counter.")
+	c.Inc()
+	c.Add(2.5)
+	c.Add(-1)
+
+	g := NewGauge("test_gauge", "A test gauge.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	expectLines(t,
+		"# HELP test_counter_total A test counter.",
+		"# TYPE test_counter_total counter",
+		"test_counter_total 3.5",
+		"# TYPE test_gauge gauge",
+		"test_gauge 1",
+	)
+}
+
+func TestLabels(t *testing.T) {
+	v := NewCounterVec("test_requests_total", "Test requests.", "type", "status")
+	v.With("UploadReq", "Success").Inc()
+	v.With("UploadReq", "Success").Inc()
+	v.With("StatReq", "NotFound").Inc()
+	v.With(`a "quoted"\name`, "line\nbreak").Inc()
+
+	expectLines(t,
+		`test_requests_total{type="UploadReq",status="Success"} 2`,
+		`test_requests_total{type="StatReq",status="NotFound"} 1`,
+		`test_requests_total{type="a \"quoted\"\\name",status="line\nbreak"} 1`,
+	)
+
+	// Children are written sorted by their label values.
+	out := text()
+	if strings.Index(out, `type="StatReq"`) > strings.Index(out, `type="UploadReq"`) {
+		t.Errorf("Children aren't sorted:\n%s", out)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "A test histogram.", []float64{10, 1})
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(5)
+	h.Observe(20)
+
+	expectLines(t,
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{le="1"} 2`,
+		`test_duration_seconds_bucket{le="10"} 3`,
+		`test_duration_seconds_bucket{le="+Inf"} 4`,
+		"test_duration_seconds_sum 26.5",
+		"test_duration_seconds_count 4",
+	)
+}
+
+func TestHandler(t *testing.T) {
+	ActiveConnections.Inc()
+	defer ActiveConnections.Dec()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Wrong content type %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "\nmcfs_active_connections 1\n") {
+		t.Errorf("Server metrics missing:\n%s", w.Body.String())
+	}
+}
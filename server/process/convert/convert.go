@@ -0,0 +1,192 @@
+/*
+Package convert implements the processor that converts uploaded images browsers
+can't display, such as TIFF and BMP, into JPEGs. The web server serves the
+converted image in place of the original. A smaller thumbnail is created at
+the same time.
+*/
+package convert
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/materials-commons/config"
+	"github.com/materials-commons/mcfs/base/mc"
+	"github.com/materials-commons/mcfs/base/mediatype"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/process"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+const (
+	// ThumbnailSize is the largest width or height of a thumbnail.
+	ThumbnailSize = 256
+
+	// jpegQuality is the quality converted images are encoded with.
+	jpegQuality = 90
+
+	// defaultMaxPixels is the largest image, in pixels, that is converted
+	// when MCFS_CONVERT_MAX_PIXELS isn't set. Decoded images are held in
+	// memory, so this bounds how much memory a conversion can take.
+	defaultMaxPixels = 50 * 1000 * 1000
+)
+
+// decoder is the pure Go decoder for an image type that is converted.
+type decoder struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}
+
+// decoders are the decoders for the image types that are converted.
+var decoders = map[string]decoder{
+	mediatype.TIFF: {tiff.Decode, tiff.DecodeConfig},
+	mediatype.BMP:  {bmp.Decode, bmp.DecodeConfig},
+	"image/bmp":    {bmp.Decode, bmp.DecodeConfig},
+}
+
+// MediaTypes are the media types the converter handles. They are the matches
+// to register the converter with.
+var MediaTypes = []string{mediatype.TIFF, mediatype.BMP, "image/bmp"}
+
+// NeedsConversion returns true if files of the given media type are converted.
+func NeedsConversion(mime string) bool {
+	_, found := decoders[mime]
+	return found
+}
+
+// ConversionPath is the path of the converted JPEG for the bytes stored under id.
+func ConversionPath(mcdir, id string) string {
+	return filepath.Join(mc.FileDirFrom(mcdir, id), ".conversion", id+".jpg")
+}
+
+// ThumbnailPath is the path of the thumbnail for the bytes stored under id.
+func ThumbnailPath(mcdir, id string) string {
+	return filepath.Join(mc.FileDirFrom(mcdir, id), ".conversion", id+".thumbnail.jpg")
+}
+
+// converter is the image conversion processor.
+type converter struct {
+	mcdir     string
+	maxPixels int64 // Read from MCFS_CONVERT_MAX_PIXELS when 0.
+}
+
+// New creates the image conversion processor. Converted images are written under
+// mcdir. When mcdir is blank MCDIR is used. The largest image converted, in
+// pixels, is read from MCFS_CONVERT_MAX_PIXELS.
+func New(mcdir string) process.Processor {
+	return converter{mcdir: mcdir}
+}
+
+// Name implements process.Processor.
+func (c converter) Name() string {
+	return "convert-image"
+}
+
+// Process implements process.Processor. It decodes the stored image and writes the
+// converted image and thumbnail. Files that share their bytes with a file that
+// was already converted are skipped, as are images with more pixels than
+// MCFS_CONVERT_MAX_PIXELS.
+func (c converter) Process(file *schema.File, svc *service.Service, st store.Store) (string, error) {
+	d, found := decoders[file.MediaType.Mime]
+	if !found {
+		return "", fmt.Errorf("can't convert media type %s", file.MediaType.Mime)
+	}
+
+	mcdir := c.mcdir
+	if mcdir == "" {
+		mcdir = config.GetString("MCDIR")
+	}
+
+	id := file.FileID()
+	conversionPath, thumbnailPath := ConversionPath(mcdir, id), ThumbnailPath(mcdir, id)
+	if exists(conversionPath) && exists(thumbnailPath) {
+		return "already converted", nil
+	}
+
+	// Check the size in the header before decoding the whole image.
+	r, err := st.ReadRange(id, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	imgConfig, err := d.decodeConfig(r)
+	r.Close()
+	if err != nil {
+		return "", err
+	}
+
+	if pixels, maxPixels := int64(imgConfig.Width)*int64(imgConfig.Height), c.pixelLimit(); pixels > maxPixels {
+		return fmt.Sprintf("skipped %dx%d image, it is larger than %d pixels", imgConfig.Width, imgConfig.Height, maxPixels), nil
+	}
+
+	r, err = st.ReadRange(id, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	img, err := d.decode(r)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeJPEG(conversionPath, img); err != nil {
+		return "", err
+	}
+
+	if err := writeJPEG(thumbnailPath, thumbnail(img, ThumbnailSize)); err != nil {
+		return "", err
+	}
+
+	bounds := img.Bounds()
+	return fmt.Sprintf("converted %dx%d image to JPEG", bounds.Dx(), bounds.Dy()), nil
+}
+
+// pixelLimit returns the largest image, in pixels, that is converted.
+func (c converter) pixelLimit() int64 {
+	switch maxPixels := config.GetInt("MCFS_CONVERT_MAX_PIXELS"); {
+	case c.maxPixels != 0:
+		return c.maxPixels
+	case maxPixels > 0:
+		return int64(maxPixels)
+	default:
+		return defaultMaxPixels
+	}
+}
+
+// exists returns true if path exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// writeJPEG encodes img to path. The image is written to a temporary file that is
+// renamed into place, so a partially written image is never served.
+func writeJPEG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = jpeg.Encode(f, img, &jpeg.Options{Quality: jpegQuality})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
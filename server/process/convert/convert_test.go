@@ -0,0 +1,137 @@
+package convert
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/mediatype"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/store"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+const (
+	tiffID = "0a6b0f23-11e3-4f5a-9cbb-0ae0b1f1a001"
+	bmpID  = "0a6b0f23-22e3-4f5a-9cbb-0ae0b1f1a002"
+	badID  = "0a6b0f23-33e3-4f5a-9cbb-0ae0b1f1a003"
+)
+
+// storeImage encodes a w x h image and stores it under id.
+func storeImage(t *testing.T, st store.Store, id string, w, h int, encode func(b *bytes.Buffer, img image.Image) error) {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+
+	var b bytes.Buffer
+	if err := encode(&b, img); err != nil {
+		t.Fatalf("Unable to encode test image: %s", err)
+	}
+
+	wc, _ := st.Append(id, 0)
+	wc.Write(b.Bytes())
+	wc.Close()
+}
+
+func encodeTIFF(b *bytes.Buffer, img image.Image) error { return tiff.Encode(b, img, nil) }
+func encodeBMP(b *bytes.Buffer, img image.Image) error  { return bmp.Encode(b, img) }
+
+// imageFile creates a file entry for the bytes stored under id.
+func imageFile(id, mime string) *schema.File {
+	file := schema.NewFile("image", "test@mc.org")
+	file.ID = id
+	file.MediaType.Mime = mime
+	return &file
+}
+
+// jpegSize returns the dimensions of the JPEG at path.
+func jpegSize(t *testing.T, path string) (int, int) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Missing converted image %s: %s", path, err)
+	}
+	defer f.Close()
+
+	config, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("Converted image %s isn't a JPEG: %s", path, err)
+	}
+	return config.Width, config.Height
+}
+
+func TestProcess(t *testing.T) {
+	mcdir, _ := ioutil.TempDir("", "convert")
+	defer os.RemoveAll(mcdir)
+
+	st := store.NewMemory()
+	storeImage(t, st, tiffID, 1024, 512, encodeTIFF)
+	storeImage(t, st, bmpID, 100, 50, encodeBMP)
+
+	c := New(mcdir)
+	if _, err := c.Process(imageFile(tiffID, mediatype.TIFF), nil, st); err != nil {
+		t.Fatalf("Unable to convert TIFF: %s", err)
+	}
+
+	if w, h := jpegSize(t, ConversionPath(mcdir, tiffID)); w != 1024 || h != 512 {
+		t.Errorf("Converted TIFF has the wrong size %dx%d", w, h)
+	}
+
+	if w, h := jpegSize(t, ThumbnailPath(mcdir, tiffID)); w != ThumbnailSize || h != ThumbnailSize/2 {
+		t.Errorf("TIFF thumbnail has the wrong size %dx%d", w, h)
+	}
+
+	if _, err := c.Process(imageFile(bmpID, mediatype.BMP), nil, st); err != nil {
+		t.Fatalf("Unable to convert BMP: %s", err)
+	}
+
+	if w, h := jpegSize(t, ThumbnailPath(mcdir, bmpID)); w != 100 || h != 50 {
+		t.Errorf("Small images shouldn't be scaled, got %dx%d", w, h)
+	}
+
+	// A duplicate of a converted file isn't converted again.
+	dup := imageFile("0a6b0f23-44e3-4f5a-9cbb-0ae0b1f1a004", mediatype.TIFF)
+	dup.UsesID = tiffID
+	if result, err := c.Process(dup, nil, st); err != nil || result != "already converted" {
+		t.Errorf("Expected duplicate to be skipped, got %q, %v", result, err)
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	mcdir, _ := ioutil.TempDir("", "convert")
+	defer os.RemoveAll(mcdir)
+
+	st := store.NewMemory()
+	c := New(mcdir)
+
+	if _, err := c.Process(imageFile(badID, mediatype.TIFF), nil, st); err == nil {
+		t.Errorf("Converted an image that isn't stored")
+	}
+
+	wc, _ := st.Append(badID, 0)
+	wc.Write([]byte("not a tiff"))
+	wc.Close()
+	if _, err := c.Process(imageFile(badID, mediatype.TIFF), nil, st); err == nil {
+		t.Errorf("Converted a corrupt image")
+	}
+
+	if _, err := c.Process(imageFile(badID, "image/jpeg"), nil, st); err == nil {
+		t.Errorf("Converted an image that doesn't need converting")
+	}
+
+	// Images larger than the limit are skipped without being decoded.
+	storeImage(t, st, tiffID, 100, 50, encodeTIFF)
+	small := converter{mcdir: mcdir, maxPixels: 100*50 - 1}
+	if result, err := small.Process(imageFile(tiffID, mediatype.TIFF), nil, st); err != nil || exists(ConversionPath(mcdir, tiffID)) {
+		t.Errorf("Expected a large image to be skipped, got %q, %v", result, err)
+	}
+
+	if NeedsConversion("image/jpeg") || !NeedsConversion(mediatype.TIFF) {
+		t.Errorf("NeedsConversion is wrong")
+	}
+}
@@ -0,0 +1,194 @@
+package extract
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/process"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// cifItems are the CIF data items that are read and the tag keys they are stored
+// under, in the order they are tagged. The space group has names in both the
+// old (symmetry) and new (space_group) CIF dictionaries.
+var cifItems = []struct {
+	item string
+	key  string
+}{
+	{"_chemical_formula_sum", "formula"},
+	{"_symmetry_space_group_name_h-m", "spacegroup"},
+	{"_space_group_name_h-m_alt", "spacegroup"},
+	{"_symmetry_int_tables_number", "spacegroup.number"},
+	{"_space_group_it_number", "spacegroup.number"},
+	{"_cell_volume", "lattice.volume"},
+	{"_chemical_name_mineral", "cif.mineral"},
+	{"_diffrn_ambient_temperature", "cif.temperature"},
+	{"_diffrn_radiation_type", "cif.radiation"},
+	{"_diffrn_radiation_wavelength", "cif.wavelength"},
+	{"_diffrn_measurement_device_type", "cif.instrument"},
+}
+
+// cellItems are the data items that describe the unit cell, in the order
+// addLattice takes them.
+var cellItems = []string{
+	"_cell_length_a", "_cell_length_b", "_cell_length_c",
+	"_cell_angle_alpha", "_cell_angle_beta", "_cell_angle_gamma",
+}
+
+// isCIFItem returns true if item is one of the data items that are read.
+func isCIFItem(item string) bool {
+	for _, cifItem := range cifItems {
+		if item == cifItem.item {
+			return true
+		}
+	}
+	for _, cellItem := range cellItems {
+		if item == cellItem {
+			return true
+		}
+	}
+	return false
+}
+
+// CIF creates the processor that extracts the composition, space group, unit
+// cell and experimental conditions from Crystallographic Information Files.
+func CIF() process.Processor {
+	return extractor{name: "extract-cif", extract: extractCIF}
+}
+
+// extractCIF reads the single valued data items of the first data block in a
+// CIF file. Looped items, such as atom sites, are skipped.
+func extractCIF(file *schema.File, st store.Store) ([]schema.Tag, error) {
+	var (
+		values  = make(map[string]string)
+		pending string // item whose value is on the next line
+		blocks  int
+		inText  bool
+	)
+
+	err := eachLine(file, st, func(line string) bool {
+		// Semicolon delimited text fields can hold anything, including lines
+		// that look like data items.
+		if strings.HasPrefix(line, ";") {
+			inText = !inText
+			pending = ""
+			return true
+		}
+		if inText {
+			return true
+		}
+
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			return true
+		case strings.HasPrefix(lower, "data_"):
+			blocks++
+			return blocks == 1
+		case strings.HasPrefix(lower, "loop_"):
+			pending = ""
+			return true
+		case pending != "":
+			if !strings.HasPrefix(line, "_") {
+				setCIFValue(values, pending, line)
+			}
+			pending = ""
+		}
+
+		if !strings.HasPrefix(line, "_") {
+			return true
+		}
+
+		item, value := line, ""
+		if i := strings.IndexAny(line, " \t"); i != -1 {
+			item, value = line[:i], strings.TrimSpace(line[i:])
+		}
+		item = strings.ToLower(item)
+		switch {
+		case !isCIFItem(item):
+		case value == "":
+			pending = item
+		default:
+			setCIFValue(values, item, value)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cifMetadata(values), nil
+}
+
+// setCIFValue stores the value of an item, keeping the first value seen.
+func setCIFValue(values map[string]string, item, value string) {
+	if _, found := values[item]; found {
+		return
+	}
+
+	value = unquoteCIF(strings.TrimSpace(value))
+	if value == "?" || value == "." {
+		return
+	}
+	values[item] = value
+}
+
+// unquoteCIF removes the quotes from a quoted CIF value.
+func unquoteCIF(value string) string {
+	if len(value) >= 2 {
+		first, last := value[0], value[len(value)-1]
+		if (first == '\'' || first == '"') && first == last {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// cifNumber parses a CIF number, dropping the standard uncertainty, so that
+// 5.0346(2) is 5.0346.
+func cifNumber(value string) (float64, bool) {
+	if i := strings.Index(value, "("); i != -1 {
+		value = value[:i]
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	return f, err == nil
+}
+
+// cifMetadata turns the data item values into tags. Numbers are written without
+// their uncertainty so they can be compared with the values from other formats.
+func cifMetadata(values map[string]string) []schema.Tag {
+	var m metadata
+
+	for _, cifItem := range cifItems {
+		value, found := values[cifItem.item]
+		if !found {
+			continue
+		}
+
+		switch cifItem.key {
+		case "formula":
+			value = normalizeFormula(value)
+		case "spacegroup":
+			value = strings.Join(strings.Fields(value), " ")
+		default:
+			if f, ok := cifNumber(value); ok {
+				value = formatFloat(f)
+			}
+		}
+		m.add(cifItem.key, value)
+	}
+
+	var cell []float64
+	for _, item := range cellItems {
+		if f, ok := cifNumber(values[item]); ok {
+			cell = append(cell, f)
+		}
+	}
+	if len(cell) == len(cellItems) {
+		m.addLattice(cell[0], cell[1], cell[2], cell[3], cell[4], cell[5])
+	}
+
+	return m.tags
+}
@@ -0,0 +1,139 @@
+/*
+Package extract implements the processors that pull scientific metadata out of
+common materials science file formats. The metadata is stored as public tags
+on the datafile, so it can be searched with the tag and lookup requests.
+
+Tag keys are shared between formats where the meaning is the same, so a search
+for a composition or lattice finds both CIF and VASP structures:
+
+	formula          reduced chemical formula, eg Fe2O3
+	spacegroup       Hermann-Mauguin space group symbol
+	spacegroup.number
+	lattice.a, lattice.b, lattice.c              cell lengths in Angstroms
+	lattice.alpha, lattice.beta, lattice.gamma   cell angles in degrees
+	lattice.volume   cell volume in cubic Angstroms
+
+Format specific keys start with the format name, such as vasp.encut or the
+hdf5.<name> keys holding the attributes on the root group of an HDF5 file.
+*/
+package extract
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// maxLineLength is the longest line the text format extractors will read.
+const maxLineLength = 1024 * 1024
+
+// extractFunc reads the metadata from a stored file.
+type extractFunc func(file *schema.File, st store.Store) ([]schema.Tag, error)
+
+// extractor is a process.Processor that stores the tags returned by its
+// extractFunc on the file.
+type extractor struct {
+	name    string
+	extract extractFunc
+}
+
+// Name implements process.Processor.
+func (e extractor) Name() string {
+	return e.name
+}
+
+// Process implements process.Processor. Extracted tags replace the public tags
+// with the same keys, so running it again on the same file is safe. The file
+// is read again before its tags are updated, since file may be the copy from
+// when the job was queued.
+func (e extractor) Process(file *schema.File, svc *service.Service, st store.Store) (string, error) {
+	tags, err := e.extract(file, st)
+	switch {
+	case err != nil:
+		return "", err
+	case len(tags) == 0:
+		return "no metadata found", nil
+	}
+
+	current, err := svc.File.ByID(file.ID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, tag := range tags {
+		current.Tags = schema.Tags.Set(current.Tags, tag)
+	}
+
+	if err := svc.File.UpdateTags(current); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("extracted %d tags", len(tags)), nil
+}
+
+// metadata collects the tags found in a file. The first value found for a key
+// is kept and blank values are ignored.
+type metadata struct {
+	tags []schema.Tag
+	seen map[string]bool
+}
+
+// add adds a public tag for key.
+func (m *metadata) add(key, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" || m.seen[key] {
+		return
+	}
+
+	if m.seen == nil {
+		m.seen = make(map[string]bool)
+	}
+	m.seen[key] = true
+	m.tags = append(m.tags, schema.Tag{Key: key, Value: value})
+}
+
+// set adds a public tag for key, replacing any earlier value. It is used for
+// values such as energies where the last one in the file is wanted.
+func (m *metadata) set(key, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	if m.seen[key] {
+		m.tags, _ = schema.Tags.Remove(m.tags, key, "")
+		m.seen[key] = false
+	}
+	m.add(key, value)
+}
+
+// eachLine calls fn with each line of a stored file until fn returns false.
+func eachLine(file *schema.File, st store.Store, fn func(line string) bool) error {
+	r, err := st.ReadRange(file.FileID(), 0, -1)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			break
+		}
+	}
+
+	return scanner.Err()
+}
+
+// formatFloat formats a computed value with at most 4 decimal places.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 4, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
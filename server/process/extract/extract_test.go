@@ -0,0 +1,262 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// storeFile stores contents and returns a file entry for them named name.
+func storeFile(st store.Store, name, contents string) *schema.File {
+	file := schema.NewFile(name, "test@mc.org")
+	file.ID = name + "-id"
+	wc, _ := st.Append(file.FileID(), 0)
+	wc.Write([]byte(contents))
+	wc.Close()
+	return &file
+}
+
+// checkTags checks that tags contains expected, a map of keys to values.
+func checkTags(t *testing.T, what string, tags []schema.Tag, expected map[string]string) {
+	found := make(map[string]string)
+	for _, tag := range tags {
+		if tag.User != "" {
+			t.Errorf("%s: extracted tag %s should be public, got user %s", what, tag.Key, tag.User)
+		}
+		found[tag.Key] = tag.Value
+	}
+
+	for key, value := range expected {
+		if found[key] != value {
+			t.Errorf("%s: expected %s = %q, got %q", what, key, value, found[key])
+		}
+	}
+}
+
+func TestFormula(t *testing.T) {
+	tests := []struct {
+		formula  string
+		expected string
+	}{
+		{"Fe2 O3", "Fe2O3"},
+		{"Fe4 O6", "Fe2O3"},
+		{"'Si O2'", "SiO2"},
+		{"C6H12O6", "CH2O"},
+		{"Ni3 Al1", "Ni3Al"},
+		{"Fe0.5 Co0.5", "Fe0.5Co0.5"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if f := normalizeFormula(test.formula); f != test.expected {
+			t.Errorf("normalizeFormula(%q) = %q, expected %q", test.formula, f, test.expected)
+		}
+	}
+}
+
+const testCIF = `#\#CIF_2.0
+data_hematite
+_chemical_name_mineral 'Hematite'
+_chemical_formula_sum 'Fe2 O3'
+_symmetry_space_group_name_H-M 'R -3 c'
+_symmetry_Int_Tables_number 167
+_cell_length_a 5.0356(1)
+_cell_length_b 5.0356(1)
+_cell_length_c 13.7489(7)
+_cell_angle_alpha 90
+_cell_angle_beta 90
+_cell_angle_gamma 120
+_diffrn_ambient_temperature
+  295
+_publ_section_title
+;
+_cell_length_a 1.0
+;
+loop_
+_atom_site_label
+_atom_site_fract_x
+Fe1 0.0
+O1 0.3059
+data_second
+_chemical_formula_sum 'Si O2'
+`
+
+func TestCIF(t *testing.T) {
+	st := store.NewMemory()
+	tags, err := extractCIF(storeFile(st, "hematite.cif", testCIF), st)
+	if err != nil {
+		t.Fatalf("extractCIF failed: %s", err)
+	}
+
+	checkTags(t, "CIF", tags, map[string]string{
+		"formula":           "Fe2O3",
+		"spacegroup":        "R -3 c",
+		"spacegroup.number": "167",
+		"lattice.a":         "5.0356",
+		"lattice.b":         "5.0356",
+		"lattice.c":         "13.7489",
+		"lattice.gamma":     "120",
+		"lattice.volume":    "301.9264",
+		"cif.mineral":       "Hematite",
+		"cif.temperature":   "295",
+	})
+}
+
+const testPOSCAR = `Fe O
+1.0
+  5.0356000000  0.0000000000  0.0000000000
+ -2.5178000000  4.3609564260  0.0000000000
+  0.0000000000  0.0000000000 13.7489000000
+Fe O
+12 18
+Direct
+`
+
+const testPOSCAR4 = `Fe O
+-301.9263
+  5.0356000000  0.0000000000  0.0000000000
+ -2.5178000000  4.3609564260  0.0000000000
+  0.0000000000  0.0000000000 13.7489000000
+12 18
+Direct
+`
+
+const testOUTCAR = ` vasp.6.3.0 18Jan22 (build Feb 09 2022) complex
+   VRHFIN =Fe: d7 s1
+   VRHFIN =O: s2p4
+   ions per type =              12  18
+   number of dos      NEDOS =    301   number of ions     NIONS =     30
+   ENCUT  =  520.0 eV  38.22 Ry    6.18 a.u.
+   ISPIN  =      2    spin polarized calculation?
+      direct lattice vectors                 reciprocal lattice vectors
+     1.000000000  0.000000000  0.000000000     1.000000000  0.000000000  0.000000000
+     0.000000000  1.000000000  0.000000000     0.000000000  1.000000000  0.000000000
+     0.000000000  0.000000000  1.000000000     0.000000000  0.000000000  1.000000000
+  free  energy   TOTEN  =      -190.10000000 eV
+      direct lattice vectors                 reciprocal lattice vectors
+     5.035600000  0.000000000  0.000000000     0.198586067  0.114653000  0.000000000
+    -2.517800000  4.360956426  0.000000000     0.000000000  0.229306001  0.000000000
+     0.000000000  0.000000000 13.748900000     0.000000000  0.000000000  0.072733092
+  free  energy   TOTEN  =      -198.28476213 eV
+`
+
+const testINCAR = `SYSTEM = hematite
+ENCUT = 520 # plane wave cutoff
+ISPIN = 2 ; MAGMOM = 12*5 18*0
+! a comment = not a setting
+`
+
+func TestVASP(t *testing.T) {
+	lattice := map[string]string{
+		"lattice.a":      "5.0356",
+		"lattice.c":      "13.7489",
+		"lattice.alpha":  "90",
+		"lattice.gamma":  "120",
+		"lattice.volume": "301.9263",
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		expected map[string]string
+	}{
+		{"POSCAR", testPOSCAR, lattice},
+		{"CONTCAR_relaxed", testPOSCAR4, lattice},
+		{"OUTCAR", testOUTCAR, lattice},
+		{"POSCAR", testPOSCAR, map[string]string{"formula": "Fe2O3"}},
+		{"POSCAR.vasp4", testPOSCAR4, map[string]string{"formula": "Fe2O3"}},
+		{"OUTCAR.300K", testOUTCAR, map[string]string{
+			"formula":      "Fe2O3",
+			"vasp.version": "6.3.0",
+			"vasp.encut":   "520.0",
+			"vasp.ispin":   "2",
+			"vasp.nions":   "30",
+			"vasp.energy":  "-198.28476213",
+		}},
+		{"INCAR", testINCAR, map[string]string{
+			"vasp.system": "hematite",
+			"vasp.encut":  "520",
+			"vasp.ispin":  "2",
+			"vasp.magmom": "12*5 18*0",
+		}},
+	}
+
+	st := store.NewMemory()
+	for _, test := range tests {
+		tags, err := extractVASP(storeFile(st, test.name, test.contents), st)
+		if err != nil {
+			t.Fatalf("%s: extractVASP failed: %s", test.name, err)
+		}
+		checkTags(t, test.name, tags, test.expected)
+	}
+
+	tags, _ := extractVASP(storeFile(st, "INCAR", testINCAR), st)
+	for _, tag := range tags {
+		if strings.Contains(tag.Key, "comment") {
+			t.Errorf("INCAR comment tagged as a setting: %v", tag)
+		}
+	}
+
+	tags, err := extractVASP(storeFile(st, "KPOINTS", "Automatic\n0\nGamma\n4 4 4\n"), st)
+	if err != nil || len(tags) != 0 {
+		t.Errorf("Expected no tags for KPOINTS, got %v, %v", tags, err)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	svc := service.NewMemory()
+	st := store.NewMemory()
+
+	file := storeFile(st, "hematite.cif", testCIF)
+	file.Tags = []schema.Tag{
+		{Key: "formula", Value: "wrong"},
+		{Key: "formula", Value: "mine", User: "test@mc.org"},
+	}
+	f, err := svc.File.InsertEntry(file)
+	if err != nil {
+		t.Fatalf("Unable to insert file: %s", err)
+	}
+
+	// Changes made after the job was queued are kept.
+	stale := *f
+	f.Current = false
+	f.Tags = append(f.Tags, schema.Tag{Key: "added", Value: "later"})
+	svc.File.Update(f)
+
+	p := CIF()
+	for i := 0; i < 2; i++ {
+		if _, err := p.Process(&stale, svc, st); err != nil {
+			t.Fatalf("Process failed: %s", err)
+		}
+	}
+
+	f, _ = svc.File.ByID(f.ID)
+	if f.Current || !schema.Tags.Match(f.Tags, "added", "later", "") {
+		t.Errorf("Process undid changes made after the job was queued: %#v", f)
+	}
+	if !schema.Tags.Match(f.Tags, "formula", "Fe2O3", "") {
+		t.Errorf("Extracted formula not stored: %v", f.Tags)
+	}
+	if !schema.Tags.Match(f.Tags, "formula", "mine", "test@mc.org") {
+		t.Errorf("Users private tag was replaced: %v", f.Tags)
+	}
+
+	formulas := 0
+	for _, tag := range f.Tags {
+		if tag.Key == "formula" && tag.User == "" {
+			formulas++
+		}
+	}
+	if formulas != 1 {
+		t.Errorf("Expected a single public formula tag after running twice, got %d", formulas)
+	}
+
+	empty := storeFile(st, "empty.cif", "")
+	result, err := p.Process(empty, svc, st)
+	if err != nil || result != "no metadata found" {
+		t.Errorf("Expected no metadata for an empty file, got %q, %v", result, err)
+	}
+}
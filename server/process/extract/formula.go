@@ -0,0 +1,100 @@
+package extract
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// elementCount matches an element symbol and its optional count, such as Fe2 or O.
+var elementCount = regexp.MustCompile(`([A-Z][a-z]?)([0-9]*\.?[0-9]*)`)
+
+// parseFormula turns a formula such as "Fe2 O3" or "Fe4O6" into its elements, in
+// the order they first appear, and their counts.
+func parseFormula(formula string) (elements []string, counts []float64) {
+	index := make(map[string]int)
+	for _, match := range elementCount.FindAllStringSubmatch(formula, -1) {
+		count := 1.0
+		if match[2] != "" {
+			c, err := strconv.ParseFloat(match[2], 64)
+			if err != nil {
+				return nil, nil
+			}
+			count = c
+		}
+
+		if i, found := index[match[1]]; found {
+			counts[i] += count
+			continue
+		}
+		index[match[1]] = len(elements)
+		elements = append(elements, match[1])
+		counts = append(counts, count)
+	}
+
+	return elements, counts
+}
+
+// formula writes the reduced formula for a composition, so that a unit cell with
+// 4 Fe and 6 O gives Fe2O3. Counts of 1 are left off. Compositions with
+// fractional counts aren't reduced.
+func formula(elements []string, counts []float64) string {
+	if len(elements) == 0 || len(elements) != len(counts) {
+		return ""
+	}
+
+	divisor := 0
+	for _, count := range counts {
+		if count <= 0 || count != math.Trunc(count) {
+			divisor = 1
+			break
+		}
+		divisor = gcd(divisor, int(count))
+	}
+
+	var s []string
+	for i, element := range elements {
+		count := counts[i] / float64(divisor)
+		if count == 1 {
+			s = append(s, element)
+		} else {
+			s = append(s, element+formatFloat(count))
+		}
+	}
+
+	return strings.Join(s, "")
+}
+
+// normalizeFormula reduces a formula as written in a file, eg "Fe4 O6" becomes Fe2O3.
+func normalizeFormula(f string) string {
+	return formula(parseFormula(f))
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// addLattice adds the lattice tags for a cell given by its lengths and angles.
+// The volume is computed from them.
+func (m *metadata) addLattice(a, b, c, alpha, beta, gamma float64) {
+	m.add("lattice.a", formatFloat(a))
+	m.add("lattice.b", formatFloat(b))
+	m.add("lattice.c", formatFloat(c))
+	m.add("lattice.alpha", formatFloat(alpha))
+	m.add("lattice.beta", formatFloat(beta))
+	m.add("lattice.gamma", formatFloat(gamma))
+
+	ca, cb, cg := cosDegrees(alpha), cosDegrees(beta), cosDegrees(gamma)
+	v := 1 - ca*ca - cb*cb - cg*cg + 2*ca*cb*cg
+	if v > 0 {
+		m.add("lattice.volume", formatFloat(a*b*c*math.Sqrt(v)))
+	}
+}
+
+func cosDegrees(d float64) float64 {
+	return math.Cos(d * math.Pi / 180)
+}
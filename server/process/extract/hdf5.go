@@ -0,0 +1,609 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/process"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// HDF5 creates the processor that extracts the header and the attributes on the
+// root group of HDF5 files. Instruments and analysis codes commonly record their
+// settings as root attributes. Each attribute is tagged as hdf5.<name>.
+//
+// Only the parts of the format needed to read the root group's object header
+// are implemented, so no HDF5 library is needed.
+func HDF5() process.Processor {
+	return extractor{name: "extract-hdf5", extract: extractHDF5}
+}
+
+const (
+	// hdf5MaxValues is the largest number of values an attribute can have and
+	// still be tagged. Larger attributes are data rather than settings.
+	hdf5MaxValues = 16
+
+	// hdf5MaxBlock is the largest header block or heap collection that is read.
+	hdf5MaxBlock = 1024 * 1024
+
+	// hdf5MaxBlocks limits the header continuation blocks followed.
+	hdf5MaxBlocks = 64
+
+	// hdf5MaxUserBlock is the furthest into a file the superblock is looked for.
+	hdf5MaxUserBlock = 64 * 1024 * 1024
+)
+
+// Header message types.
+const (
+	hdf5MsgAttribute    = 0x0c
+	hdf5MsgContinuation = 0x10
+)
+
+// Datatype classes.
+const (
+	hdf5FixedPoint     = 0
+	hdf5FloatingPoint  = 1
+	hdf5String         = 3
+	hdf5VariableLength = 9
+)
+
+var (
+	hdf5Signature = []byte("\x89HDF\r\n\x1a\n")
+	errHDF5       = errors.New("corrupt HDF5 file")
+)
+
+// extractHDF5 reads the superblock and the root group attributes.
+func extractHDF5(file *schema.File, st store.Store) ([]schema.Tag, error) {
+	info, err := st.Stat(file.FileID())
+	if err != nil {
+		return nil, err
+	}
+
+	h := &hdf5{
+		r:    &storeReaderAt{store: st, id: file.FileID()},
+		size: info.Size,
+	}
+	if err := h.readSuperblock(); err != nil {
+		return nil, err
+	}
+
+	var m metadata
+	m.add("hdf5.superblock", strconv.Itoa(h.version))
+
+	attributes, err := h.rootAttributes()
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attributes {
+		m.add("hdf5."+attr.name, attr.value)
+	}
+
+	return m.tags, nil
+}
+
+// storeReaderAt reads ranges of a stored object.
+type storeReaderAt struct {
+	store store.Store
+	id    string
+}
+
+// ReadAt implements io.ReaderAt.
+func (s *storeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r, err := s.store.ReadRange(s.id, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.ReadFull(r, p)
+}
+
+// hdf5 reads the structures of an HDF5 file. Addresses in the file are relative
+// to base, and are offsetSize bytes long. Lengths are lengthSize bytes long.
+type hdf5 struct {
+	r          io.ReaderAt
+	size       int64
+	version    int
+	offsetSize int
+	lengthSize int
+	base       uint64
+	root       uint64
+}
+
+// hdf5Attribute is an attribute with its value written as a string.
+type hdf5Attribute struct {
+	name  string
+	value string
+}
+
+// hdf5Message is a message in an object header.
+type hdf5Message struct {
+	msgType int
+	data    []byte
+}
+
+// read reads n bytes at addr. Short reads are errors.
+func (h *hdf5) read(addr uint64, n int) ([]byte, error) {
+	off := int64(h.base + addr)
+	if n < 0 || n > hdf5MaxBlock || off < 0 || off+int64(n) > h.size {
+		return nil, errHDF5
+	}
+
+	b := make([]byte, n)
+	if _, err := h.r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readPrefix reads up to n bytes at addr, stopping at the end of the file. It is
+// used to read headers whose length isn't known until they are decoded.
+func (h *hdf5) readPrefix(addr uint64, n int) ([]byte, error) {
+	if left := h.size - int64(h.base+addr); left >= 0 && left < int64(n) {
+		n = int(left)
+	}
+	return h.read(addr, n)
+}
+
+// readSuperblock finds and reads the superblock. It is at the start of the file,
+// or at a power of two offset from 512 bytes when there is a user block.
+func (h *hdf5) readSuperblock() error {
+	for at := int64(0); at < hdf5MaxUserBlock && at < h.size; at = nextSuperblock(at) {
+		n := int64(96)
+		if at+n > h.size {
+			n = h.size - at
+		}
+		b := make([]byte, n)
+		if _, err := h.r.ReadAt(b, at); err != nil {
+			return err
+		}
+		if bytes.HasPrefix(b, hdf5Signature) {
+			return h.parseSuperblock(b)
+		}
+	}
+
+	return fmt.Errorf("no HDF5 superblock found")
+}
+
+func nextSuperblock(at int64) int64 {
+	if at == 0 {
+		return 512
+	}
+	return at * 2
+}
+
+// parseSuperblock reads the sizes and addresses needed to find the root group.
+func (h *hdf5) parseSuperblock(b []byte) error {
+	c := &cursor{b: b}
+	c.skip(len(hdf5Signature))
+	h.version = int(c.u8())
+
+	switch h.version {
+	case 0, 1:
+		c.skip(4) // free space, root group and shared header versions, reserved
+		h.offsetSize, h.lengthSize = int(c.u8()), int(c.u8())
+		c.skip(1 + 2 + 2 + 4) // reserved, group K values, flags
+		if h.version == 1 {
+			c.skip(4) // indexed storage K, reserved
+		}
+		h.base = c.uint(h.offsetSize)
+		c.skip(3 * h.offsetSize) // free space, end of file and driver addresses
+		c.skip(h.offsetSize)     // root group link name offset
+		h.root = c.uint(h.offsetSize)
+
+	case 2, 3:
+		h.offsetSize, h.lengthSize = int(c.u8()), int(c.u8())
+		c.skip(1) // flags
+		h.base = c.uint(h.offsetSize)
+		c.skip(2 * h.offsetSize) // extension and end of file addresses
+		h.root = c.uint(h.offsetSize)
+
+	default:
+		return fmt.Errorf("unsupported HDF5 superblock version %d", h.version)
+	}
+
+	if c.err != nil || !validSize(h.offsetSize) || !validSize(h.lengthSize) {
+		return errHDF5
+	}
+	return nil
+}
+
+func validSize(n int) bool {
+	return n == 2 || n == 4 || n == 8
+}
+
+// rootAttributes reads the attributes in the root group's object header.
+// Attributes stored densely, outside the header, aren't read.
+func (h *hdf5) rootAttributes() ([]hdf5Attribute, error) {
+	messages, err := h.objectHeader(h.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes []hdf5Attribute
+	for _, msg := range messages {
+		if msg.msgType != hdf5MsgAttribute {
+			continue
+		}
+		if attr, ok := h.attribute(msg.data); ok {
+			attributes = append(attributes, attr)
+		}
+	}
+
+	return attributes, nil
+}
+
+// objectHeader reads the messages of the object header at addr, following
+// continuation messages.
+func (h *hdf5) objectHeader(addr uint64) ([]hdf5Message, error) {
+	prefix, err := h.readPrefix(addr, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(prefix, []byte("OHDR")):
+		return h.objectHeaderV2(addr)
+	case len(prefix) < 16:
+		return nil, errHDF5
+	case prefix[0] != 1:
+		return nil, fmt.Errorf("unsupported HDF5 object header version %d", prefix[0])
+	}
+
+	// Version 1 headers have a 16 byte prefix, and messages aligned to 8 bytes.
+	c := &cursor{b: prefix}
+	c.skip(4) // version, reserved, number of messages
+	c.skip(4) // reference count
+	size := c.u32()
+
+	var (
+		messages []hdf5Message
+		blocks   = []block{{addr + 16, uint64(size)}}
+	)
+	for i := 0; i < len(blocks) && i < hdf5MaxBlocks; i++ {
+		b, err := h.read(blocks[i].addr, int(blocks[i].length))
+		if err != nil {
+			return nil, err
+		}
+
+		c := &cursor{b: b}
+		for c.remaining() >= 8 {
+			msgType, msgSize := int(c.u16()), int(c.u16())
+			c.skip(4) // flags, reserved
+			data := c.bytes(msgSize)
+			if c.err != nil {
+				return nil, errHDF5
+			}
+			messages, blocks = h.addMessage(messages, blocks, msgType, data)
+		}
+	}
+
+	return messages, nil
+}
+
+// block is a range of the file holding header messages.
+type block struct {
+	addr   uint64
+	length uint64
+}
+
+// objectHeaderV2 reads a version 2 object header. Continuation blocks start with
+// OCHK, and blocks end with a checksum.
+func (h *hdf5) objectHeaderV2(addr uint64) ([]hdf5Message, error) {
+	prefix, err := h.readPrefix(addr, 34)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cursor{b: prefix}
+	c.skip(5) // signature, version
+	flags := c.u8()
+	if flags&0x20 != 0 {
+		c.skip(16) // times
+	}
+	if flags&0x10 != 0 {
+		c.skip(4) // attribute storage phase change values
+	}
+	size := c.uint(1 << (flags & 0x03))
+	trackOrder := flags&0x04 != 0
+
+	var (
+		messages []hdf5Message
+		blocks   = []block{{addr + uint64(c.p), size}}
+	)
+	for i := 0; i < len(blocks) && i < hdf5MaxBlocks; i++ {
+		b, err := h.read(blocks[i].addr, int(blocks[i].length))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			if !bytes.HasPrefix(b, []byte("OCHK")) || len(b) < 8 {
+				return nil, errHDF5
+			}
+			b = b[4 : len(b)-4]
+		}
+
+		c := &cursor{b: b}
+		headerSize := 4
+		if trackOrder {
+			headerSize = 6
+		}
+		for c.remaining() >= headerSize {
+			msgType, msgSize := int(c.u8()), int(c.u16())
+			c.skip(headerSize - 3) // flags, creation order
+			data := c.bytes(msgSize)
+			if c.err != nil {
+				return nil, errHDF5
+			}
+			messages, blocks = h.addMessage(messages, blocks, msgType, data)
+		}
+	}
+
+	return messages, nil
+}
+
+// addMessage adds a header message, or the block a continuation message points to.
+func (h *hdf5) addMessage(messages []hdf5Message, blocks []block, msgType int, data []byte) ([]hdf5Message, []block) {
+	if msgType != hdf5MsgContinuation {
+		return append(messages, hdf5Message{msgType: msgType, data: data}), blocks
+	}
+
+	c := &cursor{b: data}
+	addr, length := c.uint(h.offsetSize), c.uint(h.lengthSize)
+	if c.err != nil {
+		return messages, blocks
+	}
+	return messages, append(blocks, block{addr, length})
+}
+
+// attribute decodes an attribute message. Attributes with types that can't be
+// written as a string, or with too many values, are skipped.
+func (h *hdf5) attribute(data []byte) (hdf5Attribute, bool) {
+	c := &cursor{b: data}
+	version := c.u8()
+	c.skip(1) // reserved or flags
+	nameSize, typeSize, spaceSize := int(c.u16()), int(c.u16()), int(c.u16())
+	if version == 3 {
+		c.skip(1) // name character set
+	}
+
+	// Version 1 pads each part to a multiple of 8 bytes.
+	pad := func(n int) int {
+		if version == 1 {
+			return (n + 7) &^ 7
+		}
+		return n
+	}
+
+	name := c.bytes(pad(nameSize))
+	datatype := c.bytes(pad(typeSize))
+	dataspace := c.bytes(pad(spaceSize))
+	if c.err != nil || version < 1 || version > 3 {
+		return hdf5Attribute{}, false
+	}
+
+	count, ok := h.elements(dataspace)
+	if !ok || count == 0 || count > hdf5MaxValues {
+		return hdf5Attribute{}, false
+	}
+
+	values, ok := h.values(datatype[:typeSize], count, c.b[c.p:])
+	if !ok {
+		return hdf5Attribute{}, false
+	}
+
+	return hdf5Attribute{
+		name:  strings.TrimRight(string(name[:nameSize]), "\x00"),
+		value: strings.Join(values, ", "),
+	}, true
+}
+
+// elements returns the number of elements in a dataspace.
+func (h *hdf5) elements(dataspace []byte) (int, bool) {
+	c := &cursor{b: dataspace}
+	version, rank, _ := c.u8(), int(c.u8()), c.u8()
+	switch version {
+	case 1:
+		c.skip(5) // reserved
+	case 2:
+		if c.u8() == 2 { // null dataspace
+			return 0, true
+		}
+	default:
+		return 0, false
+	}
+
+	count := uint64(1)
+	for i := 0; i < rank; i++ {
+		count *= c.uint(h.lengthSize)
+		if count > hdf5MaxValues {
+			return 0, false
+		}
+	}
+
+	return int(count), c.err == nil
+}
+
+// values decodes count elements of datatype from data.
+func (h *hdf5) values(datatype []byte, count int, data []byte) ([]string, bool) {
+	c := &cursor{b: datatype}
+	classAndVersion := c.u8()
+	bits := c.bytes(3)
+	size := int(c.u32())
+	if c.err != nil {
+		return nil, false
+	}
+
+	class := int(classAndVersion & 0x0f)
+	var order binary.ByteOrder = binary.LittleEndian
+	if bits[0]&0x01 != 0 && class != hdf5String && class != hdf5VariableLength {
+		order = binary.BigEndian
+	}
+
+	elementSize := size
+	if class == hdf5VariableLength {
+		if bits[0]&0x0f != 1 { // only variable length strings
+			return nil, false
+		}
+		elementSize = 4 + h.offsetSize + 4
+	}
+	if elementSize <= 0 || len(data) < count*elementSize {
+		return nil, false
+	}
+
+	var values []string
+	for i := 0; i < count; i++ {
+		element := data[i*elementSize : (i+1)*elementSize]
+		value, ok := h.value(class, bits[0], order, element)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+// value decodes a single element.
+func (h *hdf5) value(class int, bits byte, order binary.ByteOrder, element []byte) (string, bool) {
+	switch class {
+	case hdf5FixedPoint:
+		signed := bits&0x08 != 0
+		var u uint64
+		switch len(element) {
+		case 1:
+			u = uint64(element[0])
+			if signed {
+				return strconv.FormatInt(int64(int8(u)), 10), true
+			}
+		case 2:
+			u = uint64(order.Uint16(element))
+			if signed {
+				return strconv.FormatInt(int64(int16(u)), 10), true
+			}
+		case 4:
+			u = uint64(order.Uint32(element))
+			if signed {
+				return strconv.FormatInt(int64(int32(u)), 10), true
+			}
+		case 8:
+			u = order.Uint64(element)
+			if signed {
+				return strconv.FormatInt(int64(u), 10), true
+			}
+		default:
+			return "", false
+		}
+		return strconv.FormatUint(u, 10), true
+
+	case hdf5FloatingPoint:
+		switch len(element) {
+		case 4:
+			f := math.Float32frombits(order.Uint32(element))
+			return strconv.FormatFloat(float64(f), 'g', -1, 32), true
+		case 8:
+			f := math.Float64frombits(order.Uint64(element))
+			return strconv.FormatFloat(f, 'g', -1, 64), true
+		}
+		return "", false
+
+	case hdf5String:
+		return strings.TrimRight(string(element), "\x00 "), true
+
+	case hdf5VariableLength:
+		c := &cursor{b: element}
+		c.skip(4) // length
+		collection, index := c.uint(h.offsetSize), c.u32()
+		b, ok := h.heapObject(collection, index)
+		return strings.TrimRight(string(b), "\x00"), ok
+	}
+
+	return "", false
+}
+
+// heapObject reads an object from a global heap collection.
+func (h *hdf5) heapObject(addr uint64, index uint32) ([]byte, bool) {
+	prefix, err := h.read(addr, 8+h.lengthSize)
+	if err != nil || !bytes.HasPrefix(prefix, []byte("GCOL")) {
+		return nil, false
+	}
+
+	size := (&cursor{b: prefix[8:]}).uint(h.lengthSize)
+	b, err := h.read(addr, int(size))
+	if err != nil {
+		return nil, false
+	}
+
+	c := &cursor{b: b, p: 8 + h.lengthSize}
+	for c.remaining() >= 8+h.lengthSize {
+		objIndex := c.u16()
+		c.skip(2 + 4) // reference count, reserved
+		objSize := int(c.uint(h.lengthSize))
+		if objIndex == 0 { // free space
+			return nil, false
+		}
+		data := c.bytes((objSize + 7) &^ 7)
+		if c.err != nil {
+			return nil, false
+		}
+		if uint32(objIndex) == index {
+			return data[:objSize], true
+		}
+	}
+
+	return nil, false
+}
+
+// cursor decodes little endian values from a buffer. Reading past the end of the
+// buffer sets err, and returns zero values.
+type cursor struct {
+	b   []byte
+	p   int
+	err error
+}
+
+func (c *cursor) remaining() int {
+	return len(c.b) - c.p
+}
+
+func (c *cursor) bytes(n int) []byte {
+	if c.err != nil || n < 0 || n > c.remaining() {
+		c.err = errHDF5
+		return nil
+	}
+	b := c.b[c.p : c.p+n]
+	c.p += n
+	return b
+}
+
+func (c *cursor) skip(n int) {
+	c.bytes(n)
+}
+
+func (c *cursor) u8() byte {
+	return byte(c.uint(1))
+}
+
+func (c *cursor) u16() uint16 {
+	return uint16(c.uint(2))
+}
+
+func (c *cursor) u32() uint32 {
+	return uint32(c.uint(4))
+}
+
+// uint decodes an n byte unsigned integer.
+func (c *cursor) uint(n int) uint64 {
+	b := c.bytes(n)
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	return u
+}
@@ -0,0 +1,205 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// h5 builds the little endian structures of a test HDF5 file. Addresses and
+// lengths are 8 bytes.
+type h5 struct {
+	bytes.Buffer
+}
+
+func (b *h5) u8(v ...byte) *h5 {
+	b.Write(v)
+	return b
+}
+
+func (b *h5) u16(v uint16) *h5 {
+	binary.Write(b, binary.LittleEndian, v)
+	return b
+}
+
+func (b *h5) u32(v uint32) *h5 {
+	binary.Write(b, binary.LittleEndian, v)
+	return b
+}
+
+func (b *h5) u64(v uint64) *h5 {
+	binary.Write(b, binary.LittleEndian, v)
+	return b
+}
+
+// pad pads to a multiple of n bytes.
+func (b *h5) pad(n int) *h5 {
+	for b.Len()%n != 0 {
+		b.WriteByte(0)
+	}
+	return b
+}
+
+// padTo pads to size bytes.
+func (b *h5) padTo(size int) *h5 {
+	for b.Len() < size {
+		b.WriteByte(0)
+	}
+	return b
+}
+
+const undefinedAddress = math.MaxUint64
+
+// Datatypes and dataspaces used by the test attributes.
+var (
+	h5String = func(size uint32) []byte {
+		return new(h5).u8(0x13, 0, 0, 0).u32(size).Bytes()
+	}
+	h5Int32   = new(h5).u8(0x10, 0x08, 0, 0).u32(4).u16(0).u16(32).Bytes()
+	h5Float64 = new(h5).u8(0x11, 0x20, 63, 0).u32(8).
+			u16(0).u16(64).u8(52, 11, 0, 52).u32(1023).Bytes()
+	h5VlenString = new(h5).u8(0x19, 0x01, 0, 0).u32(16).
+			u8(0x10, 0, 0, 0).u32(1).u16(0).u16(8).Bytes()
+	h5Scalar   = new(h5).u8(1, 0, 0, 0, 0, 0, 0, 0).Bytes()
+	h5Vector3  = new(h5).u8(1, 1, 0, 0, 0, 0, 0, 0).u64(3).Bytes()
+	h5Scalar2  = new(h5).u8(2, 0, 0, 0).Bytes()
+	h5Vector20 = new(h5).u8(1, 1, 0, 0, 0, 0, 0, 0).u64(20).Bytes()
+)
+
+// attributeV1 builds a version 1 attribute message, which pads each part to 8 bytes.
+func attributeV1(name string, datatype, dataspace, data []byte) []byte {
+	b := new(h5)
+	b.u8(1, 0).u16(uint16(len(name) + 1)).u16(uint16(len(datatype))).u16(uint16(len(dataspace)))
+	b.WriteString(name)
+	b.u8(0).pad(8)
+	b.Write(datatype)
+	b.pad(8)
+	b.Write(dataspace)
+	b.pad(8)
+	b.Write(data)
+	return b.pad(8).Bytes()
+}
+
+// messageV1 builds a version 1 object header message.
+func messageV1(msgType uint16, data []byte) []byte {
+	return new(h5).u16(msgType).u16(uint16(len(data))).u8(0, 0, 0, 0).u8(data...).Bytes()
+}
+
+func float64s(values ...float64) []byte {
+	b := new(h5)
+	for _, v := range values {
+		binary.Write(b, binary.LittleEndian, v)
+	}
+	return b.Bytes()
+}
+
+// testHDF5v0 builds a file with a version 0 superblock and a version 1 root
+// object header. The last attribute is in a continuation block.
+func testHDF5v0() []byte {
+	const (
+		root         = 96
+		continuation = 768
+	)
+
+	var header h5
+	header.Write(messageV1(hdf5MsgAttribute, attributeV1("instrument", h5String(8), h5Scalar, []byte("Titan\x00\x00\x00"))))
+	header.Write(messageV1(hdf5MsgAttribute, attributeV1("voltage", h5Int32, h5Scalar, new(h5).u32(300).Bytes())))
+	header.Write(messageV1(hdf5MsgAttribute, attributeV1("wavelength", h5Float64, h5Vector3, float64s(1.5406, 1.5444, 1.3922))))
+	header.Write(messageV1(hdf5MsgAttribute, attributeV1("spectrum", h5Float64, h5Vector20, make([]byte, 160))))
+
+	var cont h5
+	cont.Write(messageV1(hdf5MsgAttribute, attributeV1("temperature", h5Int32, h5Scalar, new(h5).u32(uint32(0xffffff9c)).Bytes())))
+	header.Write(messageV1(hdf5MsgContinuation, new(h5).u64(continuation).u64(uint64(cont.Len())).Bytes()))
+
+	var b h5
+	b.Write(hdf5Signature)
+	b.u8(0, 0, 0, 0, 0, 8, 8, 0).u16(4).u16(16).u32(0)
+	b.u64(0).u64(undefinedAddress).u64(1024).u64(undefinedAddress)
+	b.u64(0).u64(root).u32(0).u32(0).padTo(root)
+	b.u8(1, 0).u16(6).u32(1).u32(uint32(header.Len())).u32(0)
+	b.Write(header.Bytes())
+	b.padTo(continuation)
+	b.Write(cont.Bytes())
+	return b.padTo(1024).Bytes()
+}
+
+// testHDF5v2 builds a file with a version 2 superblock, after a 512 byte user
+// block, and a version 2 root object header holding a variable length string.
+func testHDF5v2() []byte {
+	const (
+		userBlock = 512
+		root      = 48
+		heap      = 256
+	)
+
+	value := "Sample 42, annealed"
+	attr := new(h5).u8(3, 0).u16(6).u16(uint16(len(h5VlenString))).u16(uint16(len(h5Scalar2))).u8(0)
+	attr.WriteString("notes")
+	attr.u8(0)
+	attr.Write(h5VlenString)
+	attr.Write(h5Scalar2)
+	attr.u32(uint32(len(value))).u64(heap).u32(1)
+
+	var messages h5
+	messages.u8(hdf5MsgAttribute).u16(uint16(attr.Len())).u8(0).u8(attr.Bytes()...)
+
+	var b h5
+	b.padTo(userBlock)
+	b.Write(hdf5Signature)
+	b.u8(2, 8, 8, 0).u64(userBlock).u64(undefinedAddress).u64(8192).u64(root).u32(0)
+	b.padTo(userBlock + root)
+	b.WriteString("OHDR")
+	b.u8(2, 0x01).u16(uint16(messages.Len()))
+	b.Write(messages.Bytes())
+	b.u32(0) // checksum
+	b.padTo(userBlock + heap)
+
+	var collection h5
+	collection.WriteString("GCOL")
+	collection.u8(1, 0, 0, 0).u64(4096)
+	collection.u16(1).u16(1).u32(0).u64(uint64(len(value)))
+	collection.WriteString(value)
+	collection.pad(8)
+	collection.u16(0).u16(0).u32(0).u64(uint64(4096 - collection.Len() - 16))
+	b.Write(collection.padTo(4096).Bytes())
+
+	return b.padTo(userBlock + 8192).Bytes()
+}
+
+func TestHDF5(t *testing.T) {
+	st := store.NewMemory()
+
+	tags, err := extractHDF5(storeFile(st, "v0.h5", string(testHDF5v0())), st)
+	if err != nil {
+		t.Fatalf("extractHDF5 failed on version 0 file: %s", err)
+	}
+	checkTags(t, "version 0", tags, map[string]string{
+		"hdf5.superblock":  "0",
+		"hdf5.instrument":  "Titan",
+		"hdf5.voltage":     "300",
+		"hdf5.wavelength":  "1.5406, 1.5444, 1.3922",
+		"hdf5.temperature": "-100",
+		"hdf5.spectrum":    "",
+	})
+
+	tags, err = extractHDF5(storeFile(st, "v2.h5", string(testHDF5v2())), st)
+	if err != nil {
+		t.Fatalf("extractHDF5 failed on version 2 file: %s", err)
+	}
+	checkTags(t, "version 2", tags, map[string]string{
+		"hdf5.superblock": "2",
+		"hdf5.notes":      "Sample 42, annealed",
+	})
+
+	if _, err := extractHDF5(storeFile(st, "bad.h5", "not an HDF5 file"), st); err == nil {
+		t.Errorf("Expected error for file without a superblock")
+	}
+
+	truncated := testHDF5v0()[:200]
+	if _, err := extractHDF5(storeFile(st, "truncated.h5", string(truncated)), st); err == nil {
+		t.Errorf("Expected error for truncated file")
+	}
+}
@@ -0,0 +1,305 @@
+package extract
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/process"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// VASP creates the processor that extracts metadata from VASP files. The
+// composition and lattice come from POSCAR and CONTCAR files, the settings from
+// INCAR files, and OUTCAR files give both along with the final energy. Other
+// VASP files are left alone.
+func VASP() process.Processor {
+	return extractor{name: "extract-vasp", extract: extractVASP}
+}
+
+// extractVASP chooses how to read a VASP file from its name.
+func extractVASP(file *schema.File, st store.Store) ([]schema.Tag, error) {
+	name := strings.ToUpper(file.Name)
+	switch {
+	case strings.HasPrefix(name, "POSCAR"), strings.HasPrefix(name, "CONTCAR"):
+		return extractPOSCAR(file, st)
+	case strings.HasPrefix(name, "OUTCAR"):
+		return extractOUTCAR(file, st)
+	case strings.HasPrefix(name, "INCAR"):
+		return extractINCAR(file, st)
+	default:
+		return nil, nil
+	}
+}
+
+// vector is a lattice vector in Angstroms.
+type vector [3]float64
+
+func (v vector) dot(w vector) float64 {
+	return v[0]*w[0] + v[1]*w[1] + v[2]*w[2]
+}
+
+func (v vector) cross(w vector) vector {
+	return vector{
+		v[1]*w[2] - v[2]*w[1],
+		v[2]*w[0] - v[0]*w[2],
+		v[0]*w[1] - v[1]*w[0],
+	}
+}
+
+func (v vector) length() float64 {
+	return math.Sqrt(v.dot(v))
+}
+
+// angle returns the angle between v and w in degrees.
+func (v vector) angle(w vector) float64 {
+	return math.Acos(v.dot(w)/(v.length()*w.length())) * 180 / math.Pi
+}
+
+// addVectors adds the lattice tags for the cell with lattice vectors a, b and c.
+func (m *metadata) addVectors(a, b, c vector) {
+	if a.length() == 0 || b.length() == 0 || c.length() == 0 {
+		return
+	}
+	m.addLattice(a.length(), b.length(), c.length(), b.angle(c), a.angle(c), a.angle(b))
+}
+
+// parseFloats parses all the fields as numbers.
+func parseFloats(fields []string) ([]float64, bool) {
+	var floats []float64
+	for _, field := range fields {
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, false
+		}
+		floats = append(floats, f)
+	}
+	return floats, true
+}
+
+// parseVector parses a line holding a vector.
+func parseVector(line string) (vector, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return vector{}, false
+	}
+	f, ok := parseFloats(fields[:3])
+	if !ok {
+		return vector{}, false
+	}
+	return vector{f[0], f[1], f[2]}, true
+}
+
+// extractPOSCAR reads the lattice and composition from a POSCAR or CONTCAR file.
+// The header is:
+//
+//	comment
+//	scaling factor, or the cell volume when negative
+//	three lattice vectors
+//	element names (VASP 5 and later)
+//	number of atoms of each element
+//
+// Files written by VASP 4 have no element names. Many tools write them as the
+// comment instead, so the comment is used when it names the right number of
+// elements.
+func extractPOSCAR(file *schema.File, st store.Store) ([]schema.Tag, error) {
+	var lines []string
+	err := eachLine(file, st, func(line string) bool {
+		lines = append(lines, line)
+		return len(lines) < 7
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case len(lines) < 7:
+		return nil, nil
+	}
+
+	var m metadata
+
+	scale, err := strconv.ParseFloat(firstField(lines[1]), 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	var vectors [3]vector
+	for i := range vectors {
+		v, ok := parseVector(lines[2+i])
+		if !ok {
+			return nil, nil
+		}
+		vectors[i] = v
+	}
+
+	a, b, c := vectors[0], vectors[1], vectors[2]
+	if scale < 0 {
+		volume := math.Abs(a.dot(b.cross(c)))
+		scale = math.Cbrt(-scale / volume)
+	}
+	for i := range vectors {
+		for j := range vectors[i] {
+			vectors[i][j] *= scale
+		}
+	}
+
+	elements := strings.Fields(lines[5])
+	counts, ok := parseFloats(strings.Fields(lines[6]))
+	if _, numeric := parseFloats(elements); numeric {
+		counts, ok = parseFloats(elements)
+		elements = strings.Fields(lines[0])
+	}
+	if ok && isElements(elements, len(counts)) {
+		m.add("formula", formula(elements, counts))
+	}
+
+	m.addVectors(vectors[0], vectors[1], vectors[2])
+	return m.tags, nil
+}
+
+// elementSymbol matches a chemical element symbol. VASP allows a potential
+// suffix such as Fe_pv or a hash such as O/1a2b.
+var elementSymbol = regexp.MustCompile(`^[A-Z][a-z]?([_/].*)?$`)
+
+// isElements returns true if names are n element symbols.
+func isElements(names []string, n int) bool {
+	if len(names) != n || n == 0 {
+		return false
+	}
+	for i, name := range names {
+		if !elementSymbol.MatchString(name) {
+			return false
+		}
+		names[i] = strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '/' })[0]
+	}
+	return true
+}
+
+func firstField(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// outcarNumber matches the numbers in OUTCAR tables, which can run together
+// when a column is full, as in 0.000000000-2.715000000.
+var outcarNumber = regexp.MustCompile(`-?[0-9]+\.[0-9]+`)
+
+// extractOUTCAR reads the version, main settings, composition, final lattice and
+// final energy from an OUTCAR file. OUTCAR files can be very large so they are
+// read a line at a time.
+func extractOUTCAR(file *schema.File, st store.Store) ([]schema.Tag, error) {
+	var (
+		m        metadata
+		elements []string
+		counts   []float64
+		vectors  []vector
+		latticeN int // lattice vector lines left to read
+		lattice  [3]vector
+		haveCell bool
+	)
+
+	err := eachLine(file, st, func(line string) bool {
+		if latticeN > 0 {
+			numbers := outcarNumber.FindAllString(line, -1)
+			if len(numbers) >= 3 {
+				f, _ := parseFloats(numbers[:3])
+				vectors = append(vectors, vector{f[0], f[1], f[2]})
+			}
+			latticeN--
+			if latticeN == 0 && len(vectors) == 3 {
+				lattice = [3]vector{vectors[0], vectors[1], vectors[2]}
+				haveCell = true
+			}
+			return true
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "vasp."):
+			m.add("vasp.version", strings.TrimPrefix(firstField(trimmed), "vasp."))
+		case strings.HasPrefix(trimmed, "VRHFIN"):
+			if name := between(trimmed, "=", ":"); name != "" {
+				elements = append(elements, name)
+			}
+		case strings.HasPrefix(trimmed, "ions per type"):
+			counts, _ = parseFloats(strings.Fields(after(trimmed, "=")))
+		case strings.HasPrefix(trimmed, "ENCUT"):
+			m.add("vasp.encut", firstField(after(trimmed, "=")))
+		case strings.HasPrefix(trimmed, "ISPIN"):
+			m.add("vasp.ispin", firstField(after(trimmed, "=")))
+		case strings.HasPrefix(trimmed, "GGA") && strings.Contains(trimmed, "="):
+			m.add("vasp.gga", firstField(after(trimmed, "=")))
+		case strings.Contains(trimmed, "NIONS ="):
+			m.add("vasp.nions", firstField(after(trimmed, "NIONS =")))
+		case strings.HasPrefix(trimmed, "free  energy   TOTEN"):
+			m.set("vasp.energy", firstField(after(trimmed, "=")))
+		case strings.HasPrefix(trimmed, "direct lattice vectors"):
+			vectors = nil
+			latticeN = 3
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if isElements(elements, len(counts)) {
+		m.add("formula", formula(elements, counts))
+	}
+	if haveCell {
+		m.addVectors(lattice[0], lattice[1], lattice[2])
+	}
+
+	return m.tags, nil
+}
+
+// extractINCAR reads the settings in an INCAR file. Each setting is tagged as
+// vasp.<name>, with the name in lower case.
+func extractINCAR(file *schema.File, st store.Store) ([]schema.Tag, error) {
+	var m metadata
+	err := eachLine(file, st, func(line string) bool {
+		if i := strings.IndexAny(line, "#!"); i != -1 {
+			line = line[:i]
+		}
+
+		for _, setting := range strings.Split(line, ";") {
+			parts := strings.SplitN(setting, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			name := strings.ToLower(strings.TrimSpace(parts[0]))
+			if name == "" || strings.ContainsAny(name, " \t") {
+				continue
+			}
+			m.add("vasp."+name, strings.Join(strings.Fields(parts[1]), " "))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m.tags, nil
+}
+
+// after returns the part of s after the first sep.
+func after(s, sep string) string {
+	if i := strings.Index(s, sep); i != -1 {
+		return s[i+len(sep):]
+	}
+	return ""
+}
+
+// between returns the trimmed part of s between the first start and the end that
+// follows it.
+func between(s, start, end string) string {
+	s = after(s, start)
+	if i := strings.Index(s, end); i != -1 {
+		return strings.TrimSpace(s[:i])
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+/*
+Package process runs post upload processing on datafiles. Processors, such as
+image conversion and metadata extraction, are registered for the media types
+and file extensions they handle. When an upload completes a job is queued for
+each matching processor. Jobs are kept in the database, so queued work
+survives a server restart, and each job records the result or error of its
+processor for the file.
+*/
+package process
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Processor does work on a datafile after its upload completes. A processor can
+// run more than once on the same file, for example when the server stops while
+// it is running, so running it again must be safe.
+type Processor interface {
+	// Name identifies the processor. Jobs refer to their processor by name, so
+	// it shouldn't change.
+	Name() string
+
+	// Process runs on a completely uploaded file. The file's bytes are read from
+	// st under file.FileID(). It returns a short description of what was done,
+	// which is recorded with the job.
+	Process(file *schema.File, svc *service.Service, st store.Store) (result string, err error)
+}
+
+// Registry maps media types and file extensions to the processors that handle them.
+type Registry struct {
+	mutex      sync.RWMutex
+	processors map[string]Processor // Processors by name
+	matches    map[string][]string  // Processor names by media type or extension
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		processors: make(map[string]Processor),
+		matches:    make(map[string][]string),
+	}
+}
+
+// Register adds a processor for files that match any of matches. A match is
+// either a media type, such as "image/tiff", or an extension starting with a
+// ".", such as ".cif". Registering a processor again adds to its matches.
+func (r *Registry) Register(p Processor, matches ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.processors[p.Name()] = p
+	for _, match := range matches {
+		match = strings.ToLower(match)
+		if !contains(r.matches[match], p.Name()) {
+			r.matches[match] = append(r.matches[match], p.Name())
+		}
+	}
+}
+
+// For returns the processors that handle file, matching on its media type and
+// the extension of its name. Each processor is returned once.
+func (r *Registry) For(file *schema.File) []Processor {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var (
+		names      []string
+		processors []Processor
+	)
+	keys := []string{strings.ToLower(file.MediaType.Mime), strings.ToLower(filepath.Ext(file.Name))}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		for _, name := range r.matches[key] {
+			if !contains(names, name) {
+				names = append(names, name)
+				processors = append(processors, r.processors[name])
+			}
+		}
+	}
+
+	return processors
+}
+
+// Lookup returns the processor with the given name, or nil if there isn't one.
+func (r *Registry) Lookup(name string) Processor {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.processors[name]
+}
+
+// contains returns true if name is in names.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registry holds the processors the server runs.
+var registry = NewRegistry()
+
+// Register adds a processor to the processors the server runs. See Registry.Register.
+func Register(p Processor, matches ...string) {
+	registry.Register(p, matches...)
+}
+
+// Queue queues a job for each processor that handles file, and wakes up the
+// server to run them. Processors that already have a job queued for the file
+// are skipped.
+func Queue(svc *service.Service, file *schema.File) error {
+	return server.queue(svc, file)
+}
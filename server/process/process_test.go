@@ -0,0 +1,164 @@
+package process
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// testProcessor fails until it has been run failures times.
+type testProcessor struct {
+	name     string
+	failures int
+	runs     int
+	panics   bool
+}
+
+func (p *testProcessor) Name() string {
+	return p.name
+}
+
+func (p *testProcessor) Process(file *schema.File, svc *service.Service, st store.Store) (string, error) {
+	p.runs++
+	switch {
+	case p.panics:
+		panic("bad processor")
+	case p.runs <= p.failures:
+		return "", errors.New("not yet")
+	default:
+		return "processed " + file.Name, nil
+	}
+}
+
+// newTestServer creates a processServer on an in memory service containing a
+// single file named name.
+func newTestServer(t *testing.T, name, mime string) (*processServer, *schema.File) {
+	s := newProcessServer(NewRegistry())
+	s.service = service.NewMemory()
+	s.store = store.NewMemory()
+	s.maxAttempts = 3
+	s.retryDelay = time.Minute
+
+	file := schema.NewFile(name, "test@mc.org")
+	file.MediaType.Mime = mime
+	f, err := s.service.File.InsertEntry(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert file: %s", err)
+	}
+	return s, f
+}
+
+func TestRegistryFor(t *testing.T) {
+	r := NewRegistry()
+	tiff := &testProcessor{name: "tiff"}
+	cif := &testProcessor{name: "cif"}
+	r.Register(tiff, "image/tiff")
+	r.Register(cif, ".cif", "chemical/x-cif")
+
+	file := schema.NewFile("Fe2O3.CIF", "test@mc.org")
+	file.MediaType.Mime = "chemical/x-cif"
+	if processors := r.For(&file); len(processors) != 1 || processors[0] != cif {
+		t.Fatalf("Expected only the cif processor, got %#v", processors)
+	}
+
+	file = schema.NewFile("scan.tif", "test@mc.org")
+	file.MediaType.Mime = "image/tiff"
+	if processors := r.For(&file); len(processors) != 1 || processors[0] != tiff {
+		t.Fatalf("Expected only the tiff processor, got %#v", processors)
+	}
+
+	file = schema.NewFile("notes.txt", "test@mc.org")
+	file.MediaType.Mime = "text/plain"
+	if processors := r.For(&file); len(processors) != 0 {
+		t.Fatalf("Expected no processors, got %#v", processors)
+	}
+
+	if r.Lookup("cif") != cif || r.Lookup("none") != nil {
+		t.Fatalf("Lookup returned the wrong processor")
+	}
+}
+
+func TestQueueAndRun(t *testing.T) {
+	s, file := newTestServer(t, "Fe2O3.cif", "chemical/x-cif")
+	p := &testProcessor{name: "cif"}
+	s.registry.Register(p, ".cif")
+
+	if err := s.queue(s.service, file); err != nil {
+		t.Fatalf("Unable to queue file: %s", err)
+	}
+
+	// Queuing again doesn't add another job
+	s.queue(s.service, file)
+	jobs, _ := s.service.Job.ByFile(file.ID)
+	if len(jobs) != 1 || jobs[0].Status != schema.JobQueued || jobs[0].Processor != "cif" {
+		t.Fatalf("Expected a single queued job, got %#v", jobs)
+	}
+
+	s.runReady(time.Now())
+	job, _ := s.service.Job.ByID(jobs[0].ID)
+	if job.Status != schema.JobDone || job.Result != "processed Fe2O3.cif" || job.Attempts != 1 {
+		t.Fatalf("Job wasn't recorded as done: %#v", job)
+	}
+
+	if status := s.Status(); status.Done != 1 || status.Queued != 0 {
+		t.Fatalf("Wrong status: %#v", status)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	s, file := newTestServer(t, "Fe2O3.cif", "chemical/x-cif")
+	p := &testProcessor{name: "cif", failures: 10}
+	s.registry.Register(p, ".cif")
+	s.queue(s.service, file)
+
+	now := time.Now()
+	s.runReady(now)
+	jobs, _ := s.service.Job.ByFile(file.ID)
+	job := jobs[0]
+	if job.Status != schema.JobQueued || job.Error != "not yet" || !job.RunAfter.After(now) {
+		t.Fatalf("Failed job wasn't queued for retry: %#v", job)
+	}
+
+	// The retry waits for its delay
+	s.runReady(now)
+	if p.runs != 1 {
+		t.Fatalf("Job was retried before its delay")
+	}
+
+	s.runReady(now.Add(time.Minute))
+	s.runReady(now.Add(time.Hour))
+	j, _ := s.service.Job.ByID(job.ID)
+	if j.Status != schema.JobFailed || j.Attempts != 3 || p.runs != 3 {
+		t.Fatalf("Job wasn't given up on after 3 attempts: %#v, runs %d", j, p.runs)
+	}
+
+	status := s.Status()
+	if status.Retried != 2 || status.Failed != 1 || status.LastErrorJob != job.ID {
+		t.Fatalf("Wrong status: %#v", status)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	s, file := newTestServer(t, "Fe2O3.cif", "chemical/x-cif")
+	p := &testProcessor{name: "cif", panics: true}
+	s.registry.Register(p, ".cif")
+	s.queue(s.service, file)
+
+	// Jobs left behind for a processor that isn't registered anymore
+	orphan := schema.NewJob(file.ID, "removed")
+	s.service.Job.Insert(&orphan)
+
+	s.maxAttempts = 1
+	s.runReady(time.Now())
+
+	jobs, _ := s.service.Job.ByFile(file.ID)
+	for _, job := range jobs {
+		if job.Status != schema.JobFailed || job.Error == "" {
+			t.Errorf("Expected job to fail with an error: %#v", job)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package process
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/materials-commons/config"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mc"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/search"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Create our own context log that always includes our server name.
+var l = log.New("server", "Processor")
+
+const (
+	// defaultInterval is how often the database is checked for jobs that were
+	// queued by someone else, or whose retry delay has passed.
+	defaultInterval = time.Minute
+
+	// defaultMaxAttempts is how many times a processor is run on a file before
+	// giving up on it.
+	defaultMaxAttempts = 5
+
+	// defaultRetryDelay is how long to wait before retrying a failed job. The
+	// delay doubles after each failure.
+	defaultRetryDelay = time.Minute
+)
+
+// Status reports on the jobs the server has run since it started.
+type Status struct {
+	Queued       int    // Jobs waiting to run, including retries.
+	Done         int    // Jobs that succeeded.
+	Retried      int    // Failed attempts that will be tried again.
+	Failed       int    // Jobs that were given up on.
+	LastError    string // The last error from a processor.
+	LastErrorJob string // The id of the job that had the last error.
+}
+
+// processServer runs queued jobs.
+type processServer struct {
+	service     *service.Service
+	store       store.Store
+	registry    *Registry
+	interval    time.Duration
+	maxAttempts int
+	retryDelay  time.Duration
+
+	mutex  sync.Mutex
+	status Status
+	wakeup chan struct{}
+}
+
+// We only expose a single process server.
+var server = newProcessServer(registry)
+
+// newProcessServer creates a processServer that runs the processors in r.
+func newProcessServer(r *Registry) *processServer {
+	return &processServer{
+		registry:    r,
+		interval:    defaultInterval,
+		maxAttempts: defaultMaxAttempts,
+		retryDelay:  defaultRetryDelay,
+		wakeup:      make(chan struct{}, 1),
+	}
+}
+
+// Server returns the singleton processServer.
+func Server() *processServer {
+	return server
+}
+
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started. How often to check for jobs is read from
+// MCFS_PROCESS_INTERVAL, and the delay before the first retry from
+// MCFS_PROCESS_RETRY_DELAY, both in time.ParseDuration format. The number of
+// attempts is read from MCFS_PROCESS_ATTEMPTS.
+func (s *processServer) Init() {
+	s.service = search.WithIndex(service.New(service.Configured()), search.Default())
+	s.store = store.New()
+	s.interval = mc.ConfigDuration("MCFS_PROCESS_INTERVAL", defaultInterval)
+	s.retryDelay = mc.ConfigDuration("MCFS_PROCESS_RETRY_DELAY", defaultRetryDelay)
+	if attempts := config.GetInt("MCFS_PROCESS_ATTEMPTS"); attempts > 0 {
+		s.maxAttempts = attempts
+	}
+}
+
+// Run implements the server. It is meant to be called by the Server interface.
+// Jobs left queued by a previous run are picked up straight away.
+func (s *processServer) Run(stopChan <-chan struct{}) {
+	l.Info(log.Msg("Starting, checking for jobs every %s", s.interval))
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runReady(time.Now())
+		select {
+		case <-s.wakeup:
+		case <-ticker.C:
+		case <-stopChan:
+			l.Info("Shutting down.")
+			return
+		}
+	}
+}
+
+// Status returns the current status of the server.
+func (s *processServer) Status() Status {
+	s.mutex.Lock()
+	status := s.status
+	s.mutex.Unlock()
+
+	if s.service != nil {
+		if queued, err := s.service.Job.ByStatus(schema.JobQueued); err == nil {
+			status.Queued = len(queued)
+		}
+	}
+	return status
+}
+
+// Report returns the server's Status. It is the report shown in the status of
+// the servers.
+func (s *processServer) Report() interface{} {
+	return s.Status()
+}
+
+// queue queues the jobs for a file.
+func (s *processServer) queue(svc *service.Service, file *schema.File) error {
+	processors := s.registry.For(file)
+	if len(processors) == 0 {
+		return nil
+	}
+
+	existing, err := svc.Job.ByFile(file.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range processors {
+		if isQueued(existing, p.Name()) {
+			continue
+		}
+
+		job := schema.NewJob(file.ID, p.Name())
+		if _, err := svc.Job.Insert(&job); err != nil {
+			return err
+		}
+	}
+
+	s.wake()
+	return nil
+}
+
+// isQueued returns true if one of jobs is a queued job for processor.
+func isQueued(jobs []schema.Job, processor string) bool {
+	for _, job := range jobs {
+		if job.Processor == processor && job.Status == schema.JobQueued {
+			return true
+		}
+	}
+	return false
+}
+
+// wake signals Run that there is new work without blocking.
+func (s *processServer) wake() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// runReady runs every queued job that is ready to run at now.
+func (s *processServer) runReady(now time.Time) {
+	jobs, err := s.service.Job.ByStatus(schema.JobQueued)
+	if err != nil {
+		l.Error(log.Msg("Unable to retrieve queued jobs: %s", err))
+		return
+	}
+
+	for _, job := range jobs {
+		if !job.RunAfter.After(now) {
+			s.run(&job, now)
+		}
+	}
+}
+
+// run runs a single job at now and records its outcome. Failed jobs are retried
+// until they run out of attempts. Jobs whose processor or file no longer exists
+// fail straight away.
+func (s *processServer) run(job *schema.Job, now time.Time) {
+	job.Attempts++
+	job.MTime = now
+
+	var (
+		result string
+		err    error
+		retry  = job.Attempts < s.maxAttempts
+	)
+	p := s.registry.Lookup(job.Processor)
+	file, ferr := s.service.File.ByID(job.FileID)
+	switch {
+	case p == nil:
+		err, retry = fmt.Errorf("unknown processor %s", job.Processor), false
+	case ferr != nil:
+		err, retry = fmt.Errorf("unable to retrieve datafile %s: %s", job.FileID, ferr), false
+	default:
+		result, err = safeProcess(p, file, s.service, s.store)
+	}
+
+	s.mutex.Lock()
+	switch {
+	case err == nil:
+		job.Status = schema.JobDone
+		job.Result = result
+		job.Error = ""
+		s.status.Done++
+		l.Debug(log.Msg("Job %s: %s on %s: %s", job.ID, job.Processor, job.FileID, result))
+	case retry:
+		delay := s.retryDelay << uint(job.Attempts-1)
+		job.Error = err.Error()
+		job.RunAfter = now.Add(delay)
+		s.recordError(job, err)
+		s.status.Retried++
+		l.Warn(log.Msg("Job %s: %s on %s failed, retrying in %s: %s", job.ID, job.Processor, job.FileID, delay, err))
+	default:
+		job.Status = schema.JobFailed
+		job.Error = err.Error()
+		s.recordError(job, err)
+		s.status.Failed++
+		l.Error(log.Msg("Job %s: %s on %s failed after %d attempts: %s", job.ID, job.Processor, job.FileID, job.Attempts, err))
+	}
+	s.mutex.Unlock()
+
+	if err := s.service.Job.Update(job); err != nil {
+		l.Error(log.Msg("Unable to save job %s: %s", job.ID, err))
+	}
+}
+
+// recordError keeps the last error for Status. The caller must hold the mutex.
+func (s *processServer) recordError(job *schema.Job, err error) {
+	s.status.LastError = err.Error()
+	s.status.LastErrorJob = job.ID
+}
+
+// safeProcess runs a processor, turning a panic into an error so that a bad
+// processor can't take down the server.
+func safeProcess(p Processor, file *schema.File, svc *service.Service, st store.Store) (result string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("processor %s panicked: %v", p.Name(), e)
+		}
+	}()
+	return p.Process(file, svc, st)
+}
@@ -39,6 +39,7 @@ func (h *ReqHandler) createDir(req *protocol.CreateDirReq) (resp *protocol.Creat
 		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Invalid directory path %s", req.Path)
 	default:
 		// The project exists and the user has permission.
+		h.setProject(req.ProjectID)
 		dataDir, err := h.service.Dir.ByPath(req.Path, req.ProjectID)
 		switch {
 		case err == mcerr.ErrNotFound:
@@ -1,21 +1,13 @@
 package request
 
 import (
-	"fmt"
-	r "github.com/dancannon/gorethink"
-	"github.com/materials-commons/mcfs/base/model"
 	"github.com/materials-commons/mcfs/protocol"
-	"github.com/materials-commons/mcfs/server"
+	"github.com/materials-commons/mcfs/server/store"
 	"testing"
 )
 
-func init() {
-	mcfs.InitRethinkDB()
-}
-
 func TestCreateDir(t *testing.T) {
-	h := NewReqHandler(nil, "")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMemory())
 
 	// Test valid path
 
@@ -31,7 +23,6 @@ func TestCreateDir(t *testing.T) {
 	}
 
 	createdID := resp.ID
-	var _ = createdID
 
 	// Test existing directory
 
@@ -40,13 +31,21 @@ func TestCreateDir(t *testing.T) {
 		t.Fatalf("Create existing directory failed with %#v, err: %s", resp, err)
 	}
 
-	// Cleanup the created directory
-	fmt.Println("Deleting datadir id:", createdID)
-	model.Delete("datadirs", createdID, session)
-	// Now cleanup the join table
-	rv, _ := r.Table("project2datadir").GetAllByIndex("datadir_id", createdID).Delete().RunWrite(session)
-	if rv.Deleted != 1 {
-		t.Fatalf("Multiple entries in project2datadir matched. There should only have been one: %#v\n", rv)
+	if resp.ID != createdID {
+		t.Fatalf("Create existing directory returned a different id %s, expected %s", resp.ID, createdID)
+	}
+
+	// Make sure the directory was added to the project
+	entries, _ := h.service.Project.Files(createDirRequest.ProjectID, "")
+	found := false
+	for _, entry := range entries {
+		if entry.ID == createdID {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("Created directory %s not in project", createdID)
 	}
 
 	// Test path outside of project
@@ -67,7 +66,7 @@ func TestCreateDir(t *testing.T) {
 	// Test that fails if subdirs don't exist
 
 	createDirRequest.ProjectID = "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3"
-	createDirRequest.Path = "Test/tdir1/tdir2"
+	createDirRequest.Path = "Test/tdir2/tdir3"
 
 	resp, err = h.createDir(&createDirRequest)
 	if err == nil {
@@ -1,9 +1,11 @@
 package request
 
 import (
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/metrics"
 	"github.com/materials-commons/mcfs/server/service"
 )
 
@@ -23,9 +25,11 @@ func (h *ReqHandler) createFile(req *protocol.CreateFileReq) (resp *protocol.Cre
 	if err := cfh.validateRequest(req); err != nil {
 		return nil, err
 	}
+	h.setProject(req.ProjectID)
 
 	// Check the file status.
-	files, err := h.service.File.ByPathChecksum(req.Name, req.DataDirID, req.Checksum)
+	checksums := requestChecksums(req.Checksum, req.Checksums)
+	files, err := h.service.File.ByPathChecksums(req.Name, req.DataDirID, checksums)
 	switch {
 	case len(files) == 0:
 		// This is the easy case. No matching files were found, so we just create a
@@ -74,7 +78,7 @@ func newCreateFileHandler(user string, service *service.Service) *createFileHand
 }
 
 // validateRequest will validate the CreateFileReq. It does sanity checking on the file
-// size and checksum. We rely on the client to send us a good checksum.
+// size and checksums. We rely on the client to send us good checksums.
 func (cfh *createFileHandler) validateRequest(req *protocol.CreateFileReq) error {
 	proj, err := cfh.service.Project.ByID(req.ProjectID)
 	if err != nil {
@@ -98,11 +102,7 @@ func (cfh *createFileHandler) validateRequest(req *protocol.CreateFileReq) error
 		return mcerr.Errorf(mcerr.ErrInvalid, "Invalid size (%d) for file %s", req.Size, req.Name)
 	}
 
-	if req.Checksum == "" {
-		return mcerr.Errorf(mcerr.ErrInvalid, "Bad checksum (%s) for file %s", req.Checksum, req.Name)
-	}
-
-	return nil
+	return validateChecksums(req.Name, req.Checksum, req.Checksums)
 }
 
 // createNewFile will create the file object in the database. It inserts a new file entry
@@ -140,14 +140,16 @@ func (cfh *createFileHandler) createNewFile(req *protocol.CreateFileReq) (*proto
 func (cfh *createFileHandler) newFile(req *protocol.CreateFileReq) *schema.File {
 	file := schema.NewFile(req.Name, cfh.user)
 	file.DataDirs = append(file.DataDirs, req.DataDirID)
-	file.Checksum = req.Checksum
+	file.Checksums = requestChecksums(req.Checksum, req.Checksums)
+	file.Checksum = file.Checksums[digest.MD5]
 	file.Size = req.Size
 	file.Current = false
 
-	dup, err := cfh.service.File.ByChecksum(file.Checksum)
+	dup, err := cfh.service.File.ByChecksums(file.Checksums)
 	if err == nil && dup != nil {
 		// Found a matching entry, set usesid to it
 		file.UsesID = dup.ID
+		metrics.DedupHits.Inc()
 	}
 
 	return &file
@@ -3,17 +3,15 @@ package request
 import (
 	"fmt"
 	"github.com/materials-commons/gohandy/collections"
-	"github.com/materials-commons/mcfs/base/model"
 	"github.com/materials-commons/mcfs/protocol"
-	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
 	"testing"
 )
 
 var _ = fmt.Println
 
 func TestCreateFile(t *testing.T) {
-	h := NewReqHandler(nil, "")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMemory())
 
 	// Test create with no size
 	createFileRequest := protocol.CreateFileReq{
@@ -45,7 +43,7 @@ func TestCreateFile(t *testing.T) {
 	createdID := resp.ID
 
 	// Validate the newly created datafile
-	df, err := model.GetFile(createdID, session)
+	df, err := h.service.File.ByID(createdID)
 	if err != nil {
 		t.Fatalf("Unable to retrieve a newly created datafile %s", err)
 	}
@@ -80,7 +78,7 @@ func TestCreateFile(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Unable to create file with matching size and checksum %s", err)
 	}
-	df, err = model.GetFile(resp.ID, session)
+	df, err = h.service.File.ByID(resp.ID)
 	if err != nil {
 		t.Errorf("Unable to retrieve newly created datafile %s: %s", resp.ID, err)
 	}
@@ -92,18 +90,12 @@ func TestCreateFile(t *testing.T) {
 		t.Errorf("Wrong id for UsesID %#v", df)
 	}
 
-	createdID2 := resp.ID
-
 	// Test creating an existing file
 	resp, err = h.createFile(&createFileRequest)
 	if err != nil {
 		t.Fatalf("Failed creating an existing file")
 	}
 
-	// Delete created files
-	model.Delete("datafiles", createdID, session)
-	model.Delete("datafiles", createdID2, session)
-
 	// Test creating with an invalid project id
 	validProjectID := createFileRequest.ProjectID
 	createFileRequest.ProjectID = "abc123-doesnotexist"
@@ -129,7 +121,7 @@ func TestCreateFile(t *testing.T) {
 }
 
 func TestNewFile(t *testing.T) {
-	cfh := newCreateFileHandler("test@mc.org", service.New(service.RethinkDB))
+	cfh := newCreateFileHandler("test@mc.org", newTestService(t))
 
 	req := &protocol.CreateFileReq{
 		ProjectID: "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3",
@@ -176,7 +168,7 @@ func TestNewFile(t *testing.T) {
 }
 
 func TestCreateNewFile(t *testing.T) {
-	cfh := newCreateFileHandler("test@mc.org", service.New(service.RethinkDB))
+	cfh := newCreateFileHandler("test@mc.org", newTestService(t))
 
 	req := &protocol.CreateFileReq{
 		ProjectID: "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3",
@@ -50,7 +50,7 @@ func (h *ReqHandler) createProject(req *protocol.CreateProjectReq) (*protocol.Cr
 	resp.DataDirID = proj.DataDir
 
 	// Save project id so state machine can unlock it at termination.
-	h.projectID = resp.ProjectID
+	h.setProject(resp.ProjectID)
 	return &resp, err
 }
 
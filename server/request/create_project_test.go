@@ -1,18 +1,14 @@
 package request
 
 import (
-	r "github.com/dancannon/gorethink"
 	"github.com/materials-commons/mcfs/base/mcerr"
-	"github.com/materials-commons/mcfs/base/model"
-	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/protocol"
-	"github.com/materials-commons/mcfs/server/inuse"
+	"github.com/materials-commons/mcfs/server/store"
 	"testing"
 )
 
 func TestCreateProject(t *testing.T) {
-	h := NewReqHandler(nil, "")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMemory())
 
 	createProjectRequest := protocol.CreateProjectReq{
 		Name: "TestProject1__",
@@ -29,7 +25,7 @@ func TestCreateProject(t *testing.T) {
 	}
 
 	// Make sure the created project is properly setup
-	proj, err := model.GetProject(projectID, session)
+	proj, err := h.service.Project.ByID(projectID)
 	if err != nil {
 		t.Errorf("Unable to retrieve project %s", projectID)
 	}
@@ -42,38 +38,26 @@ func TestCreateProject(t *testing.T) {
 		t.Errorf("Project doesn't have a datadir associated with it")
 	}
 
-	// Make sure the join table is updated
-	var p2d schema.Project2DataDir
-	rql := r.Table("project2datadir").GetAllByIndex("project_id", projectID)
-	err = model.GetRow(rql, session, &p2d)
-	if err != nil {
-		t.Errorf("Unable to find project in join table")
+	if proj.DataDir != datadirID {
+		t.Errorf("Wrong datadir for project %#v expected %s", proj, datadirID)
 	}
 
-	if p2d.DataDirID != datadirID {
-		t.Errorf("Wrong datadir for project %#v expected %s", p2d, datadirID)
+	// Make sure the project's directory is in the project
+	entries, err := h.service.Project.Files(projectID, "")
+	if err != nil {
+		t.Errorf("Unable to list project files: %s", err)
 	}
 
-	// Test that the project is locked:
-	resp, err = h.createProject(&createProjectRequest)
-	if !mcerr.Is(err, mcerr.ErrInUse) {
-		t.Fatalf("Attempted to access/create a project that should be locked, and got access: %s", err)
+	if len(entries) != 1 || entries[0].ID != datadirID {
+		t.Errorf("Wrong entries for project %#v expected only %s", entries, datadirID)
 	}
 
-	// Unlock it so we can test further
-	inuse.Unmark(projectID)
-
 	// Test create existing project
 	resp, err = h.createProject(&createProjectRequest)
 	if err != mcerr.ErrExists {
 		t.Errorf("Creating an existing project should have returned err mcerr.ErrExists, returned %s instead", err)
 	}
 
-	// Delete before test so we can cleanup if there is a failure
-	model.Delete("datadirs", datadirID, session)
-	model.Delete("projects", projectID, session)
-	model.Delete("project2datadir", p2d.ID, session)
-
 	if err == nil {
 		t.Fatalf("Created an existing project - shouldn't be able to")
 	}
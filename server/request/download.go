@@ -0,0 +1,53 @@
+package request
+
+import (
+	"io/ioutil"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/metrics"
+)
+
+// maxDownloadLength is the most bytes returned for a single DownloadReq.
+const maxDownloadLength = 1024 * 1024 * 20
+
+// download returns a range of bytes from a datafile. Any version of a file can
+// be downloaded, but only once it has been completely uploaded.
+func (h *ReqHandler) download(req *protocol.DownloadReq) (*protocol.DownloadResp, error) {
+	if req.Type != protocol.DataFile {
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Only datafiles can be downloaded")
+	}
+
+	file, err := h.accessibleFile(req.ID)
+	switch {
+	case err != nil:
+		return nil, err
+	case file.Uploaded != file.Size:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Datafile %s hasn't been completely uploaded", req.ID)
+	case req.Offset < 0 || req.Length < 1:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Invalid range %d/%d", req.Offset, req.Length)
+	case req.Offset >= file.Size:
+		return &protocol.DownloadResp{Ok: true}, nil
+	}
+
+	length := int64(req.Length)
+	if length > maxDownloadLength {
+		length = maxDownloadLength
+	}
+	if req.Offset+length > file.Size {
+		length = file.Size - req.Offset
+	}
+
+	r, err := h.store.ReadRange(file.FileID(), req.Offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	bytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, mcerr.Errorm(mcerr.ErrInternal, err)
+	}
+	metrics.BytesDownloaded.Add(float64(len(bytes)))
+	return &protocol.DownloadResp{Ok: true, Bytes: bytes}, nil
+}
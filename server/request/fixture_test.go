@@ -0,0 +1,103 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Ids of the items in the test fixture. They match the ids in the
+// materialscommons test database.
+const (
+	testProjectID   = "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3"
+	testDirID       = "d0b001c6-fc0a-4e95-97c3-4427de68c0a5"
+	testOtherDirID  = "f0ebb733-c75d-4983-8d68-242d688fcf73"
+	testSubDirID    = "c3d72271-4a32-4080-a6a3-b4c6a5c4b986"
+	testFileID      = "692a623d-ee26-4a40-aee6-dbfa5413aefe"
+	test2ProjectID  = "12b5aecb-1def-463d-8886-92f6e81bf234"
+	test2DirID      = "a87806ac-8f56-4eb9-abfb-6bfbb7a19dd6"
+	test2OtherDirID = "ae0cf23f-2588-4864-bf34-455b0aa23ed6"
+	test2FileID     = "eb402860-0c6c-433b-b5b6-e0280d421461"
+	testUser        = "test@mc.org"
+	test2User       = "test2@mc.org"
+)
+
+// newTestService creates an in memory service loaded with the test fixture:
+//
+//	test@mc.org owns project Test:
+//	    Test
+//	    Test/AT 250C
+//	    Test/AT 250C/AT 1 hour
+//	    Test/AT 250C/AT 2 hours/R38_03085 Sample Info.txt
+//
+//	test2@mc.org owns project Test2, which test@mc.org has no access to:
+//	    Test2
+//	    Test2/dir1/file1.txt
+//	    Test2/dir2
+func newTestService(t *testing.T) *service.Service {
+	svc := service.NewMemory(
+		schema.NewUser("test", testUser, "", "test"),
+		schema.NewUser("test2", test2User, "", "test2"),
+	)
+
+	root := addTestProject(t, svc, testProjectID, "Test", testUser)
+	addTestDir(t, svc, testProjectID, testDirID, "Test/AT 250C", testUser, root)
+	addTestDir(t, svc, testProjectID, testOtherDirID, "Test/AT 250C/AT 1 hour", testUser, testDirID)
+	addTestDir(t, svc, testProjectID, testSubDirID, "Test/AT 250C/AT 2 hours", testUser, testDirID)
+	file := addTestFile(t, svc, testFileID, "R38_03085 Sample Info.txt", testUser, testSubDirID)
+	file.Checksum = "72d47a675e81cf4a283aaf67587ddd28"
+	file.Size = 585
+	file.Uploaded = 585
+	svc.File.Update(file)
+
+	root = addTestProject(t, svc, test2ProjectID, "Test2", test2User)
+	addTestDir(t, svc, test2ProjectID, test2DirID, "Test2/dir1", test2User, root)
+	addTestDir(t, svc, test2ProjectID, test2OtherDirID, "Test2/dir2", test2User, root)
+	addTestFile(t, svc, test2FileID, "file1.txt", test2User, test2DirID)
+
+	return svc
+}
+
+// newTestHandler creates a ReqHandler for test@mc.org on the test fixture.
+func newTestHandler(t *testing.T, st store.Store) *ReqHandler {
+	h := NewReqHandler(nil, newTestService(t), st)
+	h.setUser(testUser)
+	return h
+}
+
+// addTestProject adds a project. It returns the id of the project's directory.
+func addTestProject(t *testing.T, svc *service.Service, id, name, owner string) string {
+	proj := schema.NewProject(name, "", owner)
+	proj.ID = id
+	p, err := svc.Project.Insert(&proj)
+	if err != nil {
+		t.Fatalf("Unable to insert project %s: %s", name, err)
+	}
+	return p.DataDir
+}
+
+// addTestDir adds a directory to a project.
+func addTestDir(t *testing.T, svc *service.Service, projectID, id, name, owner, parentID string) {
+	dir := schema.NewDirectory(name, owner, projectID, parentID)
+	dir.ID = id
+	if _, err := svc.Dir.Insert(&dir); err != nil {
+		t.Fatalf("Unable to insert directory %s: %s", name, err)
+	}
+
+	proj, _ := svc.Project.ByID(projectID)
+	svc.Project.AddDirectories(proj, id)
+}
+
+// addTestFile adds a completely uploaded, empty file to a directory.
+func addTestFile(t *testing.T, svc *service.Service, id, name, owner, dirID string) *schema.File {
+	file := schema.NewFile(name, owner)
+	file.ID = id
+	file.DataDirs = []string{dirID}
+	f, err := svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert file %s: %s", name, err)
+	}
+	return f
+}
@@ -0,0 +1,249 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// UploadOffsetHeader holds the offset of the bytes in a PATCH request, and the
+// offset to send from in responses.
+const UploadOffsetHeader = "Upload-Offset"
+
+// errOffsetConflict is returned when the bytes sent don't start where the stored
+// bytes end, or when an upload is finished before all its bytes were sent.
+var errOffsetConflict = errors.New("offset conflict")
+
+// UploadHandler serves uploads over http for clients that can't reach the mcfs
+// port. It makes the same decisions as the TCP upload requests, using the same
+// code, so an upload started over one can be resumed over the other. The
+// user is identified by the apikey query parameter. The endpoints are:
+//
+//	POST  /uploads/            Create a file. The body is a JSON CreateFileReq.
+//	GET   /uploads/<id>        Return the offset to send bytes from.
+//	PATCH /uploads/<id>        Write the body at the offset in the Upload-Offset header.
+//	POST  /uploads/<id>/finish Verify a fully sent file and make it current.
+//
+// Each returns a JSON UploadStatus. A PATCH that sends the last bytes of a file
+// also finishes it.
+type UploadHandler struct {
+	service *service.Service
+	store   store.Store
+}
+
+// UploadStatus is the state of an upload.
+type UploadStatus struct {
+	ID       string `json:"id"`              // Id of the file being uploaded
+	Offset   int64  `json:"offset"`          // Offset to send the next bytes from
+	Size     int64  `json:"size"`            // Size of the file
+	Complete bool   `json:"complete"`        // True when the file is verified and current
+	Error    string `json:"error,omitempty"` // Why the request failed
+}
+
+// NewUploadHandler creates a new UploadHandler.
+func NewUploadHandler(svc *service.Service, st store.Store) *UploadHandler {
+	return &UploadHandler{
+		service: svc,
+		store:   st,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (uh *UploadHandler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	// The apikey is only taken from the URL, as the body holds file bytes.
+	u, err := uh.service.User.ByAPIKey(req.URL.Query().Get("apikey"))
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	h := NewReqHandler(nil, uh.service, uh.store)
+	h.SetRemoteAddr(req.RemoteAddr)
+	h.setUser(u.Email)
+
+	var (
+		status *UploadStatus
+		path   = strings.Trim(strings.TrimPrefix(req.URL.Path, "/uploads"), "/")
+		id     = strings.TrimSuffix(path, "/finish")
+	)
+	switch {
+	case path == "" && req.Method == "POST":
+		status, err = h.httpCreateFile(req.Body)
+	case id != path && req.Method == "POST":
+		status, err = h.finishUpload(id)
+	case id == path && (req.Method == "GET" || req.Method == "HEAD"):
+		status, err = h.uploadStatus(id)
+	case id == path && req.Method == "PATCH":
+		offset, perr := strconv.ParseInt(req.Header.Get(UploadOffsetHeader), 10, 64)
+		if perr != nil {
+			err = mcerr.Errorf(mcerr.ErrInvalid, "Missing or bad %s header", UploadOffsetHeader)
+			break
+		}
+		status, err = h.writeUpload(id, offset, req.Body)
+	default:
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		code = httpStatus(err)
+		if status == nil {
+			status = &UploadStatus{ID: id}
+		}
+		status.Error = err.Error()
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set(UploadOffsetHeader, strconv.FormatInt(status.Offset, 10))
+	writer.WriteHeader(code)
+	json.NewEncoder(writer).Encode(status)
+}
+
+// httpStatus maps an error to an http status code.
+func httpStatus(err error) int {
+	switch {
+	case mcerr.Is(err, errOffsetConflict), mcerr.Is(err, mcerr.ErrInUse):
+		return http.StatusConflict
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		return http.StatusNotFound
+	case mcerr.Is(err, mcerr.ErrNoAccess):
+		return http.StatusForbidden
+	case mcerr.Is(err, mcerr.ErrInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// httpCreateFile creates a file using the same rules as the createFile request.
+// An existing partial with the same checksums is returned instead of a new
+// file, so its upload can be resumed.
+func (h *ReqHandler) httpCreateFile(body io.Reader) (*UploadStatus, error) {
+	var req protocol.CreateFileReq
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad create file request: %s", err)
+	}
+
+	resp, err := h.createFile(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.uploadStatus(resp.ID)
+}
+
+// uploadStatus determines where an upload should continue from. It makes the
+// same upload request a TCP client makes to resume, using the size and
+// checksums the file was created with.
+func (h *ReqHandler) uploadStatus(id string) (*UploadStatus, error) {
+	status, _, err := h.httpUpload(id)
+	return status, err
+}
+
+// httpUpload runs the upload request for a file. It returns the status to send
+// back, and the upload response that says where to write bytes.
+func (h *ReqHandler) httpUpload(id string) (*UploadStatus, *protocol.UploadResp, error) {
+	file, err := h.service.File.ByID(id)
+	if err != nil {
+		return nil, nil, mcerr.Errorm(mcerr.ErrNotFound, err)
+	}
+
+	resp, err := h.upload(&protocol.UploadReq{
+		DataFileID: id,
+		Size:       file.Size,
+		Checksums:  file.Digests(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := &UploadStatus{
+		ID:       id,
+		Offset:   resp.Offset,
+		Size:     file.Size,
+		Complete: file.Current,
+	}
+	return status, resp, nil
+}
+
+// writeUpload writes body to an upload at offset. The offset must be where the
+// stored bytes end. Bytes past the size the file was created with are refused.
+// The written bytes are checked the same way as for a TCP upload, so the file
+// becomes current when its last bytes are written, or is discarded when its
+// checksums don't match.
+func (h *ReqHandler) writeUpload(id string, offset int64, body io.Reader) (*UploadStatus, error) {
+	status, resp, err := h.httpUpload(id)
+	switch {
+	case err != nil:
+		return nil, err
+	case offset != status.Offset:
+		return status, mcerr.Errorf(errOffsetConflict, "Upload of %s continues at %d, not %d", id, status.Offset, offset)
+	}
+
+	u, err := createUploadFileHandler(h, resp.DataFileID, resp.Offset)
+	if err != nil {
+		return status, err
+	}
+	u.sizeLimited = true
+
+	n, err := io.Copy(u.w, io.LimitReader(body, status.Size-offset))
+	u.nbytes = n
+	if err == nil {
+		// Anything left in the body is past the end of the file.
+		if extra, _ := io.Copy(ioutil.Discard, body); extra > 0 {
+			err = mcerr.Errorf(mcerr.ErrInvalid, "Attempt to write more bytes to file than its expected size.")
+		}
+	}
+
+	return h.closeUpload(u, status, err)
+}
+
+// finishUpload verifies a file whose bytes have all been sent. This is needed
+// when the last PATCH failed after writing its bytes, or when the file's bytes
+// were sent as part of another upload of the same contents.
+func (h *ReqHandler) finishUpload(id string) (*UploadStatus, error) {
+	status, resp, err := h.httpUpload(id)
+	switch {
+	case err != nil:
+		return nil, err
+	case status.Complete:
+		return status, nil
+	case status.Offset != status.Size:
+		return status, mcerr.Errorf(errOffsetConflict, "Upload of %s is incomplete, %d of %d bytes sent", id, status.Offset, status.Size)
+	}
+
+	u, err := createUploadFileHandler(h, resp.DataFileID, resp.Offset)
+	if err != nil {
+		return status, err
+	}
+	u.sizeLimited = true
+
+	return h.closeUpload(u, status, nil)
+}
+
+// closeUpload closes an upload, updating status with the resulting file state.
+// Any write error is returned once the upload is closed.
+func (h *ReqHandler) closeUpload(u *uploadFileHandler, status *UploadStatus, writeErr error) (*UploadStatus, error) {
+	state := u.fileClose()
+	status.Offset += u.nbytes
+
+	switch state {
+	case fileStateVerified:
+		status.Complete = true
+	case fileStateInvalid:
+		status.Offset = 0
+		return status, mcerr.Errorf(mcerr.ErrInvalid, "Checksums for %s don't match, the upload must restart", status.ID)
+	}
+
+	return status, writeErr
+}
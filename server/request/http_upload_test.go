@@ -0,0 +1,179 @@
+package request
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/metrics"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// httpUploadTest sends requests to an UploadHandler on the test fixture.
+type httpUploadTest struct {
+	t      *testing.T
+	h      *ReqHandler
+	server *httptest.Server
+}
+
+func newHTTPUploadTest(t *testing.T) *httpUploadTest {
+	h := newTestHandler(t, store.NewMemory())
+	return &httpUploadTest{
+		t:      t,
+		h:      h,
+		server: httptest.NewServer(NewUploadHandler(h.service, h.store)),
+	}
+}
+
+// do sends a request as the user with apikey, and decodes the UploadStatus response.
+func (ht *httpUploadTest) do(method, path, apikey string, offset int64, body string) (int, UploadStatus) {
+	req, _ := http.NewRequest(method, ht.server.URL+path+"?apikey="+apikey, strings.NewReader(body))
+	if offset >= 0 {
+		req.Header.Set(UploadOffsetHeader, strconv.FormatInt(offset, 10))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ht.t.Fatalf("%s %s failed: %s", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var status UploadStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	return resp.StatusCode, status
+}
+
+// create creates a file in the test user's project for contents.
+func (ht *httpUploadTest) create(name, contents, checksumOf string) (int, UploadStatus) {
+	req := fmt.Sprintf(`{"ProjectID": %q, "DataDirID": %q, "Name": %q, "Size": %d, "Checksum": "%x"}`,
+		testProjectID, testOtherDirID, name, len(contents), md5.Sum([]byte(checksumOf)))
+	return ht.do("POST", "/uploads/", "test", -1, req)
+}
+
+func (ht *httpUploadTest) check(what string, code, expectedCode int, status UploadStatus, offset int64, complete bool) {
+	switch {
+	case code != expectedCode:
+		ht.t.Fatalf("%s: expected status %d, got %d (%s)", what, expectedCode, code, status.Error)
+	case status.Offset != offset:
+		ht.t.Fatalf("%s: expected offset %d, got %d", what, offset, status.Offset)
+	case status.Complete != complete:
+		ht.t.Fatalf("%s: expected complete %t, got %t", what, complete, status.Complete)
+	}
+}
+
+func TestHTTPUpload(t *testing.T) {
+	ht := newHTTPUploadTest(t)
+	defer ht.server.Close()
+
+	code, status := ht.create("http.txt", "hello world", "hello world")
+	ht.check("Create", code, http.StatusOK, status, 0, false)
+	id := status.ID
+
+	code, status = ht.do("PATCH", "/uploads/"+id, "test", 5, "hello")
+	ht.check("Write at wrong offset", code, http.StatusConflict, status, 0, false)
+
+	code, status = ht.do("PATCH", "/uploads/"+id, "test", -1, "hello")
+	ht.check("Write without offset", code, http.StatusBadRequest, status, 0, false)
+
+	code, status = ht.do("PATCH", "/uploads/"+id, "test", 0, "hello")
+	ht.check("First write", code, http.StatusOK, status, 5, false)
+
+	code, status = ht.do("GET", "/uploads/"+id, "test", -1, "")
+	ht.check("Query offset", code, http.StatusOK, status, 5, false)
+
+	code, status = ht.do("POST", "/uploads/"+id+"/finish", "test", -1, "")
+	ht.check("Finish partial", code, http.StatusConflict, status, 5, false)
+
+	// The partial is the same one a TCP client sees.
+	resp, err := ht.h.upload(&protocol.UploadReq{
+		DataFileID: id,
+		Size:       11,
+		Checksum:   fmt.Sprintf("%x", md5.Sum([]byte("hello world"))),
+	})
+	if err != nil || resp.Offset != 5 {
+		t.Fatalf("TCP upload of HTTP partial should resume at 5, got %v %v", resp, err)
+	}
+
+	code, status = ht.create("http.txt", "hello world", "hello world")
+	if status.ID != id || status.Offset != 5 {
+		t.Fatalf("Creating the same file again should return the partial, got %#v", status)
+	}
+
+	code, status = ht.do("PATCH", "/uploads/"+id, "test", 5, " world")
+	ht.check("Last write", code, http.StatusOK, status, 11, true)
+
+	file, _ := ht.h.service.File.ByID(id)
+	if !file.Current || file.Uploaded != 11 {
+		t.Fatalf("Uploaded file should be current: %#v", file)
+	}
+
+	code, status = ht.do("POST", "/uploads/"+id+"/finish", "test", -1, "")
+	ht.check("Finish complete", code, http.StatusOK, status, 11, true)
+
+	// A second file with the same contents uses the first file's bytes, and only
+	// needs to be finished.
+	code, status = ht.create("copy.txt", "hello world", "hello world")
+	ht.check("Create duplicate", code, http.StatusOK, status, 11, false)
+	dupID := status.ID
+
+	code, status = ht.do("POST", "/uploads/"+dupID+"/finish", "test", -1, "")
+	ht.check("Finish duplicate", code, http.StatusOK, status, 11, true)
+
+	dup, _ := ht.h.service.File.ByID(dupID)
+	if !dup.Current || dup.UsesID != id {
+		t.Fatalf("Duplicate should be current and use %s: %#v", id, dup)
+	}
+}
+
+func TestHTTPUploadErrors(t *testing.T) {
+	ht := newHTTPUploadTest(t)
+	defer ht.server.Close()
+
+	// Bytes that don't match the checksum are discarded.
+	failures := metrics.ChecksumFailures.Value()
+	code, status := ht.create("bad.txt", "abc", "xyz")
+	badID := status.ID
+	code, status = ht.do("PATCH", "/uploads/"+badID, "test", 0, "abc")
+	ht.check("Bad checksum", code, http.StatusBadRequest, status, 0, false)
+	if _, err := ht.h.store.Stat(badID); err == nil {
+		t.Errorf("Bytes that failed verification should be discarded")
+	}
+	if metrics.ChecksumFailures.Value() != failures+1 {
+		t.Errorf("The checksum failure wasn't counted")
+	}
+
+	code, status = ht.create("long.txt", "abc", "abc")
+	code, status = ht.do("PATCH", "/uploads/"+status.ID, "test", 0, "abcdef")
+	ht.check("Too many bytes", code, http.StatusBadRequest, status, 3, true)
+
+	code, status = ht.do("GET", "/uploads/"+badID, "", -1, "")
+	if code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized without apikey, got %d", code)
+	}
+
+	code, status = ht.do("GET", "/uploads/"+badID, "test2", -1, "")
+	if code != http.StatusForbidden {
+		t.Errorf("Expected forbidden for another users upload, got %d", code)
+	}
+
+	code, status = ht.do("GET", "/uploads/no-such-file", "test", -1, "")
+	if code != http.StatusNotFound {
+		t.Errorf("Expected not found for unknown file, got %d", code)
+	}
+
+	code, status = ht.do("POST", "/uploads/", "test", -1, "not json")
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for bad create request, got %d", code)
+	}
+
+	code, status = ht.do("DELETE", "/uploads/"+badID, "test", -1, "")
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected method not allowed for DELETE, got %d", code)
+	}
+}
@@ -9,29 +9,38 @@ import (
 // login validates a login request.
 func (h *ReqHandler) login(req *protocol.LoginReq) (*protocol.LoginResp, error) {
 	if validLogin(req.User, req.APIKey, h.service) {
-		h.user = req.User
+		h.setUser(req.User)
+		h.log.Info("Logged in")
 		return &protocol.LoginResp{}, nil
 	}
 
-	return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad login %s/%s", req.User, req.APIKey)
+	// The apikey is left out of the error as it is logged.
+	return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad login for %s", req.User)
 }
 
-// validLogin looks the user up in the database and compares the APIKey passed in with
-// the APIKey in the database.
+// validLogin looks up the user for the APIKey passed in and checks that it is
+// the user logging in.
 func validLogin(user, apikey string, s *service.Service) bool {
-	u, err := s.User.ByID(user)
+	if apikey == "" {
+		return false
+	}
+
+	u, err := s.User.ByAPIKey(apikey)
 	switch {
 	case err != nil:
 		return false
-	case u.APIKey != apikey:
+	case u.ID != user:
 		return false
 	default:
 		return true
 	}
 }
 
-// logout responds to a logout request. It currently doesn't do anything but the
-// state machine will treat this request specially and will terminate.
+// logout responds to a logout request. It clears the user and project, the state
+// machine will treat this request specially and wait for the next login.
 func (h *ReqHandler) logout(req *protocol.LogoutReq) (*protocol.LogoutResp, error) {
+	h.log.Info("Logged out")
+	h.projectID = ""
+	h.setUser("")
 	return &protocol.LogoutResp{}, nil
 }
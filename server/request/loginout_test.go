@@ -3,23 +3,15 @@ package request
 import (
 	"encoding/gob"
 	"fmt"
-	r "github.com/dancannon/gorethink"
+	"github.com/inconshreveable/log15"
+	"github.com/materials-commons/mcfs/base/log"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/store"
 	"net"
 	"os"
 	"testing"
 )
 
-var session *r.Session
-
-func init() {
-	session, _ = r.Connect(
-		r.ConnectOpts{
-			Address:  "localhost:30815",
-			Database: "materialscommons",
-		})
-}
-
 type client struct {
 	*gob.Encoder
 	*gob.Decoder
@@ -54,8 +46,7 @@ func loginTestUser() *client {
 }
 
 func TestLoginLogout(t *testing.T) {
-	h := NewReqHandler(nil, "")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMemory())
 
 	// Test valid login
 	loginRequest := protocol.LoginReq{
@@ -98,3 +89,54 @@ func TestLoginLogout(t *testing.T) {
 	}
 
 }
+
+// logRecords is a log handler that keeps the records logged to it.
+type logRecords []*log15.Record
+
+func (r *logRecords) Log(record *log15.Record) error {
+	*r = append(*r, record)
+	return nil
+}
+
+// ctx returns the value of key in the record's context.
+func ctx(record *log15.Record, key string) interface{} {
+	for i := 0; i+1 < len(record.Ctx); i += 2 {
+		if record.Ctx[i] == key {
+			return record.Ctx[i+1]
+		}
+	}
+	return nil
+}
+
+func TestLogContext(t *testing.T) {
+	var logged logRecords
+	log.SetDefaultHandler(&logged)
+	defer log.Configure("", "")
+
+	h := NewReqHandler(nil, newTestService(t), store.NewMemory())
+	h.SetRemoteAddr("127.0.0.1:4000")
+	if _, err := h.login(&protocol.LoginReq{User: testUser, APIKey: "test"}); err != nil {
+		t.Fatalf("Login failed %s", err)
+	}
+	h.createDir(&protocol.CreateDirReq{ProjectID: testProjectID, Path: "Test/AT 250C"})
+	h.log.Info("after")
+
+	last := logged[len(logged)-1]
+	switch {
+	case ctx(last, "conn") != h.connID:
+		t.Fatalf("Wrong connection id %#v", last.Ctx)
+	case ctx(last, "remote") != "127.0.0.1:4000":
+		t.Fatalf("Wrong remote address %#v", last.Ctx)
+	case ctx(last, "user") != testUser:
+		t.Fatalf("Wrong user %#v", last.Ctx)
+	case ctx(last, "project") != testProjectID:
+		t.Fatalf("Wrong project %#v", last.Ctx)
+	}
+
+	// Logging out clears the user and project.
+	h.logout(&protocol.LogoutReq{})
+	h.log.Info("logged out")
+	if last = logged[len(logged)-1]; ctx(last, "user") != "" || ctx(last, "project") != "" {
+		t.Fatalf("User or project kept after logout %#v", last.Ctx)
+	}
+}
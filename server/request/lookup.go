@@ -1,85 +1,170 @@
 package request
 
 import (
-	r "github.com/dancannon/gorethink"
-	"github.com/materials-commons/mcfs/base/db"
+	"reflect"
+	"strings"
+
 	"github.com/materials-commons/mcfs/base/mcerr"
-	"github.com/materials-commons/mcfs/base/model"
 	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/protocol"
 	"github.com/materials-commons/mcfs/server/service"
 )
 
 type lookupHandler struct {
-	session *r.Session
 	user    string
 	service *service.Service
 }
 
 func (h *ReqHandler) lookup(req *protocol.LookupReq) (interface{}, error) {
-	session, _ := db.RSession()
 	l := &lookupHandler{
-		session: session,
 		user:    h.user,
 		service: h.service,
 	}
 
+	if isSearch(req) {
+		return l.search(req)
+	}
+
 	switch req.Type {
 	case "project":
-		rql := l.projectRql(req)
-		var proj schema.Project
-		return l.execute(rql, &proj)
+		proj, err := l.project(req)
+		return l.execute(proj, err)
 
 	case "datafile":
-		rql := l.dataFileRql(req)
-		var datafile schema.File
-		return l.execute(rql, &datafile)
+		datafile, err := l.dataFile(req)
+		return l.execute(datafile, err)
 
 	case "datadir":
-		rql := l.dataDirRql(req)
-		var datadir schema.Directory
-		return l.execute(rql, &datadir)
+		datadir, err := l.dataDir(req)
+		return l.execute(datadir, err)
 
 	default:
 		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Unknown entry type %s", req.Type)
 	}
 }
 
-func (l *lookupHandler) projectRql(req *protocol.LookupReq) r.Term {
+// project looks up a project by id, or by name or any other field in the projects
+// the user owns.
+func (l *lookupHandler) project(req *protocol.LookupReq) (*schema.Project, error) {
 	switch req.Field {
 	case "id":
-		return r.Table("projects").Get(req.Value)
+		return l.service.Project.ByID(req.Value)
+	case "name":
+		return l.service.Project.ByName(req.Value, l.user)
 	default:
-		return r.Table("projects").GetAllByIndex("owner", l.user).Filter(r.Row.Field(req.Field).Eq(req.Value))
+		projects, err := l.service.Project.ByOwner(l.user)
+		if err != nil {
+			return nil, err
+		}
+		for i := range projects {
+			if fieldEquals(&projects[i], req.Field, req.Value) {
+				return &projects[i], nil
+			}
+		}
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "No project with %s %s", req.Field, req.Value)
 	}
 }
 
-func (l *lookupHandler) dataFileRql(req *protocol.LookupReq) r.Term {
+// dataFile looks up a datafile by id, by tag in the project req.LimitToID, or by
+// name or any other field in the datadir req.LimitToID.
+func (l *lookupHandler) dataFile(req *protocol.LookupReq) (*schema.File, error) {
 	switch req.Field {
 	case "id":
-		return r.Table("datafiles").Get(req.Value)
+		return l.service.File.ByID(req.Value)
+	case "name":
+		return l.service.File.ByPath(req.Value, req.LimitToID)
+	case "tag":
+		id, err := l.taggedEntry(req.Value, req.LimitToID, false)
+		if err != nil {
+			return nil, err
+		}
+		return l.service.File.ByID(id)
 	default:
-		return r.Table("datadirs").GetAllByIndex("id", req.LimitToID).
-			OuterJoin(r.Table("datafiles"),
-			func(ddirRow, dfRow r.Term) r.Term {
-				return ddirRow.Field("datafiles").Contains(dfRow.Field("id"))
-			}).Zip().Filter(r.Row.Field(req.Field).Eq(req.Value))
+		d, err := l.service.Dir.ByID(req.LimitToID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range d.DataFiles {
+			if f, err := l.service.File.ByID(id); err == nil && fieldEquals(f, req.Field, req.Value) {
+				return f, nil
+			}
+		}
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "No datafile with %s %s", req.Field, req.Value)
 	}
 }
 
-func (l *lookupHandler) dataDirRql(req *protocol.LookupReq) r.Term {
+// dataDir looks up a datadir by id, or by name, tag or any other field in the
+// project req.LimitToID.
+func (l *lookupHandler) dataDir(req *protocol.LookupReq) (*schema.Directory, error) {
 	switch req.Field {
 	case "id":
-		return r.Table("datadirs").Get(req.Value)
+		return l.service.Dir.ByID(req.Value)
+	case "name":
+		return l.service.Dir.ByPath(req.Value, req.LimitToID)
+	case "tag":
+		id, err := l.taggedEntry(req.Value, req.LimitToID, true)
+		if err != nil {
+			return nil, err
+		}
+		return l.service.Dir.ByID(id)
 	default:
-		return r.Table("project2datadir").GetAllByIndex("project_id", req.LimitToID).
-			EqJoin("datadir_id", r.Table("datadirs")).Zip().
-			Filter(r.Row.Field(req.Field).Eq(req.Value))
+		entries, err := l.service.Project.Files(req.LimitToID, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir {
+				continue
+			}
+			if d, err := l.service.Dir.ByID(entry.ID); err == nil && fieldEquals(d, req.Field, req.Value) {
+				return d, nil
+			}
+		}
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "No datadir with %s %s", req.Field, req.Value)
+	}
+}
+
+// fieldEquals returns true if the string field of the struct v points to, named
+// by its database name, equals value.
+func fieldEquals(v interface{}, field, value string) bool {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name := strings.Split(rt.Field(i).Tag.Get("gorethink"), ",")[0]
+		if name == field {
+			fv := rv.Field(i)
+			return fv.Kind() == reflect.String && fv.String() == value
+		}
+	}
+	return false
+}
+
+// taggedEntry finds a file or directory in a project with a tag the user can see
+// that matches value. The value is either key=value, or just a key to match any
+// value for the key. Extracted metadata, such as formula=Fe2O3, is found this way.
+func (l *lookupHandler) taggedEntry(value, projectID string, isDir bool) (string, error) {
+	key, tagValue := value, ""
+	if i := strings.Index(value, "="); i != -1 {
+		key, tagValue = value[:i], value[i+1:]
+	}
+
+	entries, err := l.service.Project.Files(projectID, "")
+	if err != nil {
+		return "", err
 	}
+
+	for _, entry := range entries {
+		if entry.IsDir == isDir && schema.Tags.Match(entry.Tags, key, tagValue, l.user) {
+			return entry.ID, nil
+		}
+	}
+
+	return "", mcerr.Errorf(mcerr.ErrNotFound, "Nothing tagged %s in project %s", value, projectID)
 }
 
-func (l *lookupHandler) execute(query r.Term, v interface{}) (interface{}, error) {
-	err := model.GetRow(query, l.session, v)
+// execute checks the result of a lookup. The item is only returned if the
+// user has access to it.
+func (l *lookupHandler) execute(v interface{}, err error) (interface{}, error) {
 	switch {
 	case err != nil:
 		return nil, mcerr.Errorm(mcerr.ErrInvalid, err)
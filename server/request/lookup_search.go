@@ -0,0 +1,344 @@
+package request
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/protocol"
+)
+
+// searchEntry holds the fields of a project, datadir or datafile that predicates
+// match on.
+type searchEntry struct {
+	id    string
+	name  string
+	path  string
+	size  int64
+	mtime time.Time
+	tags  []schema.Tag
+}
+
+// matcher is a compiled Predicate.
+type matcher func(e *searchEntry) bool
+
+// isSearch returns true if a LookupReq searches for multiple entries, rather
+// than looking up a single entry.
+func isSearch(req *protocol.LookupReq) bool {
+	return len(req.Where) != 0 || req.PageSize != 0 || req.Cursor != ""
+}
+
+// search finds the entries matching a LookupReq a page at a time. Only the
+// entries the user has access to are returned.
+func (l *lookupHandler) search(req *protocol.LookupReq) (*protocol.LookupResp, error) {
+	predicates := req.Where
+	if req.Field != "" {
+		predicates = append([]protocol.Predicate{{Field: req.Field, Op: protocol.OpEq, Value: req.Value}}, predicates...)
+	}
+
+	matchers := make([]matcher, 0, len(predicates))
+	for _, p := range predicates {
+		m, err := l.compile(p, req.Type == "project")
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	var (
+		entries []searchEntry
+		err     error
+	)
+	switch req.Type {
+	case "project":
+		entries, err = l.projectEntries()
+	case "datafile":
+		entries, err = l.projectFileEntries(req.LimitToID, false)
+	case "datadir":
+		entries, err = l.projectFileEntries(req.LimitToID, true)
+	default:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Unknown entry type %s", req.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return l.page(req, entries, matchers)
+}
+
+// page fills in a LookupResp with the next page of entries that match, starting
+// after req.Cursor. Entries are ordered by path and then id, so that entries with
+// the same path are still paged through in a stable order.
+func (l *lookupHandler) page(req *protocol.LookupReq, entries []searchEntry, matchers []matcher) (*protocol.LookupResp, error) {
+	pageSize := req.PageSize
+	switch {
+	case pageSize <= 0:
+		pageSize = protocol.DefaultPageSize
+	case pageSize > protocol.MaxPageSize:
+		pageSize = protocol.MaxPageSize
+	}
+
+	sort.Sort(searchEntriesByPath(entries))
+	start := 0
+	if req.Cursor != "" {
+		after := parseCursor(req.Cursor)
+		start = sort.Search(len(entries), func(i int) bool { return after.before(&entries[i]) })
+	}
+
+	resp := &protocol.LookupResp{}
+	found := 0
+	for i := start; i < len(entries); i++ {
+		e := &entries[i]
+		if !matchesAll(e, matchers) {
+			continue
+		}
+
+		if found == pageSize {
+			// There is at least one more match, so there is another page.
+			resp.Cursor = cursor(&entries[i-1])
+			break
+		}
+
+		if l.addEntry(resp, req.Type, e.id) {
+			found++
+		}
+	}
+
+	return resp, nil
+}
+
+// cursorSeparator separates the path and id in a cursor. It can't appear in
+// a path.
+const cursorSeparator = "\x00"
+
+// cursor returns the cursor that resumes a search after e.
+func cursor(e *searchEntry) string {
+	return e.path + cursorSeparator + e.id
+}
+
+// parseCursor returns the entry position a cursor resumes after.
+func parseCursor(c string) *searchEntry {
+	i := strings.LastIndex(c, cursorSeparator)
+	if i == -1 {
+		return &searchEntry{path: c}
+	}
+	return &searchEntry{path: c[:i], id: c[i+len(cursorSeparator):]}
+}
+
+// before returns true if e sorts before other.
+func (e *searchEntry) before(other *searchEntry) bool {
+	if e.path != other.path {
+		return e.path < other.path
+	}
+	return e.id < other.id
+}
+
+// addEntry looks up an entry and adds it to resp if the user has access to it.
+func (l *lookupHandler) addEntry(resp *protocol.LookupResp, entryType, id string) bool {
+	switch entryType {
+	case "project":
+		if p, err := l.service.Project.ByID(id); err == nil && l.hasAccess(p) {
+			resp.Projects = append(resp.Projects, *p)
+			return true
+		}
+	case "datadir":
+		if d, err := l.service.Dir.ByID(id); err == nil && l.hasAccess(d) {
+			resp.Dirs = append(resp.Dirs, *d)
+			return true
+		}
+	case "datafile":
+		if f, err := l.service.File.ByID(id); err == nil && l.hasAccess(f) {
+			resp.Files = append(resp.Files, *f)
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAll returns true if e matches every matcher.
+func matchesAll(e *searchEntry, matchers []matcher) bool {
+	for _, m := range matchers {
+		if !m(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// projectEntries returns the user's projects as search entries.
+func (l *lookupHandler) projectEntries() ([]searchEntry, error) {
+	projects, err := l.service.Project.ByOwner(l.user)
+	if err != nil {
+		return nil, mcerr.Errorm(mcerr.ErrInvalid, err)
+	}
+
+	entries := make([]searchEntry, 0, len(projects))
+	for _, p := range projects {
+		entries = append(entries, searchEntry{
+			id:    p.ID,
+			name:  p.Name,
+			path:  p.Name,
+			mtime: p.MTime,
+			tags:  p.Tags,
+		})
+	}
+	return entries, nil
+}
+
+// projectFileEntries returns the datadirs, or the datafiles, in a project as
+// search entries. The user must have access to the project.
+func (l *lookupHandler) projectFileEntries(projectID string, isDir bool) ([]searchEntry, error) {
+	proj, err := l.service.Project.ByID(projectID)
+	switch {
+	case err != nil:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad projectID %s", projectID)
+	case !l.hasAccess(proj):
+		return nil, mcerr.Errorf(mcerr.ErrNoAccess, "Permission denied")
+	}
+
+	files, err := l.service.Project.Files(projectID, "")
+	if err != nil {
+		return nil, mcerr.Errorm(mcerr.ErrInvalid, err)
+	}
+
+	var entries []searchEntry
+	for _, f := range files {
+		if f.IsDir == isDir {
+			entries = append(entries, searchEntry{
+				id:    f.ID,
+				name:  path.Base(f.Path),
+				path:  f.Path,
+				size:  f.Size,
+				mtime: f.MTime,
+				tags:  f.Tags,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// compile turns a Predicate into a matcher. It checks that the field and
+// operator go together, and that the value can be parsed.
+func (l *lookupHandler) compile(p protocol.Predicate, isProject bool) (matcher, error) {
+	op := p.Op
+	if op == "" {
+		op = protocol.OpEq
+	}
+
+	switch p.Field {
+	case "id":
+		return compileString(p, op, func(e *searchEntry) string { return e.id })
+	case "name":
+		return compileString(p, op, func(e *searchEntry) string { return e.name })
+	case "path":
+		return compileString(p, op, func(e *searchEntry) string { return e.path })
+	case "size":
+		if isProject {
+			break
+		}
+		size, err := strconv.ParseInt(p.Value, 10, 64)
+		if err != nil {
+			return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad size %s", p.Value)
+		}
+		return compileCompare(p, op, func(e *searchEntry) int {
+			return compareInt64(e.size, size)
+		})
+	case "mtime":
+		t, err := time.Parse(time.RFC3339, p.Value)
+		if err != nil {
+			return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad time %s, expected RFC3339", p.Value)
+		}
+		return compileCompare(p, op, func(e *searchEntry) int {
+			switch {
+			case e.mtime.Before(t):
+				return -1
+			case e.mtime.After(t):
+				return 1
+			default:
+				return 0
+			}
+		})
+	case "tag":
+		if op != protocol.OpEq {
+			break
+		}
+		key, value := p.Value, ""
+		if i := strings.Index(p.Value, "="); i != -1 {
+			key, value = p.Value[:i], p.Value[i+1:]
+		}
+		user := l.user
+		return func(e *searchEntry) bool { return schema.Tags.Match(e.tags, key, value, user) }, nil
+	}
+
+	return nil, mcerr.Errorf(mcerr.ErrInvalid, "Can't search on %s with %s", p.Field, op)
+}
+
+// compileString compiles a predicate on a string field.
+func compileString(p protocol.Predicate, op string, field func(e *searchEntry) string) (matcher, error) {
+	switch op {
+	case protocol.OpEq:
+		return func(e *searchEntry) bool { return field(e) == p.Value }, nil
+	case protocol.OpGlob:
+		if _, err := path.Match(p.Value, ""); err != nil {
+			return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad pattern %s", p.Value)
+		}
+		return func(e *searchEntry) bool {
+			matched, _ := path.Match(p.Value, field(e))
+			return matched
+		}, nil
+	case protocol.OpRegex:
+		re, err := regexp.Compile(p.Value)
+		if err != nil {
+			return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad regular expression %s: %s", p.Value, err)
+		}
+		return func(e *searchEntry) bool { return re.MatchString(field(e)) }, nil
+	default:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Can't search on %s with %s", p.Field, op)
+	}
+}
+
+// compileCompare compiles a predicate on an ordered field. compare returns
+// -1, 0 or 1 as the entry's field is less than, equal to or greater than the
+// predicate's value.
+func compileCompare(p protocol.Predicate, op string, compare func(e *searchEntry) int) (matcher, error) {
+	var accept func(c int) bool
+	switch op {
+	case protocol.OpEq:
+		accept = func(c int) bool { return c == 0 }
+	case protocol.OpLt:
+		accept = func(c int) bool { return c < 0 }
+	case protocol.OpLe:
+		accept = func(c int) bool { return c <= 0 }
+	case protocol.OpGt:
+		accept = func(c int) bool { return c > 0 }
+	case protocol.OpGe:
+		accept = func(c int) bool { return c >= 0 }
+	default:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Can't search on %s with %s", p.Field, op)
+	}
+	return func(e *searchEntry) bool { return accept(compare(e)) }, nil
+}
+
+// compareInt64 returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// searchEntriesByPath sorts search entries by their path, and then their id.
+type searchEntriesByPath []searchEntry
+
+func (s searchEntriesByPath) Len() int           { return len(s) }
+func (s searchEntriesByPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s searchEntriesByPath) Less(i, j int) bool { return s[i].before(&s[j]) }
@@ -2,9 +2,12 @@ package request
 
 import (
 	"fmt"
+	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/protocol"
-	"github.com/materials-commons/mcfs/server"
+	"github.com/materials-commons/mcfs/server/store"
+	"strings"
 	"testing"
+	"time"
 )
 
 var _ = fmt.Println
@@ -17,10 +20,6 @@ type lookupTest struct {
 	comment  string
 }
 
-func init() {
-	mcfs.InitRethinkDB()
-}
-
 /*
 Lookup datadirs. When id field we do a direct lookup. When field other than id,
 then limitTo is a project_id that we will look up a directory in.
@@ -34,6 +33,8 @@ var dataDirTests = []lookupTest{
 	{"name", "Test/AT 250C/AT 2 hours", "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3", true, "Existing name with perimissions"},
 	{"name", "Test/AT 250C/AT 2 hours", "no-such-project", false, "Existing name with bad project"},
 	{"name", "Test2/dir1", "12b5aecb-1def-463d-8886-92f6e81bf234", false, "Existing name without perimissions"},
+	{"owner", "test@mc.org", "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3", true, "Any field with permissions"},
+	{"owner", "nobody@mc.org", "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3", false, "Any field without a match"},
 }
 
 func TestLookupDataDir(t *testing.T) {
@@ -52,6 +53,9 @@ var dataFileTests = []lookupTest{
 	{"name", "R38_03085 Sample Info.txt", "c3d72271-4a32-4080-a6a3-b4c6a5c4b986", true, "Existing name with perimissions"},
 	{"name", "R38_03085 Sample Info.txt", "blah", false, "Existing name with bad datadir"},
 	{"name", "file1.txt", "a87806ac-8f56-4eb9-abfb-6bfbb7a19dd6", false, "Existing name without perimissions"},
+	{"checksum", "72d47a675e81cf4a283aaf67587ddd28", "c3d72271-4a32-4080-a6a3-b4c6a5c4b986", true, "Any field with permissions"},
+	{"checksum", "72d47a675e81cf4a283aaf67587ddd28", "d0b001c6-fc0a-4e95-97c3-4427de68c0a5", false, "Any field in the wrong datadir"},
+	{"owner", "test2@mc.org", "a87806ac-8f56-4eb9-abfb-6bfbb7a19dd6", false, "Any field without permissions"},
 }
 
 func TestLookupDataFile(t *testing.T) {
@@ -68,6 +72,9 @@ var projectTests = []lookupTest{
 	{"name", "Test", "", true, "name Lookup existing with permissions"},
 	{"name", "Does not exist", "", false, "name Lookup bad project name"},
 	{"name", "Test2", "", false, "name Lookup existing but no permissions"},
+	{"owner", "test@mc.org", "", true, "Any field in the user's projects"},
+	{"owner", "test2@mc.org", "", false, "Any field in someone else's projects"},
+	{"birthtime", "", "", false, "Only string fields match"},
 }
 
 func TestLookupProject(t *testing.T) {
@@ -83,8 +90,7 @@ func TestLookupInvalidItem(t *testing.T) {
 }
 
 func conductTest(t *testing.T, tests []lookupTest, whichType string) {
-	h := NewReqHandler(nil, "")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMemory())
 	for _, test := range tests {
 		req := &protocol.LookupReq{
 			Field:     test.field,
@@ -106,3 +112,159 @@ func conductTest(t *testing.T, tests []lookupTest, whichType string) {
 		}
 	}
 }
+
+func TestLookupByTag(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+
+	file, _ := h.service.File.ByID(testFileID)
+	file.Tags = []schema.Tag{{Key: "formula", Value: "Fe2O3"}, {Key: "sample", Value: "R38", User: test2User}}
+	h.service.File.UpdateTags(file)
+
+	datadir, _ := h.service.Dir.ByID(testSubDirID)
+	datadir.Tags = []schema.Tag{{Key: "anneal", Value: "2 hours"}}
+	h.service.Dir.UpdateTags(datadir)
+
+	file2, _ := h.service.File.ByID(test2FileID)
+	file2.Tags = []schema.Tag{{Key: "formula", Value: "Fe2O3"}}
+	h.service.File.UpdateTags(file2)
+
+	tests := []struct {
+		itemType string
+		value    string
+		limitTo  string
+		id       string
+		comment  string
+	}{
+		{"datafile", "formula=Fe2O3", testProjectID, testFileID, "Key and value"},
+		{"datafile", "formula", testProjectID, testFileID, "Key only"},
+		{"datafile", "formula=SiO2", testProjectID, "", "No matching value"},
+		{"datafile", "sample", testProjectID, "", "Other users private tag"},
+		{"datafile", "anneal", testProjectID, "", "Directory tag on datafile lookup"},
+		{"datafile", "formula=Fe2O3", test2ProjectID, "", "Project without permissions"},
+		{"datafile", "formula=Fe2O3", "no-such-project", "", "Bad project"},
+		{"datadir", "anneal=2 hours", testProjectID, testSubDirID, "Directory tag"},
+		{"datadir", "formula", testProjectID, "", "File tag on datadir lookup"},
+	}
+
+	for _, test := range tests {
+		req := &protocol.LookupReq{
+			Field:     "tag",
+			Value:     test.value,
+			LimitToID: test.limitTo,
+			Type:      test.itemType,
+		}
+
+		v, err := h.lookup(req)
+		switch {
+		case test.id == "" && err == nil:
+			t.Errorf("%s: expected error, got %#v", test.comment, v)
+		case test.id == "":
+		case err != nil:
+			t.Errorf("%s: unexpected error %s", test.comment, err)
+		case test.itemType == "datafile" && v.(*schema.File).ID != test.id:
+			t.Errorf("%s: found wrong file %s", test.comment, v.(*schema.File).ID)
+		case test.itemType == "datadir" && v.(*schema.Directory).ID != test.id:
+			t.Errorf("%s: found wrong datadir %s", test.comment, v.(*schema.Directory).ID)
+		}
+	}
+}
+
+func TestLookupSearch(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+	for i, size := range []int64{10, 20, 30} {
+		f := addTestFile(t, h.service, fmt.Sprintf("search-%d", i), fmt.Sprintf("data%d.csv", i), testUser, testOtherDirID)
+		f.Size, f.Uploaded = size, size
+		h.service.File.Update(f)
+	}
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		itemType string
+		where    []protocol.Predicate
+		limitTo  string
+		count    int // -1 when an error is expected
+		comment  string
+	}{
+		{"datafile", []protocol.Predicate{{Field: "name", Op: protocol.OpGlob, Value: "*.csv"}}, testProjectID, 3, "Glob on name"},
+		{"datafile", []protocol.Predicate{{Field: "name", Op: protocol.OpRegex, Value: "^R38_"}}, testProjectID, 1, "Regex on name"},
+		{"datafile", []protocol.Predicate{{Field: "path", Op: protocol.OpGlob, Value: "Test/*/AT 1 hour/*"}}, testProjectID, 3, "Glob on path"},
+		{"datafile", []protocol.Predicate{{Field: "size", Op: protocol.OpGt, Value: "15"}, {Field: "size", Op: protocol.OpLe, Value: "30"}}, testProjectID, 2, "Size range"},
+		{"datafile", []protocol.Predicate{{Field: "size", Op: protocol.OpGe, Value: "20"}, {Field: "name", Op: protocol.OpGlob, Value: "*.csv"}}, testProjectID, 2, "Combined predicates"},
+		{"datafile", []protocol.Predicate{{Field: "mtime", Op: protocol.OpLt, Value: future}}, testProjectID, 4, "Date range"},
+		{"datafile", []protocol.Predicate{{Field: "mtime", Op: protocol.OpGt, Value: future}}, testProjectID, 0, "Nothing in the future"},
+		{"datadir", []protocol.Predicate{{Field: "name", Op: protocol.OpRegex, Value: "AT [0-9] hours?"}}, testProjectID, 2, "Regex on datadirs"},
+		{"project", []protocol.Predicate{{Field: "name", Op: protocol.OpGlob, Value: "Te*"}}, "", 1, "Only the user's projects"},
+		{"datafile", []protocol.Predicate{{Field: "name", Op: protocol.OpGlob, Value: "*"}}, test2ProjectID, -1, "Project without permissions"},
+		{"datafile", []protocol.Predicate{{Field: "name", Op: protocol.OpGlob, Value: "*"}}, "no-such-project", -1, "Bad project"},
+		{"datafile", []protocol.Predicate{{Field: "name", Op: protocol.OpRegex, Value: "("}}, testProjectID, -1, "Bad regex"},
+		{"datafile", []protocol.Predicate{{Field: "name", Op: protocol.OpGlob, Value: "["}}, testProjectID, -1, "Bad glob"},
+		{"datafile", []protocol.Predicate{{Field: "size", Op: protocol.OpGlob, Value: "1*"}}, testProjectID, -1, "Glob on size"},
+		{"datafile", []protocol.Predicate{{Field: "mtime", Op: protocol.OpLt, Value: "yesterday"}}, testProjectID, -1, "Bad time"},
+		{"project", []protocol.Predicate{{Field: "size", Op: protocol.OpGt, Value: "0"}}, "", -1, "Projects have no size"},
+		{"datafile", []protocol.Predicate{{Field: "owner", Op: protocol.OpEq, Value: testUser}}, testProjectID, -1, "Unknown field"},
+	}
+
+	for _, test := range tests {
+		req := &protocol.LookupReq{Type: test.itemType, LimitToID: test.limitTo, Where: test.where}
+		v, err := h.lookup(req)
+		switch {
+		case test.count == -1 && err == nil:
+			t.Errorf("%s: expected error, got %#v", test.comment, v)
+		case test.count == -1:
+		case err != nil:
+			t.Errorf("%s: unexpected error %s", test.comment, err)
+		default:
+			resp := v.(*protocol.LookupResp)
+			if n := len(resp.Files) + len(resp.Dirs) + len(resp.Projects); n != test.count {
+				t.Errorf("%s: expected %d entries, got %d: %#v", test.comment, test.count, n, resp)
+			}
+		}
+	}
+}
+
+func TestLookupSearchPages(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+	for i := 0; i < 5; i++ {
+		addTestFile(t, h.service, fmt.Sprintf("page-%d", i), fmt.Sprintf("page%d.txt", i), testUser, testOtherDirID)
+	}
+
+	// A file with the same path as another isn't skipped between pages.
+	addTestFile(t, h.service, "page-1b", "page1.txt", testUser, testOtherDirID)
+
+	// Other users' files in the project are left out, without ending the search.
+	other := addTestFile(t, h.service, "page-other", "page2a.txt", test2User, testOtherDirID)
+
+	req := &protocol.LookupReq{
+		Type:      "datafile",
+		LimitToID: testProjectID,
+		Where:     []protocol.Predicate{{Field: "name", Op: protocol.OpGlob, Value: "page*"}},
+		PageSize:  2,
+	}
+
+	var names []string
+	for pages := 1; ; pages++ {
+		v, err := h.lookup(req)
+		if err != nil {
+			t.Fatalf("Search failed: %s", err)
+		}
+		resp := v.(*protocol.LookupResp)
+		for _, f := range resp.Files {
+			if f.ID == other.ID {
+				t.Fatalf("Returned a file without access")
+			}
+			names = append(names, f.Name)
+		}
+
+		if resp.Cursor == "" {
+			if pages != 3 {
+				t.Fatalf("Expected 3 pages, got %d", pages)
+			}
+			break
+		}
+		req.Cursor = resp.Cursor
+	}
+
+	if strings.Join(names, ",") != "page0.txt,page1.txt,page1.txt,page2.txt,page3.txt,page4.txt" {
+		t.Fatalf("Wrong files returned %v", names)
+	}
+}
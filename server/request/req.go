@@ -1,47 +1,91 @@
 package request
 
 import (
-	"fmt"
 	"io"
 	"reflect"
+	"sync/atomic"
 
 	"github.com/materials-commons/gohandy/marshaling"
+	"github.com/materials-commons/mcfs/base/log"
 	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/metrics"
+	"github.com/materials-commons/mcfs/server/search"
 	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
 )
 
 const maxBadRequests = 10
 
+// connections counts the ReqHandlers created, to give each one an ID for its
+// log messages.
+var connections uint64
+
 type reqStateFN func() reqStateFN
 
 // ReqHandler is an instance of the request state machine for handling client requests.
 type ReqHandler struct {
-	user            string // User who connected
-	projectID       string // The project that is being uploaded
-	mcdir           string // Location of the materials commons data directory
-	badRequestCount int    // Keep track of bad requests. Close connection when too many.
+	user            string      // User who connected
+	projectID       string      // The project that is being uploaded
+	store           store.Store // Where the datafile bytes are stored
+	badRequestCount int         // Keep track of bad requests. Close connection when too many.
+	reqType         string      // Type of the request being responded to, for metrics.
+	connID          uint64      // Identifies the connection in log messages
+	remote          string      // Address of the client
+	log             log.Logger  // Logs with the connection, user and project
 	marshaling.MarshalUnmarshaler
 	service *service.Service
+	index   *search.Index // Full-text index searched by TextSearchReq
 }
 
 // NewReqHandler creates a new ReqHandlerInstance. Each ReqHandler is a thread safe state machine for
-// handling client requests.
-func NewReqHandler(m marshaling.MarshalUnmarshaler, mcdir string) *ReqHandler {
-	return &ReqHandler{
+// handling client requests. All database access goes through svc.
+func NewReqHandler(m marshaling.MarshalUnmarshaler, svc *service.Service, st store.Store) *ReqHandler {
+	h := &ReqHandler{
 		MarshalUnmarshaler: m,
-		mcdir:              mcdir,
-		service:            service.New(service.RethinkDB),
+		store:              st,
+		service:            svc,
+		index:              search.Default(),
+		connID:             atomic.AddUint64(&connections, 1),
 	}
+	h.setLogContext()
+	return h
+}
+
+// SetRemoteAddr sets the address of the client, which is included in log
+// messages.
+func (h *ReqHandler) SetRemoteAddr(addr string) {
+	h.remote = addr
+	h.setLogContext()
+}
+
+// setUser sets the user the requests are made for.
+func (h *ReqHandler) setUser(user string) {
+	h.user = user
+	h.setLogContext()
+}
+
+// setProject sets the project the requests are working on.
+func (h *ReqHandler) setProject(projectID string) {
+	h.projectID = projectID
+	h.setLogContext()
+}
+
+// setLogContext creates the logger for the current connection, user and
+// project. It is called whenever one of them changes.
+func (h *ReqHandler) setLogContext() {
+	h.log = log.New("conn", h.connID, "remote", h.remote, "user", h.user, "project", h.projectID)
 }
 
 // Run run the ReqHandler state machine. It also performs any needed cleanup when
 // the state machine finishes. The state machine accepts and processes request
 // according to the mcfs.protocol package.
 func (h *ReqHandler) Run() {
+	h.log.Info("Connection opened")
 	for reqStateFN := h.startState; reqStateFN != nil; {
 		reqStateFN = reqStateFN()
 	}
+	h.log.Info("Connection closed")
 }
 
 type errorReq struct{}
@@ -49,14 +93,25 @@ type errorReq struct{}
 func (h *ReqHandler) req() interface{} {
 	var req protocol.Request
 	if err := h.Unmarshal(&req); err != nil {
+		h.reqType = "errorReq"
 		if err == io.EOF {
 			return protocol.CloseReq{}
 		}
 		return errorReq{}
 	}
+	h.reqType = requestType(req.Req)
+	h.log.Debug("Received request", "type", h.reqType)
 	return req.Req
 }
 
+// requestType returns the name of a request's type, such as UploadReq.
+func requestType(req interface{}) string {
+	if req == nil {
+		return "nil"
+	}
+	return reflect.TypeOf(req).Name()
+}
+
 func (h *ReqHandler) startState() reqStateFN {
 	var resp interface{}
 	var err error
@@ -77,7 +132,7 @@ func (h *ReqHandler) startState() reqStateFN {
 }
 
 func (h *ReqHandler) badRequestRestart(err error) reqStateFN {
-	fmt.Println("badRequestRestart:", err)
+	h.log.Warn("Bad request, waiting for login", "type", h.reqType, "err", err)
 
 	// Need to pass a fake response to respError that is nil.
 	var resp *protocol.LoginResp
@@ -90,7 +145,7 @@ func (h *ReqHandler) badRequestRestart(err error) reqStateFN {
 }
 
 func (h *ReqHandler) badRequestNext(err error) reqStateFN {
-	fmt.Println("badRequestNext:", err)
+	h.log.Warn("Bad request", "type", h.reqType, "err", err)
 	h.respError(nil, err)
 	if h.badRequestCount > maxBadRequests {
 		return nil
@@ -110,6 +165,8 @@ func (h *ReqHandler) nextCommand() reqStateFN {
 		if err == nil {
 			return h.uploadLoop(respUpload)
 		}
+	case protocol.UploadChunksReq:
+		return h.uploadChunks(&req)
 	case protocol.CreateFileReq:
 		resp, err = h.createFile(&req)
 	case protocol.CreateDirReq:
@@ -117,18 +174,33 @@ func (h *ReqHandler) nextCommand() reqStateFN {
 	case protocol.CreateProjectReq:
 		resp, err = h.createProject(&req)
 	case protocol.DownloadReq:
+		resp, err = h.download(&req)
 	case protocol.MoveReq:
 	case protocol.DeleteReq:
 	case protocol.StatProjectReq:
 		resp, err = h.statProject(&req)
 	case protocol.LookupReq:
 		resp, err = h.lookup(&req)
+	case protocol.TextSearchReq:
+		resp, err = h.textSearch(&req)
 	case protocol.LogoutReq:
 		resp, err = h.logout(&req)
 		h.sendResp(resp, err)
 		return h.startState
 	case protocol.StatReq:
 		resp, err = h.stat(&req)
+	case protocol.VersionsReq:
+		resp, err = h.versions(&req)
+	case protocol.RestoreVersionReq:
+		resp, err = h.restoreVersion(&req)
+	case protocol.AddTagReq:
+		resp, err = h.addTag(&req)
+	case protocol.RemoveTagReq:
+		resp, err = h.removeTag(&req)
+	case protocol.TagsReq:
+		resp, err = h.tags(&req)
+	case protocol.FindTagReq:
+		resp, err = h.findTag(&req)
 	case protocol.CloseReq:
 		return nil
 	case protocol.IndexReq:
@@ -154,9 +226,10 @@ func (h *ReqHandler) respOk(respData interface{}) {
 		Status: mcerr.ErrorCodeSuccess,
 		Resp:   respData,
 	}
+	metrics.Requests.With(h.reqType, resp.Status.String()).Inc()
 	err := h.Marshal(resp)
 	if err != nil {
-		fmt.Println("respOk: marshal error = ", err)
+		h.log.Error("Unable to send response", "type", h.reqType, "err", err)
 	}
 }
 
@@ -170,7 +243,19 @@ func (h *ReqHandler) respError(respData interface{}, err error) {
 		resp.Status = mcerr.ErrorToErrorCode(err)
 	}
 
-	fmt.Println("respError: ", resp.Status, resp.StatusMessage)
+	// Errors that don't map to an ErrorCode are sent as ErrorCodeSuccess,
+	// don't count them as successes.
+	status := resp.Status
+	if status == mcerr.ErrorCodeSuccess {
+		status = mcerr.ErrorCodeUnknown
+	}
+	metrics.Requests.With(h.reqType, status.String()).Inc()
+
+	if status == mcerr.ErrorCodeInternal || status == mcerr.ErrorCodeUnknown {
+		h.log.Error("Request failed", "type", h.reqType, "status", status.String(), "err", err)
+	} else {
+		h.log.Info("Request failed", "type", h.reqType, "status", status.String(), "err", err)
+	}
 
 	if respData != nil && !reflect.ValueOf(respData).IsNil() {
 		resp.Resp = respData
@@ -178,6 +263,6 @@ func (h *ReqHandler) respError(respData interface{}, err error) {
 
 	marshalErr := h.Marshal(resp)
 	if marshalErr != nil {
-		fmt.Println("respError: marshal error = ", marshalErr)
+		h.log.Error("Unable to send error response", "type", h.reqType, "err", marshalErr)
 	}
 }
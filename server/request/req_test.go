@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/materials-commons/mcfs/client/util"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/store"
 	"io"
 	"testing"
 )
@@ -12,7 +13,7 @@ var _ = fmt.Println
 
 func TestReq(t *testing.T) {
 	m := util.NewRequestResponseMarshaler()
-	h := NewReqHandler(m, "")
+	h := NewReqHandler(m, newTestService(t), store.NewMemory())
 
 	m.SetError(io.EOF)
 	switch h.req().(type) {
@@ -1,22 +1,17 @@
 package request
 
 import (
-	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/protocol"
 )
 
 // stat is like the file system stat call but returns information from our document store.
 func (h *ReqHandler) stat(req *protocol.StatReq) (*protocol.StatResp, error) {
-	file, err := h.service.File.ByID(req.DataFileID)
-	switch {
-	case err != nil:
-		return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown id %s", req.DataFileID)
-	case !h.service.Group.HasAccess(file.Owner, h.user):
-		return nil, mcerr.Errorf(mcerr.ErrNoAccess, "You do not have permission to access this datafile %s", req.DataFileID)
-	default:
-		return respStat(file), nil
+	file, err := h.accessibleFile(req.DataFileID)
+	if err != nil {
+		return nil, err
 	}
+	return respStat(file), nil
 }
 
 // respStat creates the StatResp object from the file.
@@ -26,6 +21,7 @@ func respStat(file *schema.File) *protocol.StatResp {
 		Name:       file.Name,
 		DataDirs:   file.DataDirs,
 		Checksum:   file.Checksum,
+		Checksums:  file.Digests(),
 		Size:       file.Size,
 		Birthtime:  file.Birthtime,
 		MTime:      file.MTime,
@@ -33,7 +33,7 @@ func (h *ReqHandler) statProject(req *protocol.StatProjectReq) (*protocol.StatPr
 
 	resp := protocol.StatProjectResp{
 		ProjectID: projectID,
-		Entries:   entries,
+		Entries:   h.visibleTags(entries),
 	}
 	return &resp, nil
 }
@@ -3,14 +3,14 @@ package request
 import (
 	"fmt"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/store"
 	"testing"
 )
 
 var _ = fmt.Println
 
 func TestProjectEntries(t *testing.T) {
-	h := NewReqHandler(nil, "")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMemory())
 
 	req := protocol.StatProjectReq{
 		Name: "Test",
@@ -3,14 +3,14 @@ package request
 import (
 	"fmt"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/store"
 	"testing"
 )
 
 var _ = fmt.Println
 
 func TestStat(t *testing.T) {
-	h := NewReqHandler(nil, "")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMemory())
 
 	statRequest := protocol.StatReq{
 		DataFileID: "692a623d-ee26-4a40-aee6-dbfa5413aefe",
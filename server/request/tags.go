@@ -0,0 +1,162 @@
+package request
+
+import (
+	"github.com/materials-commons/mcfs/base/dir"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/protocol"
+)
+
+// taggedItem is a datafile, datadir or project whose tags are being read or changed.
+type taggedItem struct {
+	tags []schema.Tag
+	save func(tags []schema.Tag) error
+}
+
+// addTag adds a tag to an item, replacing the users existing tag with the same key.
+func (h *ReqHandler) addTag(req *protocol.AddTagReq) (*protocol.TagsResp, error) {
+	if req.Key == "" {
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Tags must have a key")
+	}
+
+	item, err := h.taggedItem(req.Type, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := schema.Tag{
+		Key:   req.Key,
+		Value: req.Value,
+		User:  h.tagUser(req.Private),
+	}
+	tags := schema.Tags.Set(item.tags, tag)
+	if err := item.save(tags); err != nil {
+		return nil, mcerr.Errorm(mcerr.ErrInternal, err)
+	}
+
+	return h.respTags(tags), nil
+}
+
+// removeTag removes a tag from an item.
+func (h *ReqHandler) removeTag(req *protocol.RemoveTagReq) (*protocol.TagsResp, error) {
+	item, err := h.taggedItem(req.Type, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, removed := schema.Tags.Remove(item.tags, req.Key, h.tagUser(req.Private))
+	if !removed {
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "No tag %s on %s", req.Key, req.ID)
+	}
+
+	if err := item.save(tags); err != nil {
+		return nil, mcerr.Errorm(mcerr.ErrInternal, err)
+	}
+
+	return h.respTags(tags), nil
+}
+
+// tags returns the tags on an item.
+func (h *ReqHandler) tags(req *protocol.TagsReq) (*protocol.TagsResp, error) {
+	item, err := h.taggedItem(req.Type, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	return h.respTags(item.tags), nil
+}
+
+// findTag returns the entries in a project that have a matching tag.
+func (h *ReqHandler) findTag(req *protocol.FindTagReq) (*protocol.FindTagResp, error) {
+	if req.Key == "" {
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Tags must have a key")
+	}
+
+	if _, err := h.taggedItem(protocol.Project, req.ProjectID); err != nil {
+		return nil, err
+	}
+
+	entries, err := h.service.Project.Files(req.ProjectID, "")
+	if err != nil {
+		return nil, mcerr.Errorm(mcerr.ErrNotFound, err)
+	}
+
+	resp := &protocol.FindTagResp{}
+	for _, entry := range entries {
+		if schema.Tags.Match(entry.Tags, req.Key, req.Value, h.user) {
+			resp.Entries = append(resp.Entries, entry)
+		}
+	}
+	resp.Entries = h.visibleTags(resp.Entries)
+
+	return resp, nil
+}
+
+// taggedItem looks up the item to tag. The user must have access to the item.
+func (h *ReqHandler) taggedItem(itemType protocol.ItemType, id string) (*taggedItem, error) {
+	switch itemType {
+	case protocol.DataFile:
+		file, err := h.accessibleFile(id)
+		if err != nil {
+			return nil, err
+		}
+		save := func(tags []schema.Tag) error {
+			file.Tags = tags
+			return h.service.File.UpdateTags(file)
+		}
+		return &taggedItem{tags: file.Tags, save: save}, nil
+
+	case protocol.DataDir:
+		datadir, err := h.service.Dir.ByID(id)
+		switch {
+		case err != nil:
+			return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown id %s", id)
+		case !h.service.Group.HasAccess(datadir.Owner, h.user):
+			return nil, mcerr.Errorf(mcerr.ErrNoAccess, "You do not have permission to access this datadir %s", id)
+		}
+		save := func(tags []schema.Tag) error {
+			datadir.Tags = tags
+			return h.service.Dir.UpdateTags(datadir)
+		}
+		return &taggedItem{tags: datadir.Tags, save: save}, nil
+
+	case protocol.Project:
+		project, err := h.service.Project.ByID(id)
+		switch {
+		case err != nil:
+			return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown id %s", id)
+		case !h.service.Group.HasAccess(project.Owner, h.user):
+			return nil, mcerr.Errorf(mcerr.ErrNoAccess, "You do not have permission to access this project %s", id)
+		}
+		save := func(tags []schema.Tag) error {
+			project.Tags = tags
+			return h.service.Project.Update(project)
+		}
+		return &taggedItem{tags: project.Tags, save: save}, nil
+
+	default:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Can't tag items of type %d", itemType)
+	}
+}
+
+// tagUser returns the user to store on a tag. Public tags have no user.
+func (h *ReqHandler) tagUser(private bool) string {
+	if private {
+		return h.user
+	}
+	return ""
+}
+
+// respTags creates the TagsResp for a list of tags.
+func (h *ReqHandler) respTags(tags []schema.Tag) *protocol.TagsResp {
+	return &protocol.TagsResp{
+		Tags: schema.Tags.Visible(tags, h.user),
+	}
+}
+
+// visibleTags removes the other users private tags from a list of entries.
+func (h *ReqHandler) visibleTags(entries []dir.FileInfo) []dir.FileInfo {
+	for i := range entries {
+		entries[i].Tags = schema.Tags.Visible(entries[i].Tags, h.user)
+	}
+	return entries
+}
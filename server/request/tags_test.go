@@ -0,0 +1,166 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+func TestAddTag(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+
+	// Tag every kind of item
+	items := []struct {
+		itemType protocol.ItemType
+		id       string
+	}{
+		{protocol.DataFile, testFileID},
+		{protocol.DataDir, testSubDirID},
+		{protocol.Project, testProjectID},
+	}
+	for _, item := range items {
+		req := protocol.AddTagReq{Type: item.itemType, ID: item.id, Key: "temperature", Value: "250C"}
+		resp, err := h.addTag(&req)
+		if err != nil {
+			t.Fatalf("Unable to tag %s: %s", item.id, err)
+		}
+		if len(resp.Tags) != 1 || resp.Tags[0] != (schema.Tag{Key: "temperature", Value: "250C"}) {
+			t.Fatalf("Wrong tags for %s: %#v", item.id, resp.Tags)
+		}
+	}
+
+	// Adding a tag with the same key replaces it
+	req := protocol.AddTagReq{Type: protocol.DataFile, ID: testFileID, Key: "temperature", Value: "300C"}
+	resp, err := h.addTag(&req)
+	if err != nil {
+		t.Fatalf("Unable to replace tag: %s", err)
+	}
+	if len(resp.Tags) != 1 || resp.Tags[0].Value != "300C" {
+		t.Fatalf("Tag wasn't replaced: %#v", resp.Tags)
+	}
+
+	// A private tag with the same key is kept separately
+	req = protocol.AddTagReq{Type: protocol.DataFile, ID: testFileID, Key: "temperature", Value: "mine", Private: true}
+	if resp, err = h.addTag(&req); err != nil {
+		t.Fatalf("Unable to add private tag: %s", err)
+	}
+	if len(resp.Tags) != 2 || resp.Tags[1].User != testUser {
+		t.Fatalf("Expected public and private tags: %#v", resp.Tags)
+	}
+
+	// Tags need a key
+	req = protocol.AddTagReq{Type: protocol.DataFile, ID: testFileID, Value: "nokey"}
+	if _, err := h.addTag(&req); err == nil {
+		t.Fatalf("Added tag without a key")
+	}
+
+	// No access to other users items
+	req = protocol.AddTagReq{Type: protocol.DataDir, ID: test2DirID, Key: "temperature"}
+	if _, err := h.addTag(&req); !mcerr.Is(err, mcerr.ErrNoAccess) {
+		t.Fatalf("Expected no access tagging another users dir, got %v", err)
+	}
+
+	// Unknown items and types
+	req = protocol.AddTagReq{Type: protocol.DataFile, ID: "does-not-exist", Key: "temperature"}
+	if _, err := h.addTag(&req); err == nil {
+		t.Fatalf("Tagged a file that doesn't exist")
+	}
+
+	req = protocol.AddTagReq{Type: protocol.DataSet, ID: testFileID, Key: "temperature"}
+	if _, err := h.addTag(&req); err == nil {
+		t.Fatalf("Tagged a dataset")
+	}
+}
+
+func TestPrivateTags(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+
+	req := protocol.AddTagReq{Type: protocol.DataFile, ID: testFileID, Key: "note", Value: "check", Private: true}
+	if _, err := h.addTag(&req); err != nil {
+		t.Fatalf("Unable to add private tag: %s", err)
+	}
+
+	// Someone else can't see the tag
+	other := NewReqHandler(nil, h.service, h.store)
+	other.user = test2User
+	file, _ := h.service.File.ByID(testFileID)
+	if tags := other.respTags(file.Tags).Tags; len(tags) != 0 {
+		t.Fatalf("Private tag is visible to another user: %#v", tags)
+	}
+
+	resp, err := h.tags(&protocol.TagsReq{Type: protocol.DataFile, ID: testFileID})
+	if err != nil {
+		t.Fatalf("Unable to list tags: %s", err)
+	}
+	if len(resp.Tags) != 1 || resp.Tags[0].Value != "check" {
+		t.Fatalf("Owner can't see private tag: %#v", resp.Tags)
+	}
+}
+
+func TestRemoveTag(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+
+	h.addTag(&protocol.AddTagReq{Type: protocol.DataDir, ID: testDirID, Key: "a", Value: "1"})
+	h.addTag(&protocol.AddTagReq{Type: protocol.DataDir, ID: testDirID, Key: "b", Value: "2"})
+
+	// The private tag a doesn't exist
+	req := protocol.RemoveTagReq{Type: protocol.DataDir, ID: testDirID, Key: "a", Private: true}
+	if _, err := h.removeTag(&req); err == nil {
+		t.Fatalf("Removed private tag that doesn't exist")
+	}
+
+	req = protocol.RemoveTagReq{Type: protocol.DataDir, ID: testDirID, Key: "a"}
+	resp, err := h.removeTag(&req)
+	if err != nil {
+		t.Fatalf("Unable to remove tag: %s", err)
+	}
+	if len(resp.Tags) != 1 || resp.Tags[0].Key != "b" {
+		t.Fatalf("Wrong tags after remove: %#v", resp.Tags)
+	}
+
+	dir, _ := h.service.Dir.ByID(testDirID)
+	if len(dir.Tags) != 1 {
+		t.Fatalf("Tag removal wasn't saved: %#v", dir.Tags)
+	}
+}
+
+func TestFindTag(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+
+	h.addTag(&protocol.AddTagReq{Type: protocol.DataFile, ID: testFileID, Key: "sample", Value: "R38"})
+	h.addTag(&protocol.AddTagReq{Type: protocol.DataDir, ID: testOtherDirID, Key: "sample", Value: "R40"})
+
+	resp, err := h.findTag(&protocol.FindTagReq{ProjectID: testProjectID, Key: "sample"})
+	if err != nil {
+		t.Fatalf("Unable to find tag: %s", err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Fatalf("Expected 2 entries tagged sample, got %#v", resp.Entries)
+	}
+
+	resp, err = h.findTag(&protocol.FindTagReq{ProjectID: testProjectID, Key: "sample", Value: "R38"})
+	if err != nil {
+		t.Fatalf("Unable to find tag: %s", err)
+	}
+	if len(resp.Entries) != 1 || resp.Entries[0].ID != testFileID {
+		t.Fatalf("Expected only %s, got %#v", testFileID, resp.Entries)
+	}
+
+	if _, err := h.findTag(&protocol.FindTagReq{ProjectID: test2ProjectID, Key: "sample"}); err == nil {
+		t.Fatalf("Searched project without access")
+	}
+
+	// Tags show up in the project listing
+	stat, err := h.statProject(&protocol.StatProjectReq{ID: testProjectID})
+	if err != nil {
+		t.Fatalf("Unable to stat project: %s", err)
+	}
+	for _, entry := range stat.Entries {
+		if entry.ID == testFileID && (len(entry.Tags) != 1 || entry.Tags[0].Value != "R38") {
+			t.Fatalf("Project listing is missing the file tags: %#v", entry)
+		}
+	}
+}
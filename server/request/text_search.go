@@ -0,0 +1,56 @@
+package request
+
+import (
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/search"
+)
+
+// textSearch searches the full-text index for the entries the user has access to.
+func (h *ReqHandler) textSearch(req *protocol.TextSearchReq) (*protocol.TextSearchResp, error) {
+	switch req.Type {
+	case "", "project", "datadir", "datafile":
+	default:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Unknown entry type %s", req.Type)
+	}
+
+	if req.ProjectID != "" {
+		proj, err := h.service.Project.ByID(req.ProjectID)
+		switch {
+		case err != nil:
+			return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad projectID %s", req.ProjectID)
+		case !h.service.Group.HasAccess(proj.Owner, h.user):
+			return nil, mcerr.Errorf(mcerr.ErrNoAccess, "Permission denied")
+		}
+	}
+
+	limit := req.Limit
+	switch {
+	case limit <= 0:
+		limit = protocol.DefaultPageSize
+	case limit > protocol.MaxPageSize:
+		limit = protocol.MaxPageSize
+	}
+
+	query := search.Query{
+		Text:      req.Query,
+		Type:      req.Type,
+		ProjectID: req.ProjectID,
+		Limit:     limit,
+	}
+	hits, total := h.index.Search(query, h.user, h.service.Group)
+
+	resp := &protocol.TextSearchResp{Total: total}
+	for _, hit := range hits {
+		resp.Hits = append(resp.Hits, protocol.TextSearchHit{
+			ID:      hit.ID,
+			Type:    hit.Type,
+			Name:    hit.Name,
+			Owner:   hit.Owner,
+			Score:   hit.Score,
+			Field:   hit.Field,
+			Snippet: hit.Snippet,
+		})
+	}
+	return resp, nil
+}
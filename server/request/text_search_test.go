@@ -0,0 +1,44 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/search"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+func TestTextSearch(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+	h.index = search.NewIndex()
+	if err := h.index.Rebuild(h.service); err != nil {
+		t.Fatalf("Unable to build index: %s", err)
+	}
+
+	resp, err := h.textSearch(&protocol.TextSearchReq{Query: "sample info"})
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+	if resp.Total != 1 || resp.Hits[0].ID != testFileID || resp.Hits[0].Type != "datafile" {
+		t.Fatalf("Wrong hits %#v", resp)
+	}
+
+	// test@mc.org doesn't have access to Test2.
+	resp, _ = h.textSearch(&protocol.TextSearchReq{Query: "file1"})
+	if resp.Total != 0 {
+		t.Fatalf("Found a file without access %#v", resp)
+	}
+	if _, err := h.textSearch(&protocol.TextSearchReq{Query: "file1", ProjectID: test2ProjectID}); !mcerr.Is(err, mcerr.ErrNoAccess) {
+		t.Fatalf("Searched a project without access: %v", err)
+	}
+
+	resp, _ = h.textSearch(&protocol.TextSearchReq{Query: "at", Type: "datadir", ProjectID: testProjectID, Limit: 1})
+	if resp.Total != 3 || len(resp.Hits) != 1 {
+		t.Fatalf("Wrong datadir hits %#v", resp)
+	}
+
+	if _, err := h.textSearch(&protocol.TextSearchReq{Query: "test", Type: "blah"}); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Searched an unknown type: %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package request
 
 import (
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/protocol"
 )
 
@@ -9,53 +11,63 @@ import (
 // file ID to write to, and the offset to start sending from. The uploading of bytes
 // is handled in the uploadLoop() method.
 func (h *ReqHandler) upload(req *protocol.UploadReq) (*protocol.UploadResp, error) {
-	dataFile, err := h.service.File.ByID(req.DataFileID)
+	dataFile, err := h.uploadTarget(req.DataFileID, req.Size, requestChecksums(req.Checksum, req.Checksums))
 	if err != nil {
-		return nil, mcerr.Errorm(mcerr.ErrNotFound, err)
-	}
-
-	if !h.service.Group.HasAccess(dataFile.Owner, h.user) {
-		return nil, mcerr.ErrNoAccess
+		return nil, err
 	}
 
 	dfLocationID := datafileLocationID(dataFile)
-	fsize := datafileSize(h.mcdir, dfLocationID)
+	fsize := datafileSize(h.store, dfLocationID)
 
-	switch {
-	case fsize == -1:
+	if fsize == -1 {
 		// Problem doing a stat on the file path, send back an error
 		return nil, mcerr.Errorf(mcerr.ErrNoAccess, "Access to path for file %s denied", req.DataFileID)
+	}
+
+	// Request looks ok, determine offset to use.
+	offset, err := responseOffset(fsize, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	dfid := dfLocationID
 
-	case dataFile.Size == req.Size && dataFile.Checksum == req.Checksum:
-		// Request looks ok, determine offset to use.
-		var offset int64
-		if offset, err = responseOffset(fsize, req.Size); err != nil {
-			return nil, err
-		}
-		dfid := dfLocationID
+	// If there is nothing to write then we send back the original id.
+	// Otherwise, if we have bytes to write we send back the id to
+	// write to. Since the file could point to another file that is
+	// a duplicate (but hasn't been completely uploaded), the id could
+	// be different as it could point to the duplicate.
+	if offset == dataFile.Size {
+		dfid = dataFile.ID
+	}
+
+	return &protocol.UploadResp{DataFileID: dfid, Offset: offset}, nil
+}
 
-		// If there is nothing to write then we send back the original id.
-		// Otherwise, if we have bytes to write we send back the id to
-		// write to. Since the file could point to another file that is
-		// a duplicate (but hasn't been completely uploaded), the id could
-		// be different as it could point to the duplicate.
-		if offset == dataFile.Size {
-			dfid = dataFile.ID
-		}
+// uploadTarget looks up the file an upload is for. It checks that the user has
+// access to the file, and that the size and checksums in the request match
+// those the file was created with.
+func (h *ReqHandler) uploadTarget(dataFileID string, size int64, checksums digest.Set) (*schema.File, error) {
+	dataFile, err := h.service.File.ByID(dataFileID)
+	if err != nil {
+		return nil, mcerr.Errorm(mcerr.ErrNotFound, err)
+	}
 
-		return &protocol.UploadResp{DataFileID: dfid, Offset: offset}, nil
+	if !h.service.Group.HasAccess(dataFile.Owner, h.user) {
+		return nil, mcerr.ErrNoAccess
+	}
 
-	case dataFile.Size != req.Size:
+	switch {
+	case dataFile.Size != size:
 		// Invalid request. The correct size was set at the time createFile was called.
-		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Invalid request: Expected size (%d) doesn't match the request size (%d).", dataFile.Size, req.Size)
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Invalid request: Expected size (%d) doesn't match the request size (%d).", dataFile.Size, size)
 
-	case dataFile.Checksum != req.Checksum:
-		// Invalid request. The correct checksum was set at the time createFile was called.
-		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Invalid request: Expected checksum (%s) doesn't match the request checksum (%s).", dataFile.Checksum, req.Checksum)
+	case !dataFile.Digests().Matches(checksums):
+		// Invalid request. The correct checksums were set at the time createFile was called.
+		alg := dataFile.Digests().StrongestCommon(checksums)
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Invalid request: Expected %s checksum (%s) doesn't match the request checksum (%s).", alg, dataFile.Digests()[alg], checksums[alg])
 
 	default:
-		// We should never get here so this is a bug that we need to log
-		return nil, mcerr.ErrInternal
+		return dataFile, nil
 	}
 }
 
@@ -0,0 +1,192 @@
+package request
+
+import (
+	"time"
+
+	"github.com/materials-commons/mcfs/base/cdc"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/inuse"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// chunkUploadHandler holds internal state and methods used when a file is
+// uploaded as content defined chunks.
+type chunkUploadHandler struct {
+	chunks   *store.ChunkStore
+	manifest store.Manifest
+	wanted   map[string]bool // Hashes of the chunks the client still needs to send
+	complete bool            // The bytes for the file were already stored
+	*uploadFileHandler
+}
+
+// uploadChunks starts a chunked upload. It tells the client which chunks to send,
+// the chunks are then accepted in the uploadChunk state.
+func (h *ReqHandler) uploadChunks(req *protocol.UploadChunksReq) reqStateFN {
+	handler, resp, err := createChunkUploadHandler(h, req)
+	if err != nil {
+		h.respError(nil, err)
+		return h.nextCommand
+	}
+
+	h.log.Info("Chunked upload started", "file", handler.file.ID, "missing", len(resp.Missing))
+	h.respOk(resp)
+	return handler.uploadChunk
+}
+
+// createChunkUploadHandler validates an UploadChunksReq and creates the handler
+// for the rest of the upload. Chunks the server already has, either from other
+// files or from an earlier interrupted upload, are not requested. The file is
+// marked as in use until the upload finishes.
+func createChunkUploadHandler(h *ReqHandler, req *protocol.UploadChunksReq) (*chunkUploadHandler, *protocol.UploadChunksResp, error) {
+	chunks, ok := h.store.(*store.ChunkStore)
+	if !ok {
+		return nil, nil, mcerr.Errorf(mcerr.ErrInvalid, "Chunked uploads are not enabled")
+	}
+
+	dataFile, err := h.uploadTarget(req.DataFileID, req.Size, requestChecksums(req.Checksum, req.Checksums))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateChunks(req.Chunks); err != nil {
+		return nil, nil, err
+	}
+
+	manifest := store.Manifest{Chunks: req.Chunks}
+	if manifest.Size() != dataFile.Size {
+		return nil, nil, mcerr.Errorf(mcerr.ErrInvalid, "Chunks add up to %d bytes, expected %d", manifest.Size(), dataFile.Size)
+	}
+
+	file, err := h.service.File.ByID(datafileLocationID(dataFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !inuse.Mark(file.ID) {
+		return nil, nil, mcerr.Errorf(mcerr.ErrInUse, "File %s is already being uploaded", file.ID)
+	}
+
+	handler := &chunkUploadHandler{
+		chunks:            chunks,
+		manifest:          manifest,
+		wanted:            make(map[string]bool),
+		uploadFileHandler: &uploadFileHandler{file: file, started: time.Now(), ReqHandler: h},
+	}
+
+	resp := &protocol.UploadChunksResp{DataFileID: file.ID}
+	if datafileSize(h.store, file.FileID()) == file.Size {
+		// Nothing to send, the done request will verify the existing bytes.
+		handler.complete = true
+		return handler, resp, nil
+	}
+
+	resp.Missing = chunks.MissingChunks(req.Chunks)
+	for _, i := range resp.Missing {
+		handler.wanted[req.Chunks[i].Hash] = true
+	}
+
+	return handler, resp, nil
+}
+
+// validateChunks does sanity checking on the list of chunks sent by the client.
+func validateChunks(chunks []cdc.Chunk) error {
+	for i, chunk := range chunks {
+		switch {
+		case len(chunk.Hash) != 64:
+			return mcerr.Errorf(mcerr.ErrInvalid, "Bad hash (%s) for chunk %d", chunk.Hash, i)
+		case chunk.Size < 1 || chunk.Size > cdc.MaxChunkSize:
+			return mcerr.Errorf(mcerr.ErrInvalid, "Invalid size (%d) for chunk %d", chunk.Size, i)
+		}
+	}
+	return nil
+}
+
+// uploadChunk accepts the chunks the client was asked to send. The upload is
+// finished when the client sends a DoneReq.
+func (u *chunkUploadHandler) uploadChunk() reqStateFN {
+	request := u.req()
+	switch req := request.(type) {
+	case protocol.SendChunkReq:
+		if err := u.sendChunk(&req); err != nil {
+			u.respError(nil, err)
+		} else {
+			u.respOk(&protocol.SendChunkResp{})
+		}
+		return u.uploadChunk
+	case errorReq:
+		u.abort()
+		return nil
+	case protocol.LogoutReq:
+		u.abort()
+		u.respOk(&protocol.LogoutResp{})
+		return u.startState
+	case protocol.CloseReq:
+		u.abort()
+		return nil
+	case protocol.DoneReq:
+		if err := u.finish(); err != nil {
+			u.respError(nil, err)
+		} else {
+			u.respOk(&protocol.DoneResp{})
+		}
+		return u.nextCommand
+	default:
+		u.abort()
+		return u.badRequestNext(mcerr.Errorf(mcerr.ErrInvalid, "Unknown Request Type %T", req))
+	}
+}
+
+// sendChunk stores a chunk the client was asked to send.
+func (u *chunkUploadHandler) sendChunk(req *protocol.SendChunkReq) error {
+	switch {
+	case req.DataFileID != u.file.ID:
+		return mcerr.Errorf(mcerr.ErrInvalid, "Unexpected DataFileID %s, wanted: %s", req.DataFileID, u.file.ID)
+	case !u.wanted[req.Hash]:
+		return mcerr.Errorf(mcerr.ErrInvalid, "Unexpected chunk %s", req.Hash)
+	}
+
+	if err := u.chunks.PutChunk(req.Hash, req.Bytes); err != nil {
+		return err
+	}
+
+	delete(u.wanted, req.Hash)
+	u.nbytes += int64(len(req.Bytes))
+	return nil
+}
+
+// finish writes the manifest for the file and verifies it. The chunks that were
+// received are kept when the upload is incomplete, so a later upload of the
+// file only needs to send the rest.
+func (u *chunkUploadHandler) finish() error {
+	defer inuse.Unmark(u.file.ID)
+	state := fileStateIncomplete
+	defer func() {
+		u.recordUpload(state)
+	}()
+
+	if !u.complete {
+		if len(u.wanted) != 0 {
+			return mcerr.Errorf(mcerr.ErrInvalid, "Upload of %s is missing %d chunks", u.file.ID, len(u.wanted))
+		}
+
+		if err := u.chunks.PutManifest(u.file.FileID(), u.manifest); err != nil {
+			return err
+		}
+	}
+
+	if state = u.fileState(); state != fileStateVerified {
+		state = fileStateInvalid
+		u.discard()
+		return mcerr.Errorf(mcerr.ErrInvalid, "Checksums don't match for %s", u.file.ID)
+	}
+
+	u.markCurrent()
+	return nil
+}
+
+// abort ends the upload without writing a manifest.
+func (u *chunkUploadHandler) abort() {
+	inuse.Unmark(u.file.ID)
+	u.recordUpload(fileStateIncomplete)
+}
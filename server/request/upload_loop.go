@@ -1,22 +1,31 @@
 package request
 
 import (
-	"crypto/md5"
 	"io"
-	"os"
+	"io/ioutil"
+	"time"
 
-	"github.com/materials-commons/gohandy/file"
-	"github.com/materials-commons/mcfs/base/mc"
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/mediatype"
 	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/inuse"
+	"github.com/materials-commons/mcfs/server/metrics"
+	"github.com/materials-commons/mcfs/server/process"
 )
 
 // uploadFileHandler holds internal state and methods used by the upload loop.
 type uploadFileHandler struct {
-	w      io.WriteCloser
-	file   *schema.File
-	nbytes int64
+	w       io.WriteCloser
+	file    *schema.File
+	nbytes  int64
+	started time.Time
+
+	// sizeLimited is set when the upload refuses bytes past the file's
+	// expected size, as HTTP uploads do. A stored file of the expected size
+	// then has all of its bytes.
+	sizeLimited bool
 	*ReqHandler
 }
 
@@ -33,54 +42,41 @@ func (h *ReqHandler) uploadLoop(resp *protocol.UploadResp) reqStateFN {
 }
 
 // createUploadFileHandler creates an instance of the uploadHandler. This instance depends
-// on having the file open. If it can't open the file it returns an error.
+// on having the file open. If it can't open the file it returns an error. The file
+// is marked as in use until the handler closes it, so that no one else can write
+// to it, or reclaim it, while the upload is in progress.
 func createUploadFileHandler(h *ReqHandler, dataFileID string, offset int64) (*uploadFileHandler, error) {
 	file, err := h.service.File.ByID(dataFileID)
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := fileOpen(h.mcdir, file.FileID(), offset)
+	if !inuse.Mark(file.ID) {
+		return nil, mcerr.Errorf(mcerr.ErrInUse, "File %s is already being uploaded", file.ID)
+	}
+
+	f, err := h.store.Append(file.FileID(), offset)
 	if err != nil {
+		inuse.Unmark(file.ID)
 		return nil, err
 	}
 
+	if offset > 0 {
+		metrics.Resumes.Inc()
+	}
+	h.log.Info("Upload started", "file", file.ID, "offset", offset)
+
 	handler := &uploadFileHandler{
 		w:          f,
 		file:       file,
 		nbytes:     0,
+		started:    time.Now(),
 		ReqHandler: h,
 	}
 
 	return handler, nil
 }
 
-// fileOpen opens the actual on disk file that the database file points to.
-// It takes care of creating the directory structure if the file doesn't exist.
-func fileOpen(mcdir, dfid string, offset int64) (io.WriteCloser, error) {
-	path := mc.FilePathFrom(mcdir, dfid)
-	switch {
-	case file.Exists(path):
-		mode := os.O_RDWR
-		if offset != 0 {
-			mode = mode | os.O_APPEND
-		}
-		return os.OpenFile(path, mode, 0660)
-	default:
-		err := createDataFileDir(mcdir, dfid)
-		if err != nil {
-			return nil, err
-		}
-		return os.Create(path)
-	}
-}
-
-// createDataFileDir creates the directory where a datafile is stored.
-func createDataFileDir(mcdir, dataFileID string) error {
-	dirpath := mc.FileDirFrom(mcdir, dataFileID)
-	return os.MkdirAll(dirpath, 0777)
-}
-
 // uploadFile performs the actual file upload. It accepts requests holding bytes
 // and writes them to the file. At the moment this function is not optimized
 // for speed. Each write requires a response back to the client before more bytes
@@ -169,58 +165,108 @@ const (
 	fileStateIncomplete
 )
 
+// String returns the name of the state for log messages.
+func (s fileState) String() string {
+	switch s {
+	case fileStateVerified:
+		return "verified"
+	case fileStateInvalid:
+		return "invalid"
+	default:
+		return "incomplete"
+	}
+}
+
 // fileClose closes the currently open file that bytes are being uploaded to. It
-// also determines the state of the file. The state determines whether the file
-// upload is complete, garbage and needs to be discarded, or is still a partial.
-func (u *uploadFileHandler) fileClose() error {
+// also determines and returns the state of the file. The state determines whether
+// the file upload is complete, garbage and needs to be discarded, or is still a
+// partial.
+func (u *uploadFileHandler) fileClose() fileState {
+	defer inuse.Unmark(u.file.ID)
 	u.w.Close()
-	switch status := u.fileState(); status {
+	status := u.fileState()
+	u.recordUpload(status)
+	switch status {
 	case fileStateVerified:
 		// File has completed upload, and the checksum is correct.
 		// Mark the file as current, as well as all files that point at it.
 		u.markCurrent()
 	case fileStateInvalid:
 		// File has completed upload, but failed checksum verification. Return
-		// an error and truncate the on disk version.
-		u.truncate()
+		// an error and discard the stored version.
+		u.discard()
 	default:
 		// File hasn't completed uploading.
 		u.updateUploaded()
 	}
-	return nil
+	return status
+}
+
+// recordUpload logs and records the metrics for an upload session that ended
+// with the file in state.
+func (u *uploadFileHandler) recordUpload(state fileState) {
+	duration := time.Since(u.started)
+	metrics.BytesUploaded.Add(float64(u.nbytes))
+	metrics.UploadDuration.Observe(duration.Seconds())
+	ctx := []interface{}{"file", u.file.ID, "state", state.String(), "bytes", u.nbytes, "duration", duration}
+	if state == fileStateInvalid {
+		metrics.ChecksumFailures.Inc()
+		u.log.Warn("Upload discarded, checksums don't match", ctx...)
+		return
+	}
+	u.log.Info("Upload closed", ctx...)
 }
 
 // fileState determines an uploaded files state. It determines
-// the state by comparing expected checksums and sizes.
+// the state by comparing expected checksums and sizes. A file is
+// only verified when the hashes for every algorithm match.
 func (u *uploadFileHandler) fileState() fileState {
-	path := mc.FilePathFrom(u.mcdir, u.file.FileID())
-	checksum, err := file.HashStr(md5.New(), path)
+	// A file with fewer bytes than expected is still being uploaded, so it
+	// isn't read back. Reading a file in S3 finishes its multipart upload,
+	// which would stop the next session from continuing it.
+	if info, err := u.store.Stat(u.file.FileID()); err != nil || info.Size < u.file.Size {
+		return fileStateIncomplete
+	}
+
+	expected := u.file.Digests()
+	computed, err := u.computeDigests(expected.Algorithms())
 	switch {
 	case err != nil:
 		return fileStateIncomplete
-	case checksum == u.file.Checksum:
+	case computed.Verify(expected) == "":
 		return fileStateVerified
 	default:
 		// Not sure if the file is complete or not.
-		// Look at the file size on disk vs expected
+		// Look at the stored file size vs expected
 		// file size to determine file state.
-		finfo, err := os.Stat(path)
+		info, err := u.store.Stat(u.file.FileID())
 		switch {
 		case err != nil:
 			return fileStateIncomplete
-		case finfo.Size() > u.file.Size:
+		case info.Size > u.file.Size, u.sizeLimited && info.Size == u.file.Size:
 			// At this point we know the checksums don't match.
-			// If the size is greater than or equal to what we
-			// expect then the client sent us garbage.
+			// If the size is greater than what we expect, or
+			// all the bytes of a size limited upload are there,
+			// then the client sent us garbage.
 			return fileStateInvalid
 		default:
-			// File size on disk < expected size, so not finished
+			// Stored file size < expected size, so not finished
 			// uploading yet.
 			return fileStateIncomplete
 		}
 	}
 }
 
+// computeDigests computes the hashes of the stored file for each of algs.
+func (u *uploadFileHandler) computeDigests(algs []string) (digest.Set, error) {
+	r, err := u.store.ReadRange(u.file.FileID(), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return digest.Compute(r, algs...)
+}
+
 // markCurrent will mark the file being written to as current, plus
 // all other files that point to it. It will hide all the files parents.
 func (u *uploadFileHandler) markCurrent() {
@@ -237,10 +283,12 @@ func (u *uploadFileHandler) markCurrent() {
 }
 
 // makeFileCurrent goes through all the steps to take an entry that isn't connected
-// into the system, make it the current entry, and hide its parent.
+// into the system, make it the current entry, and hide its parent. The post upload
+// processing for the file is queued.
 func (u *uploadFileHandler) makeFileCurrent(file *schema.File) {
 	file.Uploaded = file.Size
 	file.Current = true
+	file.MediaType = u.detectMediaType(file)
 	u.service.File.Update(file)
 	u.service.File.AddDirectories(file, file.DataDirs...)
 	if file.Parent != "" {
@@ -249,17 +297,35 @@ func (u *uploadFileHandler) makeFileCurrent(file *schema.File) {
 			u.service.File.Hide(f)
 		}
 	}
+
+	if err := process.Queue(u.service, file); err != nil {
+		u.log.Error("Unable to queue processing", "file", file.ID, "err", err)
+	}
+}
+
+// detectMediaType determines the media type of a file from its name and the start
+// of its stored bytes.
+func (u *uploadFileHandler) detectMediaType(file *schema.File) schema.MediaType {
+	var head []byte
+	if r, err := u.store.ReadRange(file.FileID(), 0, mediatype.SniffLen); err == nil {
+		head, _ = ioutil.ReadAll(r)
+		r.Close()
+	}
+	return mediatype.Detect(file.Name, head)
 }
 
-// truncate will make the size of the current file 0. This routine
-// is used when an upload sends us garbage.
-func (u *uploadFileHandler) truncate() {
-	path := mc.FilePathFrom(u.mcdir, u.file.ID)
-	os.Truncate(path, 0)
+// discard will remove the stored bytes for the current file, so the next
+// upload starts from the beginning. This routine is used when an upload
+// sends us garbage.
+func (u *uploadFileHandler) discard() {
+	u.store.Delete(u.file.FileID())
 }
 
-// updateUploaded updates the total number of bytes written to the file.
+// updateUploaded updates the total number of bytes written to the file. The
+// modification time is also updated so that partials that are still being
+// worked on are not treated as abandoned.
 func (u *uploadFileHandler) updateUploaded() {
 	u.file.Uploaded += u.nbytes
+	u.file.MTime = time.Now()
 	u.service.File.Update(u.file)
 }
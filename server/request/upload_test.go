@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"github.com/materials-commons/gohandy/file"
 	"github.com/materials-commons/mcfs/base/mc"
-	"github.com/materials-commons/mcfs/base/model"
 	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/store"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -16,8 +16,7 @@ var _ = fmt.Println
 
 func TestUploadCases(t *testing.T) {
 	// Test New File
-	h := NewReqHandler(nil, "/tmp/mcdir")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMCDir("/tmp/mcdir"))
 
 	// Test bad upload with non existant DataFileID
 	uploadReq := protocol.UploadReq{
@@ -102,10 +101,9 @@ func TestUploadCases(t *testing.T) {
 	}
 
 	// Test interrupted transfer
-	h.mcdir = "/tmp/mcdir"
 	h.user = "test@mc.org"
-	os.MkdirAll(h.mcdir, 0777)
-	w, _ := fileOpen(h.mcdir, createdID, 0)
+	os.MkdirAll("/tmp/mcdir", 0777)
+	w, _ := h.store.Append(createdID, 0)
 	w.Write([]byte("Hello"))
 	w.(*os.File).Sync()
 
@@ -120,14 +118,11 @@ func TestUploadCases(t *testing.T) {
 		t.Fatalf("Tried to create a new datafile id for an interrupted transfer")
 	}
 
-	fmt.Println("Deleting datafile id", createdID)
-	model.Delete("datafiles", createdID, session)
 	os.RemoveAll("/tmp/mcdir")
 }
 
 func TestUploadNewFile(t *testing.T) {
-	h := NewReqHandler(nil, "/tmp/mcdir")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMCDir("/tmp/mcdir"))
 	testfilePath := "/tmp/mcdir/testfile.txt"
 	testfileData := "Hello world for testing"
 	testfileLen := int64(len(testfileData))
@@ -147,7 +142,7 @@ func TestUploadNewFile(t *testing.T) {
 
 	createResp, _ := h.createFile(&createFileRequest)
 	createdID := createResp.ID
-	defer cleanup(createdID)
+	defer cleanup()
 	uploadReq := protocol.UploadReq{
 		DataFileID: createdID,
 		Size:       testfileLen,
@@ -183,7 +178,7 @@ func TestUploadNewFile(t *testing.T) {
 		t.Fatalf("Incorrect number of bytes written expected %d, wrote %d", testfileLen, n)
 	}
 
-	nchecksum, err := file.Hash(md5.New(), mc.FilePathFrom(h.mcdir, createdID))
+	nchecksum, err := file.Hash(md5.New(), mc.FilePathFrom("/tmp/mcdir", createdID))
 	if err != nil {
 		t.Fatalf("Unable to checksum datafile %s", createdID)
 	}
@@ -194,11 +189,15 @@ func TestUploadNewFile(t *testing.T) {
 	if nchecksumHex != checksumHex {
 		t.Fatalf("Checksums don't match for uploaded file expected = %s, got %s", checksumHex, nchecksumHex)
 	}
+
+	uploaded, _ := h.service.File.ByID(createdID)
+	if uploaded.MediaType.Mime != "text/plain" || uploaded.MediaType.Description != "Text" {
+		t.Fatalf("Media type wasn't detected for completed upload: %#v", uploaded.MediaType)
+	}
 }
 
 func TestPartialToCompleted(t *testing.T) {
-	h := NewReqHandler(nil, "/tmp/mcdir")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMCDir("/tmp/mcdir"))
 	testfilePath := "/tmp/mcdir/testfile.txt"
 	testfileData := "Hello world for testing"
 	testfileLen := int64(len(testfileData))
@@ -218,7 +217,7 @@ func TestPartialToCompleted(t *testing.T) {
 
 	createResp, _ := h.createFile(&createFileRequest)
 	createdID := createResp.ID
-	defer cleanup(createdID)
+	defer cleanup()
 
 	uploadReq := protocol.UploadReq{
 		DataFileID: createdID,
@@ -280,7 +279,7 @@ func TestPartialToCompleted(t *testing.T) {
 		t.Fatalf("Incorrect number of bytes written expected %d, wrote %d", testfileLen, n)
 	}
 
-	nchecksum, err := file.Hash(md5.New(), mc.FilePathFrom(h.mcdir, createdID))
+	nchecksum, err := file.Hash(md5.New(), mc.FilePathFrom("/tmp/mcdir", createdID))
 	if err != nil {
 		t.Fatalf("Unable to checksum datafile %s", createdID)
 	}
@@ -293,9 +292,55 @@ func TestPartialToCompleted(t *testing.T) {
 	}
 }
 
+func TestFullSizeBadChecksumIsIncomplete(t *testing.T) {
+	h := newTestHandler(t, store.NewMCDir("/tmp/mcdir"))
+	testfileData := "Hello world for testing"
+	testfileLen := int64(len(testfileData))
+	checksumHex := fmt.Sprintf("%x", md5.Sum([]byte("Something else entirely")))
+	createFileRequest := protocol.CreateFileReq{
+		ProjectID: "9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3",
+		DataDirID: "f0ebb733-c75d-4983-8d68-242d688fcf73",
+		Name:      "testfile.txt",
+		Size:      testfileLen,
+		Checksum:  checksumHex,
+	}
+
+	createResp, _ := h.createFile(&createFileRequest)
+	defer cleanup()
+
+	resp, err := h.upload(&protocol.UploadReq{
+		DataFileID: createResp.ID,
+		Size:       testfileLen,
+		Checksum:   checksumHex,
+	})
+	if err != nil {
+		t.Fatalf("error %s", err)
+	}
+
+	uploadHandler, err := createUploadFileHandler(h, resp.DataFileID, resp.Offset)
+	if err != nil {
+		t.Fatalf("Couldn't create uploadHandler %s", err)
+	}
+
+	sendReq := protocol.SendReq{
+		DataFileID: createResp.ID,
+		Bytes:      []byte(testfileData),
+	}
+	uploadHandler.sendReqWrite(&sendReq)
+
+	// A TCP upload only discards the file when more bytes than expected
+	// were sent.
+	if state := uploadHandler.fileClose(); state != fileStateIncomplete {
+		t.Fatalf("Expected a full size file with bad checksums to be incomplete, got %s", state)
+	}
+
+	if info, err := h.store.Stat(uploadHandler.file.FileID()); err != nil || info.Size != testfileLen {
+		t.Fatalf("Stored bytes were discarded: %#v, %v", info, err)
+	}
+}
+
 func TestUploadNewFileExistingFileMatches(t *testing.T) {
-	h := NewReqHandler(nil, "/tmp/mcdir")
-	h.user = "test@mc.org"
+	h := newTestHandler(t, store.NewMCDir("/tmp/mcdir"))
 	testfilePath := "/tmp/mcdir/testfile.txt"
 	testfileData := "Hello world for testing"
 	testfileLen := int64(len(testfileData))
@@ -315,7 +360,7 @@ func TestUploadNewFileExistingFileMatches(t *testing.T) {
 
 	createResp, _ := h.createFile(&createFileRequest)
 	createdID := createResp.ID
-	defer cleanup(createdID)
+	defer cleanup()
 	uploadReq := protocol.UploadReq{
 		DataFileID: createdID,
 		Size:       testfileLen,
@@ -370,7 +415,7 @@ func TestUploadNewFileExistingFileMatches(t *testing.T) {
 
 	// Then we will write the rest of the file and request an upload. Now we should get back
 	// the newly created id and an offset equal to the length of the file
-	w, err := fileOpen(h.mcdir, createdID, testfileLen-1)
+	w, err := h.store.Append(createdID, testfileLen-1)
 	w.Write([]byte(testfileData[len(testfileData)-1:]))
 	w.Close()
 	resp, err = h.upload(&uploadReq)
@@ -381,12 +426,8 @@ func TestUploadNewFileExistingFileMatches(t *testing.T) {
 	if resp.Offset != testfileLen {
 		t.Errorf("Got back wrong length, got %d, expected %d", resp.Offset, testfileLen-1)
 	}
-
-	model.Delete("datafiles", newID, session)
 }
 
-func cleanup(datafileID string) {
-	fmt.Println("Deleting datafile id =", datafileID)
-	model.Delete("datafiles", datafileID, session)
+func cleanup() {
 	os.RemoveAll("/tmp/mcdir")
 }
@@ -1,18 +1,18 @@
 package request
 
 import (
-	"github.com/materials-commons/mcfs/base/mc"
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/schema"
-	"os"
+	"github.com/materials-commons/mcfs/server/store"
 )
 
-func datafileSize(mcdir, dataFileID string) int64 {
-	path := mc.FilePathFrom(mcdir, dataFileID)
-	finfo, err := os.Stat(path)
+func datafileSize(st store.Store, dataFileID string) int64 {
+	info, err := st.Stat(dataFileID)
 	switch {
 	case err == nil:
-		return finfo.Size()
-	case os.IsNotExist(err):
+		return info.Size
+	case mcerr.Is(err, mcerr.ErrNotFound):
 		return 0
 	default:
 		return -1
@@ -26,3 +26,39 @@ func datafileLocationID(dataFile *schema.File) string {
 
 	return dataFile.ID
 }
+
+// requestChecksums combines the MD5 checksum and the checksums map sent in a request
+// into a single set of hashes.
+func requestChecksums(checksum string, checksums digest.Set) digest.Set {
+	all := make(digest.Set, len(checksums)+1)
+	for alg, value := range checksums {
+		all[alg] = value
+	}
+
+	if checksum != "" && all[digest.MD5] == "" {
+		all[digest.MD5] = checksum
+	}
+
+	return all
+}
+
+// validateChecksums checks that a request sent at least one hash, that all the
+// hashes are for supported algorithms, and that the MD5 checksum agrees with the
+// checksums map.
+func validateChecksums(name, checksum string, checksums digest.Set) error {
+	if checksum != "" && checksums[digest.MD5] != "" && checksum != checksums[digest.MD5] {
+		return mcerr.Errorf(mcerr.ErrInvalid, "Conflicting md5 checksums for file %s", name)
+	}
+
+	for alg, value := range checksums {
+		if !digest.Supported(alg) || value == "" {
+			return mcerr.Errorf(mcerr.ErrInvalid, "Bad %s checksum (%s) for file %s", alg, value, name)
+		}
+	}
+
+	if checksum == "" && len(checksums) == 0 {
+		return mcerr.Errorf(mcerr.ErrInvalid, "No checksum for file %s", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package request
+
+import (
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+// versions returns the version history of a datafile, newest first.
+func (h *ReqHandler) versions(req *protocol.VersionsReq) (*protocol.VersionsResp, error) {
+	file, err := h.accessibleFile(req.DataFileID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &protocol.VersionsResp{}
+	for _, version := range service.Versions(h.service.File, file) {
+		resp.Versions = append(resp.Versions, respVersion(&version))
+	}
+
+	return resp, nil
+}
+
+// respVersion creates the Version object from the file.
+func respVersion(file *schema.File) protocol.Version {
+	return protocol.Version{
+		DataFileID: file.ID,
+		Name:       file.Name,
+		Current:    file.Current,
+		Owner:      file.Owner,
+		Checksum:   file.Checksum,
+		Checksums:  file.Digests(),
+		Size:       file.Size,
+		Birthtime:  file.Birthtime,
+		MTime:      file.MTime,
+	}
+}
+
+// restoreVersion makes a previous version of a file current again. A new version
+// is created that uses the bytes of the previous version, and the current version
+// is hidden. This keeps the history going forward, so the version that was
+// replaced can itself be restored later.
+func (h *ReqHandler) restoreVersion(req *protocol.RestoreVersionReq) (*protocol.CreateResp, error) {
+	version, err := h.accessibleFile(req.DataFileID)
+	switch {
+	case err != nil:
+		return nil, err
+	case version.Current:
+		// Nothing to do
+		return &protocol.CreateResp{ID: version.ID}, nil
+	case version.Uploaded != version.Size:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Version %s was never completely uploaded", version.ID)
+	case len(version.DataDirs) == 0:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Version %s isn't in a directory", version.ID)
+	}
+
+	restored := schema.NewFile(version.Name, h.user)
+	restored.Description = version.Description
+	restored.MediaType = version.MediaType
+	restored.Checksum = version.Checksum
+	restored.Checksums = version.Checksums
+	restored.Size = version.Size
+	restored.Uploaded = version.Size
+	restored.UsesID = version.FileID()
+	restored.DataDirs = version.DataDirs
+	restored.Tags = version.Tags
+
+	current, err := h.service.File.ByPath(version.Name, version.DataDirs[0])
+	switch {
+	case err == nil:
+		restored.Parent = current.ID
+	case !mcerr.Is(err, mcerr.ErrNotFound):
+		return nil, err
+	}
+
+	created, err := h.service.File.Insert(&restored)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil {
+		h.service.File.Hide(current)
+	}
+
+	return &protocol.CreateResp{ID: created.ID}, nil
+}
+
+// accessibleFile looks up a file, checking that the user has access to it.
+func (h *ReqHandler) accessibleFile(dataFileID string) (*schema.File, error) {
+	file, err := h.service.File.ByID(dataFileID)
+	switch {
+	case err != nil:
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown id %s", dataFileID)
+	case !h.service.Group.HasAccess(file.Owner, h.user):
+		return nil, mcerr.Errorf(mcerr.ErrNoAccess, "You do not have permission to access this datafile %s", dataFileID)
+	default:
+		return file, nil
+	}
+}
@@ -0,0 +1,163 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/protocol"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// addTestVersions adds two versions of versions.txt to the fixture, the way an
+// upload would leave them. The first version is hidden and the second is current.
+// Each version's bytes are its name.
+func addTestVersions(t *testing.T, h *ReqHandler) (v1, v2 *schema.File) {
+	v1 = addTestVersion(t, h, "v1", "")
+	v2 = addTestVersion(t, h, "v2", v1.ID)
+	h.service.File.Hide(v1)
+	return v1, v2
+}
+
+// addTestVersion adds a single completely uploaded version.
+func addTestVersion(t *testing.T, h *ReqHandler, contents, parent string) *schema.File {
+	file := schema.NewFile("versions.txt", testUser)
+	file.DataDirs = []string{testSubDirID}
+	file.Checksum = contents
+	file.Size = int64(len(contents))
+	file.Uploaded = file.Size
+	file.Parent = parent
+	f, err := h.service.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert version %s: %s", contents, err)
+	}
+
+	w, _ := h.store.Append(f.ID, 0)
+	w.Write([]byte(contents))
+	w.Close()
+	return f
+}
+
+func TestVersions(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+	v1, v2 := addTestVersions(t, h)
+
+	resp, err := h.versions(&protocol.VersionsReq{DataFileID: v2.ID})
+	if err != nil {
+		t.Fatalf("Unable to list versions: %s", err)
+	}
+
+	if len(resp.Versions) != 2 {
+		t.Fatalf("Expected 2 versions, got %#v", resp.Versions)
+	}
+
+	if resp.Versions[0].DataFileID != v2.ID || !resp.Versions[0].Current {
+		t.Errorf("Expected current version %s first, got %#v", v2.ID, resp.Versions[0])
+	}
+
+	if resp.Versions[1].DataFileID != v1.ID || resp.Versions[1].Current {
+		t.Errorf("Expected hidden version %s second, got %#v", v1.ID, resp.Versions[1])
+	}
+
+	if resp.Versions[1].Size != 2 || resp.Versions[1].Owner != testUser {
+		t.Errorf("Wrong size or owner for version %#v", resp.Versions[1])
+	}
+
+	// Test file we don't have access to
+	if _, err := h.versions(&protocol.VersionsReq{DataFileID: test2FileID}); err == nil {
+		t.Errorf("Listed versions of a file we don't have access to")
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+	v1, v2 := addTestVersions(t, h)
+
+	resp, err := h.restoreVersion(&protocol.RestoreVersionReq{DataFileID: v1.ID})
+	if err != nil {
+		t.Fatalf("Unable to restore version: %s", err)
+	}
+
+	current, err := h.service.File.ByPath("versions.txt", testSubDirID)
+	if err != nil {
+		t.Fatalf("No current version after restore: %s", err)
+	}
+
+	if current.ID != resp.ID {
+		t.Fatalf("Restored version %s isn't current, %s is", resp.ID, current.ID)
+	}
+
+	if current.UsesID != v1.ID || current.Parent != v2.ID {
+		t.Errorf("Restored version should use %s and have parent %s: %#v", v1.ID, v2.ID, current)
+	}
+
+	if old, _ := h.service.File.ByID(v2.ID); old.Current {
+		t.Errorf("Version %s replaced by restore is still current", v2.ID)
+	}
+
+	versions, _ := h.versions(&protocol.VersionsReq{DataFileID: current.ID})
+	if len(versions.Versions) != 3 {
+		t.Errorf("Expected 3 versions after restore, got %#v", versions.Versions)
+	}
+
+	// Restoring the current version does nothing
+	resp, err = h.restoreVersion(&protocol.RestoreVersionReq{DataFileID: current.ID})
+	if err != nil || resp.ID != current.ID {
+		t.Errorf("Restoring the current version should return it: %#v/%s", resp, err)
+	}
+
+	// Test partial versions can't be restored
+	partial := addTestVersion(t, h, "v3", current.ID)
+	partial.Current = false
+	partial.Uploaded = 1
+	h.service.File.Update(partial)
+	if _, err := h.restoreVersion(&protocol.RestoreVersionReq{DataFileID: partial.ID}); err == nil {
+		t.Errorf("Restored a version that was never completely uploaded")
+	}
+}
+
+func TestDownload(t *testing.T) {
+	h := newTestHandler(t, store.NewMemory())
+	v1, _ := addTestVersions(t, h)
+	restored, _ := h.restoreVersion(&protocol.RestoreVersionReq{DataFileID: v1.ID})
+
+	req := protocol.DownloadReq{
+		Type:   protocol.DataFile,
+		ID:     restored.ID,
+		Length: 1,
+	}
+
+	// Restored versions share the bytes of the version they restored.
+	var contents []byte
+	for {
+		resp, err := h.download(&req)
+		if err != nil {
+			t.Fatalf("Download failed at offset %d: %s", req.Offset, err)
+		}
+		if !resp.Ok {
+			t.Fatalf("Download at offset %d wasn't Ok", req.Offset)
+		}
+		if len(resp.Bytes) == 0 {
+			break
+		}
+		contents = append(contents, resp.Bytes...)
+		req.Offset += int64(len(resp.Bytes))
+	}
+
+	if string(contents) != "v1" {
+		t.Errorf("Expected to download 'v1', got '%s'", contents)
+	}
+
+	// Test file we don't have access to
+	req.ID = test2FileID
+	req.Offset = 0
+	if _, err := h.download(&req); err == nil {
+		t.Errorf("Downloaded a file we don't have access to")
+	}
+
+	// Test only datafiles can be downloaded
+	req.ID = testSubDirID
+	req.Type = protocol.DataDir
+	if _, err := h.download(&req); err == nil {
+		t.Errorf("Downloaded a directory")
+	}
+}
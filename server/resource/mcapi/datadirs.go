@@ -0,0 +1,80 @@
+package mcapi
+
+import (
+	"path/filepath"
+
+	"github.com/emicklei/go-restful"
+	"github.com/materials-commons/mcfs/base/dir"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+// dirListing is a directory and the directories and files directly in it.
+type dirListing struct {
+	Directory *schema.Directory
+	Entries   []dir.FileInfo
+}
+
+type dirsResource struct {
+	service *service.Service
+}
+
+func newDirsResource(container *restful.Container, svc *service.Service) error {
+	dr := dirsResource{
+		service: svc,
+	}
+	dr.register(container)
+	return nil
+}
+
+func (d dirsResource) register(container *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path("/api/datadirs").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("/{datadir-id}").To(d.get).
+		Doc("Retrieve a directory and the directories and files in it.").
+		Param(ws.PathParameter("datadir-id", "id of the directory").DataType("string")).
+		Param(ws.QueryParameter("base", "path the entry paths are made relative to").DataType("string")).
+		Writes(dirListing{}))
+
+	container.Add(ws)
+}
+
+func (d dirsResource) get(request *restful.Request, response *restful.Response) {
+	user := currentUser(request)
+	datadir, err := d.service.Dir.ByID(request.PathParameter("datadir-id"))
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	if err := checkAccess(d.service, datadir.Owner, user); err != nil {
+		writeError(response, err)
+		return
+	}
+
+	base := request.QueryParameter("base")
+	entries, err := d.service.Project.Files(datadir.Project, base)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	listing := dirListing{
+		Directory: datadir,
+		Entries:   []dir.FileInfo{},
+	}
+	datadir.Tags = schema.Tags.Visible(datadir.Tags, user)
+	parent := filepath.Join(base, datadir.Name)
+	for _, entry := range entries {
+		if filepath.Dir(entry.Path) != parent {
+			continue
+		}
+		entry.Tags = schema.Tags.Visible(entry.Tags, user)
+		listing.Entries = append(listing.Entries, entry)
+	}
+
+	response.WriteEntity(listing)
+}
@@ -0,0 +1,80 @@
+package mcapi
+
+import (
+	"github.com/emicklei/go-restful"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+type filesResource struct {
+	service *service.Service
+}
+
+func newFilesResource(container *restful.Container, svc *service.Service) error {
+	fr := filesResource{
+		service: svc,
+	}
+	fr.register(container)
+	return nil
+}
+
+func (f filesResource) register(container *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path("/api/datafiles").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("/{datafile-id}").To(f.get).
+		Doc("Retrieve a file's size, checksums, upload state and other attributes.").
+		Param(ws.PathParameter("datafile-id", "id of the file").DataType("string")).
+		Writes(schema.File{}))
+
+	ws.Route(ws.GET("/{datafile-id}/versions").To(f.versions).
+		Doc("List a file and the versions it replaced, newest first.").
+		Param(ws.PathParameter("datafile-id", "id of the file").DataType("string")).
+		Writes([]schema.File{}))
+
+	container.Add(ws)
+}
+
+func (f filesResource) get(request *restful.Request, response *restful.Response) {
+	file, err := f.file(request)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+	response.WriteEntity(file)
+}
+
+// versions lists a file and the versions it replaced, newest first.
+func (f filesResource) versions(request *restful.Request, response *restful.Response) {
+	file, err := f.file(request)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	versions := service.Versions(f.service.File, file)
+	for i := range versions {
+		versions[i].Tags = schema.Tags.Visible(versions[i].Tags, currentUser(request))
+	}
+
+	response.WriteEntity(versions)
+}
+
+// file retrieves the file in the request's path, if the user can access it.
+// Only the tags the user can see are returned.
+func (f filesResource) file(request *restful.Request) (*schema.File, error) {
+	user := currentUser(request)
+	file, err := f.service.File.ByID(request.PathParameter("datafile-id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAccess(f.service, file.Owner, user); err != nil {
+		return nil, err
+	}
+
+	file.Tags = schema.Tags.Visible(file.Tags, user)
+	return file, nil
+}
@@ -0,0 +1,131 @@
+/*
+Package mcapi is the REST API to the projects, directories, files, groups and
+share links on the server. It is served over http under /api, for the web front end and
+scripts:
+
+	GET    /api/projects                      Projects the user can access
+	GET    /api/projects/{project-id}         A project
+	GET    /api/projects/{project-id}/tree    Every directory and file in a project
+	GET    /api/datadirs/{datadir-id}         A directory and its entries
+	GET    /api/datafiles/{datafile-id}       A file
+	GET    /api/datafiles/{datafile-id}/versions
+	                                          A file and its previous versions
+	GET    /api/groups                        Groups the user owns
+	POST   /api/groups                        Create a group
+	GET    /api/groups/{group-id}             A group
+	PUT    /api/groups/{group-id}             Update a group's name, description and users
+	DELETE /api/groups/{group-id}             Delete a group
+	PUT    /api/groups/{group-id}/users/{user}
+	DELETE /api/groups/{group-id}/users/{user}
+	                                          Add or remove a user
+	GET    /api/sharelinks                    Share links the user created
+	POST   /api/sharelinks                    Create a share link
+	DELETE /api/sharelinks/{link-id}          Revoke a share link
+
+Every request must identify its user with an apikey, either in the apikey
+query parameter or as a bearer token in the Authorization header. Users only
+see items they own or were given access to through the owner's groups.
+*/
+package mcapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/share"
+)
+
+// userAttribute is the request attribute holding the authenticated user.
+const userAttribute = "user"
+
+// NewContainer creates a container for all the mcapi web services. Share links
+// are created and checked by links. Mount it on /api/.
+func NewContainer(svc *service.Service, links *share.Links) *restful.Container {
+	container := restful.NewContainer()
+	container.Filter(authenticate(svc))
+
+	if err := newProjectsResource(container, svc); err != nil {
+		panic("Could not register projectsResource")
+	}
+
+	if err := newDirsResource(container, svc); err != nil {
+		panic("Could not register dirsResource")
+	}
+
+	if err := newFilesResource(container, svc); err != nil {
+		panic("Could not register filesResource")
+	}
+
+	if err := newGroupsResource(container, svc); err != nil {
+		panic("Could not register groupsResource")
+	}
+
+	if err := newShareLinksResource(container, links); err != nil {
+		panic("Could not register shareLinksResource")
+	}
+
+	return container
+}
+
+// authenticate returns a filter that looks up the user for a request's
+// apikey. Requests without a valid apikey are refused.
+func authenticate(svc *service.Service) restful.FilterFunction {
+	return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		apikey := request.QueryParameter("apikey")
+		if auth := request.HeaderParameter("Authorization"); apikey == "" && strings.HasPrefix(auth, "Bearer ") {
+			apikey = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+
+		if apikey == "" {
+			response.WriteErrorString(http.StatusUnauthorized, "No apikey")
+			return
+		}
+
+		u, err := svc.User.ByAPIKey(apikey)
+		if err != nil {
+			response.WriteErrorString(http.StatusUnauthorized, "Bad apikey")
+			return
+		}
+
+		request.SetAttribute(userAttribute, u)
+		chain.ProcessFilter(request, response)
+	}
+}
+
+// currentUser returns the email of the user making the request.
+func currentUser(request *restful.Request) string {
+	return request.Attribute(userAttribute).(*schema.User).Email
+}
+
+// checkAccess returns ErrNoAccess if user can't access items owned by owner.
+func checkAccess(svc *service.Service, owner, user string) error {
+	if !svc.Group.HasAccess(owner, user) {
+		return mcerr.Errorf(mcerr.ErrNoAccess, "%s doesn't have access", user)
+	}
+	return nil
+}
+
+// writeError writes err with the http status for its kind.
+func writeError(response *restful.Response, err error) {
+	response.WriteErrorString(errorStatus(err), err.Error())
+}
+
+// errorStatus maps an error to an http status code.
+func errorStatus(err error) int {
+	switch {
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		return http.StatusNotFound
+	case mcerr.Is(err, mcerr.ErrNoAccess):
+		return http.StatusForbidden
+	case mcerr.Is(err, mcerr.ErrInvalid):
+		return http.StatusBadRequest
+	case mcerr.Is(err, mcerr.ErrExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
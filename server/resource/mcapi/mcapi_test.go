@@ -0,0 +1,294 @@
+package mcapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/dir"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/share"
+)
+
+// testAPI serves the API for a set of projects:
+//
+//	Proj    owned by test@mc.org, with Proj/top.txt and Proj/a/x.txt. x.txt
+//	        has two versions.
+//	Shared  owned by test2@mc.org, who added test@mc.org to a group.
+//	Private owned by test3@mc.org.
+//
+// test4@mc.org has no projects.
+type testAPI struct {
+	t         *testing.T
+	svc       *service.Service
+	links     *share.Links
+	server    *httptest.Server
+	projectID string
+	dirID     string
+	fileID    string
+	privateID string
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	ta := &testAPI{
+		t: t,
+		svc: service.NewMemory(
+			schema.NewUser("test", "test@mc.org", "", "testkey"),
+			schema.NewUser("test2", "test2@mc.org", "", "test2key"),
+			schema.NewUser("test3", "test3@mc.org", "", "test3key"),
+			schema.NewUser("test4", "test4@mc.org", "", "test4key"),
+		),
+	}
+
+	p := ta.addProject("Proj", "test@mc.org")
+	ta.projectID = p.ID
+	d := schema.NewDirectory("Proj/a", p.Owner, p.ID, p.DataDir)
+	datadir, _ := ta.svc.Dir.Insert(&d)
+	ta.svc.Project.AddDirectories(p, datadir.ID)
+	ta.dirID = datadir.ID
+
+	ta.addFile("top.txt", p.DataDir, "")
+	first := ta.addFile("x.txt", ta.dirID, "")
+	first.Current = false
+	ta.svc.File.Update(first)
+	ta.fileID = ta.addFile("x.txt", ta.dirID, first.ID).ID
+
+	ta.addProject("Shared", "test2@mc.org")
+	g := schema.NewGroup("test2@mc.org", "readers")
+	g.Users = []string{"test@mc.org"}
+	ta.svc.Group.Insert(&g)
+
+	ta.privateID = ta.addProject("Private", "test3@mc.org").ID
+
+	ta.links = share.New(ta.svc, []byte("secret"))
+	ta.server = httptest.NewServer(NewContainer(ta.svc, ta.links))
+	return ta
+}
+
+func (ta *testAPI) addProject(name, owner string) *schema.Project {
+	proj := schema.NewProject(name, "", owner)
+	p, err := ta.svc.Project.Insert(&proj)
+	if err != nil {
+		ta.t.Fatalf("Unable to create project %s: %s", name, err)
+	}
+	return p
+}
+
+func (ta *testAPI) addFile(name, dirID, parent string) *schema.File {
+	file := schema.NewFile(name, "test@mc.org")
+	file.DataDirs = []string{dirID}
+	file.Parent = parent
+	file.Tags = []schema.Tag{
+		{Key: "public", Value: "yes"},
+		{Key: "private", Value: "yes", User: "test2@mc.org"},
+	}
+	f, err := ta.svc.File.Insert(&file)
+	if err != nil {
+		ta.t.Fatalf("Unable to create file %s: %s", name, err)
+	}
+	datadir, _ := ta.svc.Dir.ByID(dirID)
+	ta.svc.Dir.AddFiles(datadir, f.ID)
+	return f
+}
+
+// do sends a request with apikey, and decodes the JSON response into result
+// when the request succeeds.
+func (ta *testAPI) do(method, path, apikey, body string, result interface{}) int {
+	req, _ := http.NewRequest(method, ta.server.URL+path, strings.NewReader(body))
+	if apikey != "" {
+		req.Header.Set("Authorization", "Bearer "+apikey)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ta.t.Fatalf("%s %s failed: %s", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 300 && result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			ta.t.Fatalf("%s %s returned bad JSON %q: %s", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// raw sends a request with apikey, and returns the status and the body as it
+// was sent.
+func (ta *testAPI) raw(method, path, apikey string) (int, string) {
+	req, _ := http.NewRequest(method, ta.server.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+apikey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ta.t.Fatalf("%s %s failed: %s", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func (ta *testAPI) expect(what string, status, expected int) {
+	if status != expected {
+		ta.t.Fatalf("%s: expected status %d, got %d", what, expected, status)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ta := newTestAPI(t)
+	defer ta.server.Close()
+
+	ta.expect("No apikey", ta.do("GET", "/api/projects", "", "", nil), http.StatusUnauthorized)
+	ta.expect("Bad apikey", ta.do("GET", "/api/projects", "nokey", "", nil), http.StatusUnauthorized)
+	ta.expect("Bearer token", ta.do("GET", "/api/projects", "testkey", "", nil), http.StatusOK)
+	ta.expect("Query apikey", ta.do("GET", "/api/projects?apikey=testkey", "", "", nil), http.StatusOK)
+}
+
+func TestProjects(t *testing.T) {
+	ta := newTestAPI(t)
+	defer ta.server.Close()
+
+	var projects []schema.Project
+	ta.expect("List", ta.do("GET", "/api/projects", "testkey", "", &projects), http.StatusOK)
+	if len(projects) != 2 || projects[0].Name != "Proj" || projects[1].Name != "Shared" {
+		t.Fatalf("Expected Proj and Shared, got %#v", projects)
+	}
+
+	status, body := ta.raw("GET", "/api/projects", "test4key")
+	ta.expect("List none", status, http.StatusOK)
+	if strings.TrimSpace(body) != "[]" {
+		t.Fatalf("Expected an empty list, got %s", body)
+	}
+
+	var project schema.Project
+	ta.expect("Get", ta.do("GET", "/api/projects/"+ta.projectID, "testkey", "", &project), http.StatusOK)
+	if project.ID != ta.projectID {
+		t.Fatalf("Wrong project %#v", project)
+	}
+
+	ta.expect("No access", ta.do("GET", "/api/projects/"+ta.privateID, "testkey", "", nil), http.StatusForbidden)
+	ta.expect("Unknown", ta.do("GET", "/api/projects/no-such-project", "testkey", "", nil), http.StatusNotFound)
+
+	var tree []dir.FileInfo
+	ta.expect("Tree", ta.do("GET", "/api/projects/"+ta.projectID+"/tree", "testkey", "", &tree), http.StatusOK)
+	var paths []string
+	for _, entry := range tree {
+		paths = append(paths, entry.Path)
+	}
+	if strings.Join(paths, ",") != "Proj,Proj/a,Proj/a/x.txt,Proj/a/x.txt,Proj/top.txt" {
+		t.Fatalf("Wrong tree %v", paths)
+	}
+}
+
+func TestDirsAndFiles(t *testing.T) {
+	ta := newTestAPI(t)
+	defer ta.server.Close()
+
+	var listing dirListing
+	ta.expect("Dir", ta.do("GET", "/api/datadirs/"+ta.dirID, "testkey", "", &listing), http.StatusOK)
+	if listing.Directory.Name != "Proj/a" || len(listing.Entries) != 2 || listing.Entries[0].Path != "Proj/a/x.txt" {
+		t.Fatalf("Wrong listing %#v", listing)
+	}
+	if len(listing.Entries[0].Tags) != 1 {
+		t.Fatalf("Only public tags should be visible: %#v", listing.Entries[0].Tags)
+	}
+
+	ta.expect("Dir base", ta.do("GET", "/api/datadirs/"+ta.dirID+"?base=/home/test", "testkey", "", &listing), http.StatusOK)
+	if len(listing.Entries) != 2 || listing.Entries[0].Path != "/home/test/Proj/a/x.txt" {
+		t.Fatalf("Wrong listing with a base %#v", listing)
+	}
+
+	ta.expect("Dir no access", ta.do("GET", "/api/datadirs/"+ta.dirID, "test3key", "", nil), http.StatusForbidden)
+
+	var file schema.File
+	ta.expect("File", ta.do("GET", "/api/datafiles/"+ta.fileID, "testkey", "", &file), http.StatusOK)
+	if file.ID != ta.fileID || !file.Current || len(file.Tags) != 1 {
+		t.Fatalf("Wrong file %#v", file)
+	}
+
+	var versions []schema.File
+	ta.expect("Versions", ta.do("GET", "/api/datafiles/"+ta.fileID+"/versions", "testkey", "", &versions), http.StatusOK)
+	if len(versions) != 2 || versions[0].ID != ta.fileID || versions[1].Current {
+		t.Fatalf("Expected the current version, then the previous one: %#v", versions)
+	}
+
+	ta.expect("Unknown file", ta.do("GET", "/api/datafiles/no-such-file", "testkey", "", nil), http.StatusNotFound)
+}
+
+func TestGroups(t *testing.T) {
+	ta := newTestAPI(t)
+	defer ta.server.Close()
+
+	var group schema.Group
+	ta.expect("Create without name", ta.do("POST", "/api/groups", "testkey", `{"Description": "x"}`, nil), http.StatusBadRequest)
+	ta.expect("Create", ta.do("POST", "/api/groups", "testkey", `{"Name": "team", "Users": ["a@mc.org"]}`, &group), http.StatusCreated)
+	if group.Owner != "test@mc.org" || group.Name != "team" || len(group.Users) != 1 {
+		t.Fatalf("Wrong group created %#v", group)
+	}
+	path := "/api/groups/" + group.ID
+
+	ta.expect("Add user", ta.do("PUT", path+"/users/b@mc.org", "testkey", "", &group), http.StatusOK)
+	if !ta.svc.Group.HasAccess("test@mc.org", "b@mc.org") {
+		t.Fatalf("b@mc.org should have access after being added: %#v", group)
+	}
+
+	ta.expect("Remove user", ta.do("DELETE", path+"/users/a@mc.org", "testkey", "", &group), http.StatusOK)
+	if len(group.Users) != 1 || group.Users[0] != "b@mc.org" {
+		t.Fatalf("a@mc.org should have been removed: %#v", group)
+	}
+
+	ta.expect("Update", ta.do("PUT", path, "testkey", `{"Name": "renamed", "Users": []}`, &group), http.StatusOK)
+	if group.Name != "renamed" || len(group.Users) != 0 {
+		t.Fatalf("Group wasn't updated: %#v", group)
+	}
+
+	ta.expect("Other user", ta.do("GET", path, "test2key", "", nil), http.StatusForbidden)
+
+	var groups []schema.Group
+	ta.expect("List", ta.do("GET", "/api/groups", "testkey", "", &groups), http.StatusOK)
+	if len(groups) != 1 || groups[0].ID != group.ID {
+		t.Fatalf("Expected only the new group, got %#v", groups)
+	}
+
+	ta.expect("Delete", ta.do("DELETE", path, "testkey", "", nil), http.StatusNoContent)
+	ta.expect("Deleted", ta.do("GET", path, "testkey", "", nil), http.StatusNotFound)
+}
+
+func TestShareLinks(t *testing.T) {
+	ta := newTestAPI(t)
+	defer ta.server.Close()
+
+	var created shareLinkResp
+	req := `{"FileID": "` + ta.fileID + `", "Duration": "2h", "MaxDownloads": 5}`
+	ta.expect("Create", ta.do("POST", "/api/sharelinks", "testkey", req, &created), http.StatusCreated)
+	if created.Link.FileID != ta.fileID || created.Link.MaxDownloads != 5 || created.URL != ta.links.URL(&created.Link) {
+		t.Fatalf("Wrong link created %#v", created)
+	}
+
+	ta.expect("Bad duration", ta.do("POST", "/api/sharelinks", "testkey", `{"FileID": "x", "Duration": "soon"}`, nil), http.StatusBadRequest)
+	ta.expect("No access", ta.do("POST", "/api/sharelinks", "test3key", req, nil), http.StatusForbidden)
+
+	path := "/api/sharelinks/" + created.Link.ID
+	ta.expect("Revoke by other user", ta.do("DELETE", path, "test2key", "", nil), http.StatusForbidden)
+
+	var revoked shareLinkResp
+	ta.expect("Revoke", ta.do("DELETE", path, "testkey", "", &revoked), http.StatusOK)
+	if !revoked.Link.Revoked {
+		t.Fatalf("Link wasn't revoked %#v", revoked)
+	}
+
+	var links []shareLinkResp
+	ta.expect("List", ta.do("GET", "/api/sharelinks", "testkey", "", &links), http.StatusOK)
+	if len(links) != 1 || links[0].Link.ID != created.Link.ID || !links[0].Link.Revoked {
+		t.Fatalf("Expected the revoked link, got %#v", links)
+	}
+}
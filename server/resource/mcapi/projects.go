@@ -0,0 +1,133 @@
+package mcapi
+
+import (
+	"sort"
+
+	"github.com/emicklei/go-restful"
+	"github.com/materials-commons/mcfs/base/dir"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+type projectsResource struct {
+	service *service.Service
+}
+
+func newProjectsResource(container *restful.Container, svc *service.Service) error {
+	pr := projectsResource{
+		service: svc,
+	}
+	pr.register(container)
+	return nil
+}
+
+func (p projectsResource) register(container *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path("/api/projects").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("").To(p.all).
+		Doc("List the projects the user owns or was given access to.").
+		Writes([]schema.Project{}))
+
+	ws.Route(ws.GET("/{project-id}").To(p.get).
+		Doc("Retrieve a project.").
+		Param(ws.PathParameter("project-id", "id of the project").DataType("string")).
+		Writes(schema.Project{}))
+
+	ws.Route(ws.GET("/{project-id}/tree").To(p.tree).
+		Doc("List every directory and file in the project, sorted by path.").
+		Param(ws.PathParameter("project-id", "id of the project").DataType("string")).
+		Param(ws.QueryParameter("base", "path the entry paths are made relative to").DataType("string")).
+		Writes([]dir.FileInfo{}))
+
+	container.Add(ws)
+}
+
+// all lists the user's projects, followed by the projects of every owner who
+// added the user to one of their groups.
+func (p projectsResource) all(request *restful.Request, response *restful.Response) {
+	user := currentUser(request)
+	projects, err := p.service.Project.ByOwner(user)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	groups, err := p.service.Group.ByUser(user)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	owners := map[string]bool{user: true}
+	var shared []schema.Project
+	for _, group := range groups {
+		if owners[group.Owner] {
+			continue
+		}
+		owners[group.Owner] = true
+
+		owned, err := p.service.Project.ByOwner(group.Owner)
+		if err != nil {
+			writeError(response, err)
+			return
+		}
+		shared = append(shared, owned...)
+	}
+	sort.Sort(byName(shared))
+
+	// Start from an empty list so a user without projects gets [] not null.
+	all := append([]schema.Project{}, projects...)
+	response.WriteEntity(append(all, shared...))
+}
+
+func (p projectsResource) get(request *restful.Request, response *restful.Response) {
+	project, err := p.project(request)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+	response.WriteEntity(project)
+}
+
+func (p projectsResource) tree(request *restful.Request, response *restful.Response) {
+	project, err := p.project(request)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	entries, err := p.service.Project.Files(project.ID, request.QueryParameter("base"))
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	user := currentUser(request)
+	for i := range entries {
+		entries[i].Tags = schema.Tags.Visible(entries[i].Tags, user)
+	}
+	response.WriteEntity(entries)
+}
+
+// project retrieves the project in the request's path, if the user can access it.
+func (p projectsResource) project(request *restful.Request) (*schema.Project, error) {
+	project, err := p.service.Project.ByID(request.PathParameter("project-id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAccess(p.service, project.Owner, currentUser(request)); err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+type byName []schema.Project
+
+func (p byName) Len() int           { return len(p) }
+func (p byName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byName) Less(i, j int) bool { return p[i].Name < p[j].Name }
@@ -0,0 +1,119 @@
+package mcapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/share"
+)
+
+// shareLinkReq is the body of a request to create a share link. Duration is
+// how long the link lasts, as in 72h. It defaults to share.DefaultDuration.
+type shareLinkReq struct {
+	FileID       string
+	DirID        string
+	Duration     string
+	MaxDownloads int
+}
+
+// shareLinkResp is a share link and its url. The url is a path on the server's
+// http port.
+type shareLinkResp struct {
+	Link schema.ShareLink
+	URL  string
+}
+
+type shareLinksResource struct {
+	links *share.Links
+}
+
+func newShareLinksResource(container *restful.Container, links *share.Links) error {
+	sr := shareLinksResource{
+		links: links,
+	}
+	sr.register(container)
+	return nil
+}
+
+func (s shareLinksResource) register(container *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path("/api/sharelinks").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("").To(s.all).
+		Doc("List the share links the user created.").
+		Writes([]shareLinkResp{}))
+
+	ws.Route(ws.POST("").To(s.create).
+		Doc("Create a share link for a file or a directory.").
+		Reads(shareLinkReq{}).
+		Writes(shareLinkResp{}))
+
+	ws.Route(ws.DELETE("/{link-id}").To(s.revoke).
+		Doc("Revoke a share link.").
+		Param(ws.PathParameter("link-id", "id of the share link").DataType("string")).
+		Writes(shareLinkResp{}))
+
+	container.Add(ws)
+}
+
+func (s shareLinksResource) all(request *restful.Request, response *restful.Response) {
+	links, err := s.links.List(currentUser(request))
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	resps := make([]shareLinkResp, len(links))
+	for i := range links {
+		resps[i] = s.resp(&links[i])
+	}
+	response.WriteEntity(resps)
+}
+
+func (s shareLinksResource) create(request *restful.Request, response *restful.Response) {
+	var req shareLinkReq
+	if err := request.ReadEntity(&req); err != nil {
+		writeError(response, mcerr.Errorf(mcerr.ErrInvalid, "Bad share link request: %s", err))
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			writeError(response, mcerr.Errorf(mcerr.ErrInvalid, "Bad duration %s", req.Duration))
+			return
+		}
+		duration = d
+	}
+
+	link, err := s.links.Create(currentUser(request), req.FileID, req.DirID, duration, req.MaxDownloads)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	response.WriteHeader(http.StatusCreated)
+	response.WriteEntity(s.resp(link))
+}
+
+func (s shareLinksResource) revoke(request *restful.Request, response *restful.Response) {
+	link, err := s.links.Revoke(currentUser(request), request.PathParameter("link-id"))
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+	response.WriteEntity(s.resp(link))
+}
+
+func (s shareLinksResource) resp(link *schema.ShareLink) shareLinkResp {
+	return shareLinkResp{
+		Link: *link,
+		URL:  s.links.URL(link),
+	}
+}
@@ -1,28 +1,37 @@
 package mcapi
 
 import (
-	"github.com/emicklei/go-restful"
 	"net/http"
+	"time"
 
-	"fmt"
-
-	"github.com/materials-commons/mcfs/base/model"
+	"github.com/emicklei/go-restful"
+	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/schema"
-	"github.com/materials-commons/mcfs/server/servers/access"
+	"github.com/materials-commons/mcfs/server/service"
 )
 
+// groupReq is the body of a request to create or update a group.
+type groupReq struct {
+	Name        string
+	Description string
+	Users       []string
+}
+
 type groupsResource struct {
+	service *service.Service
 }
 
-func newGroupsResource(container *restful.Container) error {
-	gr := groupsResource{}
+func newGroupsResource(container *restful.Container, svc *service.Service) error {
+	gr := groupsResource{
+		service: svc,
+	}
 	gr.register(container)
 	return nil
 }
 
 func (g groupsResource) register(container *restful.Container) {
 	ws := new(restful.WebService)
-	ws.Path("/groups").
+	ws.Path("/api/groups").
 		Consumes(restful.MIME_JSON).
 		Produces(restful.MIME_JSON)
 
@@ -30,19 +39,177 @@ func (g groupsResource) register(container *restful.Container) {
 		Doc("List all groups for user.").
 		Writes([]schema.Group{}))
 
+	ws.Route(ws.POST("").To(g.create).
+		Doc("Create a group owned by the user.").
+		Reads(groupReq{}).
+		Writes(schema.Group{}))
+
+	ws.Route(ws.GET("/{group-id}").To(g.get).
+		Doc("Retrieve a group.").
+		Param(ws.PathParameter("group-id", "id of the group").DataType("string")).
+		Writes(schema.Group{}))
+
+	ws.Route(ws.PUT("/{group-id}").To(g.update).
+		Doc("Replace a group's name, description and users.").
+		Param(ws.PathParameter("group-id", "id of the group").DataType("string")).
+		Reads(groupReq{}).
+		Writes(schema.Group{}))
+
+	ws.Route(ws.DELETE("/{group-id}").To(g.remove).
+		Doc("Delete a group.").
+		Param(ws.PathParameter("group-id", "id of the group").DataType("string")))
+
+	ws.Route(ws.PUT("/{group-id}/users/{user}").To(g.addUser).
+		Doc("Add a user to a group.").
+		Param(ws.PathParameter("group-id", "id of the group").DataType("string")).
+		Param(ws.PathParameter("user", "email of the user").DataType("string")).
+		Writes(schema.Group{}))
+
+	ws.Route(ws.DELETE("/{group-id}/users/{user}").To(g.removeUser).
+		Doc("Remove a user from a group.").
+		Param(ws.PathParameter("group-id", "id of the group").DataType("string")).
+		Param(ws.PathParameter("user", "email of the user").DataType("string")).
+		Writes(schema.Group{}))
+
 	container.Add(ws)
 }
 
 func (g groupsResource) all(request *restful.Request, response *restful.Response) {
-	user, err := access.GetUserByAPIKey("")
-	_ = user
-	_ = err
-	rql := model.Groups.T().GetAllByIndex("owner", "")
-	var groups []schema.Group
-	if err := model.Groups.Q().Rows(rql, &groups); err != nil {
-		response.WriteErrorString(http.StatusNotFound, fmt.Sprintf("Error querying database %s", err))
+	groups, err := g.service.Group.ByOwner(currentUser(request))
+	if err != nil {
+		writeError(response, err)
 		return
 	}
 
+	if groups == nil {
+		groups = []schema.Group{}
+	}
 	response.WriteEntity(groups)
 }
+
+func (g groupsResource) create(request *restful.Request, response *restful.Response) {
+	var req groupReq
+	if err := request.ReadEntity(&req); err != nil || req.Name == "" {
+		writeError(response, mcerr.Errorf(mcerr.ErrInvalid, "A group needs a name"))
+		return
+	}
+
+	group := schema.NewGroup(currentUser(request), req.Name)
+	if req.Description != "" {
+		group.Description = req.Description
+	}
+	group.Users = req.Users
+
+	created, err := g.service.Group.Insert(&group)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	response.WriteHeader(http.StatusCreated)
+	response.WriteEntity(created)
+}
+
+func (g groupsResource) get(request *restful.Request, response *restful.Response) {
+	group, err := g.group(request)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+	response.WriteEntity(group)
+}
+
+func (g groupsResource) update(request *restful.Request, response *restful.Response) {
+	var req groupReq
+	if err := request.ReadEntity(&req); err != nil || req.Name == "" {
+		writeError(response, mcerr.Errorf(mcerr.ErrInvalid, "A group needs a name"))
+		return
+	}
+
+	g.modify(request, response, func(group *schema.Group) {
+		group.Name = req.Name
+		group.Description = req.Description
+		group.Users = req.Users
+	})
+}
+
+func (g groupsResource) remove(request *restful.Request, response *restful.Response) {
+	group, err := g.group(request)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	if err := g.service.Group.Delete(group.ID); err != nil {
+		writeError(response, err)
+		return
+	}
+
+	// Response.WriteHeader only records the status for WriteEntity.
+	response.ResponseWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (g groupsResource) addUser(request *restful.Request, response *restful.Response) {
+	user := request.PathParameter("user")
+	g.modify(request, response, func(group *schema.Group) {
+		if !hasUser(group, user) {
+			group.Users = append(group.Users, user)
+		}
+	})
+}
+
+func (g groupsResource) removeUser(request *restful.Request, response *restful.Response) {
+	user := request.PathParameter("user")
+	g.modify(request, response, func(group *schema.Group) {
+		var users []string
+		for _, u := range group.Users {
+			if u != user {
+				users = append(users, u)
+			}
+		}
+		group.Users = users
+	})
+}
+
+// modify applies change to the group in the request's path and saves it.
+func (g groupsResource) modify(request *restful.Request, response *restful.Response, change func(group *schema.Group)) {
+	group, err := g.group(request)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	change(group)
+	group.MTime = time.Now()
+	if err := g.service.Group.Update(group); err != nil {
+		writeError(response, err)
+		return
+	}
+
+	response.WriteEntity(group)
+}
+
+// group retrieves the group in the request's path. Only the owner of a group
+// can see or change it.
+func (g groupsResource) group(request *restful.Request) (*schema.Group, error) {
+	id := request.PathParameter("group-id")
+	group, err := g.service.Group.ByID(id)
+	switch {
+	case err != nil:
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown group %s", id)
+	case group.Owner != currentUser(request):
+		return nil, mcerr.Errorf(mcerr.ErrNoAccess, "Group %s belongs to another user", id)
+	default:
+		return group, nil
+	}
+}
+
+// hasUser returns true if user is a member of group.
+func hasUser(group *schema.Group, user string) bool {
+	for _, u := range group.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
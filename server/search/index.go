@@ -0,0 +1,572 @@
+/*
+Package search implements full-text search over projects, datadirs and
+datafiles. The index is an in memory inverted index of the words in their
+names, descriptions, notes and tags, which includes the metadata extracted
+from datafiles. It is kept up to date by going through a service.Service
+returned by WithIndex, and is rebuilt from the database by the search server
+when it starts.
+*/
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+// Field weights. A word in a name counts for more than one in a tag, which
+// counts for more than one in a description or note.
+const (
+	nameWeight        = 3.0
+	tagWeight         = 2.0
+	descriptionWeight = 1.0
+)
+
+// snippetRadius is the number of words on each side of a match that are
+// included in a snippet.
+const snippetRadius = 8
+
+// Query is a full-text search.
+type Query struct {
+	Text      string // Words to search for, every word must match
+	Type      string // Only match project, datadir or datafile entries, blank for all
+	ProjectID string // Only match entries in this project, blank for all
+	Limit     int    // Maximum number of hits to return, all when 0
+}
+
+// Hit is an entry matching a Query.
+type Hit struct {
+	ID       string   // Id of the project, datadir or datafile
+	Type     string   // project, datadir or datafile
+	Name     string   // Name of the entry
+	Owner    string   // Owner of the entry
+	Projects []string // Projects the entry is in
+	Score    float64  // How well the entry matches, higher is better
+	Field    string   // The field the snippet is from: name, description, notes or tag
+	Snippet  string   // Text around the words that matched
+}
+
+// field is a piece of text that is searched.
+type field struct {
+	name   string
+	text   string
+	user   string // The user who can see the field, blank when everyone can
+	weight float64
+	words  []string
+}
+
+// document is an indexed project, datadir or datafile.
+type document struct {
+	id       string
+	kind     string
+	name     string
+	owner    string
+	projects []string
+	fields   []field
+}
+
+// corpus is the set of documents and the postings for their words.
+type corpus struct {
+	docs     map[string]*document
+	postings map[string]map[string]bool // Word to the ids of the documents containing it
+}
+
+// Index is a full-text index. Access to it is thread safe.
+type Index struct {
+	mutex   sync.RWMutex
+	corpus  *corpus
+	pending map[string]*document // Updates made during a rebuild, nil values are removals
+	built   time.Time
+
+	// rebuildMutex allows only one rebuild at a time.
+	rebuildMutex sync.Mutex
+}
+
+var index = NewIndex()
+
+// NewIndex creates a new empty Index.
+func NewIndex() *Index {
+	return &Index{corpus: newCorpus()}
+}
+
+// Default returns the index used by the server.
+func Default() *Index {
+	return index
+}
+
+func newCorpus() *corpus {
+	return &corpus{
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string]bool),
+	}
+}
+
+// tokenize splits text into lower case words of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// add adds a document, replacing any document with the same id.
+func (c *corpus) add(doc *document) {
+	c.remove(doc.id)
+	c.docs[doc.id] = doc
+	for _, f := range doc.fields {
+		for _, word := range f.words {
+			ids, ok := c.postings[word]
+			if !ok {
+				ids = make(map[string]bool)
+				c.postings[word] = ids
+			}
+			ids[doc.id] = true
+		}
+	}
+}
+
+// remove removes a document and its postings.
+func (c *corpus) remove(id string) {
+	doc, ok := c.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, f := range doc.fields {
+		for _, word := range f.words {
+			if ids, ok := c.postings[word]; ok {
+				delete(ids, id)
+				if len(ids) == 0 {
+					delete(c.postings, word)
+				}
+			}
+		}
+	}
+	delete(c.docs, id)
+}
+
+// newField creates a field, splitting its text into words.
+func newField(name, text, user string, weight float64) field {
+	return field{
+		name:   name,
+		text:   text,
+		user:   user,
+		weight: weight,
+		words:  tokenize(text),
+	}
+}
+
+// tagFields creates a field for each tag. Private tags are only visible to
+// their user.
+func tagFields(tags []schema.Tag) []field {
+	var fields []field
+	for _, tag := range tags {
+		text := tag.Key
+		if tag.Value != "" {
+			text = tag.Key + "=" + tag.Value
+		}
+		fields = append(fields, newField("tag", text, tag.User, tagWeight))
+	}
+	return fields
+}
+
+// projectDocument creates the document for a project.
+func projectDocument(p *schema.Project) *document {
+	fields := []field{
+		newField("name", p.Name, "", nameWeight),
+		newField("description", p.Description, "", descriptionWeight),
+	}
+	for _, note := range p.Notes {
+		fields = append(fields, newField("notes", note.Message, "", descriptionWeight))
+	}
+
+	return &document{
+		id:       p.ID,
+		kind:     "project",
+		name:     p.Name,
+		owner:    p.Owner,
+		projects: []string{p.ID},
+		fields:   append(fields, tagFields(p.Tags)...),
+	}
+}
+
+// dirDocument creates the document for a datadir.
+func dirDocument(d *schema.Directory) *document {
+	return &document{
+		id:       d.ID,
+		kind:     "datadir",
+		name:     d.Name,
+		owner:    d.Owner,
+		projects: []string{d.Project},
+		fields:   append([]field{newField("name", d.Name, "", nameWeight)}, tagFields(d.Tags)...),
+	}
+}
+
+// fileDocument creates the document for a datafile in projects.
+func fileDocument(f *schema.File, projects []string) *document {
+	fields := []field{
+		newField("name", f.Name, "", nameWeight),
+		newField("description", f.Description, "", descriptionWeight),
+	}
+
+	return &document{
+		id:       f.ID,
+		kind:     "datafile",
+		name:     f.Name,
+		owner:    f.Owner,
+		projects: projects,
+		fields:   append(fields, tagFields(f.Tags)...),
+	}
+}
+
+// update replaces the document for id with doc, or removes it when doc is nil.
+func (idx *Index) update(id string, doc *document) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.corpus.remove(id)
+	if doc != nil {
+		idx.corpus.add(doc)
+	}
+
+	if idx.pending != nil {
+		idx.pending[id] = doc
+	}
+}
+
+// AddProject adds or replaces a project in the index.
+func (idx *Index) AddProject(p *schema.Project) {
+	idx.update(p.ID, projectDocument(p))
+}
+
+// AddDir adds or replaces a datadir in the index.
+func (idx *Index) AddDir(d *schema.Directory) {
+	idx.update(d.ID, dirDocument(d))
+}
+
+// AddFile adds or replaces a datafile in projects in the index. Only current
+// files are searchable, so a file that isn't current is removed.
+func (idx *Index) AddFile(f *schema.File, projects []string) {
+	if !f.Current {
+		idx.Remove(f.ID)
+		return
+	}
+	idx.update(f.ID, fileDocument(f, projects))
+}
+
+// Remove removes an entry from the index.
+func (idx *Index) Remove(id string) {
+	idx.update(id, nil)
+}
+
+// Len returns the number of entries in the index.
+func (idx *Index) Len() int {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return len(idx.corpus.docs)
+}
+
+// Built returns when the index was last rebuilt.
+func (idx *Index) Built() time.Time {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return idx.built
+}
+
+// Rebuild replaces the index with the projects, datadirs and current datafiles
+// in the database. The index can be searched and updated while it is rebuilt.
+// Updates made during the rebuild are applied to the new index.
+func (idx *Index) Rebuild(svc *service.Service) error {
+	idx.rebuildMutex.Lock()
+	defer idx.rebuildMutex.Unlock()
+
+	idx.mutex.Lock()
+	idx.pending = make(map[string]*document)
+	idx.mutex.Unlock()
+
+	c := newCorpus()
+	err := build(c, svc)
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if err == nil {
+		for id, doc := range idx.pending {
+			c.remove(id)
+			if doc != nil {
+				c.add(doc)
+			}
+		}
+		idx.corpus = c
+		idx.built = time.Now()
+	}
+	idx.pending = nil
+	return err
+}
+
+// build adds every user's projects, and the datadirs and current datafiles in
+// them, to c.
+func build(c *corpus, svc *service.Service) error {
+	users, err := svc.User.All()
+	if err != nil {
+		return err
+	}
+
+	// A datafile can be in more than one project, so the projects it is in
+	// are collected before it is added.
+	files := make(map[string]*document)
+	for _, u := range users {
+		projects, err := svc.Project.ByOwner(u.ID)
+		if err != nil && !mcerr.Is(err, mcerr.ErrNotFound) {
+			return err
+		}
+
+		for i := range projects {
+			p := &projects[i]
+			c.add(projectDocument(p))
+
+			entries, err := svc.Project.Files(p.ID, "")
+			if err != nil && !mcerr.Is(err, mcerr.ErrNotFound) {
+				return err
+			}
+
+			for _, entry := range entries {
+				if entry.IsDir {
+					if d, err := svc.Dir.ByID(entry.ID); err == nil {
+						c.add(dirDocument(d))
+					}
+					continue
+				}
+
+				if doc, ok := files[entry.ID]; ok {
+					doc.projects = append(doc.projects, p.ID)
+				} else if f, err := svc.File.ByID(entry.ID); err == nil && f.Current {
+					files[f.ID] = fileDocument(f, []string{p.ID})
+				}
+			}
+		}
+	}
+
+	for _, doc := range files {
+		c.add(doc)
+	}
+	return nil
+}
+
+// Search returns the entries matching q that user has access to, best match
+// first, and the number of entries that matched before q.Limit was applied.
+// Access to an entry's owner is checked with groups.
+func (idx *Index) Search(q Query, user string, groups service.Groups) ([]Hit, int) {
+	words := uniqueWords(tokenize(q.Text))
+	if len(words) == 0 {
+		return nil, 0
+	}
+
+	matched := idx.match(q, words, user)
+
+	// Access is checked once per owner, and without holding the lock as
+	// it can go to the database.
+	access := make(map[string]bool)
+	hits := matched[:0]
+	for _, hit := range matched {
+		allowed, ok := access[hit.Owner]
+		if !ok {
+			allowed = groups.HasAccess(hit.Owner, user)
+			access[hit.Owner] = allowed
+		}
+		if allowed {
+			hits = append(hits, hit)
+		}
+	}
+
+	sort.Sort(hitsByScore(hits))
+	total := len(hits)
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits, total
+}
+
+// match scores the documents containing every word in the fields user can see.
+func (idx *Index) match(q Query, words []string, user string) []Hit {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	c := idx.corpus
+
+	// Only the documents containing the rarest word need to be looked at.
+	var candidates map[string]bool
+	for _, word := range words {
+		ids := c.postings[word]
+		if len(ids) == 0 {
+			return nil
+		}
+		if candidates == nil || len(ids) < len(candidates) {
+			candidates = ids
+		}
+	}
+
+	var hits []Hit
+	for id := range candidates {
+		doc := c.docs[id]
+		if q.Type != "" && doc.kind != q.Type {
+			continue
+		}
+		if q.ProjectID != "" && !contains(doc.projects, q.ProjectID) {
+			continue
+		}
+
+		score, best := c.score(doc, words, user)
+		if score == 0 {
+			continue
+		}
+
+		hits = append(hits, Hit{
+			ID:       doc.id,
+			Type:     doc.kind,
+			Name:     doc.name,
+			Owner:    doc.owner,
+			Projects: doc.projects,
+			Score:    score,
+			Field:    best.name,
+			Snippet:  snippet(best.text, words),
+		})
+	}
+	return hits
+}
+
+// score scores a document by how often each word appears in the fields user
+// can see, weighted by the field and by how rare the word is. It returns 0 if
+// a word doesn't appear. It also returns the field to take the snippet from,
+// which is the one containing the most words, preferring fields other than
+// the name as the name is already shown.
+func (c *corpus) score(doc *document, words []string, user string) (float64, *field) {
+	var (
+		total     float64
+		best      *field
+		bestCount int
+	)
+	counts := make([]int, len(doc.fields))
+	for _, word := range words {
+		idf := math.Log(1 + float64(len(c.docs))/float64(len(c.postings[word])))
+		var wordScore float64
+		for i := range doc.fields {
+			f := &doc.fields[i]
+			if f.user != "" && f.user != user {
+				continue
+			}
+
+			n := countWord(f.words, word)
+			if n != 0 {
+				wordScore += f.weight * float64(n) / math.Sqrt(float64(len(f.words)))
+				counts[i]++
+			}
+		}
+		if wordScore == 0 {
+			return 0, nil
+		}
+		total += idf * wordScore
+	}
+
+	for i := range doc.fields {
+		f := &doc.fields[i]
+		better := counts[i] > bestCount ||
+			(counts[i] != 0 && counts[i] == bestCount && best.name == "name" && f.name != "name")
+		if better {
+			best, bestCount = f, counts[i]
+		}
+	}
+	return total, best
+}
+
+// snippet returns the words of text around the first one that matches words.
+func snippet(text string, words []string) string {
+	textWords := strings.Fields(text)
+	first := 0
+	for i, w := range textWords {
+		if containsAny(tokenize(w), words) {
+			first = i
+			break
+		}
+	}
+
+	start, end := first-snippetRadius, first+snippetRadius+1
+	if start < 0 {
+		start = 0
+	}
+	if end > len(textWords) {
+		end = len(textWords)
+	}
+
+	s := strings.Join(textWords[start:end], " ")
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(textWords) {
+		s += "..."
+	}
+	return s
+}
+
+// uniqueWords returns words without duplicates.
+func uniqueWords(words []string) []string {
+	var unique []string
+	for _, w := range words {
+		if !contains(unique, w) {
+			unique = append(unique, w)
+		}
+	}
+	return unique
+}
+
+// countWord returns the number of times word appears in words.
+func countWord(words []string, word string) int {
+	n := 0
+	for _, w := range words {
+		if w == word {
+			n++
+		}
+	}
+	return n
+}
+
+// contains returns true if s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny returns true if any of the words is in list.
+func containsAny(list []string, words []string) bool {
+	for _, w := range words {
+		if contains(list, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// hitsByScore sorts hits best first. Hits with the same score are sorted by
+// name, and then id, so results are stable.
+type hitsByScore []Hit
+
+func (h hitsByScore) Len() int      { return len(h) }
+func (h hitsByScore) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h hitsByScore) Less(i, j int) bool {
+	switch {
+	case h[i].Score != h[j].Score:
+		return h[i].Score > h[j].Score
+	case h[i].Name != h[j].Name:
+		return h[i].Name < h[j].Name
+	default:
+		return h[i].ID < h[j].ID
+	}
+}
@@ -0,0 +1,211 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+const (
+	testUser  = "test@mc.org"
+	test2User = "test2@mc.org"
+)
+
+// newTestService creates an in memory service, for test@mc.org and test2@mc.org,
+// whose changes are made to a new index.
+func newTestService() (*service.Service, *Index) {
+	svc := service.NewMemory(
+		schema.NewUser("test", testUser, "", "test"),
+		schema.NewUser("test2", test2User, "", "test2"),
+	)
+	idx := NewIndex()
+	return WithIndex(svc, idx), idx
+}
+
+// addProject adds a project with a description.
+func addProject(t *testing.T, svc *service.Service, name, description, owner string) *schema.Project {
+	proj := schema.NewProject(name, "", owner)
+	proj.Description = description
+	p, err := svc.Project.Insert(&proj)
+	if err != nil {
+		t.Fatalf("Unable to insert project %s: %s", name, err)
+	}
+	return p
+}
+
+// addFile adds a current file with a description to the project's directory.
+func addFile(t *testing.T, svc *service.Service, p *schema.Project, name, description string) *schema.File {
+	file := schema.NewFile(name, p.Owner)
+	file.Description = description
+	file.DataDirs = []string{p.DataDir}
+	f, err := svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert file %s: %s", name, err)
+	}
+	return f
+}
+
+// ids returns the ids of hits.
+func ids(hits []Hit) []string {
+	var ids []string
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSearchRanking(t *testing.T) {
+	svc, idx := newTestService()
+	p := addProject(t, svc, "Anneal", "Heat treatment of aluminum samples", testUser)
+	byName := addFile(t, svc, p, "aluminum.cif", "")
+	byDescription := addFile(t, svc, p, "sample.txt",
+		"Measurements taken on the first day after the aluminum sample was quenched in water")
+
+	hits, total := idx.Search(Query{Text: "Aluminum", Type: "datafile"}, testUser, svc.Group)
+	if total != 2 || len(hits) != 2 || hits[0].ID != byName.ID || hits[1].ID != byDescription.ID {
+		t.Fatalf("Wrong hits %#v", hits)
+	}
+
+	hit := hits[1]
+	if hit.Field != "description" || hit.Snippet != "Measurements taken on the first day after the aluminum sample was quenched in water" {
+		t.Fatalf("Wrong snippet %#v", hit)
+	}
+	if hits[0].Field != "name" || hits[0].Snippet != "aluminum.cif" {
+		t.Fatalf("Wrong snippet for a name %#v", hits[0])
+	}
+
+	// Every word must match, in any field.
+	hits, _ = idx.Search(Query{Text: "aluminum quenched"}, testUser, svc.Group)
+	if len(hits) != 1 || hits[0].ID != byDescription.ID {
+		t.Fatalf("Wrong hits for two words %#v", hits)
+	}
+
+	hits, total = idx.Search(Query{Text: "aluminum", Limit: 1}, testUser, svc.Group)
+	if total != 3 || len(hits) != 1 {
+		t.Fatalf("Limit not applied %d %#v", total, hits)
+	}
+
+	if hits, _ := idx.Search(Query{Text: "aluminum", ProjectID: "nope"}, testUser, svc.Group); len(hits) != 0 {
+		t.Fatalf("Found hits in another project %#v", hits)
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	text := "one two three four five six seven eight nine ten eleven twelve thirteen"
+	s := snippet(text+" "+text, []string{"eleven"})
+	if s != "...three four five six seven eight nine ten eleven twelve thirteen one two three four five six..." {
+		t.Fatalf("Wrong snippet %s", s)
+	}
+}
+
+func TestSearchAccess(t *testing.T) {
+	svc, idx := newTestService()
+	p := addProject(t, svc, "Mine", "Magnesium alloys", testUser)
+	p2 := addProject(t, svc, "Theirs", "Magnesium castings", test2User)
+
+	hits, _ := idx.Search(Query{Text: "magnesium"}, testUser, svc.Group)
+	if len(hits) != 1 || hits[0].ID != p.ID {
+		t.Fatalf("Wrong hits %#v", hits)
+	}
+
+	g := schema.NewGroup(test2User, "collaborators")
+	g.Users = []string{testUser}
+	svc.Group.Insert(&g)
+	hits, _ = idx.Search(Query{Text: "magnesium"}, testUser, svc.Group)
+	if len(hits) != 2 || !contains(ids(hits), p2.ID) {
+		t.Fatalf("Shared project not found %#v", hits)
+	}
+}
+
+func TestSearchTags(t *testing.T) {
+	svc, idx := newTestService()
+	p := addProject(t, svc, "Crystals", "", testUser)
+	f := addFile(t, svc, p, "structure.cif", "")
+
+	f.Tags = []schema.Tag{
+		{Key: "formula", Value: "Fe2O3"},
+		{Key: "favorite", User: testUser},
+	}
+	if err := svc.File.UpdateTags(f); err != nil {
+		t.Fatalf("Unable to update tags: %s", err)
+	}
+
+	hits, _ := idx.Search(Query{Text: "fe2o3"}, test2User, allowAll{})
+	if len(hits) != 1 || hits[0].Field != "tag" || hits[0].Snippet != "formula=Fe2O3" {
+		t.Fatalf("Tag not found %#v", hits)
+	}
+
+	// Private tags are only seen by their user.
+	if hits, _ := idx.Search(Query{Text: "favorite"}, testUser, svc.Group); len(hits) != 1 {
+		t.Fatalf("Private tag not found %#v", hits)
+	}
+	if hits, _ := idx.Search(Query{Text: "favorite"}, test2User, allowAll{}); len(hits) != 0 {
+		t.Fatalf("Private tag found by another user %#v", hits)
+	}
+}
+
+func TestSearchUpdates(t *testing.T) {
+	svc, idx := newTestService()
+	p := addProject(t, svc, "Updates", "", testUser)
+
+	// Partial uploads aren't searchable until they become current.
+	file := schema.NewFile("titanium.dat", testUser)
+	file.DataDirs = []string{p.DataDir}
+	file.Current = false
+	f, _ := svc.File.Insert(&file)
+	if hits, _ := idx.Search(Query{Text: "titanium"}, testUser, svc.Group); len(hits) != 0 {
+		t.Fatalf("Partial found %#v", hits)
+	}
+
+	f.Current = true
+	svc.File.Update(f)
+	hits, _ := idx.Search(Query{Text: "titanium"}, testUser, svc.Group)
+	if len(hits) != 1 || hits[0].ID != f.ID || !contains(hits[0].Projects, p.ID) {
+		t.Fatalf("Current file not found %#v", hits)
+	}
+
+	svc.File.Hide(f)
+	if hits, _ := idx.Search(Query{Text: "titanium"}, testUser, svc.Group); len(hits) != 0 {
+		t.Fatalf("Hidden file found %#v", hits)
+	}
+
+	p.Notes = []schema.Note{{Message: "Switched to the vanadium furnace"}}
+	svc.Project.Update(p)
+	hits, _ = idx.Search(Query{Text: "vanadium"}, testUser, svc.Group)
+	if len(hits) != 1 || hits[0].Field != "notes" {
+		t.Fatalf("Note not found %#v", hits)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	svc, idx := newTestService()
+	p := addProject(t, svc, "Rebuild", "Copper wire", testUser)
+	f := addFile(t, svc, p, "copper.txt", "")
+	before, _ := idx.Search(Query{Text: "copper"}, testUser, svc.Group)
+
+	rebuilt := NewIndex()
+	if err := rebuilt.Rebuild(svc); err != nil {
+		t.Fatalf("Rebuild failed: %s", err)
+	}
+	if rebuilt.Len() != idx.Len() || rebuilt.Built().IsZero() {
+		t.Fatalf("Rebuilt index has %d entries, expected %d", rebuilt.Len(), idx.Len())
+	}
+
+	after, _ := rebuilt.Search(Query{Text: "copper"}, testUser, svc.Group)
+	if len(after) != 2 || len(before) != 2 || after[0].ID != before[0].ID || after[1].ID != before[1].ID {
+		t.Fatalf("Rebuilt hits %#v don't match %#v", after, before)
+	}
+	if !contains(ids(after), f.ID) {
+		t.Fatalf("File not rebuilt %#v", after)
+	}
+}
+
+// allowAll gives every user access to everything.
+type allowAll struct {
+	service.Groups
+}
+
+func (allowAll) HasAccess(owner, user string) bool {
+	return true
+}
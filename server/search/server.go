@@ -0,0 +1,95 @@
+package search
+
+import (
+	"sync"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mc"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+// Create our own context log that always includes our server name.
+var l = log.New("server", "Search")
+
+// defaultInterval is how often the index is rebuilt, to pick up changes made
+// outside of the server, such as by mcfsadmin.
+const defaultInterval = 24 * time.Hour
+
+// Status reports on the index.
+type Status struct {
+	Entries   int       // Number of projects, datadirs and datafiles indexed.
+	Built     time.Time // When the index was last rebuilt.
+	LastError string    // Why the last rebuild failed.
+}
+
+// searchServer rebuilds the Default index from the database when it starts,
+// and then periodically.
+type searchServer struct {
+	service  *service.Service
+	index    *Index
+	interval time.Duration
+
+	mutex     sync.Mutex
+	lastError string
+}
+
+// We only expose a single search server.
+var server = &searchServer{index: Default()}
+
+// Server returns the singleton searchServer.
+func Server() *searchServer {
+	return server
+}
+
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started. How often to rebuild the index is read from
+// MCFS_SEARCH_INTERVAL in time.ParseDuration format.
+func (s *searchServer) Init() {
+	s.service = service.New(service.Configured())
+	s.interval = mc.ConfigDuration("MCFS_SEARCH_INTERVAL", defaultInterval)
+}
+
+// Run implements the server. It is meant to be called by the Server interface.
+func (s *searchServer) Run(stopChan <-chan struct{}) {
+	l.Info(log.Msg("Starting, rebuilding the index every %s", s.interval))
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.rebuild()
+		select {
+		case <-ticker.C:
+		case <-stopChan:
+			l.Info("Shutting down.")
+			return
+		}
+	}
+}
+
+// rebuild rebuilds the index, recording why it failed.
+func (s *searchServer) rebuild() {
+	start := time.Now()
+	err := s.index.Rebuild(s.service)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		s.lastError = err.Error()
+		l.Error(log.Msg("Unable to rebuild index: %s", err))
+		return
+	}
+	s.lastError = ""
+	l.Info("Rebuilt index", "entries", s.index.Len(), "duration", time.Since(start))
+}
+
+// Report implements servers.Reporter.
+func (s *searchServer) Report() interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return Status{
+		Entries:   s.index.Len(),
+		Built:     s.index.Built(),
+		LastError: s.lastError,
+	}
+}
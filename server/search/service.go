@@ -0,0 +1,194 @@
+package search
+
+import (
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+// WithIndex returns a copy of svc whose changes to projects, datadirs and
+// datafiles are also made to idx. Datafiles are added to the index when they
+// become current, and removed when they are hidden or deleted.
+func WithIndex(svc *service.Service, idx *Index) *service.Service {
+	u := &updater{service: svc, index: idx}
+	indexed := *svc
+	indexed.File = indexedFiles{svc.File, u}
+	indexed.Dir = indexedDirs{svc.Dir, u}
+	indexed.Project = indexedProjects{svc.Project, u}
+	return &indexed
+}
+
+// updater reindexes entries from the database after they change. Indexing
+// never fails the change, the index is brought back in line by the next
+// rebuild.
+type updater struct {
+	service *service.Service
+	index   *Index
+}
+
+// file reindexes a datafile.
+func (u *updater) file(id string) {
+	f, err := u.service.File.ByID(id)
+	if err != nil {
+		u.index.Remove(id)
+		return
+	}
+	u.index.AddFile(f, u.projects(f))
+}
+
+// projects returns the projects a datafile's directories are in.
+func (u *updater) projects(f *schema.File) []string {
+	var projects []string
+	for _, dirID := range f.DataDirs {
+		if d, err := u.service.Dir.ByID(dirID); err == nil && !contains(projects, d.Project) {
+			projects = append(projects, d.Project)
+		}
+	}
+	return projects
+}
+
+// dir reindexes a datadir.
+func (u *updater) dir(id string) {
+	if d, err := u.service.Dir.ByID(id); err == nil {
+		u.index.AddDir(d)
+	}
+}
+
+// project reindexes a project and its top level directory, which is created
+// along with it.
+func (u *updater) project(id string) {
+	if p, err := u.service.Project.ByID(id); err == nil {
+		u.index.AddProject(p)
+		u.dir(p.DataDir)
+	}
+}
+
+// indexedFiles updates the index when datafiles change.
+type indexedFiles struct {
+	service.Files
+	updater *updater
+}
+
+// Hide hides a datafile and removes it from the index.
+func (f indexedFiles) Hide(file *schema.File) error {
+	if err := f.Files.Hide(file); err != nil {
+		return err
+	}
+	f.updater.file(file.ID)
+	return nil
+}
+
+// Update updates a datafile and reindexes it.
+func (f indexedFiles) Update(file *schema.File) error {
+	if err := f.Files.Update(file); err != nil {
+		return err
+	}
+	f.updater.file(file.ID)
+	return nil
+}
+
+// UpdateTags updates the tags on a datafile and reindexes it.
+func (f indexedFiles) UpdateTags(file *schema.File) error {
+	if err := f.Files.UpdateTags(file); err != nil {
+		return err
+	}
+	f.updater.file(file.ID)
+	return nil
+}
+
+// Insert inserts a datafile and indexes it.
+func (f indexedFiles) Insert(file *schema.File) (*schema.File, error) {
+	inserted, err := f.Files.Insert(file)
+	if err != nil {
+		return nil, err
+	}
+	f.updater.file(inserted.ID)
+	return inserted, nil
+}
+
+// InsertEntry inserts a datafile entry and indexes it.
+func (f indexedFiles) InsertEntry(file *schema.File) (*schema.File, error) {
+	inserted, err := f.Files.InsertEntry(file)
+	if err != nil {
+		return nil, err
+	}
+	f.updater.file(inserted.ID)
+	return inserted, nil
+}
+
+// Delete deletes a datafile and removes it from the index.
+func (f indexedFiles) Delete(id string) error {
+	if err := f.Files.Delete(id); err != nil {
+		return err
+	}
+	f.updater.index.Remove(id)
+	return nil
+}
+
+// AddDirectories adds a datafile to directories and reindexes it, as it
+// may now be in other projects.
+func (f indexedFiles) AddDirectories(file *schema.File, dirIDs ...string) error {
+	if err := f.Files.AddDirectories(file, dirIDs...); err != nil {
+		return err
+	}
+	f.updater.file(file.ID)
+	return nil
+}
+
+// indexedDirs updates the index when datadirs change.
+type indexedDirs struct {
+	service.Dirs
+	updater *updater
+}
+
+// Update updates a datadir and reindexes it.
+func (d indexedDirs) Update(dir *schema.Directory) error {
+	if err := d.Dirs.Update(dir); err != nil {
+		return err
+	}
+	d.updater.dir(dir.ID)
+	return nil
+}
+
+// UpdateTags updates the tags on a datadir and reindexes it.
+func (d indexedDirs) UpdateTags(dir *schema.Directory) error {
+	if err := d.Dirs.UpdateTags(dir); err != nil {
+		return err
+	}
+	d.updater.dir(dir.ID)
+	return nil
+}
+
+// Insert inserts a datadir and indexes it.
+func (d indexedDirs) Insert(dir *schema.Directory) (*schema.Directory, error) {
+	inserted, err := d.Dirs.Insert(dir)
+	if err != nil {
+		return nil, err
+	}
+	d.updater.dir(inserted.ID)
+	return inserted, nil
+}
+
+// indexedProjects updates the index when projects change.
+type indexedProjects struct {
+	service.Projects
+	updater *updater
+}
+
+// Update updates a project and reindexes it.
+func (p indexedProjects) Update(project *schema.Project) error {
+	if err := p.Projects.Update(project); err != nil {
+		return err
+	}
+	p.updater.project(project.ID)
+	return nil
+}
+
+// Insert inserts a project and indexes it.
+func (p indexedProjects) Insert(project *schema.Project) (*schema.Project, error) {
+	inserted, err := p.Projects.Insert(project)
+	if err != nil {
+		return nil, err
+	}
+	p.updater.project(inserted.ID)
+	return inserted, nil
+}
@@ -1,156 +1,136 @@
 package access
 
 import (
+	"sync"
+	"time"
+
 	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mc"
 	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/server"
 	"github.com/materials-commons/mcfs/server/service"
 )
 
-func init() {
-	mcfs.InitRethinkDB()
-}
-
 // Create our own context log that always includes our server name.
 var l = log.New("server", "AccessServer")
 
-// The command to send
-type command int
+// defaultInterval is how often the keys are reloaded from the database.
+const defaultInterval = 5 * time.Second
 
-// Command definitions
-const (
-	acGetUser command = iota
-)
-
-// Request to send
-type request struct {
-	command command
-	arg     string
+// Report is the report for the access server.
+type Report struct {
+	Keys   int       // How many apikeys are loaded.
+	Loaded time.Time // When the keys were last loaded.
 }
 
-// Reponse to the request
-type response struct {
-	user *schema.User
-	err  error
-}
-
-// accessServer defines a server to control access to a shared set of user keys.
-// Communication and response are across channels. The server controls access
-// to the shared set of keys. It allows us to control reloading and updating the keys
-// in a safe manner.
+// accessServer controls access to a shared set of user keys. Lookups read the
+// keys directly. The server reloads the keys every interval, so keys that are
+// added, revoked or rotated take effect within seconds. A reload reads the
+// keys into a new map that replaces the old one, so lookups never wait for
+// the database.
 type accessServer struct {
+	interval time.Duration
+
+	// mutex protects isRunning, apikeys and report, which are read by the
+	// go routines looking up keys.
+	mutex     sync.Mutex
 	isRunning bool
 	apikeys   *apikeys
-	request   chan *request
-	response  chan *response
+	report    Report
 }
 
 // We only expose a single access server. The public routines work against this instance.
-var server = &accessServer{
-	apikeys: newAPIKeys(service.New(service.RethinkDB).User),
-}
+var server = &accessServer{}
 
 // Server returns the singleton accessServer.
 func Server() *accessServer {
 	return server
 }
 
-// Send sends a request to the server.
-func (s *accessServer) Send(request *request) error {
-	// Shortcut check, if we know the server isn't running then we
-	// don't have to wait for the panic.
-	if !s.isRunning {
-		return mcfs.ErrServerNotRunning
+// getUser looks up a user by their apikey in the loaded keys.
+func (s *accessServer) getUser(apikey string) (*schema.User, error) {
+	s.mutex.Lock()
+	isRunning, keys := s.isRunning, s.apikeys
+	s.mutex.Unlock()
+	if !isRunning {
+		return nil, mcfs.ErrServerNotRunning
 	}
 
-	var err error
-
-	defer func() {
-		if e := recover(); e != nil {
-			l.Debug("Attempt to send when server is not running.")
-			err = mcfs.ErrServerNotRunning
-		}
-	}()
-
-	s.request <- request
-	return err
-}
-
-// Recv receives a response from the server.
-func (s *accessServer) Recv() *response {
-	return <-s.response
+	u, found := keys.lookup(apikey)
+	if !found {
+		return nil, mcerr.ErrNotFound
+	}
+	return &u, nil
 }
 
 // Init initializes the server. It meant to be called by the Server interface each
-// time the server is started.
+// time the server is started. The keys are loaded from the configured database
+// when the server runs, and reloaded every MCFS_APIKEYS_INTERVAL in
+// time.ParseDuration format (eg, "10s").
 func (s *accessServer) Init() {
-	s.request = make(chan *request)
-	s.response = make(chan *response)
+	keys := newAPIKeys(service.New(service.Configured()).User)
+	s.mutex.Lock()
+	s.apikeys = keys
+	s.mutex.Unlock()
+	s.interval = mc.ConfigDuration("MCFS_APIKEYS_INTERVAL", defaultInterval)
 }
 
 // Run implements the server. It is meant to be called by the Server interface.
 func (s *accessServer) Run(stopChan <-chan struct{}) {
-	l.Info("Starting")
-	s.isRunning = true
+	l.Info(log.Msg("Starting, reloading keys every %s", s.interval))
 	if err := s.apikeys.load(); err != nil {
-		s.shutdown()
 		l.Crit(log.Msg("Unable to load apikeys: %s\n", err))
 		return
 	}
+	s.loaded()
+	s.setRunning(true)
+	defer s.setRunning(false)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case request := <-s.request:
-			l.Debug(log.Msg("Received request: %#v\n", request))
-			s.doRequest(request)
+		case <-ticker.C:
+			s.reload()
 		case <-stopChan:
 			l.Info("Shutting down.")
-			s.shutdown()
 			return
 		}
 	}
 }
 
-// shutdown performs cleanup of the server data structures.
-func (s *accessServer) shutdown() {
-	s.isRunning = false
-	close(s.request)
-	close(s.response)
+// setRunning records whether lookups can use the loaded keys.
+func (s *accessServer) setRunning(isRunning bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.isRunning = isRunning
 }
 
-// doRequest performs the request sent along the channel. Unknown requests send back an error.
-func (s *accessServer) doRequest(request *request) {
-	switch request.command {
-	case acGetUser:
-		s.doGetUser(request.arg)
-	default:
-		l.Warn("Received invalid command:", "command", request.command)
-		s.doInvalidRequest()
+// reload reloads the keys. The current keys are kept if the database can't
+// be read.
+func (s *accessServer) reload() {
+	if err := s.apikeys.load(); err != nil {
+		l.Error(log.Msg("Unable to reload apikeys: %s", err))
+		return
 	}
+	s.loaded()
 }
 
-// doGetUser looks up a user by their apikey
-func (s *accessServer) doGetUser(apikey string) {
-	u, found := s.apikeys.lookup(apikey)
-	switch {
-	case found:
-		s.response <- &response{
-			user: &u,
-			err:  nil,
-		}
-	default:
-		s.response <- &response{
-			user: nil,
-			err:  mcerr.ErrNotFound,
-		}
+// loaded records the keys that were loaded for the server's report.
+func (s *accessServer) loaded() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.report = Report{
+		Keys:   s.apikeys.count(),
+		Loaded: time.Now(),
 	}
 }
 
-// doInvalidRequest returns an error when the command is not recognized
-func (s *accessServer) doInvalidRequest() {
-	s.response <- &response{
-		user: nil,
-		err:  mcerr.ErrInvalid,
-	}
+// Report returns how many keys are loaded, and when they were loaded.
+func (s *accessServer) Report() interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.report
 }
@@ -1,7 +1,151 @@
 package access
 
 import (
-//"testing"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/config"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
 )
 
-//func
+// fakeUsers is an in memory implementation of service.Users whose users can
+// be changed. Only All is implemented.
+type fakeUsers struct {
+	service.Users
+	mutex sync.Mutex
+	users []schema.User
+}
+
+func (f *fakeUsers) All() ([]schema.User, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]schema.User(nil), f.users...), nil
+}
+
+func (f *fakeUsers) set(users ...schema.User) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.users = users
+}
+
+// waitFor retries lookup until it returns the expected error state, or fails
+// after a second.
+func waitFor(t *testing.T, apikey string, found bool, what string) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(5 * time.Millisecond) {
+		if _, err := GetUserByAPIKey(apikey); (err == nil) == found {
+			return
+		}
+	}
+	t.Fatalf("%s: expected found to be %t for %s", what, found, apikey)
+}
+
+func TestReloadKeys(t *testing.T) {
+	users := &fakeUsers{}
+	users.set(schema.NewUser("test", "test@mc.org", "", "testkey"))
+
+	config.Set("MCDB_TYPE", "memory")
+	server.Init()
+	server.apikeys = newAPIKeys(users)
+	server.interval = 10 * time.Millisecond
+	stopChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		server.Run(stopChan)
+		close(done)
+	}()
+	defer func() {
+		close(stopChan)
+		<-done
+	}()
+
+	waitFor(t, "testkey", true, "Loaded")
+	u, _ := GetUserByAPIKey("testkey")
+	if u.Email != "test@mc.org" {
+		t.Fatalf("Wrong user for testkey %#v", u)
+	}
+
+	// Add a user and rotate the first user's key.
+	users.set(schema.NewUser("test", "test@mc.org", "", "newkey"), schema.NewUser("test2", "test2@mc.org", "", "test2key"))
+	waitFor(t, "newkey", true, "Rotated")
+	waitFor(t, "test2key", true, "Added")
+	waitFor(t, "testkey", false, "Old key")
+
+	// Revoke a key.
+	users.set(schema.NewUser("test", "test@mc.org", "", "newkey"))
+	waitFor(t, "test2key", false, "Revoked")
+
+	if report := server.Report().(Report); report.Keys != 1 {
+		t.Fatalf("Expected 1 key to be loaded, got %#v", report)
+	}
+}
+
+// blockingUsers blocks in All until release is closed, after the first call.
+type blockingUsers struct {
+	fakeUsers
+	calls   int
+	release chan struct{}
+}
+
+func (b *blockingUsers) All() ([]schema.User, error) {
+	b.mutex.Lock()
+	b.calls++
+	first := b.calls == 1
+	b.mutex.Unlock()
+	if !first {
+		<-b.release
+	}
+	return b.fakeUsers.All()
+}
+
+func TestLookupDuringReload(t *testing.T) {
+	users := &blockingUsers{release: make(chan struct{})}
+	users.set(schema.NewUser("test", "test@mc.org", "", "testkey"))
+
+	config.Set("MCDB_TYPE", "memory")
+	server.Init()
+	server.apikeys = newAPIKeys(users)
+	server.interval = time.Millisecond
+	stopChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		server.Run(stopChan)
+		close(done)
+	}()
+	defer func() {
+		close(users.release)
+		close(stopChan)
+		<-done
+	}()
+
+	waitFor(t, "testkey", true, "Loaded")
+
+	// Lookups are answered from the loaded keys while a reload is stuck
+	// reading the database.
+	time.Sleep(10 * time.Millisecond)
+	answered := make(chan struct{})
+	go func() {
+		GetUserByAPIKey("testkey")
+		close(answered)
+	}()
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		t.Fatalf("Lookup waited for the reload")
+	}
+}
+
+func TestWithCache(t *testing.T) {
+	svc := service.NewMemory(schema.NewUser("test", "test@mc.org", "", "testkey"))
+	cached := WithCache(svc)
+
+	// The database is used when the server isn't running.
+	if u, err := cached.User.ByAPIKey("testkey"); err != nil || u.Email != "test@mc.org" {
+		t.Fatalf("Lookup without the server failed: %#v %s", u, err)
+	}
+
+	if svc.User == cached.User {
+		t.Fatalf("WithCache changed the service it was given")
+	}
+}
@@ -2,19 +2,33 @@ package access
 
 import (
 	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server"
+	"github.com/materials-commons/mcfs/server/service"
 )
 
 // GetUserByAPIKey returns the User for a given APIKey.
 func GetUserByAPIKey(apikey string) (*schema.User, error) {
-	request := request{
-		command: acGetUser,
-		arg:     apikey,
-	}
+	return server.getUser(apikey)
+}
 
-	if err := server.Send(&request); err != nil {
-		return nil, err
-	}
+// WithCache returns a copy of svc whose apikey lookups go through
+// GetUserByAPIKey. Lookups go to svc when the access server isn't running.
+func WithCache(svc *service.Service) *service.Service {
+	cached := *svc
+	cached.User = cachedUsers{svc.User}
+	return &cached
+}
 
-	response := server.Recv()
-	return response.user, response.err
+// cachedUsers looks up apikeys in the access server's keys.
+type cachedUsers struct {
+	service.Users
+}
+
+// ByAPIKey looks up users by their apikey.
+func (u cachedUsers) ByAPIKey(apikey string) (*schema.User, error) {
+	user, err := GetUserByAPIKey(apikey)
+	if err == mcfs.ErrServerNotRunning {
+		return u.Users.ByAPIKey(apikey)
+	}
+	return user, err
 }
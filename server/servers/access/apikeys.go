@@ -1,11 +1,15 @@
 package access
 
 import (
+	"sync"
+
 	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/server/service"
 )
 
 type apikeys struct {
+	// mutex protects keys, which load replaces while lookups are running.
+	mutex sync.RWMutex
 	keys  map[string]schema.User
 	users service.Users
 }
@@ -17,25 +21,39 @@ func newAPIKeys(users service.Users) *apikeys {
 	}
 }
 
+// load replaces the keys with the current keys in the database. Keys that
+// were removed or rotated stop working. The keys are read into a new map, so
+// lookups aren't blocked while the database is read. When the keys can't be
+// loaded the previous keys are kept.
 func (a *apikeys) load() error {
 	users, err := a.users.All()
 	if err != nil {
 		return err
 	}
 
+	keys := make(map[string]schema.User)
 	for _, user := range users {
-		a.keys[user.APIKey] = user
+		if user.APIKey != "" && !user.Disabled {
+			keys[user.APIKey] = user
+		}
 	}
 
+	a.mutex.Lock()
+	a.keys = keys
+	a.mutex.Unlock()
 	return nil
 }
 
-func (a *apikeys) reload() error {
-	a.keys = make(map[string]schema.User)
-	return a.load()
-}
-
 func (a *apikeys) lookup(apikey string) (user schema.User, found bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
 	user, found = a.keys[apikey]
 	return user, found
 }
+
+// count returns the number of keys loaded.
+func (a *apikeys) count() int {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return len(a.keys)
+}
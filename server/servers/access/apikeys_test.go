@@ -38,7 +38,7 @@ func TestReloadAndLookup(t *testing.T) {
 	defer func() {
 		model.Users.Q().Delete("tuser@test.org")
 	}()
-	_apikeys.reload()
+	_apikeys.load()
 	_, found := _apikeys.lookup("apikey123")
 	if !found {
 		t.Fatalf("apikeys reload failed, couldn't find user with key apikey123")
@@ -46,7 +46,7 @@ func TestReloadAndLookup(t *testing.T) {
 	// Modify a user, reload and make sure that the user was modified
 	user.APIKey = "abc123"
 	model.Users.Q().Update(user.ID, user)
-	_apikeys.reload()
+	_apikeys.load()
 	_, found = _apikeys.lookup("apikey123")
 	if found {
 		t.Fatalf("apikeys found key just replaced")
@@ -0,0 +1,83 @@
+package dbcheck
+
+import (
+	"time"
+
+	"github.com/materials-commons/mcfs/base/db"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mc"
+)
+
+// Create our own context log that always includes our server name.
+var l = log.New("server", "DBCheck")
+
+// defaultInterval is how often the database connection is checked.
+const defaultInterval = 30 * time.Second
+
+// dbCheckServer periodically checks that the shared RethinkDB session can
+// still run queries. A session that fails the check is replaced by a new
+// one, so the server recovers from database restarts without losing its
+// connections for good. The check interval is also how often a lost
+// database is reconnected to.
+type dbCheckServer struct {
+	check    func() error
+	interval time.Duration
+	healthy  bool
+}
+
+// Report is the report for the dbcheck server.
+type Report struct {
+	Healthy bool // Whether the last check succeeded.
+}
+
+// We only expose a single dbcheck server.
+var server = &dbCheckServer{}
+
+// Server returns the singleton dbCheckServer.
+func Server() *dbCheckServer {
+	return server
+}
+
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started. How often to check is read from MCDB_CHECK_INTERVAL
+// in time.ParseDuration format (eg, "1m").
+func (s *dbCheckServer) Init() {
+	s.check = db.RCheck
+	s.healthy = true
+	s.interval = mc.ConfigDuration("MCDB_CHECK_INTERVAL", defaultInterval)
+}
+
+// Run implements the server. It is meant to be called by the Server interface.
+func (s *dbCheckServer) Run(stopChan <-chan struct{}) {
+	l.Info(log.Msg("Starting, checking the database every %s", s.interval))
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.checkDB()
+		case <-stopChan:
+			l.Info("Shutting down.")
+			return
+		}
+	}
+}
+
+// checkDB runs a single check. Only changes in the state of the database
+// are logged.
+func (s *dbCheckServer) checkDB() {
+	err := s.check()
+	switch {
+	case err != nil && s.healthy:
+		l.Error(log.Msg("Database check failed, reconnecting: %s", err))
+	case err == nil && !s.healthy:
+		l.Info("Database connection restored.")
+	}
+	s.healthy = err == nil
+}
+
+// Report returns whether the database was healthy when last checked.
+func (s *dbCheckServer) Report() interface{} {
+	return Report{Healthy: s.healthy}
+}
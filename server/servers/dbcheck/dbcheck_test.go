@@ -0,0 +1,31 @@
+package dbcheck
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDB(t *testing.T) {
+	var checkErr error
+	s := &dbCheckServer{
+		check:   func() error { return checkErr },
+		healthy: true,
+	}
+
+	s.checkDB()
+	if !s.healthy {
+		t.Fatalf("Successful check marked database unhealthy")
+	}
+
+	checkErr = errors.New("connection refused")
+	s.checkDB()
+	if s.healthy {
+		t.Fatalf("Failed check left database healthy")
+	}
+
+	checkErr = nil
+	s.checkDB()
+	if !s.healthy {
+		t.Fatalf("Database not marked healthy after it recovered")
+	}
+}
@@ -0,0 +1,180 @@
+package reaper
+
+import (
+	"time"
+
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/mc"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/inuse"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Create our own context log that always includes our server name.
+var l = log.New("server", "PartialsReaper")
+
+const (
+	// defaultMaxAge is how long a partial can go without any bytes being
+	// written to it before it is considered abandoned.
+	defaultMaxAge = 7 * 24 * time.Hour
+
+	// defaultInterval is how often we look for abandoned partials.
+	defaultInterval = time.Hour
+)
+
+// reaperServer periodically looks for partial uploads that have been abandoned
+// and reclaims their database entries and physical files. A partial is abandoned
+// when it hasn't been written to in maxAge.
+type reaperServer struct {
+	files    service.Files
+	tracker  *inuse.Tracker
+	store    store.Store
+	maxAge   time.Duration
+	interval time.Duration
+}
+
+// We only expose a single reaper server.
+var server = &reaperServer{}
+
+// Server returns the singleton reaperServer.
+func Server() *reaperServer {
+	return server
+}
+
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started. The age at which partials expire is read from
+// MCFS_PARTIALS_MAX_AGE, and how often to look for them from MCFS_PARTIALS_INTERVAL.
+// Both are in time.ParseDuration format (eg, "72h").
+func (s *reaperServer) Init() {
+	s.files = service.New(service.Configured()).File
+	s.store = store.New()
+	s.tracker = inuse.Default()
+	s.maxAge = mc.ConfigDuration("MCFS_PARTIALS_MAX_AGE", defaultMaxAge)
+	s.interval = mc.ConfigDuration("MCFS_PARTIALS_INTERVAL", defaultInterval)
+}
+
+// Run implements the server. It is meant to be called by the Server interface.
+func (s *reaperServer) Run(stopChan <-chan struct{}) {
+	l.Info(log.Msg("Starting, partials expire after %s", s.maxAge))
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.reap(time.Now().Add(-s.maxAge))
+		case <-stopChan:
+			l.Info("Shutting down.")
+			return
+		}
+	}
+}
+
+// Reap reclaims the partials in files that haven't been written to in maxAge
+// without running the server. It returns the files that were reclaimed.
+func Reap(files service.Files, st store.Store, maxAge time.Duration) []schema.File {
+	s := &reaperServer{
+		files:   files,
+		store:   st,
+		tracker: inuse.Default(),
+		maxAge:  maxAge,
+	}
+	return s.reap(time.Now().Add(-maxAge))
+}
+
+// reap reclaims all partials that haven't been written to since cutoff. It
+// returns the list of files that were reclaimed.
+func (s *reaperServer) reap(cutoff time.Time) []schema.File {
+	partials, err := s.files.PartialsBefore(cutoff)
+	if err != nil {
+		l.Error(log.Msg("Unable to retrieve partials: %s", err))
+		return nil
+	}
+
+	var reclaimed []schema.File
+	seen := make(map[string]bool)
+	for _, partial := range partials {
+		if seen[partial.ID] {
+			// Already reclaimed as a dependent of another partial.
+			continue
+		}
+
+		var files []schema.File
+		switch {
+		case partial.UsesID == "":
+			files = s.reclaim(partial, cutoff)
+		case !s.ownerExists(partial.UsesID):
+			// A partial that points at another file is handled when that
+			// file is reclaimed, unless that file no longer exists.
+			files = s.reclaimEntries(partial)
+		}
+
+		for _, f := range files {
+			seen[f.ID] = true
+		}
+		reclaimed = append(reclaimed, files...)
+	}
+
+	return reclaimed
+}
+
+// ownerExists checks if the file a duplicate points at is still around.
+func (s *reaperServer) ownerExists(id string) bool {
+	_, err := s.files.ByID(id)
+	return err == nil
+}
+
+// reclaim reclaims a partial that owns its physical file. The partial is skipped if
+// it is being uploaded, or if any of the files that share its physical file
+// have been active since cutoff.
+func (s *reaperServer) reclaim(partial schema.File, cutoff time.Time) []schema.File {
+	if !s.tracker.Mark(partial.ID) {
+		l.Debug(log.Msg("Partial %s is in use, skipping", partial.ID))
+		return nil
+	}
+	defer s.tracker.Unmark(partial.ID)
+
+	dependents, err := s.files.MatchOn("usesid", partial.ID)
+	if err != nil {
+		l.Error(log.Msg("Unable to retrieve files using %s: %s", partial.ID, err))
+		return nil
+	}
+
+	for _, dependent := range dependents {
+		if dependent.ID == partial.ID {
+			continue
+		}
+		if dependent.Current || !dependent.MTime.Before(cutoff) || s.tracker.Is(dependent.ID) {
+			l.Debug(log.Msg("Partial %s has active dependent %s, skipping", partial.ID, dependent.ID))
+			return nil
+		}
+	}
+
+	var reclaimed []schema.File
+	for _, dependent := range dependents {
+		if dependent.ID != partial.ID {
+			reclaimed = append(reclaimed, s.reclaimEntries(dependent)...)
+		}
+	}
+
+	if err := s.store.Delete(partial.ID); err != nil && !mcerr.Is(err, mcerr.ErrNotFound) {
+		l.Error(log.Msg("Unable to remove physical file for partial %s: %s", partial.ID, err))
+		return reclaimed
+	}
+
+	return append(reclaimed, s.reclaimEntries(partial)...)
+}
+
+// reclaimEntries removes the database entry for a partial.
+func (s *reaperServer) reclaimEntries(partial schema.File) []schema.File {
+	if err := s.files.Delete(partial.ID); err != nil {
+		l.Error(log.Msg("Unable to delete partial %s: %s", partial.ID, err))
+		return nil
+	}
+
+	l.Info("Reclaimed partial", "id", partial.ID, "name", partial.Name, "owner", partial.Owner,
+		"uploaded", partial.Uploaded, "size", partial.Size, "mtime", partial.MTime)
+	return []schema.File{partial}
+}
@@ -0,0 +1,164 @@
+package reaper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/inuse"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// fakeFiles is an in memory implementation of service.Files. Only the methods
+// used by the reaper are implemented.
+type fakeFiles struct {
+	service.Files
+	files map[string]schema.File
+}
+
+func (f *fakeFiles) ByID(id string) (*schema.File, error) {
+	if file, found := f.files[id]; found {
+		return &file, nil
+	}
+	return nil, mcerr.ErrNotFound
+}
+
+func (f *fakeFiles) PartialsBefore(cutoff time.Time) ([]schema.File, error) {
+	var partials []schema.File
+	for _, file := range f.files {
+		if !file.Current && file.Uploaded != file.Size && file.MTime.Before(cutoff) {
+			partials = append(partials, file)
+		}
+	}
+	return partials, nil
+}
+
+func (f *fakeFiles) MatchOn(key, value string) ([]schema.File, error) {
+	var files []schema.File
+	for _, file := range f.files {
+		if file.UsesID == value {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (f *fakeFiles) Delete(id string) error {
+	delete(f.files, id)
+	return nil
+}
+
+// removedStore records the objects deleted from it.
+type removedStore struct {
+	store.Store
+	removed map[string]bool
+}
+
+func (s *removedStore) Delete(id string) error {
+	s.removed[id] = true
+	return nil
+}
+
+func newTestServer(files ...schema.File) (*reaperServer, *fakeFiles, map[string]bool) {
+	ff := &fakeFiles{files: make(map[string]schema.File)}
+	for _, file := range files {
+		ff.files[file.ID] = file
+	}
+	removed := make(map[string]bool)
+	s := &reaperServer{
+		files:   ff,
+		store:   &removedStore{Store: store.NewMemory(), removed: removed},
+		tracker: inuse.NewTracker(),
+	}
+	return s, ff, removed
+}
+
+func partial(id, usesID string, mtime time.Time) schema.File {
+	return schema.File{
+		ID:       id,
+		UsesID:   usesID,
+		Size:     100,
+		Uploaded: 10,
+		MTime:    mtime,
+	}
+}
+
+func TestReapAbandoned(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	cutoff := now.Add(-time.Hour)
+
+	s, ff, removed := newTestServer(
+		partial("abandoned", "", old),
+		partial("active", "", now),
+		schema.File{ID: "complete", Size: 100, Uploaded: 100, MTime: old, Current: true},
+	)
+
+	reclaimed := s.reap(cutoff)
+	if len(reclaimed) != 1 || reclaimed[0].ID != "abandoned" {
+		t.Fatalf("Expected only abandoned to be reclaimed, got %#v", reclaimed)
+	}
+
+	if _, found := ff.files["abandoned"]; found {
+		t.Errorf("abandoned entry was not deleted")
+	}
+
+	if !removed["abandoned"] {
+		t.Errorf("abandoned physical file was not removed")
+	}
+
+	if _, found := ff.files["active"]; !found {
+		t.Errorf("active partial was deleted")
+	}
+
+	if _, found := ff.files["complete"]; !found {
+		t.Errorf("complete file was deleted")
+	}
+}
+
+func TestReapSkipsInUse(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	s, ff, removed := newTestServer(partial("uploading", "", old))
+	s.tracker.Mark("uploading")
+
+	if reclaimed := s.reap(time.Now()); len(reclaimed) != 0 {
+		t.Fatalf("Expected nothing to be reclaimed, got %#v", reclaimed)
+	}
+
+	if _, found := ff.files["uploading"]; !found || removed["uploading"] {
+		t.Errorf("in use partial was reclaimed")
+	}
+}
+
+func TestReapSharedPhysicalFile(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	cutoff := now.Add(-time.Hour)
+
+	// A partial whose physical file is shared with a current file must be left alone.
+	current := schema.File{ID: "dup", UsesID: "shared", Size: 100, Uploaded: 100, MTime: old, Current: true}
+	s, ff, removed := newTestServer(partial("shared", "", old), current)
+	if reclaimed := s.reap(cutoff); len(reclaimed) != 0 {
+		t.Fatalf("Expected nothing to be reclaimed, got %#v", reclaimed)
+	}
+
+	if _, found := ff.files["shared"]; !found || removed["shared"] {
+		t.Errorf("shared partial was reclaimed")
+	}
+
+	// Once all the files sharing it are abandoned partials everything is reclaimed.
+	s, ff, removed = newTestServer(partial("shared", "", old), partial("dup", "shared", old))
+	if reclaimed := s.reap(cutoff); len(reclaimed) != 2 {
+		t.Fatalf("Expected both entries to be reclaimed, got %#v", reclaimed)
+	}
+
+	if len(ff.files) != 0 {
+		t.Errorf("Expected all entries to be deleted, got %#v", ff.files)
+	}
+
+	if !removed["shared"] || removed["dup"] {
+		t.Errorf("Expected only the shared physical file to be removed, got %#v", removed)
+	}
+}
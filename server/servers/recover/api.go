@@ -1,10 +1,16 @@
 package recover
 
 import (
-	"fmt"
+	"github.com/materials-commons/mcfs/server"
 )
 
-// AddRequest adds a request
+// AddRequest adds a request. It returns mcfs.ErrServerNotRunning if the
+// server isn't running.
 func AddRequest(request *Request) error {
-	return fmt.Errorf("not implemented")
+	if !server.isRunning {
+		return mcfs.ErrServerNotRunning
+	}
+
+	server.request <- request
+	return nil
 }
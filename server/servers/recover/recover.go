@@ -1,6 +1,14 @@
 package recover
 
-import ()
+import (
+	"github.com/materials-commons/mcfs/base/log"
+)
+
+// Create our own context log that always includes our server name.
+var l = log.New("server", "Recovery")
+
+// pending is how many requests can wait before AddRequest blocks.
+const pending = 50
 
 // Request is what we have been asked to do.
 type Request struct{}
@@ -8,20 +16,47 @@ type Request struct{}
 // Response is something else
 type Response struct{}
 
+// recoveryServer handles recovery requests one at a time.
 type recoveryServer struct {
-	request chan Request
+	isRunning bool
+	request   chan *Request
 }
 
-var server = &recoveryServer{
-	request: make(chan Request, 50),
-}
+// We only expose a single recovery server.
+var server = &recoveryServer{}
 
 // Server returns the server
 func Server() *recoveryServer {
 	return server
 }
 
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started.
+func (s *recoveryServer) Init() {
+	s.request = make(chan *Request, pending)
+}
+
 // Run runs the server
 func (s *recoveryServer) Run(stopChan <-chan struct{}) {
+	l.Info("Starting")
+	s.isRunning = true
+	defer func() {
+		s.isRunning = false
+	}()
+
+	for {
+		select {
+		case request := <-s.request:
+			s.doRequest(request)
+		case <-stopChan:
+			l.Info("Shutting down.")
+			return
+		}
+	}
+}
 
+// doRequest performs a recovery request. There is nothing to recover yet,
+// so requests are only logged.
+func (s *recoveryServer) doRequest(request *Request) {
+	l.Info(log.Msg("Received recovery request: %#v", request))
 }
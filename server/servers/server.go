@@ -1,6 +1,10 @@
 package servers
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	"launchpad.net/tomb"
 )
 
@@ -16,34 +20,146 @@ type Instance interface {
 	Init()
 }
 
+// Reporter is implemented by instances that have more to report than whether
+// they are running, such as the jobs a processor has run. The report is
+// included in the server's Info.
+type Reporter interface {
+	Report() interface{}
+}
+
+// Restart delays. A server that stops on its own is restarted after
+// minRestartDelay. The delay doubles each time the server stops again,
+// up to maxRestartDelay, and is reset once the server has stayed up for
+// maxRestartDelay. They are variables so tests can shorten them.
+var (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+)
+
 // Server is an instance of server that can be started, stopped and
-// queried for status. A server is a go routine.
+// queried for status. A server is a go routine. The server is supervised:
+// if Run returns or panics before Stop is called the instance is
+// initialized and run again.
 type Server struct {
 	tomb.Tomb
 	Instance
-	started bool
+
+	// mutex protects the fields below, which are updated by the supervising
+	// go routine and read when reporting status.
+	mutex       sync.Mutex
+	started     bool
+	supervising bool // A supervise go routine was started on the tomb.
+	startedAt   time.Time
+	restarts  int
+	lastError string
+}
+
+// Info describes a server's state.
+type Info struct {
+	Status    Status
+	Started   time.Time   // When the instance was last started.
+	Restarts  int         // How many times the instance was restarted.
+	LastError string      // Why the instance last stopped on its own.
+	Report    interface{} `json:",omitempty"` // Set for instances that are a Reporter.
 }
 
 // Start starts a server instance. It handles marking a server as done when it
-// has finished running.
+// has finished running, and restarts the instance if it stops on its own. An
+// instance that is still running, or still stopping, is stopped and waited
+// for first, so that two runs never overlap.
 func (s *Server) Start() {
+	s.mutex.Lock()
+	supervising := s.supervising
+	s.mutex.Unlock()
+	if supervising {
+		s.Stop()
+		s.Wait()
+	}
+
 	s.Init()
+	s.mutex.Lock()
 	s.Tomb = tomb.Tomb{}
 	s.started = true
+	s.supervising = true
+	s.startedAt = time.Now()
+	s.mutex.Unlock()
 	go func() {
 		defer s.Done()
-		s.Run(s.Dying())
+		s.supervise()
+	}()
+}
+
+// supervise runs the instance until the server is stopped.
+func (s *Server) supervise() {
+	delay := minRestartDelay
+	for {
+		began := time.Now()
+		err := s.run()
+
+		select {
+		case <-s.Dying():
+			return
+		default:
+		}
+
+		if time.Since(began) >= maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		s.mutex.Lock()
+		s.lastError = err.Error()
+		s.mutex.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-s.Dying():
+			return
+		}
+
+		if delay *= 2; delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+
+		s.Init()
+		s.mutex.Lock()
+		s.restarts++
+		s.startedAt = time.Now()
+		s.mutex.Unlock()
+	}
+}
+
+// run runs the instance once. It returns why the instance stopped, which
+// is only meaningful when the server wasn't asked to stop.
+func (s *Server) run() (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
 	}()
+
+	s.Run(s.Dying())
+	return fmt.Errorf("stopped without being asked to")
 }
 
 // Stop stops a server instance.
 func (s *Server) Stop() {
+	s.mutex.Lock()
 	s.started = false
+	s.mutex.Unlock()
 	s.Kill(nil)
 }
 
+// isStarted returns true if the server has been started and not stopped.
+func (s *Server) isStarted() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.started
+}
+
 // Status returns the current status of the server.
 func (s *Server) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	if !s.started {
 		return Stopped
 	}
@@ -57,3 +173,22 @@ func (s *Server) Status() Status {
 		return Stopped
 	}
 }
+
+// Info returns the status of the server, how often it has been restarted,
+// and the instance's report if it has one.
+func (s *Server) Info() Info {
+	status := s.Status()
+	s.mutex.Lock()
+	info := Info{
+		Status:    status,
+		Started:   s.startedAt,
+		Restarts:  s.restarts,
+		LastError: s.lastError,
+	}
+	s.mutex.Unlock()
+
+	if r, ok := s.Instance.(Reporter); ok {
+		info.Report = r.Report()
+	}
+	return info
+}
@@ -71,3 +71,82 @@ func TestCommunication(t *testing.T) {
 		t.Fatalf("Server running but got bad response: %s", response)
 	}
 }
+
+// crashServer stops on its own, by returning or panicking, each time it is run.
+type crashServer struct {
+	panics bool
+	runs   chan int
+	count  int
+}
+
+func (cs *crashServer) Run(stopChan <-chan struct{}) {
+	cs.count++
+	cs.runs <- cs.count
+	if cs.panics {
+		panic("crashed")
+	}
+}
+
+func (cs *crashServer) Init() {}
+
+func (cs *crashServer) Report() interface{} {
+	return "crash report"
+}
+
+func TestRestart(t *testing.T) {
+	minRestartDelay = time.Millisecond
+	defer func() { minRestartDelay = time.Second }()
+
+	for _, panics := range []bool{false, true} {
+		cs := &crashServer{panics: panics, runs: make(chan int)}
+		s := &Server{Instance: cs}
+		s.Start()
+		for i := 1; i <= 3; i++ {
+			select {
+			case run := <-cs.runs:
+				if run != i {
+					t.Fatalf("Expected run %d, got %d", i, run)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Server wasn't restarted (panics %t)", panics)
+			}
+		}
+		s.Stop()
+		go func() {
+			// Let a run that started before Stop finish.
+			for range cs.runs {
+			}
+		}()
+		s.Wait()
+		close(cs.runs)
+
+		info := s.Info()
+		if info.Restarts < 2 || info.LastError == "" || info.Report != "crash report" {
+			t.Fatalf("Wrong info after restarts (panics %t): %#v", panics, info)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("Test", &testServer{})
+	if info := Infos()["Test"]; info.Status != Stopped {
+		t.Fatalf("Registered server should be Stopped, got %s", info.Status)
+	}
+
+	StartNamed("Test")
+	if info := Infos()["Test"]; info.Status != Running {
+		t.Fatalf("Started server should be Running, got %s", info.Status)
+	}
+
+	// Restarting waits for the earlier run to finish.
+	StopNamed("Test")
+	StartNamed("Test")
+	if info := Infos()["Test"]; info.Status != Running {
+		t.Fatalf("Restarted server should be Running, got %s", info.Status)
+	}
+
+	Stop()
+	if info := Infos()["Test"]; info.Status != Stopped {
+		t.Fatalf("Stopped server should be Stopped, got %s", info.Status)
+	}
+}
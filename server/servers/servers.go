@@ -1,16 +1,30 @@
 package servers
 
 import (
-	"github.com/materials-commons/mcfs/server/servers/access"
+	"sync"
 )
 
-// Maps each server instance to name.
-var servers = map[string]Server{
-	"Access": {Instance: access.Server()},
+var (
+	// mutex protects servers.
+	mutex sync.Mutex
+
+	// Maps each server instance to name.
+	servers = make(map[string]*Server)
+)
+
+// Register adds a server instance under name. The instance isn't started
+// until Start or StartNamed is called. Registering a name again replaces
+// the earlier instance, which should be stopped first.
+func Register(name string, instance Instance) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	servers[name] = &Server{Instance: instance}
 }
 
 // Start starts all server instances.
 func Start() {
+	mutex.Lock()
+	defer mutex.Unlock()
 	for _, s := range servers {
 		s.Start()
 	}
@@ -18,6 +32,8 @@ func Start() {
 
 // StartNamed starts the named server instances.
 func StartNamed(serverNames ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
 	for _, serverName := range serverNames {
 		s, found := servers[serverName]
 		if found {
@@ -26,19 +42,48 @@ func StartNamed(serverNames ...string) {
 	}
 }
 
-// Stop stops all server instances.
+// Stop stops all server instances, and waits for them to finish.
 func Stop() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	var stopped []*Server
 	for _, s := range servers {
-		s.Stop()
+		if s.isStarted() {
+			s.Stop()
+			stopped = append(stopped, s)
+		}
+	}
+
+	for _, s := range stopped {
+		s.Wait()
 	}
 }
 
-// StopNamed stops the named server instances.
+// StopNamed stops the named server instances, and waits for them to finish.
 func StopNamed(serverNames ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	var stopped []*Server
 	for _, serverName := range serverNames {
 		s, found := servers[serverName]
-		if found {
+		if found && s.isStarted() {
 			s.Stop()
+			stopped = append(stopped, s)
 		}
 	}
+
+	for _, s := range stopped {
+		s.Wait()
+	}
+}
+
+// Infos returns the Info for each registered server, by name.
+func Infos() map[string]Info {
+	mutex.Lock()
+	defer mutex.Unlock()
+	infos := make(map[string]Info, len(servers))
+	for name, s := range servers {
+		infos[name] = s.Info()
+	}
+	return infos
 }
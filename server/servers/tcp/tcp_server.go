@@ -0,0 +1,168 @@
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/materials-commons/config"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/client/util"
+	"github.com/materials-commons/mcfs/server/metrics"
+	"github.com/materials-commons/mcfs/server/request"
+	"github.com/materials-commons/mcfs/server/search"
+	"github.com/materials-commons/mcfs/server/servers/access"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// Create our own context log that always includes our server name.
+var l = log.New("server", "TCPServer")
+
+// tcpServer accepts connections from mcfs clients. Each connection is
+// handled in its own go routine by a request handler running the upload and
+// download protocol.
+type tcpServer struct {
+	service *service.Service
+	store   store.Store
+
+	// mutex protects listener, which is opened by Listen and closed when
+	// the server stops.
+	mutex    sync.Mutex
+	listener net.Listener
+
+	connections int64 // Currently open connections.
+	accepted    int64 // Connections accepted since the program started.
+}
+
+// Report is the report for the TCP server.
+type Report struct {
+	Address     string
+	Connections int64
+	Accepted    int64
+}
+
+// We only expose a single tcp server.
+var server = &tcpServer{}
+
+// Server returns the singleton tcpServer.
+func Server() *tcpServer {
+	return server
+}
+
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started.
+func (s *tcpServer) Init() {
+	s.service = search.WithIndex(access.WithCache(service.New(service.Configured())), search.Default())
+	s.store = store.New()
+}
+
+// address returns the address to listen on. The interface is read from
+// MCFS_BIND and the port from MCFS_PORT.
+func address() string {
+	return fmt.Sprintf("%s:%d", config.GetString("MCFS_BIND"), config.GetInt("MCFS_PORT"))
+}
+
+// Listen opens the listener if it isn't already open. Run calls it, but it
+// can be called before the server is started to find out straight away
+// whether the port is available.
+func (s *tcpServer) Listen() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.listener != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", address())
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// Run implements the server. It is meant to be called by the Server interface.
+func (s *tcpServer) Run(stopChan <-chan struct{}) {
+	if err := s.Listen(); err != nil {
+		l.Error(log.Msg("Unable to listen on %s: %s", address(), err))
+		return
+	}
+
+	s.mutex.Lock()
+	listener := s.listener
+	s.mutex.Unlock()
+	l.Info(log.Msg("Starting, listening on %s", listener.Addr()))
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stopChan:
+			l.Info("Shutting down.")
+		case <-done:
+		}
+		s.close()
+	}()
+
+	s.acceptConnections(listener)
+}
+
+// close closes the listener so it is reopened when the server starts again.
+func (s *tcpServer) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+}
+
+// acceptConnections listens on the listener until it is closed. When a new
+// connection comes in it is dispatched in a separate go routine. Connections
+// that are open when the server stops are left to finish.
+func (s *tcpServer) acceptConnections(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		switch {
+		case err == nil:
+			m := util.NewGobMarshaler(conn)
+			r := request.NewReqHandler(m, s.service, s.store)
+			r.SetRemoteAddr(conn.RemoteAddr().String())
+			atomic.AddInt64(&s.accepted, 1)
+			go s.handleConnection(r, conn)
+		case isTemporary(err):
+			continue
+		default:
+			return
+		}
+	}
+}
+
+// isTemporary returns true for accept errors that are worth retrying.
+func isTemporary(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Temporary()
+}
+
+// handleConnection handles connection requests by running the state machine. It also
+// takes care of book keeping like shutting down the net connection when the
+// connection is terminated.
+func (s *tcpServer) handleConnection(reqHandler *request.ReqHandler, conn net.Conn) {
+	atomic.AddInt64(&s.connections, 1)
+	defer atomic.AddInt64(&s.connections, -1)
+	metrics.ActiveConnections.Inc()
+	defer metrics.ActiveConnections.Dec()
+	defer conn.Close()
+	reqHandler.Run()
+}
+
+// Report returns the address the server listens on and how many connections
+// it has.
+func (s *tcpServer) Report() interface{} {
+	return Report{
+		Address:     address(),
+		Connections: atomic.LoadInt64(&s.connections),
+		Accepted:    atomic.LoadInt64(&s.accepted),
+	}
+}
@@ -1,47 +1,119 @@
+/*
+Package tlog is the transaction log server. Entries appended to the log are
+written as JSON, one per line, to the file named by MCFS_TLOG. When MCFS_TLOG
+isn't set entries are accepted and dropped.
+*/
 package tlog
 
 import (
+	"encoding/json"
 	"os"
+	"time"
+
+	"github.com/materials-commons/config"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/server"
 )
 
+// Create our own context log that always includes our server name.
+var l = log.New("server", "TLog")
+
+// pending is how many entries can wait to be written before Append blocks.
+const pending = 100
+
+// Entry is a line in the transaction log.
+type Entry struct {
+	Time time.Time
+	What interface{}
+}
+
+// tlogServer writes entries to the transaction log. Writes are done by the
+// server's go routine, so Append never waits on the disk.
 type tlogServer struct {
 	isRunning bool
-	request   chan interface{}
-	response  chan bool
+	path      string
+	request   chan Entry
 	tlogFile  *os.File
+	encoder   *json.Encoder
 }
 
+// We only expose a single tlog server.
 var server = &tlogServer{}
 
+// Server returns the singleton tlogServer.
 func Server() *tlogServer {
 	return server
 }
 
-func (s *tlogServer) Append(what interface{}) {
+// Append adds an entry to the transaction log. It returns
+// mcfs.ErrServerNotRunning if the server isn't running.
+func (s *tlogServer) Append(what interface{}) error {
 	if !s.isRunning {
-		panic("Not running")
+		return mcfs.ErrServerNotRunning
 	}
+
+	s.request <- Entry{Time: time.Now(), What: what}
+	return nil
 }
 
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started.
 func (s *tlogServer) Init() {
-	var err error
-	s.request = make(chan interface{})
-	s.response = make(chan bool)
-	if s.tlogFile, err = os.OpenFile("", os.O_RDWR|os.O_APPEND, 0660); err != nil {
-		// Panic here because we couldn't open the log
-	}
+	s.request = make(chan Entry, pending)
+	s.path = config.GetString("MCFS_TLOG")
+	s.tlogFile = nil
+	s.encoder = nil
 }
 
+// Run implements the server. It is meant to be called by the Server interface.
 func (s *tlogServer) Run(stopChan <-chan struct{}) {
+	if s.path != "" {
+		var err error
+		if s.tlogFile, err = os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660); err != nil {
+			l.Error(log.Msg("Unable to open transaction log %s: %s", s.path, err))
+			return
+		}
+		defer s.tlogFile.Close()
+		s.encoder = json.NewEncoder(s.tlogFile)
+	}
+
+	l.Info(log.Msg("Starting, logging to '%s'", s.path))
 	s.isRunning = true
+	defer func() {
+		s.isRunning = false
+	}()
+
 	for {
 		select {
-		case request := <-s.request:
-			s.writeEntry(request)
+		case entry := <-s.request:
+			s.writeEntry(entry)
 		case <-stopChan:
+			l.Info("Shutting down.")
+			s.drain()
+			return
+		}
+	}
+}
+
+// drain writes the entries that were appended before the server stopped.
+func (s *tlogServer) drain() {
+	for {
+		select {
+		case entry := <-s.request:
+			s.writeEntry(entry)
+		default:
+			return
 		}
 	}
 }
 
-func (s *tlogServer) writeEntry(item interface{}) {
+// writeEntry writes an entry to the log file.
+func (s *tlogServer) writeEntry(entry Entry) {
+	if s.encoder == nil {
+		return
+	}
+
+	if err := s.encoder.Encode(entry); err != nil {
+		l.Error(log.Msg("Unable to write to transaction log: %s", err))
+	}
 }
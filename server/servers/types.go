@@ -26,3 +26,8 @@ func (s Status) String() string {
 		return "Unknown"
 	}
 }
+
+// MarshalText writes the status by name, so it reads well in JSON.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
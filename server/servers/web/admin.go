@@ -0,0 +1,42 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/materials-commons/mcfs/server/servers"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+// statusHandler writes the servers.Info for each server as JSON. Only users in
+// the admin group can see it.
+func (s *webServer) statusHandler(writer http.ResponseWriter, req *http.Request) {
+	u, err := s.service.User.ByAPIKey(req.FormValue("apikey"))
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if !s.isAdmin(u.Email) {
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(servers.Infos())
+}
+
+// isAdmin returns true if user is in the admin group.
+func (s *webServer) isAdmin(user string) bool {
+	group, err := s.service.Group.ByID(service.AdminGroup)
+	if err != nil {
+		return false
+	}
+
+	for _, u := range group.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
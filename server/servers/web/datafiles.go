@@ -0,0 +1,83 @@
+package web
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/process/convert"
+	"github.com/materials-commons/mcfs/server/share"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// datafileHandler serves data files. The request is authorized by either an
+// apikey or a share link. Files that are converted for display, such as TIFF
+// images, are served as their conversion unless download is set.
+func (s *webServer) datafileHandler(writer http.ResponseWriter, req *http.Request) {
+	shared := req.FormValue(share.LinkParam) != ""
+	apikey := req.FormValue("apikey")
+	if apikey == "" && !shared {
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	download := req.FormValue("download")
+
+	// Verify key
+	var u *schema.User
+	if !shared {
+		var err error
+		if u, err = s.service.User.ByAPIKey(apikey); err != nil {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// Get datafile from db and check access
+	dataFileID := filepath.Base(req.URL.Path)
+	df, err := s.service.File.ByID(dataFileID)
+	switch {
+	case err != nil:
+		l.Info(log.Msg("Failed looking up fileID %s: %s", dataFileID, err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	case shared && !s.authorizedShare(req, df):
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	case !shared && !s.service.Group.HasAccess(df.Owner, u.Email):
+		l.Info(log.Msg("No access owner: %s, accessed by: %s", df.Owner, u.Email))
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	case convert.NeedsConversion(df.MediaType.Mime) && download == "":
+		path := convert.ConversionPath(s.mcdir, df.FileID())
+		writer.Header().Set("Content-Type", "image/jpeg")
+		http.ServeFile(writer, req, path)
+	default:
+		s.serveDatafile(writer, req, df)
+	}
+}
+
+// authorizedShare returns true if the share link in req allows downloading df.
+// A GET request from the start of the file counts as a download of the link.
+func (s *webServer) authorizedShare(req *http.Request, df *schema.File) bool {
+	if err := s.links.AuthorizeFile(req.Form, df, share.RequestUse(req)); err != nil {
+		l.Info(log.Msg("Share link refused for %s: %s", df.ID, err))
+		return false
+	}
+	return true
+}
+
+// serveDatafile writes the bytes for a datafile from the store. Range requests
+// are supported.
+func (s *webServer) serveDatafile(writer http.ResponseWriter, req *http.Request, df *schema.File) {
+	r, err := store.NewReader(s.store, df.FileID())
+	if err != nil {
+		l.Error(log.Msg("Unable to open datafile %s: %s", df.FileID(), err))
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	defer r.Close()
+
+	if df.MediaType.Mime != "" {
+		writer.Header().Set("Content-Type", df.MediaType.Mime)
+	}
+	http.ServeContent(writer, req, df.Name, df.MTime, r)
+}
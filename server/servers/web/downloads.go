@@ -0,0 +1,42 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/materials-commons/mcfs/server/metrics"
+)
+
+// countingWriter counts the bytes written to a response.
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// countDownloads counts the bytes of successful responses from h as
+// downloaded bytes. Error pages aren't counted.
+func countDownloads(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		cw := &countingWriter{ResponseWriter: writer}
+		h.ServeHTTP(cw, req)
+		if cw.status < 300 {
+			metrics.BytesDownloaded.Add(float64(cw.n))
+		}
+	})
+}
@@ -1,93 +1,112 @@
+/*
+Package web is the http server. It serves out datafiles and archives of
+projects and directories, accepts resumable uploads, and serves the REST api.
+It also reports the status of the servers to admins, and the server's
+metrics under /metrics.
+*/
 package web
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"time"
+
 	"github.com/materials-commons/config"
 	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/server/archive"
+	"github.com/materials-commons/mcfs/server/metrics"
 	"github.com/materials-commons/mcfs/server/request"
-	"github.com/materials-commons/mcfs/server/servers"
+	"github.com/materials-commons/mcfs/server/resource/mcapi"
+	"github.com/materials-commons/mcfs/server/search"
+	"github.com/materials-commons/mcfs/server/servers/access"
 	"github.com/materials-commons/mcfs/server/service"
-	"mime"
-	"net/http"
-	"path/filepath"
-	"strings"
+	"github.com/materials-commons/mcfs/server/share"
+	"github.com/materials-commons/mcfs/server/store"
 )
 
-type webServer struct{}
-
+// Create our own context log that always includes our server name.
 var l = log.New("server", "WebServer")
-var server = &webServer{}
 
-var mcdir = config.GetString("MCDIR")
+// shutdownTimeout is how long requests in progress are given to finish when
+// the server stops.
+const shutdownTimeout = 10 * time.Second
 
-func Server() servers.Instance {
-	return server
-}
-
-func (s *webServer) Init() {
+// webServer serves http requests on MCFS_HTTP_PORT.
+type webServer struct {
+	service *service.Service
+	store   store.Store
+	mcdir   string
 
+	// links creates and checks the signed links that let files be
+	// downloaded without an apikey.
+	links *share.Links
 }
 
-func (s *webServer) Run(stopChan <-chan struct{}) {
-	go s.webserver()
-	<-stopChan
-}
+// We only expose a single web server.
+var server = &webServer{}
 
-func (s *webServer) webserver() {
-	port := config.GetInt("MCFS_HTTP_PORT")
-	http.HandleFunc("/datafiles/static/", s.datafileHandler)
-	err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
-	var _ = err
+// Server returns the singleton webServer.
+func Server() *webServer {
+	return server
 }
 
-func (s *webServer) datafileHandler(writer http.ResponseWriter, req *http.Request) {
-	apikey := req.FormValue("apikey")
-	if apikey == "" {
-		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
+// Init initializes the server. It meant to be called by the Server interface each
+// time the server is started. Share links are signed with MCFS_SHARE_SECRET. The
+// share links are kept across restarts, so links signed with a random secret
+// keep working until the program exits.
+func (s *webServer) Init() {
+	s.service = search.WithIndex(access.WithCache(service.New(service.Configured())), search.Default())
+	s.store = store.New()
+	s.mcdir = config.GetString("MCDIR")
+	if s.links == nil {
+		secret := config.GetString("MCFS_SHARE_SECRET")
+		if secret == "" {
+			l.Crit("MCFS_SHARE_SECRET is not set. Share links are signed with a random secret, and stop working when the server is restarted.")
+		}
+		s.links = share.New(s.service, []byte(secret))
 	}
+}
 
-	download := req.FormValue("download")
-
-	// Verify key
-	u, err := service.User.ByAPIKey(apikey)
+// Run implements the server. It is meant to be called by the Server interface.
+func (s *webServer) Run(stopChan <-chan struct{}) {
+	addr := fmt.Sprintf(":%d", config.GetInt("MCFS_HTTP_PORT"))
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		l.Error(log.Msg("Unable to listen on %s: %s", addr, err))
 		return
 	}
 
-	// Get datafile from db and check access
-	dataFileID := filepath.Base(req.URL.Path)
-	df, err := service.File.ByID(dataFileID)
-	switch {
-	case err != nil:
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-	case !service.Group.HasAccess(df.Owner, u.Email):
-		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-	default:
-		var path string
-		if isTiff(df.Name) && download == "" {
-			path = tiffConversionPath(mcdir, df.FileID())
-		} else {
-			extension := strings.ToLower(filepath.Ext(df.Name))
-			if mimetype := mime.TypeByExtension(extension); mimetype != "" {
-				writer.Header().Set("Content-Type", mimetype)
-			}
-			path = request.DataFilePath(mcdir, df.FileID())
-		}
-		http.ServeFile(writer, req, path)
-	}
-}
+	l.Info(log.Msg("Starting, listening on %s", addr))
+	httpServer := &http.Server{Handler: s.handler()}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- httpServer.Serve(listener)
+	}()
 
-// isTiff checks a name to see if it is for a TIFF file.
-func isTiff(name string) bool {
-	ext := strings.ToLower(filepath.Ext(name))
-	if ext == ".tiff" || ext == ".tif" {
-		return true
+	select {
+	case err := <-errChan:
+		l.Error(log.Msg("Server failed: %s", err))
+	case <-stopChan:
+		l.Info("Shutting down.")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		httpServer.Shutdown(ctx)
 	}
-	return false
 }
 
-func tiffConversionPath(mcdir, id string) string {
-	return filepath.Join(request.DataFileDir(mcdir, id), ".conversion", id+".jpg")
+// handler returns the handler for all the requests the server serves. A new
+// handler is created each time the server runs.
+func (s *webServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/datafiles/static/", countDownloads(http.HandlerFunc(s.datafileHandler)))
+	archiveHandler := countDownloads(&archive.Handler{Service: s.service, Store: s.store, Links: s.links})
+	mux.Handle("/projects/archive/", archiveHandler)
+	mux.Handle("/datadirs/archive/", archiveHandler)
+	mux.Handle("/uploads/", request.NewUploadHandler(s.service, s.store))
+	mux.Handle("/api/", mcapi.NewContainer(s.service, s.links))
+	mux.HandleFunc("/admin/status", s.statusHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
 }
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/servers"
+	"github.com/materials-commons/mcfs/server/service"
+	"github.com/materials-commons/mcfs/server/share"
+	"github.com/materials-commons/mcfs/server/store"
+)
+
+// newTestServer returns a webServer with a file owned by test@mc.org.
+// admin@mc.org is in the admin group.
+func newTestServer(t *testing.T) (*webServer, *schema.File) {
+	svc := service.NewMemory(
+		schema.NewUser("test", "test@mc.org", "", "testkey"),
+		schema.NewUser("test2", "test2@mc.org", "", "test2key"),
+		schema.NewUser("admin", "admin@mc.org", "", "adminkey"),
+	)
+
+	admins := schema.NewGroup("admin@mc.org", "admin")
+	admins.ID = service.AdminGroup
+	admins.Users = []string{"admin@mc.org"}
+	svc.Group.Insert(&admins)
+
+	file := schema.NewFile("x.txt", "test@mc.org")
+	file.MediaType.Mime = "text/plain"
+	df, err := svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to create file: %s", err)
+	}
+
+	s := &webServer{
+		service: svc,
+		store:   store.NewMemory(),
+		links:   share.New(svc, []byte("secret")),
+	}
+
+	w, _ := s.store.Append(df.FileID(), 0)
+	w.Write([]byte("hello"))
+	w.Close()
+	return s, df
+}
+
+// get sends a GET for path and returns the status and body.
+func get(t *testing.T, server *httptest.Server, path string) (int, string) {
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s failed: %s", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestDatafileHandler(t *testing.T) {
+	s, df := newTestServer(t)
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	link, _ := s.links.Create("test@mc.org", df.ID, "", 0, 0)
+
+	tests := []struct {
+		path    string
+		status  int
+		body    string
+		comment string
+	}{
+		{"/datafiles/static/" + df.ID, http.StatusUnauthorized, "", "No apikey"},
+		{"/datafiles/static/" + df.ID + "?apikey=nokey", http.StatusUnauthorized, "", "Bad apikey"},
+		{"/datafiles/static/" + df.ID + "?apikey=test2key", http.StatusUnauthorized, "", "No access"},
+		{"/datafiles/static/no-such-file?apikey=testkey", http.StatusBadRequest, "", "Unknown file"},
+		{"/datafiles/static/" + df.ID + "?apikey=testkey", http.StatusOK, "hello", "Owner"},
+		{s.links.URL(link), http.StatusOK, "hello", "Share link"},
+	}
+
+	for _, test := range tests {
+		status, body := get(t, server, test.path)
+		if status != test.status || (test.body != "" && body != test.body) {
+			t.Errorf("%s: expected %d %q, got %d %q", test.comment, test.status, test.body, status, body)
+		}
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	s, _ := newTestServer(t)
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	servers.Register("Web", s)
+
+	if status, _ := get(t, server, "/admin/status"); status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized without an apikey, got %d", status)
+	}
+
+	if status, _ := get(t, server, "/admin/status?apikey=testkey"); status != http.StatusForbidden {
+		t.Errorf("Expected forbidden for a user who isn't an admin, got %d", status)
+	}
+
+	status, body := get(t, server, "/admin/status?apikey=adminkey")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status for admin, got %d", status)
+	}
+
+	var infos map[string]struct{ Status string }
+	if err := json.Unmarshal([]byte(body), &infos); err != nil {
+		t.Fatalf("Bad JSON %q: %s", body, err)
+	}
+	if infos["Web"].Status != "Stopped" {
+		t.Errorf("Expected the Web server to be reported as Stopped, got %#v", infos)
+	}
+}
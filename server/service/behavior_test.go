@@ -0,0 +1,735 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// The tests in this file describe how every ServiceDatabase backend behaves.
+// Each backend runs them against its own database. They create their own
+// entries, using unique names and checksums, so they don't depend on what
+// else is in the database.
+
+const behaviorOwner = "behavior@mc.org"
+
+// testServiceBehavior runs the behavioral tests against svc. user must be an
+// existing user in the database.
+func testServiceBehavior(t *testing.T, svc *Service, user schema.User) {
+	t.Run("Users", func(t *testing.T) { testUsersBehavior(t, svc, user) })
+	t.Run("Groups", func(t *testing.T) { testGroupsBehavior(t, svc) })
+	t.Run("Projects", func(t *testing.T) { testProjectsBehavior(t, svc) })
+	t.Run("Files", func(t *testing.T) { testFilesBehavior(t, svc) })
+	t.Run("Checksums", func(t *testing.T) { testChecksumsBehavior(t, svc) })
+	t.Run("Versions", func(t *testing.T) { testVersionsBehavior(t, svc) })
+	t.Run("Partials", func(t *testing.T) { testPartialsBehavior(t, svc) })
+	t.Run("Tags", func(t *testing.T) { testTagsBehavior(t, svc) })
+	t.Run("Jobs", func(t *testing.T) { testJobsBehavior(t, svc) })
+	t.Run("ShareLinks", func(t *testing.T) { testShareLinksBehavior(t, svc) })
+}
+
+func testUsersBehavior(t *testing.T, svc *Service, user schema.User) {
+	u, err := svc.User.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("Unable to retrieve existing user %s: %s", user.ID, err)
+	}
+	if u.ID != user.ID {
+		t.Fatalf("Wrong user retrieved expected %s, got %#v", user.ID, u)
+	}
+
+	if _, err := svc.User.ByID("does@not.exist"); err == nil {
+		t.Fatalf("Retrieved non existant user does@not.exist")
+	}
+
+	u, err = svc.User.ByAPIKey(user.APIKey)
+	if err != nil {
+		t.Fatalf("Failed to retrieve apikey %s: %s", user.APIKey, err)
+	}
+	if u.ID != user.ID {
+		t.Fatalf("Wrong user with apikey %s: %#v", user.APIKey, u)
+	}
+
+	if _, err := svc.User.ByAPIKey("no-such-key"); err == nil {
+		t.Fatalf("Retrieved key that does not exist")
+	}
+
+	users, err := svc.User.All()
+	if err != nil {
+		t.Fatalf("Failed retrieving all users: %s", err)
+	}
+	if userIndex(users, user.ID) == -1 {
+		t.Fatalf("List of all users did not contain %s: %#v", user.ID, users)
+	}
+
+	if _, err := svc.User.ByAPIKey(""); err == nil {
+		t.Fatalf("Retrieved a user with an empty apikey")
+	}
+
+	email := "user-" + newID() + "@mc.org"
+	newUser := schema.NewUser("new", email, "", "key-"+newID())
+	newUser.ID = ""
+	inserted, err := svc.User.Insert(&newUser)
+	if err != nil {
+		t.Fatalf("Unable to insert user %s: %s", email, err)
+	}
+	if inserted.ID != email {
+		t.Fatalf("Inserted user's id isn't their email: %#v", inserted)
+	}
+	if _, err := svc.User.ByAPIKey(newUser.APIKey); err != nil {
+		t.Fatalf("Unable to retrieve inserted user by apikey: %s", err)
+	}
+
+	inserted.Disabled = true
+	if err := svc.User.Update(inserted); err != nil {
+		t.Fatalf("Unable to update user %s: %s", email, err)
+	}
+	if _, err := svc.User.ByAPIKey(newUser.APIKey); err == nil {
+		t.Fatalf("Retrieved disabled user by apikey")
+	}
+	if u, err := svc.User.ByID(email); err != nil || !u.Disabled {
+		t.Fatalf("Disabled user not updated: %#v %v", u, err)
+	}
+}
+
+func userIndex(users []schema.User, id string) int {
+	for i, u := range users {
+		if u.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func testGroupsBehavior(t *testing.T, svc *Service) {
+	owner := "owner-" + newID() + "@mc.org"
+	member := "member-" + newID() + "@mc.org"
+
+	if svc.Group.HasAccess(owner, member) {
+		t.Fatalf("Access passed when owner has no groups")
+	}
+
+	if !svc.Group.HasAccess(owner, owner) {
+		t.Fatalf("Access failed when user is also the owner")
+	}
+
+	g := schema.NewGroup(owner, "tgroup")
+	g.Users = append(g.Users, member)
+	group, err := svc.Group.Insert(&g)
+	if err != nil {
+		t.Fatalf("Unable to create new group: %s", err)
+	}
+	defer svc.Group.Delete(group.ID)
+
+	found, err := svc.Group.ByID(group.ID)
+	if err != nil {
+		t.Fatalf("Unable to retrieve new group %s: %s", group.ID, err)
+	}
+	if found.Owner != owner || len(found.Users) != 1 || found.Users[0] != member {
+		t.Fatalf("Retrieved group doesn't match inserted group: %#v", found)
+	}
+
+	if !svc.Group.HasAccess(owner, member) {
+		t.Fatalf("%s should have had access", member)
+	}
+
+	if svc.Group.HasAccess(owner, "nouser@mc.org") {
+		t.Fatalf("nouser@mc.org should not have access")
+	}
+
+	if groups, err := svc.Group.ByOwner(owner); err != nil || len(groups) != 1 || groups[0].ID != group.ID {
+		t.Fatalf("Expected %s's group, got %#v %v", owner, groups, err)
+	}
+
+	if groups, err := svc.Group.ByUser(member); err != nil || len(groups) != 1 || groups[0].ID != group.ID {
+		t.Fatalf("Expected the group %s is a member of, got %#v %v", member, groups, err)
+	}
+
+	added := "added-" + newID() + "@mc.org"
+	found.Users = append(found.Users, added)
+	if err := svc.Group.Update(found); err != nil {
+		t.Fatalf("Unable to update group: %s", err)
+	}
+	if !svc.Group.HasAccess(owner, added) {
+		t.Fatalf("%s should have access after being added to the group", added)
+	}
+
+	if err := svc.Group.Delete(group.ID); err != nil {
+		t.Fatalf("Unable to delete group: %s", err)
+	}
+
+	if svc.Group.HasAccess(owner, member) {
+		t.Fatalf("%s still has access after the group was deleted", member)
+	}
+}
+
+// newBehaviorProject creates a project with a unique name.
+func newBehaviorProject(t *testing.T, svc *Service) *schema.Project {
+	p := schema.NewProject("behavior-"+newID(), "", behaviorOwner)
+	project, err := svc.Project.Insert(&p)
+	if err != nil {
+		t.Fatalf("Unable to insert project: %s", err)
+	}
+	return project
+}
+
+func testProjectsBehavior(t *testing.T, svc *Service) {
+	project := newBehaviorProject(t, svc)
+	if project.ID == "" || project.DataDir == "" {
+		t.Fatalf("Inserted project is missing its id or directory: %#v", project)
+	}
+
+	p := schema.NewProject("has-a-dir", "some-dir-id", behaviorOwner)
+	if _, err := svc.Project.Insert(&p); err != mcerr.ErrInvalid {
+		t.Fatalf("Expected ErrInvalid inserting a project with a directory, got %v", err)
+	}
+
+	found, err := svc.Project.ByID(project.ID)
+	if err != nil {
+		t.Fatalf("Unable to retrieve project %s: %s", project.ID, err)
+	}
+	if found.DataDir != project.DataDir {
+		t.Fatalf("Project directory wasn't saved, expected %s, got %s", project.DataDir, found.DataDir)
+	}
+
+	if _, err := svc.Project.ByName(project.Name, behaviorOwner); err != nil {
+		t.Fatalf("Unable to find project %s by name: %s", project.Name, err)
+	}
+
+	if _, err := svc.Project.ByName(project.Name, "someone@else.org"); err != mcerr.ErrNotFound {
+		t.Fatalf("Found project %s for the wrong owner: %v", project.Name, err)
+	}
+
+	projects, err := svc.Project.ByOwner(behaviorOwner)
+	if err != nil {
+		t.Fatalf("Unable to list projects for %s: %s", behaviorOwner, err)
+	}
+	owned := false
+	for i, p := range projects {
+		owned = owned || p.ID == project.ID
+		if i > 0 && projects[i-1].Name > p.Name {
+			t.Fatalf("Projects aren't sorted by name: %#v", projects)
+		}
+	}
+	if !owned {
+		t.Fatalf("Project %s missing from the projects owned by %s", project.ID, behaviorOwner)
+	}
+
+	if _, err := svc.Project.ByID("does-not-exist"); err != mcerr.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for a project that doesn't exist, got %v", err)
+	}
+
+	project.Description = "updated"
+	if err := svc.Project.Update(project); err != nil {
+		t.Fatalf("Unable to update project: %s", err)
+	}
+	if found, _ := svc.Project.ByID(project.ID); found == nil || found.Description != "updated" {
+		t.Fatalf("Project update wasn't saved: %#v", found)
+	}
+
+	dir, err := svc.Dir.ByPath(project.Name, project.ID)
+	if err != nil {
+		t.Fatalf("Unable to find project directory by path: %s", err)
+	}
+	if dir.ID != project.DataDir {
+		t.Fatalf("Wrong project directory, expected %s, got %s", project.DataDir, dir.ID)
+	}
+
+	subdir := schema.NewDirectory(project.Name+"/sub", behaviorOwner, project.ID, dir.ID)
+	newSubdir, err := svc.Dir.Insert(&subdir)
+	if err != nil {
+		t.Fatalf("Unable to insert subdirectory: %s", err)
+	}
+	if err := svc.Project.AddDirectories(project, newSubdir.ID); err != nil {
+		t.Fatalf("Unable to add subdirectory to project: %s", err)
+	}
+
+	file := schema.NewFile("a.txt", behaviorOwner)
+	file.DataDirs = []string{newSubdir.ID}
+	file.Size = 5
+	if _, err := svc.File.Insert(&file); err != nil {
+		t.Fatalf("Unable to insert file: %s", err)
+	}
+
+	entries, err := svc.Project.Files(project.ID, "")
+	if err != nil {
+		t.Fatalf("Unable to list project files: %s", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	expected := []string{project.Name, project.Name + "/sub", project.Name + "/sub/a.txt"}
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected project files %v, got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Fatalf("Expected project files %v, got %v", expected, paths)
+		}
+	}
+
+	if entries[2].IsDir || entries[2].Size != 5 || !entries[1].IsDir {
+		t.Fatalf("Project file entries have the wrong details: %#v", entries)
+	}
+
+	if _, err := svc.Project.Files("does-not-exist", ""); err != mcerr.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound listing a project that doesn't exist, got %v", err)
+	}
+}
+
+func testTagsBehavior(t *testing.T, svc *Service) {
+	project := newBehaviorProject(t, svc)
+	file := schema.NewFile("tagged.txt", behaviorOwner)
+	file.DataDirs = []string{project.DataDir}
+	newFile, err := svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert file: %s", err)
+	}
+
+	fileTag := schema.Tag{Key: "sample", Value: "R38", User: behaviorOwner}
+	newFile.Tags = []schema.Tag{fileTag}
+	if err := svc.File.UpdateTags(newFile); err != nil {
+		t.Fatalf("Unable to update file tags: %s", err)
+	}
+	if found, _ := svc.File.ByID(newFile.ID); found == nil || len(found.Tags) != 1 || found.Tags[0] != fileTag {
+		t.Fatalf("File tags weren't saved: %#v", found)
+	}
+
+	dir, err := svc.Dir.ByID(project.DataDir)
+	if err != nil {
+		t.Fatalf("Unable to retrieve project directory: %s", err)
+	}
+	dirTag := schema.Tag{Key: "temperature", Value: "250C"}
+	dir.Tags = []schema.Tag{dirTag}
+	if err := svc.Dir.UpdateTags(dir); err != nil {
+		t.Fatalf("Unable to update dir tags: %s", err)
+	}
+	if found, _ := svc.Dir.ByID(dir.ID); found == nil || len(found.Tags) != 1 || found.Tags[0] != dirTag {
+		t.Fatalf("Dir tags weren't saved: %#v", found)
+	}
+
+	entries, err := svc.Project.Files(project.ID, "")
+	if err != nil {
+		t.Fatalf("Unable to list project files: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected a directory and a file, got %#v", entries)
+	}
+	if len(entries[0].Tags) != 1 || entries[0].Tags[0] != dirTag {
+		t.Fatalf("Directory entry is missing its tags: %#v", entries[0])
+	}
+	if len(entries[1].Tags) != 1 || entries[1].Tags[0] != fileTag {
+		t.Fatalf("File entry is missing its tags: %#v", entries[1])
+	}
+
+	// Only the tags are written, so the rest of a stale copy is ignored.
+	stale := *newFile
+	stale.Description = "stale"
+	stale.Tags = nil
+	if err := svc.File.UpdateTags(&stale); err != nil {
+		t.Fatalf("Unable to update file tags: %s", err)
+	}
+	if found, _ := svc.File.ByID(newFile.ID); found == nil || len(found.Tags) != 0 || found.Description == "stale" {
+		t.Fatalf("Expected only the tags to be updated: %#v", found)
+	}
+}
+
+func testJobsBehavior(t *testing.T, svc *Service) {
+	fileID := newID()
+	first := schema.NewJob(fileID, "first")
+	first.Birthtime = first.Birthtime.Add(-time.Minute)
+	newFirst, err := svc.Job.Insert(&first)
+	if err != nil {
+		t.Fatalf("Unable to insert job: %s", err)
+	}
+	if newFirst.ID == "" {
+		t.Fatalf("Inserted job has no id")
+	}
+
+	second := schema.NewJob(fileID, "second")
+	newSecond, err := svc.Job.Insert(&second)
+	if err != nil {
+		t.Fatalf("Unable to insert job: %s", err)
+	}
+
+	jobs, err := svc.Job.ByFile(fileID)
+	if err != nil {
+		t.Fatalf("Unable to list jobs for file: %s", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != newFirst.ID || jobs[1].ID != newSecond.ID {
+		t.Fatalf("Expected jobs first and second, got %#v", jobs)
+	}
+
+	newFirst.Status = schema.JobDone
+	newFirst.Attempts = 1
+	newFirst.Result = "processed"
+	if err := svc.Job.Update(newFirst); err != nil {
+		t.Fatalf("Unable to update job: %s", err)
+	}
+	found, err := svc.Job.ByID(newFirst.ID)
+	if err != nil {
+		t.Fatalf("Unable to retrieve job: %s", err)
+	}
+	if found.Status != schema.JobDone || found.Attempts != 1 || found.Result != "processed" {
+		t.Fatalf("Job update wasn't saved: %#v", found)
+	}
+
+	queued, err := svc.Job.ByStatus(schema.JobQueued)
+	if err != nil {
+		t.Fatalf("Unable to list queued jobs: %s", err)
+	}
+	for _, job := range queued {
+		if job.ID == newFirst.ID {
+			t.Fatalf("Finished job is still queued")
+		}
+	}
+	if !containsJob(queued, newSecond.ID) {
+		t.Fatalf("Queued job %s missing from %#v", newSecond.ID, queued)
+	}
+
+	if _, err := svc.Job.ByID("does-not-exist"); err == nil {
+		t.Fatalf("Retrieved a job that doesn't exist")
+	}
+}
+
+func containsJob(jobs []schema.Job, id string) bool {
+	for _, job := range jobs {
+		if job.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func testFilesBehavior(t *testing.T, svc *Service) {
+	project := newBehaviorProject(t, svc)
+	dirID := project.DataDir
+	md5 := newID()
+	sha256 := newID()
+
+	file := schema.NewFile("file.txt", behaviorOwner)
+	file.DataDirs = []string{dirID}
+	file.Checksum = md5
+	file.Checksums = digest.Set{digest.MD5: md5, digest.SHA256: sha256}
+	file.Size = 10
+	file.Uploaded = 10
+	f, err := svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert file: %s", err)
+	}
+	defer svc.File.Delete(f.ID)
+
+	found, err := svc.File.ByID(f.ID)
+	if err != nil {
+		t.Fatalf("Unable to retrieve file %s: %s", f.ID, err)
+	}
+	if found.Name != "file.txt" || found.Checksums[digest.SHA256] != sha256 || !found.Current {
+		t.Fatalf("Retrieved file doesn't match inserted file: %#v", found)
+	}
+	if len(found.DataDirs) != 1 || found.DataDirs[0] != dirID {
+		t.Fatalf("File directories weren't saved: %#v", found.DataDirs)
+	}
+
+	if _, err := svc.File.ByID("does-not-exist"); err == nil {
+		t.Fatalf("Retrieved non-existent file")
+	}
+
+	dir, err := svc.Dir.ByID(dirID)
+	if err != nil {
+		t.Fatalf("Unable to retrieve directory: %s", err)
+	}
+	if len(dir.DataFiles) != 1 || dir.DataFiles[0] != f.ID {
+		t.Fatalf("Insert didn't add the file to its directory: %#v", dir.DataFiles)
+	}
+
+	if _, err := svc.File.ByPath("file.txt", dirID); err != nil {
+		t.Fatalf("Unable to lookup file by path: %s", err)
+	}
+
+	if _, err := svc.File.ByPath("file.txt", "dir-does-not-exist"); err != mcerr.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound looking up file in the wrong directory, got %v", err)
+	}
+
+	// Checksum lookups match on the strongest hash in common.
+	if files, err := svc.File.ByPathChecksums("file.txt", dirID, digest.Set{digest.SHA256: sha256}); err != nil || len(files) != 1 {
+		t.Fatalf("Expected one match by sha256, got %d (%v)", len(files), err)
+	}
+
+	if files, _ := svc.File.ByPathChecksums("file.txt", dirID, digest.Set{digest.MD5: md5, digest.SHA256: "other"}); len(files) != 0 {
+		t.Fatalf("Matched on md5 when sha256 was different")
+	}
+
+	if match, err := svc.File.ByChecksums(digest.Set{digest.MD5: md5}); err != nil || match.ID != f.ID {
+		t.Fatalf("Unable to lookup file by md5: %v", err)
+	}
+
+	if match, err := svc.File.ByChecksums(digest.Set{digest.SHA256: sha256}); err != nil || match.ID != f.ID {
+		t.Fatalf("Unable to lookup file by sha256: %v", err)
+	}
+
+	if _, err := svc.File.ByChecksums(digest.Set{digest.MD5: "does-not-exist"}); err != mcerr.ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for an unknown checksum, got %v", err)
+	}
+
+	// A duplicate points at the original and is never returned by ByChecksums.
+	dup := schema.NewFile("dup.txt", behaviorOwner)
+	dup.DataDirs = []string{dirID}
+	dup.Checksum = md5
+	dup.Checksums = digest.Set{digest.MD5: md5}
+	dup.UsesID = f.ID
+	d, err := svc.File.Insert(&dup)
+	if err != nil {
+		t.Fatalf("Unable to insert duplicate: %s", err)
+	}
+
+	if match, err := svc.File.ByChecksums(digest.Set{digest.MD5: md5}); err != nil || match.ID != f.ID {
+		t.Fatalf("ByChecksums should return the original, not the duplicate: %v", err)
+	}
+
+	dependents, err := svc.File.MatchOn("usesid", f.ID)
+	if err != nil || len(dependents) != 1 || dependents[0].ID != d.ID {
+		t.Fatalf("Expected MatchOn usesid to return the duplicate, got %#v (%v)", dependents, err)
+	}
+
+	// Hiding a file keeps it, but removes it from its directory.
+	if err := svc.File.Hide(d); err != nil {
+		t.Fatalf("Unable to hide file: %s", err)
+	}
+
+	if _, err := svc.File.ByPath("dup.txt", dirID); err != mcerr.ErrNotFound {
+		t.Fatalf("Found hidden file by path: %v", err)
+	}
+
+	if hidden, err := svc.File.ByID(d.ID); err != nil || hidden.Current {
+		t.Fatalf("Hidden file should still exist and not be current: %v", err)
+	}
+
+	dir, _ = svc.Dir.ByID(dirID)
+	if len(dir.DataFiles) != 1 || dir.DataFiles[0] != f.ID {
+		t.Fatalf("Hidden file wasn't removed from its directory: %#v", dir.DataFiles)
+	}
+
+	// Update saves changes to the file.
+	f.Description = "updated"
+	if err := svc.File.Update(f); err != nil {
+		t.Fatalf("Unable to update file: %s", err)
+	}
+	if updated, _ := svc.File.ByID(f.ID); updated == nil || updated.Description != "updated" {
+		t.Fatalf("File update wasn't saved: %#v", updated)
+	}
+
+	// Delete removes the file and takes it out of its directory.
+	if err := svc.File.Delete(d.ID); err != nil {
+		t.Fatalf("Unable to delete duplicate: %s", err)
+	}
+	if err := svc.File.Delete(f.ID); err != nil {
+		t.Fatalf("Unable to delete file: %s", err)
+	}
+
+	if _, err := svc.File.ByID(f.ID); err == nil {
+		t.Fatalf("Found deleted file")
+	}
+
+	dir, _ = svc.Dir.ByID(dirID)
+	if len(dir.DataFiles) != 0 {
+		t.Fatalf("Deleted file is still in its directory: %#v", dir.DataFiles)
+	}
+}
+
+func testChecksumsBehavior(t *testing.T, svc *Service) {
+	project := newBehaviorProject(t, svc)
+	sha1 := newID()
+	sha512 := newID()
+
+	// Every supported hash finds a file, not just MD5 and SHA256.
+	file := schema.NewFile("sha.txt", behaviorOwner)
+	file.DataDirs = []string{project.DataDir}
+	file.Checksums = digest.Set{digest.SHA1: sha1, digest.SHA512: sha512}
+	f, err := svc.File.Insert(&file)
+	if err != nil {
+		t.Fatalf("Unable to insert file: %s", err)
+	}
+	defer svc.File.Delete(f.ID)
+
+	if match, err := svc.File.ByChecksums(digest.Set{digest.SHA1: sha1}); err != nil || match.ID != f.ID {
+		t.Fatalf("Unable to lookup file by sha1: %v", err)
+	}
+
+	if match, err := svc.File.ByChecksums(digest.Set{digest.SHA512: sha512}); err != nil || match.ID != f.ID {
+		t.Fatalf("Unable to lookup file by sha512: %v", err)
+	}
+
+	if _, err := svc.File.ByChecksums(digest.Set{digest.SHA1: sha1, digest.SHA512: "other"}); err != mcerr.ErrNotFound {
+		t.Fatalf("Matched on sha1 when sha512 was different: %v", err)
+	}
+
+	// A file without the strongest hash asked for is found by a weaker one.
+	old := schema.NewFile("old.txt", behaviorOwner)
+	old.DataDirs = []string{project.DataDir}
+	old.Checksums = digest.Set{digest.SHA1: newID()}
+	o, err := svc.File.Insert(&old)
+	if err != nil {
+		t.Fatalf("Unable to insert file: %s", err)
+	}
+	defer svc.File.Delete(o.ID)
+
+	checksums := digest.Set{digest.SHA1: old.Checksums[digest.SHA1], digest.SHA512: newID()}
+	if match, err := svc.File.ByChecksums(checksums); err != nil || match.ID != o.ID {
+		t.Fatalf("Unable to lookup file by sha1 when it has no sha512: %v", err)
+	}
+}
+
+func testVersionsBehavior(t *testing.T, svc *Service) {
+	project := newBehaviorProject(t, svc)
+
+	var ids []string
+	parent := ""
+	for i := 0; i < 3; i++ {
+		file := schema.NewFile("versioned.txt", behaviorOwner)
+		file.DataDirs = []string{project.DataDir}
+		file.Parent = parent
+		f, err := svc.File.Insert(&file)
+		if err != nil {
+			t.Fatalf("Unable to insert version %d: %s", i, err)
+		}
+		defer svc.File.Delete(f.ID)
+		ids = append(ids, f.ID)
+		parent = f.ID
+	}
+
+	newest, err := svc.File.ByID(ids[2])
+	if err != nil {
+		t.Fatalf("Unable to lookup newest version: %s", err)
+	}
+
+	versions := Versions(svc.File, newest)
+	if len(versions) != 3 || versions[0].ID != ids[2] || versions[2].ID != ids[0] {
+		t.Fatalf("Expected three versions newest first, got %d", len(versions))
+	}
+
+	// The history stops at a deleted version.
+	svc.File.Delete(ids[0])
+	if versions := Versions(svc.File, newest); len(versions) != 2 {
+		t.Fatalf("Expected two versions after deleting the first, got %d", len(versions))
+	}
+}
+
+func testPartialsBehavior(t *testing.T, svc *Service) {
+	project := newBehaviorProject(t, svc)
+	dirID := project.DataDir
+	name := "partial-" + newID()
+
+	// A partial is an entry that hasn't been linked into its directory yet.
+	partial := schema.NewFile(name, behaviorOwner)
+	partial.DataDirs = []string{dirID}
+	partial.Current = false
+	partial.Size = 100
+	partial.Uploaded = 50
+	partial.MTime = time.Now().Add(-48 * time.Hour)
+	p, err := svc.File.InsertEntry(&partial)
+	if err != nil {
+		t.Fatalf("Unable to insert partial: %s", err)
+	}
+	defer svc.File.Delete(p.ID)
+
+	dir, _ := svc.Dir.ByID(dirID)
+	if len(dir.DataFiles) != 0 {
+		t.Fatalf("InsertEntry shouldn't add the file to its directory: %#v", dir.DataFiles)
+	}
+
+	partials, err := svc.File.ByPathPartials(name, dirID)
+	if err != nil || len(partials) != 1 || partials[0].ID != p.ID {
+		t.Fatalf("Expected to find the partial by path, got %#v (%v)", partials, err)
+	}
+
+	if !containsFile(partialsBefore(t, svc, time.Now().Add(-24*time.Hour)), p.ID) {
+		t.Fatalf("PartialsBefore didn't return a partial older than the cutoff")
+	}
+
+	if containsFile(partialsBefore(t, svc, time.Now().Add(-72*time.Hour)), p.ID) {
+		t.Fatalf("PartialsBefore returned a partial newer than the cutoff")
+	}
+
+	// Completing the upload links the file in and it stops being a partial.
+	p.Uploaded = p.Size
+	p.Current = true
+	if err := svc.File.AddDirectories(p, dirID); err != nil {
+		t.Fatalf("Unable to add directory to partial: %s", err)
+	}
+
+	if partials, _ := svc.File.ByPathPartials(name, dirID); len(partials) != 0 {
+		t.Fatalf("Completed upload is still a partial")
+	}
+
+	if _, err := svc.File.ByPath(name, dirID); err != nil {
+		t.Fatalf("Completed upload isn't found by path: %s", err)
+	}
+
+	dir, _ = svc.Dir.ByID(dirID)
+	if len(dir.DataFiles) != 1 || dir.DataFiles[0] != p.ID {
+		t.Fatalf("AddDirectories didn't add the file to its directory: %#v", dir.DataFiles)
+	}
+}
+
+func partialsBefore(t *testing.T, svc *Service, cutoff time.Time) []schema.File {
+	partials, err := svc.File.PartialsBefore(cutoff)
+	if err != nil {
+		t.Fatalf("PartialsBefore failed: %s", err)
+	}
+	return partials
+}
+
+func containsFile(files []schema.File, id string) bool {
+	return schema.Files.Find(files, func(f schema.File) bool { return f.ID == id }) != nil
+}
+
+func testShareLinksBehavior(t *testing.T, svc *Service) {
+	owner := "owner-" + newID() + "@mc.org"
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	first := schema.NewShareLink(owner, "file-"+newID(), "", expires, 3)
+	first.Birthtime = first.Birthtime.Add(-time.Minute)
+	newFirst, err := svc.Share.Insert(&first)
+	if err != nil {
+		t.Fatalf("Unable to insert share link: %s", err)
+	}
+
+	second := schema.NewShareLink(owner, "", "dir-"+newID(), expires, 0)
+	if _, err := svc.Share.Insert(&second); err != nil {
+		t.Fatalf("Unable to insert share link: %s", err)
+	}
+
+	found, err := svc.Share.ByID(newFirst.ID)
+	switch {
+	case err != nil:
+		t.Fatalf("Unable to retrieve share link %s: %s", newFirst.ID, err)
+	case found.FileID != first.FileID || found.MaxDownloads != 3 || !found.Expires.Equal(expires):
+		t.Fatalf("Retrieved share link doesn't match inserted link: %#v", found)
+	}
+
+	found.Downloads++
+	found.Revoked = true
+	if err := svc.Share.Update(found); err != nil {
+		t.Fatalf("Unable to update share link: %s", err)
+	}
+
+	links, err := svc.Share.ByOwner(owner)
+	switch {
+	case err != nil:
+		t.Fatalf("Unable to list share links for %s: %s", owner, err)
+	case len(links) != 2:
+		t.Fatalf("Expected 2 share links, got %#v", links)
+	case links[0].ID != newFirst.ID || links[0].Downloads != 1 || !links[0].Revoked:
+		t.Fatalf("Expected the updated first link first, got %#v", links[0])
+	case links[1].DirID != second.DirID:
+		t.Fatalf("Expected the directory link second, got %#v", links[1])
+	}
+
+	if _, err := svc.Share.ByID("does-not-exist"); err == nil {
+		t.Fatalf("Retrieved share link that doesn't exist")
+	}
+}
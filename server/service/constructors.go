@@ -2,15 +2,27 @@ package service
 
 import (
 	"fmt"
+	"sync"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/materials-commons/config"
 	"github.com/materials-commons/mcfs/base/db"
+	"github.com/materials-commons/mcfs/base/log"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/metrics"
 )
 
+// Create our own context log that always includes the package name.
+var l = log.New("package", "service")
+
 type Service struct {
 	File    Files
 	Dir     Dirs
 	Project Projects
 	Group   Groups
 	User    Users
+	Job     Jobs
+	Share   ShareLinks
 }
 
 func New(serviceDatabase ServiceDatabase) *Service {
@@ -20,16 +32,89 @@ func New(serviceDatabase ServiceDatabase) *Service {
 		if err != nil {
 			panic(fmt.Sprintf("Unable to connect to database: %s", err))
 		}
+		if err := setupRDatabase(session); err != nil {
+			panic(fmt.Sprintf("Unable to set up database: %s", err))
+		}
 		return &Service{
-			File:    newRFiles(session),
-			Dir:     newRDirs(session),
-			Project: newRProjects(session),
-			Group:   newRGroups(session),
-			User:    newRUsers(session),
+			File:    newRFiles(rSession),
+			Dir:     newRDirs(rSession),
+			Project: newRProjects(rSession),
+			Group:   newRGroups(rSession),
+			User:    newRUsers(rSession),
+			Job:     newRJobs(rSession),
+			Share:   newRShareLinks(rSession),
 		}
 	case SQL:
-		panic("SQL ServiceDatabase not supported")
+		sqldb, err := db.SQLSession()
+		if err != nil {
+			panic(fmt.Sprintf("Unable to connect to database: %s", err))
+		}
+		if err := migrate(sqldb); err != nil {
+			panic(fmt.Sprintf("Unable to update database schema: %s", err))
+		}
+		return &Service{
+			File:    newSFiles(sqldb),
+			Dir:     newSDirs(sqldb),
+			Project: newSProjects(sqldb),
+			Group:   newSGroups(sqldb),
+			User:    newSUsers(sqldb),
+			Job:     newSJobs(sqldb),
+			Share:   newSShareLinks(sqldb),
+		}
+	case Memory:
+		memoryOnce.Do(func() {
+			memory = NewMemory(memoryUsers()...)
+		})
+		return memory
 	default:
 		panic("Unknown service type")
 	}
 }
+
+// rSession returns the RethinkDB session to run a query on. The session is
+// shared by the whole server and is replaced when it goes bad, so it is looked
+// up for each query rather than held on to. A session that can't reach the
+// database is still returned, and the query fails with its own error.
+func rSession() *r.Session {
+	session, err := db.RSession()
+	if err != nil {
+		l.Error(log.Msg("Database session is unhealthy: %s", err))
+	}
+	return session
+}
+
+// Configured returns the ServiceDatabase selected by MCDB_TYPE. It is SQL
+// when MCDB_TYPE is "sql", Memory when it is "memory", and RethinkDB otherwise.
+func Configured() ServiceDatabase {
+	switch config.GetString("MCDB_TYPE") {
+	case "sql":
+		return SQL
+	case "memory":
+		return Memory
+	default:
+		return RethinkDB
+	}
+}
+
+// memory is the Service shared by everyone that asks for a Memory service,
+// so that all parts of a server see the same data.
+var memory *Service
+var memoryOnce sync.Once
+
+// memoryUsers returns the users a Memory service starts with. There is only
+// ever a single user, given by MCDB_USER and MCDB_APIKEY.
+func memoryUsers() []schema.User {
+	email := config.GetString("MCDB_USER")
+	if email == "" {
+		return nil
+	}
+
+	user := schema.NewUser(email, email, "", config.GetString("MCDB_APIKEY"))
+	return []schema.User{user}
+}
+
+// dbError counts a failed database operation, and returns err.
+func dbError(err error) error {
+	metrics.DBErrors.With(err.Error()).Inc()
+	return err
+}
@@ -1,14 +1,27 @@
 package service
 
 import (
-	r "github.com/dancannon/gorethink"
-	"github.com/materials-commons/mcfs/base/db"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/server"
 )
 
-var session *r.Session
-
 func init() {
 	mcfs.InitRethinkDB()
-	session, _ = db.RSession()
+}
+
+func TestRService(t *testing.T) {
+	svc := &Service{
+		File:    newRFiles(rSession),
+		Dir:     newRDirs(rSession),
+		Project: newRProjects(rSession),
+		Group:   newRGroups(rSession),
+		User:    newRUsers(rSession),
+		Job:     newRJobs(rSession),
+		Share:   newRShareLinks(rSession),
+	}
+
+	user := schema.User{ID: "test@mc.org", APIKey: "test"}
+	testServiceBehavior(t, svc, user)
 }
@@ -51,6 +51,7 @@ func (dlist *dirList) addDirectory(d schema.DataDirDenorm, base string) {
 		Path:  filepath.Join(base, d.Name),
 		MTime: d.Birthtime,
 		IsDir: true,
+		Tags:  d.Tags,
 	}
 	dlist.files = append(dlist.files, newDir)
 
@@ -62,6 +63,7 @@ func (dlist *dirList) addDirectory(d schema.DataDirDenorm, base string) {
 			Size:     f.Size,
 			Checksum: f.Checksum,
 			MTime:    f.Birthtime,
+			Tags:     f.Tags,
 		}
 		dlist.files = append(dlist.files, newFile)
 	}
@@ -1,6 +1,9 @@
 package service
 
 import (
+	"time"
+
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/base/dir"
 	"github.com/materials-commons/mcfs/base/schema"
 )
@@ -14,6 +17,9 @@ const (
 
 	// SQL represents a generic SQL database backend
 	SQL
+
+	// Memory keeps everything in memory. Nothing is persisted.
+	Memory
 )
 
 // Users is the common API to users.
@@ -21,18 +27,22 @@ type Users interface {
 	ByID(id string) (*schema.User, error)
 	ByAPIKey(apikey string) (*schema.User, error)
 	All() ([]schema.User, error)
+	Update(*schema.User) error
+	Insert(*schema.User) (*schema.User, error)
 }
 
 // Files is the common API to files.
 type Files interface {
 	ByID(id string) (*schema.File, error)
 	ByPath(name, dirID string) (*schema.File, error)
-	ByPathChecksum(name, dirID, checksum string) ([]schema.File, error)
+	ByPathChecksums(name, dirID string, checksums digest.Set) ([]schema.File, error)
 	ByPathPartials(name, dirID string) ([]schema.File, error)
-	ByChecksum(checksum string) (*schema.File, error)
+	PartialsBefore(cutoff time.Time) ([]schema.File, error)
+	ByChecksums(checksums digest.Set) (*schema.File, error)
 	MatchOn(key, value string) ([]schema.File, error)
 	Hide(*schema.File) error
 	Update(*schema.File) error
+	UpdateTags(*schema.File) error
 	Insert(file *schema.File) (*schema.File, error)
 	InsertEntry(file *schema.File) (*schema.File, error)
 	Delete(id string) error
@@ -44,6 +54,7 @@ type Dirs interface {
 	ByID(id string) (*schema.Directory, error)
 	ByPath(path, projectID string) (*schema.Directory, error)
 	Update(*schema.Directory) error
+	UpdateTags(*schema.Directory) error
 	Insert(*schema.Directory) (*schema.Directory, error)
 	AddFiles(dir *schema.Directory, fileIDs ...string) error
 	RemoveFiles(dir *schema.Directory, fileIDs ...string) error
@@ -53,15 +64,40 @@ type Dirs interface {
 type Projects interface {
 	ByID(id string) (*schema.Project, error)
 	ByName(name, owner string) (*schema.Project, error)
+	ByOwner(owner string) ([]schema.Project, error)
 	Files(id, base string) ([]dir.FileInfo, error)
 	Update(*schema.Project) error
 	Insert(*schema.Project) (*schema.Project, error)
 	AddDirectories(project *schema.Project, directoryIDs ...string) error
 }
 
+// Jobs is the common API to post upload processing jobs.
+type Jobs interface {
+	ByID(id string) (*schema.Job, error)
+	ByFile(fileID string) ([]schema.Job, error)
+	ByStatus(status string) ([]schema.Job, error)
+	Insert(*schema.Job) (*schema.Job, error)
+	Update(*schema.Job) error
+}
+
+// ShareLinks is the common API to signed share links.
+type ShareLinks interface {
+	ByID(id string) (*schema.ShareLink, error)
+	ByOwner(owner string) ([]schema.ShareLink, error)
+	Insert(*schema.ShareLink) (*schema.ShareLink, error)
+	Update(*schema.ShareLink) error
+}
+
+// AdminGroup is the id of the group whose users are admins. Admins have access
+// to every user's items.
+const AdminGroup = "admin"
+
 // Groups is the common API to groups.
 type Groups interface {
 	ByID(id string) (*schema.Group, error)
+	ByOwner(owner string) ([]schema.Group, error)
+	ByUser(user string) ([]schema.Group, error)
+	Update(*schema.Group) error
 	Insert(*schema.Group) (*schema.Group, error)
 	Delete(id string) error
 	HasAccess(owner, user string) bool
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"github.com/materials-commons/gohandy/collections"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server"
+)
+
+// mDirs implements the Dirs interface in memory
+type mDirs struct {
+	mdb *memDB
+}
+
+// newMDirs creates a new instance of mDirs
+func newMDirs(mdb *memDB) mDirs {
+	return mDirs{
+		mdb: mdb,
+	}
+}
+
+// ByID looks up a dir by its primary key.
+func (d mDirs) ByID(id string) (*schema.Directory, error) {
+	d.mdb.mutex.RLock()
+	defer d.mdb.mutex.RUnlock()
+
+	dir, ok := d.mdb.dirs[id]
+	if !ok {
+		return nil, mcerr.ErrNotFound
+	}
+	dir = copyDir(dir)
+	return &dir, nil
+}
+
+// ByPath looks up a directory in a project by its path.
+func (d mDirs) ByPath(path, projectID string) (*schema.Directory, error) {
+	d.mdb.mutex.RLock()
+	defer d.mdb.mutex.RUnlock()
+
+	for _, dir := range d.mdb.dirs {
+		if dir.Name == path && dir.Project == projectID {
+			dir = copyDir(dir)
+			return &dir, nil
+		}
+	}
+	return nil, mcerr.ErrNotFound
+}
+
+// Update updates an existing dir. If you are adding new files you should use the
+// AddFiles method.
+func (d mDirs) Update(dir *schema.Directory) error {
+	d.mdb.mutex.Lock()
+	defer d.mdb.mutex.Unlock()
+
+	if _, ok := d.mdb.dirs[dir.ID]; !ok {
+		return mcerr.ErrNotFound
+	}
+	d.mdb.dirs[dir.ID] = copyDir(*dir)
+	return nil
+}
+
+// UpdateTags updates the tags on a dir. Projects are listed straight from the
+// dirs, so there is nothing else to update. Only the tags are written.
+func (d mDirs) UpdateTags(dir *schema.Directory) error {
+	d.mdb.mutex.Lock()
+	defer d.mdb.mutex.Unlock()
+
+	stored, ok := d.mdb.dirs[dir.ID]
+	if !ok {
+		return mcerr.ErrNotFound
+	}
+	stored.Tags = copyTags(dir.Tags)
+	d.mdb.dirs[dir.ID] = stored
+	return nil
+}
+
+// Insert creates a new dir.
+func (d mDirs) Insert(dir *schema.Directory) (*schema.Directory, error) {
+	d.mdb.mutex.Lock()
+	defer d.mdb.mutex.Unlock()
+
+	newDir := copyDir(*dir)
+	if newDir.ID == "" {
+		newDir.ID = newID()
+	}
+	if _, exists := d.mdb.dirs[newDir.ID]; exists {
+		return nil, dbError(mcfs.ErrDBInsertFailed)
+	}
+
+	d.mdb.dirs[newDir.ID] = newDir
+	newDir = copyDir(newDir)
+	return &newDir, nil
+}
+
+// AddFiles adds new file ids to a dir.
+func (d mDirs) AddFiles(dir *schema.Directory, fileIDs ...string) error {
+	for _, id := range fileIDs {
+		if index := collections.Strings.Find(dir.DataFiles, id); index == -1 {
+			dir.DataFiles = append(dir.DataFiles, id)
+		}
+	}
+
+	if err := d.Update(dir); err != nil {
+		return dbError(mcfs.ErrDBUpdateFailed)
+	}
+	return nil
+}
+
+// RemoveFiles removes matching file ids from the directory.
+func (d mDirs) RemoveFiles(dir *schema.Directory, fileIDs ...string) error {
+	dir.DataFiles = collections.Strings.Remove(dir.DataFiles, fileIDs...)
+	return d.Update(dir)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// memDB holds the state for the in memory backend. All the m* types share
+// a single memDB, and every access goes through its lock. Items are stored
+// and returned as copies so callers can't change the database by holding
+// on to a returned item.
+type memDB struct {
+	mutex           sync.RWMutex
+	users           map[string]schema.User
+	files           map[string]schema.File
+	dirs            map[string]schema.Directory
+	projects        map[string]schema.Project
+	groups          map[string]schema.Group
+	jobs            map[string]schema.Job
+	shareLinks      map[string]schema.ShareLink
+	project2datadir []schema.Project2DataDir
+}
+
+// newMemDB creates an empty memDB.
+func newMemDB() *memDB {
+	return &memDB{
+		users:    make(map[string]schema.User),
+		files:    make(map[string]schema.File),
+		dirs:     make(map[string]schema.Directory),
+		projects: make(map[string]schema.Project),
+		groups:   make(map[string]schema.Group),
+		jobs:     make(map[string]schema.Job),
+
+		shareLinks: make(map[string]schema.ShareLink),
+	}
+}
+
+// NewMemory creates a Service that keeps everything in memory. It is meant
+// for tests and for running a single user server without a database. Users
+// are created outside of the file server, so the initial set of users is
+// passed in.
+func NewMemory(users ...schema.User) *Service {
+	mdb := newMemDB()
+	for _, user := range users {
+		mdb.users[user.ID] = copyUser(user)
+	}
+
+	return &Service{
+		File:    newMFiles(mdb),
+		Dir:     newMDirs(mdb),
+		Project: newMProjects(mdb),
+		Group:   newMGroups(mdb),
+		User:    newMUsers(mdb),
+		Job:     newMJobs(mdb),
+		Share:   newMShareLinks(mdb),
+	}
+}
+
+// copyStrings returns a copy of a string slice.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
+
+// copyTags returns a copy of a tag slice.
+func copyTags(tags []schema.Tag) []schema.Tag {
+	if tags == nil {
+		return nil
+	}
+	return append([]schema.Tag(nil), tags...)
+}
+
+// copyUser returns a copy of user that shares no state with it.
+func copyUser(user schema.User) schema.User {
+	user.Notes = copyStrings(user.Notes)
+	return user
+}
+
+// copyFile returns a copy of file that shares no state with it.
+func copyFile(file schema.File) schema.File {
+	if file.Checksums != nil {
+		checksums := make(digest.Set, len(file.Checksums))
+		for alg, value := range file.Checksums {
+			checksums[alg] = value
+		}
+		file.Checksums = checksums
+	}
+	file.Tags = copyTags(file.Tags)
+	file.DataDirs = copyStrings(file.DataDirs)
+	return file
+}
+
+// copyDir returns a copy of dir that shares no state with it.
+func copyDir(dir schema.Directory) schema.Directory {
+	dir.DataFiles = copyStrings(dir.DataFiles)
+	dir.Tags = copyTags(dir.Tags)
+	return dir
+}
+
+// copyProject returns a copy of project that shares no state with it.
+func copyProject(project schema.Project) schema.Project {
+	if project.Notes != nil {
+		project.Notes = append([]schema.Note(nil), project.Notes...)
+	}
+	project.Tags = copyTags(project.Tags)
+	project.Reviews = copyStrings(project.Reviews)
+	project.MyTags = copyStrings(project.MyTags)
+	return project
+}
+
+// copyGroup returns a copy of group that shares no state with it.
+func copyGroup(group schema.Group) schema.Group {
+	group.Users = copyStrings(group.Users)
+	return group
+}
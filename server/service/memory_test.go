@@ -0,0 +1,12 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+func TestMemoryService(t *testing.T) {
+	user := schema.NewUser("test", "test@mc.org", "password", "test")
+	testServiceBehavior(t, NewMemory(user), user)
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"time"
+
+	"github.com/materials-commons/gohandy/collections"
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server"
+)
+
+// mFiles implements the Files interface in memory
+type mFiles struct {
+	mdb *memDB
+}
+
+// newMFiles creates a new instance of mFiles
+func newMFiles(mdb *memDB) mFiles {
+	return mFiles{
+		mdb: mdb,
+	}
+}
+
+// ByID looks up a file by its primary key.
+func (f mFiles) ByID(id string) (*schema.File, error) {
+	f.mdb.mutex.RLock()
+	defer f.mdb.mutex.RUnlock()
+
+	file, ok := f.mdb.files[id]
+	if !ok {
+		return nil, mcerr.ErrNotFound
+	}
+	file = copyFile(file)
+	return &file, nil
+}
+
+// ByPath looks up a file by its name in a specific directory. It only returns the
+// current file, not hidden files.
+func (f mFiles) ByPath(name, dirID string) (*schema.File, error) {
+	files := f.filter(func(file *schema.File) bool {
+		return file.Current && file.Name == name && inDir(file, dirID)
+	})
+	if len(files) == 0 {
+		return nil, mcerr.ErrNotFound
+	}
+	return &files[0], nil
+}
+
+// ByPathPartials returns all the partials matching name in the given directory. A
+// partial is a file that has not completed uploading. A file is a partial when its
+// size is not equal to uploaded.
+func (f mFiles) ByPathPartials(name, dirID string) ([]schema.File, error) {
+	return f.filter(func(file *schema.File) bool {
+		return file.Name == name && inDir(file, dirID) && file.Uploaded != file.Size
+	}), nil
+}
+
+// PartialsBefore returns all the partials across the system that have not been
+// modified since cutoff.
+func (f mFiles) PartialsBefore(cutoff time.Time) ([]schema.File, error) {
+	return f.filter(func(file *schema.File) bool {
+		return !file.Current && file.Uploaded != file.Size && file.MTime.Before(cutoff)
+	}), nil
+}
+
+// ByPathChecksums looks up a file by its name, checksums and directory. A file matches
+// when the strongest hash it has in common with checksums is the same. This method
+// can return files that are only partially uploaded.
+func (f mFiles) ByPathChecksums(name, dirID string, checksums digest.Set) ([]schema.File, error) {
+	return f.filter(func(file *schema.File) bool {
+		return file.Name == name && inDir(file, dirID) && file.Digests().Matches(checksums)
+	}), nil
+}
+
+// ByChecksums looks up a file by its checksums, matching on the strongest hash in
+// common. This routine only returns the original root entry, it will not return
+// entries that are duplicates and point at the root.
+func (f mFiles) ByChecksums(checksums digest.Set) (*schema.File, error) {
+	files := f.filter(func(file *schema.File) bool {
+		return file.UsesID == "" && file.Digests().Matches(checksums)
+	})
+	if len(files) == 0 {
+		return nil, mcerr.ErrNotFound
+	}
+	return &files[0], nil
+}
+
+// MatchOn looks up files by key. It accepts the same keys as the SQL backend.
+func (f mFiles) MatchOn(key, value string) ([]schema.File, error) {
+	var field func(file *schema.File) string
+	switch key {
+	case "id":
+		field = func(file *schema.File) string { return file.ID }
+	case "name":
+		field = func(file *schema.File) string { return file.Name }
+	case "owner":
+		field = func(file *schema.File) string { return file.Owner }
+	case "checksum":
+		field = func(file *schema.File) string { return file.Checksum }
+	case "parent":
+		field = func(file *schema.File) string { return file.Parent }
+	case "usesid":
+		field = func(file *schema.File) string { return file.UsesID }
+	default:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Can't match files on %s", key)
+	}
+
+	return f.filter(func(file *schema.File) bool {
+		return field(file) == value
+	}), nil
+}
+
+// Hide keeps the file around, but removes it from all dependent objects. This allows
+// multiple versions of a file to exist, but only the current version to be used.
+func (f mFiles) Hide(file *schema.File) error {
+	file.Current = false
+	f.Update(file)
+	return f.removeFromDependents(file)
+}
+
+// Update updates an existing datafile. If you are adding the datafile to a directory
+// you should use the AddDirectories method. This method will not update related items.
+func (f mFiles) Update(file *schema.File) error {
+	f.mdb.mutex.Lock()
+	defer f.mdb.mutex.Unlock()
+
+	if _, ok := f.mdb.files[file.ID]; !ok {
+		return mcerr.ErrNotFound
+	}
+	f.mdb.files[file.ID] = copyFile(*file)
+	return nil
+}
+
+// UpdateTags updates the tags on a file. Projects are listed straight from the
+// files, so there is nothing else to update. Only the tags are written.
+func (f mFiles) UpdateTags(file *schema.File) error {
+	f.mdb.mutex.Lock()
+	defer f.mdb.mutex.Unlock()
+
+	stored, ok := f.mdb.files[file.ID]
+	if !ok {
+		return mcerr.ErrNotFound
+	}
+	stored.Tags = copyTags(file.Tags)
+	f.mdb.files[file.ID] = stored
+	return nil
+}
+
+// Insert creates a new file entry. Insert updates the directory and other
+// dependent objects in the system.
+func (f mFiles) Insert(file *schema.File) (*schema.File, error) {
+	newFile, err := f.InsertEntry(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.AddDirectories(newFile, file.DataDirs...); err != nil {
+		return newFile, err
+	}
+	return newFile, nil
+}
+
+// InsertEntry creates a new file entry. It does not update any dependent
+// objects. You can use AddDirectory to add/update the directory this file
+// belongs in. This method exists to allow for the creation of new file
+// objects that will be linked into the rest of the system at a late date.
+func (f mFiles) InsertEntry(file *schema.File) (*schema.File, error) {
+	f.mdb.mutex.Lock()
+	defer f.mdb.mutex.Unlock()
+
+	newFile := copyFile(*file)
+	if newFile.ID == "" {
+		newFile.ID = newID()
+	}
+	if _, exists := f.mdb.files[newFile.ID]; exists {
+		return nil, dbError(mcfs.ErrDBInsertFailed)
+	}
+
+	f.mdb.files[newFile.ID] = newFile
+	newFile = copyFile(newFile)
+	return &newFile, nil
+}
+
+// Delete deletes a file. It updates dependent objects.
+func (f mFiles) Delete(id string) error {
+	f.mdb.mutex.Lock()
+	file, ok := f.mdb.files[id]
+	delete(f.mdb.files, id)
+	f.mdb.mutex.Unlock()
+
+	if !ok {
+		return mcerr.ErrNotFound
+	}
+	return f.removeFromDependents(&file)
+}
+
+// removeFromDependents removes the file from all the other objects in
+// the database that refer to it.
+func (f mFiles) removeFromDependents(file *schema.File) error {
+	mdirs := newMDirs(f.mdb)
+	var rv error
+	for _, dirID := range file.DataDirs {
+		ddir, err := mdirs.ByID(dirID)
+		if err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+			continue
+		}
+
+		if err := mdirs.RemoveFiles(ddir, file.ID); err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+		}
+	}
+
+	return rv
+}
+
+// AddDirectories adds new directories to a file. It updates all related items.
+func (f mFiles) AddDirectories(file *schema.File, dirIDs ...string) error {
+	mdirs := newMDirs(f.mdb)
+	var rv error
+	for _, ddirID := range dirIDs {
+		if index := collections.Strings.Find(file.DataDirs, ddirID); index == -1 {
+			file.DataDirs = append(file.DataDirs, ddirID)
+		}
+		dir, err := mdirs.ByID(ddirID)
+		if err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+			continue
+		}
+		if err := mdirs.AddFiles(dir, file.ID); err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+		}
+	}
+	f.Update(file)
+	return rv
+}
+
+// filter returns copies of all the files that match.
+func (f mFiles) filter(match func(file *schema.File) bool) []schema.File {
+	f.mdb.mutex.RLock()
+	defer f.mdb.mutex.RUnlock()
+
+	var files []schema.File
+	for _, file := range f.mdb.files {
+		if match(&file) {
+			files = append(files, copyFile(file))
+		}
+	}
+	return files
+}
+
+// inDir returns true if the file is in the directory dirID.
+func inDir(file *schema.File, dirID string) bool {
+	return collections.Strings.Find(file.DataDirs, dirID) != -1
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// mGroups implements the Groups interface in memory
+type mGroups struct {
+	mdb *memDB
+}
+
+// newMGroups creates a new instance of mGroups
+func newMGroups(mdb *memDB) mGroups {
+	return mGroups{
+		mdb: mdb,
+	}
+}
+
+// ByID looks up a group by its primary key.
+func (g mGroups) ByID(id string) (*schema.Group, error) {
+	g.mdb.mutex.RLock()
+	defer g.mdb.mutex.RUnlock()
+
+	group, ok := g.mdb.groups[id]
+	if !ok {
+		return nil, mcerr.ErrNotFound
+	}
+	group = copyGroup(group)
+	return &group, nil
+}
+
+// ByOwner returns the groups owned by owner.
+func (g mGroups) ByOwner(owner string) ([]schema.Group, error) {
+	return g.matching(func(group schema.Group) bool { return group.Owner == owner })
+}
+
+// ByUser returns the groups that user is a member of.
+func (g mGroups) ByUser(user string) ([]schema.Group, error) {
+	return g.matching(func(group schema.Group) bool { return hasUser(group, user) })
+}
+
+// matching returns the groups that match accepts.
+func (g mGroups) matching(accept func(group schema.Group) bool) ([]schema.Group, error) {
+	g.mdb.mutex.RLock()
+	defer g.mdb.mutex.RUnlock()
+
+	var groups []schema.Group
+	for _, group := range g.mdb.groups {
+		if accept(group) {
+			groups = append(groups, copyGroup(group))
+		}
+	}
+	return groups, nil
+}
+
+// Update updates an existing group.
+func (g mGroups) Update(group *schema.Group) error {
+	g.mdb.mutex.Lock()
+	defer g.mdb.mutex.Unlock()
+
+	if _, ok := g.mdb.groups[group.ID]; !ok {
+		return mcerr.ErrNotFound
+	}
+	g.mdb.groups[group.ID] = copyGroup(*group)
+	return nil
+}
+
+// Insert creates a new group.
+func (g mGroups) Insert(group *schema.Group) (*schema.Group, error) {
+	g.mdb.mutex.Lock()
+	defer g.mdb.mutex.Unlock()
+
+	newGroup := copyGroup(*group)
+	if newGroup.ID == "" {
+		newGroup.ID = newID()
+	}
+	if _, exists := g.mdb.groups[newGroup.ID]; exists {
+		return nil, mcerr.ErrExists
+	}
+
+	g.mdb.groups[newGroup.ID] = newGroup
+	newGroup = copyGroup(newGroup)
+	return &newGroup, nil
+}
+
+// Delete deletes a group.
+func (g mGroups) Delete(id string) error {
+	g.mdb.mutex.Lock()
+	defer g.mdb.mutex.Unlock()
+
+	delete(g.mdb.groups, id)
+	return nil
+}
+
+// HasAccess checks to see if the user making the request has access to the
+// particular item. Access is determined the same way as for RethinkDB: the
+// user is the owner, is in the admin group, or is in one of the owner's groups.
+func (g mGroups) HasAccess(owner, user string) bool {
+	g.mdb.mutex.RLock()
+	defer g.mdb.mutex.RUnlock()
+
+	if user == owner {
+		return true
+	}
+
+	for _, group := range g.mdb.groups {
+		if group.ID != AdminGroup && group.Owner != owner {
+			continue
+		}
+
+		if hasUser(group, user) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasUser returns true if user is a member of group.
+func hasUser(group schema.Group, user string) bool {
+	for _, u := range group.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// mJobs implements the Jobs interface in memory
+type mJobs struct {
+	mdb *memDB
+}
+
+// newMJobs creates a new instance of mJobs
+func newMJobs(mdb *memDB) mJobs {
+	return mJobs{
+		mdb: mdb,
+	}
+}
+
+// ByID looks up a job by its primary key.
+func (j mJobs) ByID(id string) (*schema.Job, error) {
+	j.mdb.mutex.RLock()
+	defer j.mdb.mutex.RUnlock()
+
+	job, ok := j.mdb.jobs[id]
+	if !ok {
+		return nil, mcerr.ErrNotFound
+	}
+	return &job, nil
+}
+
+// ByFile returns all the jobs for a datafile, oldest first.
+func (j mJobs) ByFile(fileID string) ([]schema.Job, error) {
+	return j.filter(func(job *schema.Job) bool { return job.FileID == fileID }), nil
+}
+
+// ByStatus returns all the jobs in a given state, oldest first.
+func (j mJobs) ByStatus(status string) ([]schema.Job, error) {
+	return j.filter(func(job *schema.Job) bool { return job.Status == status }), nil
+}
+
+// filter returns the jobs that match, oldest first.
+func (j mJobs) filter(match func(job *schema.Job) bool) []schema.Job {
+	j.mdb.mutex.RLock()
+	defer j.mdb.mutex.RUnlock()
+
+	var jobs []schema.Job
+	for _, job := range j.mdb.jobs {
+		if match(&job) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	sort.Sort(jobsByBirthtime(jobs))
+	return jobs
+}
+
+// jobsByBirthtime sorts jobs from oldest to newest.
+type jobsByBirthtime []schema.Job
+
+func (jobs jobsByBirthtime) Len() int           { return len(jobs) }
+func (jobs jobsByBirthtime) Swap(i, k int)      { jobs[i], jobs[k] = jobs[k], jobs[i] }
+func (jobs jobsByBirthtime) Less(i, k int) bool { return jobs[i].Birthtime.Before(jobs[k].Birthtime) }
+
+// Insert creates a new job.
+func (j mJobs) Insert(job *schema.Job) (*schema.Job, error) {
+	j.mdb.mutex.Lock()
+	defer j.mdb.mutex.Unlock()
+
+	newJob := *job
+	if newJob.ID == "" {
+		newJob.ID = newID()
+	}
+	if _, exists := j.mdb.jobs[newJob.ID]; exists {
+		return nil, mcerr.ErrExists
+	}
+
+	j.mdb.jobs[newJob.ID] = newJob
+	return &newJob, nil
+}
+
+// Update updates an existing job.
+func (j mJobs) Update(job *schema.Job) error {
+	j.mdb.mutex.Lock()
+	defer j.mdb.mutex.Unlock()
+
+	if _, ok := j.mdb.jobs[job.ID]; !ok {
+		return mcerr.ErrNotFound
+	}
+	j.mdb.jobs[job.ID] = *job
+	return nil
+}
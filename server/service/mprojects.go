@@ -0,0 +1,205 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/materials-commons/mcfs/base/dir"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server"
+)
+
+// mProjects implements the Projects interface in memory
+type mProjects struct {
+	mdb *memDB
+}
+
+// newMProjects creates a new instance of mProjects
+func newMProjects(mdb *memDB) mProjects {
+	return mProjects{
+		mdb: mdb,
+	}
+}
+
+// ByID looks up a project by its primary key.
+func (p mProjects) ByID(id string) (*schema.Project, error) {
+	p.mdb.mutex.RLock()
+	defer p.mdb.mutex.RUnlock()
+
+	project, ok := p.mdb.projects[id]
+	if !ok {
+		return nil, mcerr.ErrNotFound
+	}
+	project = copyProject(project)
+	return &project, nil
+}
+
+// ByName looks up a project by its name and owner.
+func (p mProjects) ByName(name, owner string) (*schema.Project, error) {
+	p.mdb.mutex.RLock()
+	defer p.mdb.mutex.RUnlock()
+
+	for _, project := range p.mdb.projects {
+		if project.Name == name && project.Owner == owner {
+			project = copyProject(project)
+			return &project, nil
+		}
+	}
+	return nil, mcerr.ErrNotFound
+}
+
+// ByOwner returns the projects owned by owner, sorted by name.
+func (p mProjects) ByOwner(owner string) ([]schema.Project, error) {
+	p.mdb.mutex.RLock()
+	defer p.mdb.mutex.RUnlock()
+
+	var projects []schema.Project
+	for _, project := range p.mdb.projects {
+		if project.Owner == owner {
+			projects = append(projects, copyProject(project))
+		}
+	}
+	sort.Sort(projectsByName(projects))
+	return projects, nil
+}
+
+// Files returns a flattened list of all the files and directories in a project.
+// Each entry has its full path starting from the project. The returned list is
+// in sorted (ascending) order.
+func (p mProjects) Files(projectID, base string) ([]dir.FileInfo, error) {
+	p.mdb.mutex.RLock()
+	defer p.mdb.mutex.RUnlock()
+
+	var entries []schema.DataDirDenorm
+	for _, p2d := range p.mdb.project2datadir {
+		if p2d.ProjectID != projectID {
+			continue
+		}
+
+		d, ok := p.mdb.dirs[p2d.DataDirID]
+		if !ok {
+			continue
+		}
+
+		entry := schema.DataDirDenorm{
+			ID:        d.ID,
+			Name:      d.Name,
+			Owner:     d.Owner,
+			Birthtime: d.Birthtime,
+			ProjectID: projectID,
+			Tags:      copyTags(d.Tags),
+		}
+		for _, fileID := range d.DataFiles {
+			f, ok := p.mdb.files[fileID]
+			if !ok {
+				continue
+			}
+			entry.DataFiles = append(entry.DataFiles, schema.FileEntry{
+				ID:        f.ID,
+				Name:      f.Name,
+				Owner:     f.Owner,
+				Birthtime: f.Birthtime,
+				Checksum:  f.Checksum,
+				Size:      f.Size,
+				Tags:      copyTags(f.Tags),
+				MediaType: f.MediaType.Mime,
+			})
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		// Nothing was found, treat as invalid project.
+		return nil, mcerr.ErrNotFound
+	}
+
+	dirlist := &dirList{}
+	return dirlist.build(entries, base), nil
+}
+
+// Update updates an existing project.
+func (p mProjects) Update(project *schema.Project) error {
+	p.mdb.mutex.Lock()
+	defer p.mdb.mutex.Unlock()
+
+	if _, ok := p.mdb.projects[project.ID]; !ok {
+		return mcerr.ErrNotFound
+	}
+	p.mdb.projects[project.ID] = copyProject(*project)
+	return nil
+}
+
+// Insert inserts a new project. This method creates the directory object
+// for the project. If a directory id is specified in the project then
+// the method will return ErrInvalid.
+func (p mProjects) Insert(project *schema.Project) (*schema.Project, error) {
+	if project.DataDir != "" {
+		return nil, mcerr.ErrInvalid
+	}
+
+	newProject := copyProject(*project)
+	if newProject.ID == "" {
+		newProject.ID = newID()
+	}
+
+	p.mdb.mutex.Lock()
+	if _, exists := p.mdb.projects[newProject.ID]; exists {
+		p.mdb.mutex.Unlock()
+		return nil, dbError(mcfs.ErrDBInsertFailed)
+	}
+	p.mdb.projects[newProject.ID] = newProject
+	p.mdb.mutex.Unlock()
+
+	dir := schema.NewDirectory(project.Name, project.Owner, newProject.ID, "")
+	newDir, err := newMDirs(p.mdb).Insert(&dir)
+	if err != nil {
+		return nil, dbError(mcfs.ErrDBRelatedUpdateFailed)
+	}
+
+	newProject.DataDir = newDir.ID
+	if err = p.Update(&newProject); err != nil {
+		return &newProject, err
+	}
+
+	err = p.AddDirectories(&newProject, newDir.ID)
+
+	return &newProject, err
+}
+
+// AddDirectories adds new directories to the project.
+func (p mProjects) AddDirectories(project *schema.Project, directoryIDs ...string) error {
+	p.mdb.mutex.Lock()
+	defer p.mdb.mutex.Unlock()
+
+	for _, dirID := range directoryIDs {
+		if p.hasDirectory(project.ID, dirID) {
+			continue
+		}
+
+		p2d := schema.Project2DataDir{
+			ID:        newID(),
+			ProjectID: project.ID,
+			DataDirID: dirID,
+		}
+		p.mdb.project2datadir = append(p.mdb.project2datadir, p2d)
+	}
+
+	return nil
+}
+
+// hasDirectory returns true if the directory is already in the project. The
+// caller must hold the lock.
+func (p mProjects) hasDirectory(projectID, dirID string) bool {
+	for _, p2d := range p.mdb.project2datadir {
+		if p2d.ProjectID == projectID && p2d.DataDirID == dirID {
+			return true
+		}
+	}
+	return false
+}
+
+type projectsByName []schema.Project
+
+func (p projectsByName) Len() int           { return len(p) }
+func (p projectsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p projectsByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// mShareLinks implements the ShareLinks interface in memory
+type mShareLinks struct {
+	mdb *memDB
+}
+
+// newMShareLinks creates a new instance of mShareLinks
+func newMShareLinks(mdb *memDB) mShareLinks {
+	return mShareLinks{
+		mdb: mdb,
+	}
+}
+
+// ByID looks up a share link by its primary key.
+func (s mShareLinks) ByID(id string) (*schema.ShareLink, error) {
+	s.mdb.mutex.RLock()
+	defer s.mdb.mutex.RUnlock()
+
+	link, ok := s.mdb.shareLinks[id]
+	if !ok {
+		return nil, mcerr.ErrNotFound
+	}
+	return &link, nil
+}
+
+// ByOwner returns all the share links created by owner, oldest first.
+func (s mShareLinks) ByOwner(owner string) ([]schema.ShareLink, error) {
+	s.mdb.mutex.RLock()
+	defer s.mdb.mutex.RUnlock()
+
+	var links []schema.ShareLink
+	for _, link := range s.mdb.shareLinks {
+		if link.Owner == owner {
+			links = append(links, link)
+		}
+	}
+
+	sort.Sort(linksByBirthtime(links))
+	return links, nil
+}
+
+// linksByBirthtime sorts share links from oldest to newest.
+type linksByBirthtime []schema.ShareLink
+
+func (links linksByBirthtime) Len() int      { return len(links) }
+func (links linksByBirthtime) Swap(i, k int) { links[i], links[k] = links[k], links[i] }
+func (links linksByBirthtime) Less(i, k int) bool {
+	return links[i].Birthtime.Before(links[k].Birthtime)
+}
+
+// Insert creates a new share link.
+func (s mShareLinks) Insert(link *schema.ShareLink) (*schema.ShareLink, error) {
+	s.mdb.mutex.Lock()
+	defer s.mdb.mutex.Unlock()
+
+	newLink := *link
+	if newLink.ID == "" {
+		newLink.ID = newID()
+	}
+	if _, exists := s.mdb.shareLinks[newLink.ID]; exists {
+		return nil, mcerr.ErrExists
+	}
+
+	s.mdb.shareLinks[newLink.ID] = newLink
+	return &newLink, nil
+}
+
+// Update updates an existing share link.
+func (s mShareLinks) Update(link *schema.ShareLink) error {
+	s.mdb.mutex.Lock()
+	defer s.mdb.mutex.Unlock()
+
+	if _, ok := s.mdb.shareLinks[link.ID]; !ok {
+		return mcerr.ErrNotFound
+	}
+	s.mdb.shareLinks[link.ID] = *link
+	return nil
+}
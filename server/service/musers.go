@@ -0,0 +1,100 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// mUsers implements the Users interface in memory
+type mUsers struct {
+	mdb *memDB
+}
+
+// newMUsers creates a new instance of mUsers
+func newMUsers(mdb *memDB) mUsers {
+	return mUsers{
+		mdb: mdb,
+	}
+}
+
+// ByID looks up users by their primary key.
+func (u mUsers) ByID(id string) (*schema.User, error) {
+	u.mdb.mutex.RLock()
+	defer u.mdb.mutex.RUnlock()
+
+	user, ok := u.mdb.users[id]
+	if !ok {
+		return nil, mcerr.ErrNotFound
+	}
+	user = copyUser(user)
+	return &user, nil
+}
+
+// ByAPIKey looks up users by their apikey. Disabled users aren't returned.
+func (u mUsers) ByAPIKey(apikey string) (*schema.User, error) {
+	u.mdb.mutex.RLock()
+	defer u.mdb.mutex.RUnlock()
+
+	if apikey == "" {
+		return nil, mcerr.ErrNotFound
+	}
+
+	for _, user := range u.mdb.users {
+		if user.APIKey == apikey && !user.Disabled {
+			user = copyUser(user)
+			return &user, nil
+		}
+	}
+	return nil, mcerr.ErrNotFound
+}
+
+// All returns all the users, ordered by id.
+func (u mUsers) All() ([]schema.User, error) {
+	u.mdb.mutex.RLock()
+	defer u.mdb.mutex.RUnlock()
+
+	ids := make([]string, 0, len(u.mdb.users))
+	for id := range u.mdb.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	users := make([]schema.User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, copyUser(u.mdb.users[id]))
+	}
+	return users, nil
+}
+
+// Update updates an existing user.
+func (u mUsers) Update(user *schema.User) error {
+	u.mdb.mutex.Lock()
+	defer u.mdb.mutex.Unlock()
+
+	if _, ok := u.mdb.users[user.ID]; !ok {
+		return mcerr.ErrNotFound
+	}
+	u.mdb.users[user.ID] = copyUser(*user)
+	return nil
+}
+
+// Insert creates a new user. Users are identified by their email, which is
+// used as the id when none is given.
+func (u mUsers) Insert(user *schema.User) (*schema.User, error) {
+	u.mdb.mutex.Lock()
+	defer u.mdb.mutex.Unlock()
+
+	newUser := copyUser(*user)
+	if newUser.ID == "" {
+		newUser.ID = newUser.Email
+	}
+	if _, exists := u.mdb.users[newUser.ID]; exists {
+		return nil, mcerr.ErrExists
+	}
+
+	u.mdb.users[newUser.ID] = newUser
+	newUser = copyUser(newUser)
+	return &newUser, nil
+}
@@ -10,11 +10,11 @@ import (
 
 // rDirs implements the Dirs interface for RethinkDB
 type rDirs struct {
-	session *r.Session
+	session func() *r.Session
 }
 
 // newRDirs creates a new instance of rDirs
-func newRDirs(session *r.Session) rDirs {
+func newRDirs(session func() *r.Session) rDirs {
 	return rDirs{
 		session: session,
 	}
@@ -23,7 +23,7 @@ func newRDirs(session *r.Session) rDirs {
 // ByID looks up a dir by its primary key. In RethinkDB this is the id field.
 func (d rDirs) ByID(id string) (*schema.Directory, error) {
 	var dir schema.Directory
-	if err := model.Dirs.Qs(d.session).ByID(id, &dir); err != nil {
+	if err := model.Dirs.Qs(d.session()).ByID(id, &dir); err != nil {
 		return nil, err
 	}
 	return &dir, nil
@@ -33,7 +33,7 @@ func (d rDirs) ByID(id string) (*schema.Directory, error) {
 func (d rDirs) ByPath(path, projectID string) (*schema.Directory, error) {
 	rql := model.Dirs.T().GetAllByIndex("name", path).Filter(r.Row.Field("project").Eq(projectID))
 	var dir schema.Directory
-	if err := model.Dirs.Qs(d.session).Row(rql, &dir); err != nil {
+	if err := model.Dirs.Qs(d.session()).Row(rql, &dir); err != nil {
 		return nil, err
 	}
 	return &dir, nil
@@ -43,19 +43,34 @@ func (d rDirs) ByPath(path, projectID string) (*schema.Directory, error) {
 // AddFiles method. This method will not update related items. AddFiles takes care
 // of updating other related tables.
 func (d rDirs) Update(dir *schema.Directory) error {
-	if err := model.Dirs.Qs(d.session).Update(dir.ID, dir); err != nil {
+	if err := model.Dirs.Qs(d.session()).Update(dir.ID, dir); err != nil {
 		return err
 	}
 	return nil
 }
 
+// UpdateTags updates the tags on a dir and its entry in the denorm table.
+// Only the tags are written, so concurrent changes to the rest of the dir are
+// kept.
+func (d rDirs) UpdateTags(dir *schema.Directory) error {
+	tags := map[string]interface{}{"tags": dir.Tags}
+	if err := model.Dirs.Qs(d.session()).Update(dir.ID, tags); err != nil {
+		return err
+	}
+
+	if err := model.DirsDenorm.Qs(d.session()).Update(dir.ID, tags); err != nil {
+		return dbError(mcfs.ErrDBRelatedUpdateFailed)
+	}
+	return nil
+}
+
 // Insert creates a new dir. This method can return an error, with a valid
 // DataDir. This happens when the dir is created, but one or more of the intermediate
 // steps failed. The call needs to handle this case.
 func (d rDirs) Insert(dir *schema.Directory) (*schema.Directory, error) {
 	var newDir schema.Directory
-	if err := model.Dirs.Qs(d.session).Insert(dir, &newDir); err != nil {
-		return nil, mcfs.ErrDBInsertFailed
+	if err := model.Dirs.Qs(d.session()).Insert(dir, &newDir); err != nil {
+		return nil, dbError(mcfs.ErrDBInsertFailed)
 	}
 
 	// Insert the directory into the denorm table.
@@ -65,17 +80,18 @@ func (d rDirs) Insert(dir *schema.Directory) (*schema.Directory, error) {
 		Owner:     newDir.Owner,
 		Birthtime: newDir.Birthtime,
 		ProjectID: dir.Project,
+		Tags:      newDir.Tags,
 	}
 
 	if len(newDir.DataFiles) > 0 {
 		var err error
 		if ddirDenorm.DataFiles, err = d.createDataFiles(newDir.DataFiles); err != nil {
-			return &newDir, mcfs.ErrDBRelatedUpdateFailed
+			return &newDir, dbError(mcfs.ErrDBRelatedUpdateFailed)
 		}
 	}
 
-	if err := model.DirsDenorm.Qs(d.session).Insert(ddirDenorm, nil); err != nil {
-		return &newDir, mcfs.ErrDBRelatedUpdateFailed
+	if err := model.DirsDenorm.Qs(d.session()).Insert(ddirDenorm, nil); err != nil {
+		return &newDir, dbError(mcfs.ErrDBRelatedUpdateFailed)
 	}
 
 	return &newDir, nil
@@ -93,24 +109,24 @@ func (d rDirs) AddFiles(dir *schema.Directory, fileIDs ...string) error {
 		}
 	}
 
-	if err := model.Dirs.Qs(d.session).Update(dir.ID, dir); err != nil {
-		return mcfs.ErrDBUpdateFailed
+	if err := model.Dirs.Qs(d.session()).Update(dir.ID, dir); err != nil {
+		return dbError(mcfs.ErrDBUpdateFailed)
 	}
 
 	// Add entries to the denorm table for this dir.
 	var dirDenorm schema.DataDirDenorm
 	fileEntries, err := d.createDataFiles(dir.DataFiles)
 	if err != nil {
-		return mcfs.ErrDBRelatedUpdateFailed
+		return dbError(mcfs.ErrDBRelatedUpdateFailed)
 	}
 
-	if err := model.DirsDenorm.Qs(d.session).ByID(dir.ID, &dirDenorm); err != nil {
-		return mcfs.ErrDBRelatedUpdateFailed
+	if err := model.DirsDenorm.Qs(d.session()).ByID(dir.ID, &dirDenorm); err != nil {
+		return dbError(mcfs.ErrDBRelatedUpdateFailed)
 	}
 
 	dirDenorm.DataFiles = fileEntries
-	if err := model.DirsDenorm.Qs(d.session).Update(dirDenorm.ID, dirDenorm); err != nil {
-		return mcfs.ErrDBRelatedUpdateFailed
+	if err := model.DirsDenorm.Qs(d.session()).Update(dirDenorm.ID, dirDenorm); err != nil {
+		return dbError(mcfs.ErrDBRelatedUpdateFailed)
 	}
 
 	return nil
@@ -122,8 +138,8 @@ func (d rDirs) createDataFiles(dataFileIDs []string) (dataFileEntries []schema.F
 	var errorReturn error
 	for _, dataFileID := range dataFileIDs {
 		var dataFile schema.File
-		if err := model.Files.Qs(d.session).ByID(dataFileID, &dataFile); err != nil {
-			errorReturn = mcfs.ErrDBLookupFailed
+		if err := model.Files.Qs(d.session()).ByID(dataFileID, &dataFile); err != nil {
+			errorReturn = dbError(mcfs.ErrDBLookupFailed)
 			continue
 		}
 
@@ -134,6 +150,8 @@ func (d rDirs) createDataFiles(dataFileIDs []string) (dataFileEntries []schema.F
 			Birthtime: dataFile.Birthtime,
 			Checksum:  dataFile.Checksum,
 			Size:      dataFile.Size,
+			Tags:      dataFile.Tags,
+			MediaType: dataFile.MediaType.Mime,
 		}
 		dataFileEntries = append(dataFileEntries, dataFileEntry)
 	}
@@ -149,12 +167,12 @@ func (d rDirs) RemoveFiles(dir *schema.Directory, fileIDs ...string) error {
 		return err
 	}
 	var dirDenorm schema.DataDirDenorm
-	if err := model.DirsDenorm.Qs(d.session).ByID(dir.ID, &dirDenorm); err != nil {
-		return mcfs.ErrDBRelatedUpdateFailed
+	if err := model.DirsDenorm.Qs(d.session()).ByID(dir.ID, &dirDenorm); err != nil {
+		return dbError(mcfs.ErrDBRelatedUpdateFailed)
 	}
 	dirDenorm.DataFiles = removeMatchingFileIDs(dirDenorm, fileIDs...)
-	if err := model.DirsDenorm.Qs(d.session).Update(dirDenorm.ID, dirDenorm); err != nil {
-		return mcfs.ErrDBRelatedUpdateFailed
+	if err := model.DirsDenorm.Qs(d.session()).Update(dirDenorm.ID, dirDenorm); err != nil {
+		return dbError(mcfs.ErrDBRelatedUpdateFailed)
 	}
 	return nil
 }
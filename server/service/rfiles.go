@@ -1,8 +1,12 @@
 package service
 
 import (
+	"time"
+
 	r "github.com/dancannon/gorethink"
 	"github.com/materials-commons/gohandy/collections"
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/model"
 	"github.com/materials-commons/mcfs/base/schema"
 	"github.com/materials-commons/mcfs/server"
@@ -10,11 +14,11 @@ import (
 
 // rFiles implements the Files interface for RethinkDB
 type rFiles struct {
-	session *r.Session
+	session func() *r.Session
 }
 
 // newRFiles creates a new instance of rFiles
-func newRFiles(session *r.Session) rFiles {
+func newRFiles(session func() *r.Session) rFiles {
 	return rFiles{
 		session: session,
 	}
@@ -23,7 +27,7 @@ func newRFiles(session *r.Session) rFiles {
 // ByID looks up a file by its primary key. In RethinkDB this is the id field.
 func (f rFiles) ByID(id string) (*schema.File, error) {
 	var file schema.File
-	if err := model.Files.Qs(f.session).ByID(id, &file); err != nil {
+	if err := model.Files.Qs(f.session()).ByID(id, &file); err != nil {
 		return nil, err
 	}
 	return &file, nil
@@ -35,7 +39,7 @@ func (f rFiles) ByPath(name, dirID string) (*schema.File, error) {
 	rql := model.Files.T().GetAllByIndex("name", name).
 		Filter(r.Row.Field("datadirs").Contains(dirID).And(r.Row.Field("current").Eq(true)))
 	var file schema.File
-	if err := model.Files.Qs(f.session).Row(rql, &file); err != nil {
+	if err := model.Files.Qs(f.session()).Row(rql, &file); err != nil {
 		return nil, err
 	}
 	return &file, nil
@@ -49,41 +53,108 @@ func (f rFiles) ByPathPartials(name, dirID string) ([]schema.File, error) {
 		Filter(r.Row.Field("datadirs").Contains(dirID).
 		And(r.Row.Field("uploaded").Ne(r.Row.Field("size"))))
 	var files []schema.File
-	if err := model.Files.Qs(f.session).Rows(rql, &files); err != nil {
+	if err := model.Files.Qs(f.session()).Rows(rql, &files); err != nil {
 		return nil, err
 	}
 	return files, nil
 }
 
-// ByPathChecksum looks up a file by its name, checksum and directory. This method
-// can return files that are only partially uploaded. It can return
-func (f rFiles) ByPathChecksum(name, dirID, checksum string) ([]schema.File, error) {
+// PartialsBefore returns all the partials across the system that have not been
+// modified since cutoff. Hidden versions of a file are not partials because their
+// uploaded and size fields are equal.
+func (f rFiles) PartialsBefore(cutoff time.Time) ([]schema.File, error) {
+	rql := model.Files.T().Filter(r.Row.Field("current").Eq(false).
+		And(r.Row.Field("uploaded").Ne(r.Row.Field("size"))).
+		And(r.Row.Field("mtime").Lt(cutoff)))
 	var files []schema.File
-	rql := model.Files.T().GetAllByIndex("name", name).
-		Filter(r.Row.Field("datadirs").Contains(dirID).
-		And(r.Row.Field("checksum").Eq(checksum)))
-	if err := model.Files.Qs(f.session).Rows(rql, &files); err != nil {
+	if err := model.Files.Qs(f.session()).Rows(rql, &files); err != nil {
 		return nil, err
 	}
 	return files, nil
 }
 
-// ByChecksum looks up a file by its checksum. This routine only returns the original
-// root entry, it will not return entries that are duplicates and point at the root.
-func (f rFiles) ByChecksum(checksum string) (*schema.File, error) {
-	rql := model.Files.T().GetAllByIndex("checksum", checksum).Filter(r.Row.Field("usesid").Eq(""))
-	var file schema.File
-	if err := model.Files.Qs(f.session).Row(rql, &file); err != nil {
+// ByPathChecksums looks up a file by its name, checksums and directory. A file matches
+// when the strongest hash it has in common with checksums is the same. This method
+// can return files that are only partially uploaded.
+func (f rFiles) ByPathChecksums(name, dirID string, checksums digest.Set) ([]schema.File, error) {
+	var files []schema.File
+	rql := model.Files.T().GetAllByIndex("name", name).
+		Filter(r.Row.Field("datadirs").Contains(dirID).And(checksumsFilter(checksums)))
+	if err := model.Files.Qs(f.session()).Rows(rql, &files); err != nil {
 		return nil, err
 	}
-	return &file, nil
+	return matchChecksums(files, checksums), nil
+}
+
+// ByChecksums looks up a file by its checksums, matching on the strongest hash in
+// common. This routine only returns the original root entry, it will not return
+// entries that are duplicates and point at the root. Only the MD5 and SHA256
+// hashes are indexed, so a lookup without either finds nothing rather than
+// scanning every file.
+func (f rFiles) ByChecksums(checksums digest.Set) (*schema.File, error) {
+	// Look up the strongest indexed hash first. A file may not have a hash
+	// for that algorithm, so fall back to the weaker ones.
+	algs := checksums.Algorithms()
+	for i := len(algs) - 1; i >= 0; i-- {
+		alg := algs[i]
+		rql := model.Files.T().GetAllByIndex(checksumIndex(alg), checksums[alg]).
+			Filter(r.Row.Field("usesid").Eq(""))
+
+		var files []schema.File
+		if err := model.Files.Qs(f.session()).Rows(rql, &files); err != nil {
+			return nil, err
+		}
+
+		if matches := matchChecksums(files, checksums); len(matches) != 0 {
+			return &matches[0], nil
+		}
+	}
+
+	return nil, mcerr.ErrNotFound
+}
+
+// checksumIndex returns the name of the index on the hashes for alg. MD5
+// hashes are looked up on the checksum field, which every file has.
+func checksumIndex(alg string) string {
+	if alg == digest.MD5 {
+		return "checksum"
+	}
+	return alg
+}
+
+// checksumsFilter selects the files that share any hash with checksums. The MD5
+// hash is also checked against the checksum field for entries that predate
+// the checksums field.
+func checksumsFilter(checksums digest.Set) r.Term {
+	filter := r.Expr(false)
+	for _, alg := range checksums.Algorithms() {
+		filter = filter.Or(r.Row.Field("checksums").Field(alg).Default("").Eq(checksums[alg]))
+	}
+
+	if md5 := checksums[digest.MD5]; md5 != "" {
+		filter = filter.Or(r.Row.Field("checksum").Eq(md5))
+	}
+
+	return filter
+}
+
+// matchChecksums returns the files whose hashes match checksums on the strongest
+// algorithm they have in common.
+func matchChecksums(files []schema.File, checksums digest.Set) []schema.File {
+	var matches []schema.File
+	for _, file := range files {
+		if file.Digests().Matches(checksums) {
+			matches = append(matches, file)
+		}
+	}
+	return matches
 }
 
 // MatchOn looks up files by key.
 func (f rFiles) MatchOn(key, value string) ([]schema.File, error) {
 	var files []schema.File
 	rql := model.Files.T().GetAllByIndex(key, value)
-	if err := model.Files.Qs(f.session).Rows(rql, &files); err != nil {
+	if err := model.Files.Qs(f.session()).Rows(rql, &files); err != nil {
 		return nil, err
 	}
 	return files, nil
@@ -93,24 +164,50 @@ func (f rFiles) MatchOn(key, value string) ([]schema.File, error) {
 // multiple versions of a file to exist, but only the current version to be used.
 func (f rFiles) Hide(file *schema.File) error {
 	file.Current = false
-	model.Files.Qs(f.session).Update(file.ID, file)
+	model.Files.Qs(f.session()).Update(file.ID, file)
 	return f.removeFromDependents(file)
 }
 
 // Update updates an existing datafile. If you are adding the datafile to a directory
 // you should use the AddDirectories method. This method will not update related items.
 func (f rFiles) Update(file *schema.File) error {
-	if err := model.Files.Qs(f.session).Update(file.ID, file); err != nil {
+	if err := model.Files.Qs(f.session()).Update(file.ID, file); err != nil {
 		return err
 	}
 	return nil
 }
 
+// UpdateTags updates the tags on a file, and the file's entry in the
+// denorm table for each of its directories. Only the tags are written, so
+// concurrent changes to the rest of the file and its directories are kept.
+func (f rFiles) UpdateTags(file *schema.File) error {
+	tags := map[string]interface{}{"tags": file.Tags}
+	if err := model.Files.Qs(f.session()).Update(file.ID, tags); err != nil {
+		return err
+	}
+
+	var rv error
+	for _, ddirID := range file.DataDirs {
+		entries := func(row r.Term) interface{} {
+			return map[string]interface{}{
+				"datafiles": row.Field("datafiles").Map(func(entry r.Term) interface{} {
+					return r.Branch(entry.Field("id").Eq(file.ID), entry.Merge(tags), entry)
+				}),
+			}
+		}
+		if err := model.DirsDenorm.Qs(f.session()).Update(ddirID, entries); err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+		}
+	}
+
+	return rv
+}
+
 // Insert creates a new file entry. Insert updates the directory and other
 // dependent objects in the system.
 func (f rFiles) Insert(file *schema.File) (*schema.File, error) {
 	var newFile schema.File
-	if err := model.Files.Qs(f.session).Insert(file, &newFile); err != nil {
+	if err := model.Files.Qs(f.session()).Insert(file, &newFile); err != nil {
 		return nil, err
 	}
 	if err := f.AddDirectories(&newFile, file.DataDirs...); err != nil {
@@ -125,7 +222,7 @@ func (f rFiles) Insert(file *schema.File) (*schema.File, error) {
 // objects that will be linked into the rest of the system at a late date.
 func (f rFiles) InsertEntry(file *schema.File) (*schema.File, error) {
 	var newFile schema.File
-	if err := model.Files.Qs(f.session).Insert(file, &newFile); err != nil {
+	if err := model.Files.Qs(f.session()).Insert(file, &newFile); err != nil {
 		return nil, err
 	}
 	return &newFile, nil
@@ -138,7 +235,7 @@ func (f rFiles) Delete(id string) error {
 		return err
 	}
 
-	if err := model.Files.Qs(f.session).Delete(id); err != nil {
+	if err := model.Files.Qs(f.session()).Delete(id); err != nil {
 		return err
 	}
 
@@ -154,12 +251,12 @@ func (f rFiles) removeFromDependents(file *schema.File) error {
 	for _, dirID := range file.DataDirs {
 		ddir, err := rdirs.ByID(dirID)
 		if err != nil {
-			rv = mcfs.ErrDBRelatedUpdateFailed
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
 		}
 
 		err = rdirs.RemoveFiles(ddir, file.ID)
 		if err != nil {
-			rv = mcfs.ErrDBRelatedUpdateFailed
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
 		}
 	}
 
@@ -178,7 +275,7 @@ func (f rFiles) AddDirectories(file *schema.File, dirIDs ...string) error {
 		dir, err := rdirs.ByID(ddirID)
 		rdirs.AddFiles(dir, file.ID)
 		if err != nil {
-			rv = mcfs.ErrDBRelatedUpdateFailed
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
 		}
 	}
 	f.Update(file)
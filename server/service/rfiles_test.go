@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"github.com/materials-commons/mcfs/base/digest"
 	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/schema"
 	"testing"
@@ -10,7 +11,7 @@ import (
 var _ = fmt.Println
 
 func TestRFilesByID(t *testing.T) {
-	rfiles := newRFiles(session)
+	rfiles := newRFiles(rSession)
 
 	// Test existing
 	_, err := rfiles.ByID("650ccb87-f423-499e-b644-2bb093eca86a")
@@ -26,7 +27,7 @@ func TestRFilesByID(t *testing.T) {
 }
 
 func TestRFilesByPath(t *testing.T) {
-	rfiles := newRFiles(session)
+	rfiles := newRFiles(rSession)
 
 	// Lookup an existing file that exists in the given directory
 	f, err := rfiles.ByPath("2H-10X2.JPG", "d0b001c6-fc0a-4e95-97c3-4427de68c0a5")
@@ -79,10 +80,10 @@ func TestRFilesByPath(t *testing.T) {
 }
 
 func TestRFilesByChecksum(t *testing.T) {
-	rfiles := newRFiles(session)
+	rfiles := newRFiles(rSession)
 
 	// Lookup an existing checksum
-	f, err := rfiles.ByChecksum("72d47a675e81cf4a283aaf67587ddd28")
+	f, err := rfiles.ByChecksums(digest.Set{digest.MD5: "72d47a675e81cf4a283aaf67587ddd28"})
 	if err != nil {
 		t.Fatalf("Failed looking up an existing checksum: %s", err)
 	}
@@ -92,7 +93,7 @@ func TestRFilesByChecksum(t *testing.T) {
 	}
 
 	// Lookup an non-existent checksum
-	f, err = rfiles.ByChecksum("does-not-exist")
+	f, err = rfiles.ByChecksums(digest.Set{digest.MD5: "does-not-exist"})
 	if err == nil {
 		t.Fatalf("No error returned when looking up a file by a bad checksum")
 	}
@@ -100,13 +101,23 @@ func TestRFilesByChecksum(t *testing.T) {
 	if f != nil {
 		t.Fatalf("Found a file for a bad checksum")
 	}
+
+	// Lookup by a SHA256 that doesn't exist goes through its index
+	if _, err := rfiles.ByChecksums(digest.Set{digest.SHA256: "does-not-exist"}); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for a bad SHA256, got %v", err)
+	}
+
+	// Lookup by a SHA1 that doesn't exist goes through its index
+	if _, err := rfiles.ByChecksums(digest.Set{digest.SHA1: "does-not-exist"}); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for a bad SHA1, got %v", err)
+	}
 }
 
 func TestRFilesInsert(t *testing.T) {
 	// Insert a new item
 	dataFile := schema.NewFile("testfile.txt", "test@mc.org")
 	dataFile.DataDirs = append(dataFile.DataDirs, "d0b001c6-fc0a-4e95-97c3-4427de68c0a5")
-	rfiles := newRFiles(session)
+	rfiles := newRFiles(rSession)
 	newDF, err := rfiles.Insert(&dataFile)
 	if err != nil {
 		t.Fatalf("Unable to insert new datafile: %s", err)
@@ -121,6 +132,6 @@ func TestRFilesInsert(t *testing.T) {
 
 func rfilesCleanup(f *schema.File) {
 	fmt.Println("Deleting file: ", f.ID, f.Name)
-	rf := newRFiles(session)
+	rf := newRFiles(rSession)
 	rf.Delete(f.ID)
 }
@@ -8,11 +8,11 @@ import (
 
 // rGroups implements the Groups interface for RethinkDB
 type rGroups struct {
-	session *r.Session
+	session func() *r.Session
 }
 
 // newRGroups creates a new instance of rGroups
-func newRGroups(session *r.Session) rGroups {
+func newRGroups(session func() *r.Session) rGroups {
 	return rGroups{
 		session: session,
 	}
@@ -21,16 +21,42 @@ func newRGroups(session *r.Session) rGroups {
 // ByID looks up a group by its primary key.
 func (g rGroups) ByID(id string) (*schema.Group, error) {
 	var group schema.Group
-	if err := model.Groups.Qs(g.session).ByID(id, &group); err != nil {
+	if err := model.Groups.Qs(g.session()).ByID(id, &group); err != nil {
 		return nil, err
 	}
 	return &group, nil
 }
 
+// ByOwner returns the groups owned by owner.
+func (g rGroups) ByOwner(owner string) ([]schema.Group, error) {
+	rql := model.Groups.T().GetAllByIndex("owner", owner)
+	return g.groups(rql)
+}
+
+// ByUser returns the groups that user is a member of.
+func (g rGroups) ByUser(user string) ([]schema.Group, error) {
+	rql := model.Groups.T().Filter(r.Row.Field("users").Contains(user))
+	return g.groups(rql)
+}
+
+// groups returns the groups matching rql.
+func (g rGroups) groups(rql r.Term) ([]schema.Group, error) {
+	var groups []schema.Group
+	if err := model.Groups.Qs(g.session()).Rows(rql, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Update updates an existing group.
+func (g rGroups) Update(group *schema.Group) error {
+	return model.Groups.Qs(g.session()).Update(group.ID, group)
+}
+
 // Insert creates a new group.
 func (g rGroups) Insert(group *schema.Group) (*schema.Group, error) {
 	var newGroup schema.Group
-	if err := model.Groups.Qs(g.session).Insert(group, &newGroup); err != nil {
+	if err := model.Groups.Qs(g.session()).Insert(group, &newGroup); err != nil {
 		return nil, err
 	}
 	return &newGroup, nil
@@ -38,7 +64,7 @@ func (g rGroups) Insert(group *schema.Group) (*schema.Group, error) {
 
 // Delete deletes a group. It updates all dependent objects.
 func (g rGroups) Delete(id string) error {
-	return model.Groups.Qs(g.session).Delete(id)
+	return model.Groups.Qs(g.session()).Delete(id)
 }
 
 // HasAccess checks to see if the user making the request has access to the
@@ -63,7 +89,7 @@ func (g rGroups) ownerGaveAccessTo(owner, user string) bool {
 	// Get the owners groups
 	rql := model.Groups.T().GetAllByIndex("owner", owner)
 	var groups []schema.Group
-	if err := model.Groups.Qs(g.session).Rows(rql, &groups); err != nil {
+	if err := model.Groups.Qs(g.session()).Rows(rql, &groups); err != nil {
 		// Some sort of error occurred, assume no access
 		return false
 	}
@@ -85,7 +111,7 @@ func (g rGroups) ownerGaveAccessTo(owner, user string) bool {
 
 // isAdmin check if user is in admin table
 func (g rGroups) isAdmin(user string) bool {
-	group, err := g.ByID("admin")
+	group, err := g.ByID(AdminGroup)
 	if err != nil {
 		return false
 	}
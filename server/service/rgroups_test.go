@@ -9,7 +9,7 @@ import (
 var _ = fmt.Println
 
 func TestHasAccess(t *testing.T) {
-	rgroups := newRGroups(session)
+	rgroups := newRGroups(rSession)
 	user := "gtarcea@umich.edu"
 	owner := "mcfada@umich.edu"
 	// Test empty table different user
@@ -43,6 +43,6 @@ func TestHasAccess(t *testing.T) {
 
 func deleteItem(id string) {
 	fmt.Printf("Deleting group id %s\n", id)
-	rgroups := newRGroups(session)
+	rgroups := newRGroups(rSession)
 	rgroups.Delete(id)
 }
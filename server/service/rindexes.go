@@ -0,0 +1,135 @@
+package service
+
+import (
+	"sync"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/materials-commons/gohandy/collections"
+	"github.com/materials-commons/mcfs/base/db"
+	"github.com/materials-commons/mcfs/base/model"
+)
+
+// rTables are the tables the service adds to those the database is created
+// with.
+var rTables = []string{"jobs", "sharelinks"}
+
+// rIndex is a secondary index on a possibly nested field of a table.
+type rIndex struct {
+	model *model.Model
+	name  string
+	path  []string // Field names leading to the indexed field.
+}
+
+// rIndexes are the secondary indexes the service adds to those the database
+// is created with. Rows without the indexed field aren't indexed.
+var rIndexes = []rIndex{
+	{model: model.Files, name: "sha1", path: []string{"checksums", "sha1"}},
+	{model: model.Files, name: "sha256", path: []string{"checksums", "sha256"}},
+	{model: model.Files, name: "sha512", path: []string{"checksums", "sha512"}},
+	{model: model.Jobs, name: "datafile_id", path: []string{"datafile_id"}},
+	{model: model.Jobs, name: "status", path: []string{"status"}},
+	{model: model.ShareLinks, name: "owner", path: []string{"owner"}},
+}
+
+var (
+	// rSetupDone is set once setupRDatabase succeeds, so that the database
+	// is only set up by the first Service created.
+	rSetupDone bool
+	rSetupMux  sync.Mutex
+)
+
+// setupRDatabase creates the tables and indexes the service needs, and
+// migrates the rows stored in old shapes, unless it has already succeeded.
+// A failure is returned and the whole setup is tried again on the next call.
+func setupRDatabase(session *r.Session) error {
+	rSetupMux.Lock()
+	defer rSetupMux.Unlock()
+
+	if rSetupDone {
+		return nil
+	}
+
+	if err := createRIndexes(session); err != nil {
+		return err
+	}
+
+	if err := migrateRTags(session); err != nil {
+		return err
+	}
+	rSetupDone = true
+	return nil
+}
+
+// createRIndexes creates the tables in rTables and the indexes in rIndexes
+// that don't exist yet, and waits for them to be ready.
+func createRIndexes(session *r.Session) error {
+	if err := createRTables(session); err != nil {
+		return err
+	}
+
+	for _, index := range rIndexes {
+		names, err := rNames(session, index.model.T().IndexList())
+		if err != nil {
+			return err
+		}
+
+		if collections.Strings.Find(names, index.name) != -1 {
+			continue
+		}
+
+		path := index.path
+		create := index.model.T().IndexCreateFunc(index.name, func(row r.Term) r.Term {
+			for _, field := range path {
+				row = row.Field(field)
+			}
+			return row
+		})
+		if _, err := create.RunWrite(session); err != nil {
+			return err
+		}
+
+		cursor, err := index.model.T().IndexWait(index.name).Run(session)
+		if err != nil {
+			return err
+		}
+		cursor.Close()
+	}
+
+	return nil
+}
+
+// createRTables creates the tables in rTables that don't exist yet in the
+// default database.
+func createRTables(session *r.Session) error {
+	database := r.Db(db.RDatabase())
+	names, err := rNames(session, database.TableList())
+	if err != nil {
+		return err
+	}
+
+	for _, table := range rTables {
+		if collections.Strings.Find(names, table) != -1 {
+			continue
+		}
+
+		if _, err := database.TableCreate(table).RunWrite(session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rNames runs a query that lists names, such as IndexList.
+func rNames(session *r.Session, query r.Term) ([]string, error) {
+	cursor, err := query.Run(session)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := cursor.All(&names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
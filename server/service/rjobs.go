@@ -0,0 +1,63 @@
+package service
+
+import (
+	r "github.com/dancannon/gorethink"
+	"github.com/materials-commons/mcfs/base/model"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// rJobs implements the Jobs interface for RethinkDB
+type rJobs struct {
+	session func() *r.Session
+}
+
+// newRJobs creates a new instance of rJobs
+func newRJobs(session func() *r.Session) rJobs {
+	return rJobs{
+		session: session,
+	}
+}
+
+// ByID looks up a job by its primary key.
+func (j rJobs) ByID(id string) (*schema.Job, error) {
+	var job schema.Job
+	if err := model.Jobs.Qs(j.session()).ByID(id, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ByFile returns all the jobs for a datafile, oldest first.
+func (j rJobs) ByFile(fileID string) ([]schema.Job, error) {
+	rql := model.Jobs.T().GetAllByIndex("datafile_id", fileID).OrderBy("birthtime")
+	return j.jobs(rql)
+}
+
+// ByStatus returns all the jobs in a given state, oldest first.
+func (j rJobs) ByStatus(status string) ([]schema.Job, error) {
+	rql := model.Jobs.T().GetAllByIndex("status", status).OrderBy("birthtime")
+	return j.jobs(rql)
+}
+
+// jobs runs a query that returns a list of jobs.
+func (j rJobs) jobs(rql r.Term) ([]schema.Job, error) {
+	var jobs []schema.Job
+	if err := model.Jobs.Qs(j.session()).Rows(rql, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Insert creates a new job.
+func (j rJobs) Insert(job *schema.Job) (*schema.Job, error) {
+	var newJob schema.Job
+	if err := model.Jobs.Qs(j.session()).Insert(job, &newJob); err != nil {
+		return nil, err
+	}
+	return &newJob, nil
+}
+
+// Update updates an existing job.
+func (j rJobs) Update(job *schema.Job) error {
+	return model.Jobs.Qs(j.session()).Update(job.ID, job)
+}
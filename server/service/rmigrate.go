@@ -0,0 +1,65 @@
+package service
+
+import (
+	r "github.com/dancannon/gorethink"
+	"github.com/materials-commons/mcfs/base/model"
+)
+
+// migrateRTags converts the tags stored before tags were typed to lists of
+// schema.Tag. Project tags were a list of names, file tags an untyped list,
+// and the denorm table kept a map of tag names to values. Names become public
+// tags with an empty value, and map entries public tags with the entry's
+// value. Only rows that still have the old shapes are written.
+func migrateRTags(session *r.Session) error {
+	for _, m := range []*model.Model{model.Projects, model.Files} {
+		update := m.T().Filter(func(row r.Term) r.Term {
+			return rOldTags(row.Field("tags"))
+		}).Update(func(row r.Term) interface{} {
+			return map[string]interface{}{"tags": rTypedTags(row.Field("tags"))}
+		})
+		if _, err := update.RunWrite(session); err != nil {
+			return err
+		}
+	}
+
+	update := model.DirsDenorm.T().Filter(func(row r.Term) r.Term {
+		oldEntries := row.Field("datafiles").Default([]interface{}{}).Filter(func(entry r.Term) r.Term {
+			return rOldTags(entry.Field("tags"))
+		})
+		return rOldTags(row.Field("tags")).Or(oldEntries.Count().Gt(0))
+	}).Update(func(row r.Term) interface{} {
+		return map[string]interface{}{
+			"tags": rTypedTags(row.Field("tags")),
+			"datafiles": row.Field("datafiles").Default([]interface{}{}).Map(func(entry r.Term) interface{} {
+				return entry.Merge(map[string]interface{}{"tags": rTypedTags(entry.Field("tags"))})
+			}),
+		}
+	})
+	_, err := update.RunWrite(session)
+	return err
+}
+
+// rOldTags is true when tags is a map, or a list holding names.
+func rOldTags(tags r.Term) r.Term {
+	tags = tags.Default([]interface{}{})
+	return r.Branch(tags.TypeOf().Eq("OBJECT"),
+		true,
+		tags.Filter(func(tag r.Term) r.Term {
+			return tag.TypeOf().Eq("STRING")
+		}).Count().Gt(0))
+}
+
+// rTypedTags converts tags in any of the old shapes to a list of tags. Tags
+// that already have the new shape are kept as they are.
+func rTypedTags(tags r.Term) r.Term {
+	tags = tags.Default([]interface{}{})
+	return r.Branch(tags.TypeOf().Eq("OBJECT"),
+		tags.Keys().Map(func(key r.Term) interface{} {
+			return map[string]interface{}{"key": key, "value": tags.Field(key).CoerceTo("STRING"), "user": ""}
+		}),
+		tags.Map(func(tag r.Term) interface{} {
+			return r.Branch(tag.TypeOf().Eq("STRING"),
+				map[string]interface{}{"key": tag, "value": "", "user": ""},
+				tag)
+		}))
+}
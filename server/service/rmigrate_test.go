@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/model"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+func TestRMigrateTags(t *testing.T) {
+	session := rSession()
+	project := map[string]interface{}{
+		"name":  "migrate-tags",
+		"owner": "test@mc.org",
+		"tags":  []string{"old"},
+	}
+	rv, err := model.Projects.T().Insert(project).RunWrite(session)
+	if err != nil || len(rv.GeneratedKeys) != 1 {
+		t.Fatalf("Unable to insert project with old tags: %v", err)
+	}
+	id := rv.GeneratedKeys[0]
+	defer model.Projects.T().Get(id).Delete().RunWrite(session)
+
+	if err := migrateRTags(session); err != nil {
+		t.Fatalf("Migration failed: %s", err)
+	}
+
+	migrated, err := newRProjects(rSession).ByID(id)
+	if err != nil {
+		t.Fatalf("Unable to read migrated project: %s", err)
+	}
+
+	if len(migrated.Tags) != 1 || migrated.Tags[0] != (schema.Tag{Key: "old"}) {
+		t.Fatalf("Expected a public tag named old, got %#v", migrated.Tags)
+	}
+}
@@ -10,10 +10,10 @@ import (
 )
 
 type rProjects struct {
-	session *r.Session
+	session func() *r.Session
 }
 
-func newRProjects(session *r.Session) rProjects {
+func newRProjects(session func() *r.Session) rProjects {
 	return rProjects{
 		session: session,
 	}
@@ -22,7 +22,7 @@ func newRProjects(session *r.Session) rProjects {
 // ByID looks up a project by its primary key.
 func (p rProjects) ByID(id string) (*schema.Project, error) {
 	var project schema.Project
-	if err := model.Projects.Qs(p.session).ByID(id, &project); err != nil {
+	if err := model.Projects.Qs(p.session()).ByID(id, &project); err != nil {
 		return nil, mcerr.ErrNotFound
 	}
 	return &project, nil
@@ -32,19 +32,29 @@ func (p rProjects) ByID(id string) (*schema.Project, error) {
 func (p rProjects) ByName(name, owner string) (*schema.Project, error) {
 	var project schema.Project
 	rql := model.Projects.T().GetAllByIndex("name", name).Filter(r.Row.Field("owner").Eq(owner))
-	if err := model.Projects.Qs(p.session).Row(rql, &project); err != nil {
+	if err := model.Projects.Qs(p.session()).Row(rql, &project); err != nil {
 		return nil, mcerr.ErrNotFound
 	}
 	return &project, nil
 }
 
+// ByOwner returns the projects owned by owner, sorted by name.
+func (p rProjects) ByOwner(owner string) ([]schema.Project, error) {
+	rql := model.Projects.T().Filter(r.Row.Field("owner").Eq(owner)).OrderBy("name")
+	var projects []schema.Project
+	if err := model.Projects.Qs(p.session()).Rows(rql, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
 // Files returns a flattened list of all the files and directories in a project.
 // Each entry has its full path starting from the project. The returned list is
 // in sorted (ascending) order.
 func (p rProjects) Files(projectID, base string) ([]dir.FileInfo, error) {
 	rql := r.Table("project2datadir").GetAllByIndex("project_id", projectID).EqJoin("datadir_id", r.Table("datadirs_denorm")).Zip()
 	var entries []schema.DataDirDenorm
-	if err := model.DirsDenorm.Qs(p.session).Rows(rql, &entries); err != nil {
+	if err := model.DirsDenorm.Qs(p.session()).Rows(rql, &entries); err != nil {
 		return nil, err
 	}
 	if len(entries) == 0 {
@@ -57,7 +67,7 @@ func (p rProjects) Files(projectID, base string) ([]dir.FileInfo, error) {
 
 // Update updates an existing project.
 func (p rProjects) Update(project *schema.Project) error {
-	return model.Projects.Qs(p.session).Update(project.ID, project)
+	return model.Projects.Qs(p.session()).Update(project.ID, project)
 }
 
 // Insert inserts a new project. This method creates the directory object
@@ -74,19 +84,19 @@ func (p rProjects) Insert(project *schema.Project) (*schema.Project, error) {
 		err        error
 	)
 
-	if err = model.Projects.Qs(p.session).Insert(project, &newProject); err != nil {
-		return nil, mcfs.ErrDBInsertFailed
+	if err = model.Projects.Qs(p.session()).Insert(project, &newProject); err != nil {
+		return nil, dbError(mcfs.ErrDBInsertFailed)
 	}
 
 	dir := schema.NewDirectory(project.Name, project.Owner, newProject.ID, "")
 	rdirs := newRDirs(p.session)
 
 	if newDir, err = rdirs.Insert(&dir); err != nil {
-		return nil, mcfs.ErrDBRelatedUpdateFailed
+		return nil, dbError(mcfs.ErrDBRelatedUpdateFailed)
 	}
 
 	newProject.DataDir = newDir.ID
-	if err = model.Projects.Qs(p.session).Update(newProject.ID, &newProject); err != nil {
+	if err = model.Projects.Qs(p.session()).Update(newProject.ID, &newProject); err != nil {
 		return &newProject, err
 	}
 
@@ -105,8 +115,8 @@ func (p rProjects) AddDirectories(project *schema.Project, directoryIDs ...strin
 			ProjectID: project.ID,
 			DataDirID: dirID,
 		}
-		if err := model.Projects.Qs(p.session).InsertRaw("project2datadir", p2d, nil); err != nil {
-			rverror = mcfs.ErrDBRelatedUpdateFailed
+		if err := model.Projects.Qs(p.session()).InsertRaw("project2datadir", p2d, nil); err != nil {
+			rverror = dbError(mcfs.ErrDBRelatedUpdateFailed)
 		}
 	}
 
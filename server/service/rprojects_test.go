@@ -12,7 +12,7 @@ func TestRProjectsByID(t *testing.T) {
 	db.SetAddress("localhost:30815")
 	db.SetDatabase("materialscommons")
 
-	rprojs := newRProjects(session)
+	rprojs := newRProjects(rSession)
 
 	// Test existing
 	_, err := rprojs.ByID("9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3")
@@ -22,7 +22,7 @@ func TestRProjectsByID(t *testing.T) {
 }
 
 func TestRProjectsByName(t *testing.T) {
-	rprojs := newRProjects(session)
+	rprojs := newRProjects(rSession)
 	proj, err := rprojs.ByName("Test", "test@mc.org")
 	if err != nil {
 		t.Fatalf("Unable to find existing project 'Test', owner 'test@mc.org': %s", err)
@@ -32,7 +32,7 @@ func TestRProjectsByName(t *testing.T) {
 }
 
 func TestRProjectsFiles(t *testing.T) {
-	rprojs := newRProjects(session)
+	rprojs := newRProjects(rSession)
 	files, err := rprojs.Files("9b18dac4-caff-4dc6-9a18-ae5c6b9c9ca3", "")
 	if err != nil {
 		t.Fatalf("Unable to build list of files for existing project: %s", err)
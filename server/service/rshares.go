@@ -0,0 +1,52 @@
+package service
+
+import (
+	r "github.com/dancannon/gorethink"
+	"github.com/materials-commons/mcfs/base/model"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// rShareLinks implements the ShareLinks interface for RethinkDB
+type rShareLinks struct {
+	session func() *r.Session
+}
+
+// newRShareLinks creates a new instance of rShareLinks
+func newRShareLinks(session func() *r.Session) rShareLinks {
+	return rShareLinks{
+		session: session,
+	}
+}
+
+// ByID looks up a share link by its primary key.
+func (s rShareLinks) ByID(id string) (*schema.ShareLink, error) {
+	var link schema.ShareLink
+	if err := model.ShareLinks.Qs(s.session()).ByID(id, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// ByOwner returns all the share links created by owner, oldest first.
+func (s rShareLinks) ByOwner(owner string) ([]schema.ShareLink, error) {
+	rql := model.ShareLinks.T().GetAllByIndex("owner", owner).OrderBy("birthtime")
+	var links []schema.ShareLink
+	if err := model.ShareLinks.Qs(s.session()).Rows(rql, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Insert creates a new share link.
+func (s rShareLinks) Insert(link *schema.ShareLink) (*schema.ShareLink, error) {
+	var newLink schema.ShareLink
+	if err := model.ShareLinks.Qs(s.session()).Insert(link, &newLink); err != nil {
+		return nil, err
+	}
+	return &newLink, nil
+}
+
+// Update updates an existing share link.
+func (s rShareLinks) Update(link *schema.ShareLink) error {
+	return model.ShareLinks.Qs(s.session()).Update(link.ID, link)
+}
@@ -2,17 +2,18 @@ package service
 
 import (
 	r "github.com/dancannon/gorethink"
+	"github.com/materials-commons/mcfs/base/mcerr"
 	"github.com/materials-commons/mcfs/base/model"
 	"github.com/materials-commons/mcfs/base/schema"
 )
 
 // rUsers implements the Users interface for RethinkDB
 type rUsers struct {
-	session *r.Session
+	session func() *r.Session
 }
 
 // newRUsers creates a new instance of the rUsers for RethinkDB
-func newRUsers(session *r.Session) rUsers {
+func newRUsers(session func() *r.Session) rUsers {
 	return rUsers{
 		session: session,
 	}
@@ -21,27 +22,55 @@ func newRUsers(session *r.Session) rUsers {
 // ByID looks up users by their primary key. In RethinkDB this is the id field.
 func (u rUsers) ByID(id string) (*schema.User, error) {
 	var user schema.User
-	if err := model.Users.Qs(u.session).ByID(id, &user); err != nil {
+	if err := model.Users.Qs(u.session()).ByID(id, &user); err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
 // ByAPIKey looks up users by their apikey. In RethinkDB this is the apikey field.
+// Disabled users aren't returned.
 func (u rUsers) ByAPIKey(apikey string) (*schema.User, error) {
 	var user schema.User
+	if apikey == "" {
+		return nil, mcerr.ErrNotFound
+	}
+
 	rql := model.Users.T().GetAllByIndex("apikey", apikey)
-	if err := model.Users.Qs(u.session).Row(rql, &user); err != nil {
+	if err := model.Users.Qs(u.session()).Row(rql, &user); err != nil {
 		return nil, err
 	}
+	if user.Disabled {
+		return nil, mcerr.ErrNotFound
+	}
 	return &user, nil
 }
 
 // All returns all the users in the database.
 func (u rUsers) All() ([]schema.User, error) {
 	var users []schema.User
-	if err := model.Users.Qs(u.session).Rows(model.Users.T(), &users); err != nil {
+	if err := model.Users.Qs(u.session()).Rows(model.Users.T(), &users); err != nil {
 		return nil, err
 	}
 	return users, nil
 }
+
+// Update updates an existing user.
+func (u rUsers) Update(user *schema.User) error {
+	return model.Users.Qs(u.session()).Update(user.ID, user)
+}
+
+// Insert creates a new user. Users are identified by their email, which is
+// used as the id when none is given.
+func (u rUsers) Insert(user *schema.User) (*schema.User, error) {
+	newUser := *user
+	if newUser.ID == "" {
+		newUser.ID = newUser.Email
+	}
+
+	var inserted schema.User
+	if err := model.Users.Qs(u.session()).Insert(&newUser, &inserted); err != nil {
+		return nil, err
+	}
+	return &inserted, nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/gohandy/collections"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server"
+)
+
+// dirRow is a row in the datadirs table. The files in a directory are kept
+// in the datadir_datafiles table.
+type dirRow struct {
+	ID        string    `db:"id"`
+	Owner     string    `db:"owner"`
+	Name      string    `db:"name"`
+	Project   string    `db:"project"`
+	Parent    string    `db:"parent"`
+	Birthtime time.Time `db:"birthtime"`
+	MTime     time.Time `db:"mtime"`
+	ATime     time.Time `db:"atime"`
+	Tags      string    `db:"tags"`
+}
+
+// dir converts a row to a schema.Directory. It doesn't fill in DataFiles.
+func (row dirRow) dir() schema.Directory {
+	d := schema.Directory{
+		ID:        row.ID,
+		Owner:     row.Owner,
+		Name:      row.Name,
+		Project:   row.Project,
+		Parent:    row.Parent,
+		Birthtime: row.Birthtime,
+		MTime:     row.MTime,
+		ATime:     row.ATime,
+	}
+	fromJSON(row.Tags, &d.Tags)
+	return d
+}
+
+// sDirs implements the Dirs interface for SQL databases
+type sDirs struct {
+	db *sqlx.DB
+}
+
+// newSDirs creates a new instance of sDirs
+func newSDirs(db *sqlx.DB) sDirs {
+	return sDirs{
+		db: db,
+	}
+}
+
+// ByID looks up a dir by its primary key.
+func (d sDirs) ByID(id string) (*schema.Directory, error) {
+	return d.dir("select * from datadirs where id = ?", id)
+}
+
+// ByPath looks up a directory in a project by its path.
+func (d sDirs) ByPath(path, projectID string) (*schema.Directory, error) {
+	return d.dir("select * from datadirs where name = ? and project = ?", path, projectID)
+}
+
+// dir looks up a single directory and the files in it.
+func (d sDirs) dir(query string, args ...interface{}) (*schema.Directory, error) {
+	var row dirRow
+	if err := sqlGet(d.db, &row, query, args...); err != nil {
+		return nil, err
+	}
+
+	dir := row.dir()
+	fileIDs, err := sqlStrings(d.db, "select datafile_id from datadir_datafiles where datadir_id = ? order by position", dir.ID)
+	if err != nil {
+		return nil, err
+	}
+	dir.DataFiles = fileIDs
+	return &dir, nil
+}
+
+// Update updates an existing dir. If you are adding new files you should use the
+// AddFiles method.
+func (d sDirs) Update(dir *schema.Directory) error {
+	return withTx(d.db, func(tx sqlTx) error {
+		err := sqlExec(tx, `update datadirs set
+                owner = ?, name = ?, project = ?, parent = ?, birthtime = ?, mtime = ?, atime = ?, tags = ?
+                where id = ?`,
+			dir.Owner, dir.Name, dir.Project, dir.Parent, dir.Birthtime, dir.MTime, dir.ATime,
+			toJSON(dir.Tags), dir.ID)
+		if err != nil {
+			return err
+		}
+		return d.writeFiles(tx, dir)
+	})
+}
+
+// UpdateTags updates the tags on a dir. Projects are listed through a join, so
+// there is nothing else to update. Only the tags are written.
+func (d sDirs) UpdateTags(dir *schema.Directory) error {
+	return sqlExec(d.db, "update datadirs set tags = ? where id = ?", toJSON(dir.Tags), dir.ID)
+}
+
+// Insert creates a new dir.
+func (d sDirs) Insert(dir *schema.Directory) (*schema.Directory, error) {
+	newDir := *dir
+	if newDir.ID == "" {
+		newDir.ID = newID()
+	}
+
+	err := withTx(d.db, func(tx sqlTx) error {
+		err := sqlExec(tx, `insert into datadirs
+                (id, owner, name, project, parent, birthtime, mtime, atime, tags)
+                values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			newDir.ID, newDir.Owner, newDir.Name, newDir.Project, newDir.Parent, newDir.Birthtime,
+			newDir.MTime, newDir.ATime, toJSON(newDir.Tags))
+		if err != nil {
+			return err
+		}
+		return d.writeFiles(tx, &newDir)
+	})
+	if err != nil {
+		return nil, dbError(mcfs.ErrDBInsertFailed)
+	}
+
+	newDir.DataFiles = append([]string(nil), dir.DataFiles...)
+	return &newDir, nil
+}
+
+// AddFiles adds new file ids to a dir. Files are listed through a join, so
+// unlike RethinkDB there is no denormalized table to keep up to date.
+func (d sDirs) AddFiles(dir *schema.Directory, fileIDs ...string) error {
+	for _, id := range fileIDs {
+		if index := collections.Strings.Find(dir.DataFiles, id); index == -1 {
+			dir.DataFiles = append(dir.DataFiles, id)
+		}
+	}
+
+	if err := d.Update(dir); err != nil {
+		return dbError(mcfs.ErrDBUpdateFailed)
+	}
+	return nil
+}
+
+// RemoveFiles removes matching file ids from the directory.
+func (d sDirs) RemoveFiles(dir *schema.Directory, fileIDs ...string) error {
+	dir.DataFiles = collections.Strings.Remove(dir.DataFiles, fileIDs...)
+	return d.Update(dir)
+}
+
+// writeFiles replaces the list of files stored for a directory.
+func (d sDirs) writeFiles(tx sqlTx, dir *schema.Directory) error {
+	if err := sqlExec(tx, "delete from datadir_datafiles where datadir_id = ?", dir.ID); err != nil {
+		return err
+	}
+
+	for i, fileID := range dir.DataFiles {
+		err := sqlExec(tx, "insert into datadir_datafiles (datadir_id, datafile_id, position) values (?, ?, ?)",
+			dir.ID, fileID, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/gohandy/collections"
+	"github.com/materials-commons/mcfs/base/digest"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server"
+)
+
+// fileRow is a row in the datafiles table. The directories a file is in
+// are kept in the datafile_datadirs table.
+type fileRow struct {
+	ID              string    `db:"id"`
+	Current         bool      `db:"current"`
+	Name            string    `db:"name"`
+	Birthtime       time.Time `db:"birthtime"`
+	MTime           time.Time `db:"mtime"`
+	ATime           time.Time `db:"atime"`
+	Description     string    `db:"description"`
+	Mime            string    `db:"mime"`
+	MimeDescription string    `db:"mime_description"`
+	Owner           string    `db:"owner"`
+	Checksum        string    `db:"checksum"`
+	Checksums       string    `db:"checksums"`
+	Size            int64     `db:"size"`
+	Uploaded        int64     `db:"uploaded"`
+	Parent          string    `db:"parent"`
+	UsesID          string    `db:"usesid"`
+	Tags            string    `db:"tags"`
+}
+
+// file converts a row to a schema.File. It doesn't fill in DataDirs.
+func (row fileRow) file() schema.File {
+	f := schema.File{
+		ID:          row.ID,
+		Current:     row.Current,
+		Name:        row.Name,
+		Birthtime:   row.Birthtime,
+		MTime:       row.MTime,
+		ATime:       row.ATime,
+		Description: row.Description,
+		MediaType: schema.MediaType{
+			Mime:        row.Mime,
+			Description: row.MimeDescription,
+		},
+		Owner:    row.Owner,
+		Checksum: row.Checksum,
+		Size:     row.Size,
+		Uploaded: row.Uploaded,
+		Parent:   row.Parent,
+		UsesID:   row.UsesID,
+	}
+	fromJSON(row.Checksums, &f.Checksums)
+	fromJSON(row.Tags, &f.Tags)
+	return f
+}
+
+// matchOnColumns maps the keys MatchOn accepts to their columns.
+var matchOnColumns = map[string]string{
+	"id":       "id",
+	"name":     "name",
+	"owner":    "owner",
+	"checksum": "checksum",
+	"parent":   "parent",
+	"usesid":   "usesid",
+}
+
+// sFiles implements the Files interface for SQL databases
+type sFiles struct {
+	db *sqlx.DB
+}
+
+// newSFiles creates a new instance of sFiles
+func newSFiles(db *sqlx.DB) sFiles {
+	return sFiles{
+		db: db,
+	}
+}
+
+// ByID looks up a file by its primary key.
+func (f sFiles) ByID(id string) (*schema.File, error) {
+	files, err := f.files("select * from datafiles where id = ?", id)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(files) == 0:
+		return nil, mcerr.ErrNotFound
+	}
+	return &files[0], nil
+}
+
+// ByPath looks up a file by its name in a specific directory. It only returns the
+// current file, not hidden files.
+func (f sFiles) ByPath(name, dirID string) (*schema.File, error) {
+	files, err := f.files(`select f.* from datafiles f
+            join datafile_datadirs d on d.datafile_id = f.id
+            where f.name = ? and d.datadir_id = ? and f.current = ?`, name, dirID, true)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(files) == 0:
+		return nil, mcerr.ErrNotFound
+	}
+	return &files[0], nil
+}
+
+// ByPathPartials returns all the partials matching name in the given directory. A
+// partial is a file that has not completed uploading. A file is a partial when its
+// size is not equal to uploaded.
+func (f sFiles) ByPathPartials(name, dirID string) ([]schema.File, error) {
+	return f.files(`select f.* from datafiles f
+            join datafile_datadirs d on d.datafile_id = f.id
+            where f.name = ? and d.datadir_id = ? and f.uploaded <> f.size`, name, dirID)
+}
+
+// PartialsBefore returns all the partials across the system that have not been
+// modified since cutoff.
+func (f sFiles) PartialsBefore(cutoff time.Time) ([]schema.File, error) {
+	return f.files(`select * from datafiles
+            where current = ? and uploaded <> size and mtime < ?`, false, cutoff)
+}
+
+// ByPathChecksums looks up a file by its name, checksums and directory. A file matches
+// when the strongest hash it has in common with checksums is the same. This method
+// can return files that are only partially uploaded.
+func (f sFiles) ByPathChecksums(name, dirID string, checksums digest.Set) ([]schema.File, error) {
+	filter, args := checksumsWhere(checksums)
+	args = append([]interface{}{name, dirID}, args...)
+	files, err := f.files(`select f.* from datafiles f
+            join datafile_datadirs d on d.datafile_id = f.id
+            where f.name = ? and d.datadir_id = ? and `+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	return matchChecksums(files, checksums), nil
+}
+
+// ByChecksums looks up a file by its checksums, matching on the strongest hash in
+// common. This routine only returns the original root entry, it will not return
+// entries that are duplicates and point at the root.
+func (f sFiles) ByChecksums(checksums digest.Set) (*schema.File, error) {
+	filter, args := checksumsWhere(checksums)
+	files, err := f.files("select f.* from datafiles f where f.usesid = '' and "+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := matchChecksums(files, checksums)
+	if len(matches) == 0 {
+		return nil, mcerr.ErrNotFound
+	}
+	return &matches[0], nil
+}
+
+// checksumsWhere builds a where clause selecting the files that share any hash
+// with checksums. Like checksumsFilter, the MD5 hash is also checked against
+// the checksum column for entries that predate the checksums field.
+func checksumsWhere(checksums digest.Set) (string, []interface{}) {
+	var (
+		clauses []string
+		args    []interface{}
+	)
+
+	if md5 := checksums[digest.MD5]; md5 != "" {
+		clauses = append(clauses, "f.checksum = ?")
+		args = append(args, md5)
+	}
+
+	var algs []string
+	for _, alg := range checksums.Algorithms() {
+		algs = append(algs, "(algorithm = ? and value = ?)")
+		args = append(args, alg, checksums[alg])
+	}
+
+	if len(algs) != 0 {
+		clauses = append(clauses, "f.id in (select datafile_id from datafile_checksums where "+
+			strings.Join(algs, " or ")+")")
+	}
+
+	if len(clauses) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(clauses, " or ") + ")", args
+}
+
+// MatchOn looks up files by key.
+func (f sFiles) MatchOn(key, value string) ([]schema.File, error) {
+	column, ok := matchOnColumns[key]
+	if !ok {
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Can't match files on %s", key)
+	}
+	return f.files("select * from datafiles where "+column+" = ?", value)
+}
+
+// Hide keeps the file around, but removes it from all dependent objects. This allows
+// multiple versions of a file to exist, but only the current version to be used.
+func (f sFiles) Hide(file *schema.File) error {
+	file.Current = false
+	f.Update(file)
+	return f.removeFromDependents(file)
+}
+
+// Update updates an existing datafile. If you are adding the datafile to a directory
+// you should use the AddDirectories method. This method will not update related items.
+func (f sFiles) Update(file *schema.File) error {
+	return withTx(f.db, func(tx sqlTx) error {
+		err := sqlExec(tx, `update datafiles set
+                current = ?, name = ?, birthtime = ?, mtime = ?, atime = ?, description = ?,
+                mime = ?, mime_description = ?, owner = ?, checksum = ?, checksums = ?,
+                size = ?, uploaded = ?, parent = ?, usesid = ?, tags = ?
+                where id = ?`,
+			file.Current, file.Name, file.Birthtime, file.MTime, file.ATime, file.Description,
+			file.MediaType.Mime, file.MediaType.Description, file.Owner, file.Checksum,
+			toJSON(file.Checksums), file.Size, file.Uploaded, file.Parent, file.UsesID,
+			toJSON(file.Tags), file.ID)
+		if err != nil {
+			return err
+		}
+		return f.writeRelated(tx, file)
+	})
+}
+
+// UpdateTags updates the tags on a file. Projects are listed through a join, so
+// there is nothing else to update. Only the tags are written.
+func (f sFiles) UpdateTags(file *schema.File) error {
+	return sqlExec(f.db, "update datafiles set tags = ? where id = ?", toJSON(file.Tags), file.ID)
+}
+
+// Insert creates a new file entry. Insert updates the directory and other
+// dependent objects in the system.
+func (f sFiles) Insert(file *schema.File) (*schema.File, error) {
+	newFile, err := f.InsertEntry(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.AddDirectories(newFile, file.DataDirs...); err != nil {
+		return newFile, err
+	}
+	return newFile, nil
+}
+
+// InsertEntry creates a new file entry. It does not update any dependent
+// objects. You can use AddDirectory to add/update the directory this file
+// belongs in. This method exists to allow for the creation of new file
+// objects that will be linked into the rest of the system at a late date.
+func (f sFiles) InsertEntry(file *schema.File) (*schema.File, error) {
+	newFile := *file
+	if newFile.ID == "" {
+		newFile.ID = newID()
+	}
+
+	err := withTx(f.db, func(tx sqlTx) error {
+		err := sqlExec(tx, `insert into datafiles
+                (id, current, name, birthtime, mtime, atime, description, mime, mime_description,
+                owner, checksum, checksums, size, uploaded, parent, usesid, tags)
+                values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			newFile.ID, newFile.Current, newFile.Name, newFile.Birthtime, newFile.MTime, newFile.ATime,
+			newFile.Description, newFile.MediaType.Mime, newFile.MediaType.Description, newFile.Owner,
+			newFile.Checksum, toJSON(newFile.Checksums), newFile.Size, newFile.Uploaded, newFile.Parent,
+			newFile.UsesID, toJSON(newFile.Tags))
+		if err != nil {
+			return err
+		}
+		return f.writeRelated(tx, &newFile)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newFile.DataDirs = append([]string(nil), file.DataDirs...)
+	return &newFile, nil
+}
+
+// writeRelated replaces the checksums and directories stored for a file.
+func (f sFiles) writeRelated(tx sqlTx, file *schema.File) error {
+	if err := sqlExec(tx, "delete from datafile_checksums where datafile_id = ?", file.ID); err != nil {
+		return err
+	}
+
+	for alg, value := range file.Checksums {
+		if value == "" {
+			continue
+		}
+		err := sqlExec(tx, "insert into datafile_checksums (datafile_id, algorithm, value) values (?, ?, ?)",
+			file.ID, alg, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := sqlExec(tx, "delete from datafile_datadirs where datafile_id = ?", file.ID); err != nil {
+		return err
+	}
+
+	for i, dirID := range file.DataDirs {
+		err := sqlExec(tx, "insert into datafile_datadirs (datafile_id, datadir_id, position) values (?, ?, ?)",
+			file.ID, dirID, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete deletes a file. It updates dependent objects.
+func (f sFiles) Delete(id string) error {
+	file, err := f.ByID(id)
+	if err != nil {
+		return err
+	}
+
+	err = withTx(f.db, func(tx sqlTx) error {
+		for _, table := range []string{"datafile_checksums", "datafile_datadirs"} {
+			if err := sqlExec(tx, "delete from "+table+" where datafile_id = ?", id); err != nil {
+				return err
+			}
+		}
+		return sqlExec(tx, "delete from datafiles where id = ?", id)
+	})
+	if err != nil {
+		return err
+	}
+
+	return f.removeFromDependents(file)
+}
+
+// removeFromDependents removes the file from all the other objects in
+// the database that refer to it.
+func (f sFiles) removeFromDependents(file *schema.File) error {
+	sdirs := newSDirs(f.db)
+	var rv error
+	for _, dirID := range file.DataDirs {
+		ddir, err := sdirs.ByID(dirID)
+		if err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+			continue
+		}
+
+		if err := sdirs.RemoveFiles(ddir, file.ID); err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+		}
+	}
+
+	return rv
+}
+
+// AddDirectories adds new directories to a file. It updates all related items
+// and join tables.
+func (f sFiles) AddDirectories(file *schema.File, dirIDs ...string) error {
+	sdirs := newSDirs(f.db)
+	var rv error
+	for _, ddirID := range dirIDs {
+		if index := collections.Strings.Find(file.DataDirs, ddirID); index == -1 {
+			file.DataDirs = append(file.DataDirs, ddirID)
+		}
+		dir, err := sdirs.ByID(ddirID)
+		if err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+			continue
+		}
+		if err := sdirs.AddFiles(dir, file.ID); err != nil {
+			rv = dbError(mcfs.ErrDBRelatedUpdateFailed)
+		}
+	}
+	f.Update(file)
+	return rv
+}
+
+// files runs a query against the datafiles table and fills in the
+// directories for each file it returns.
+func (f sFiles) files(query string, args ...interface{}) ([]schema.File, error) {
+	var rows []fileRow
+	if err := sqlSelect(f.db, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	files := make([]schema.File, 0, len(rows))
+	for _, row := range rows {
+		file := row.file()
+		dirIDs, err := sqlStrings(f.db, "select datadir_id from datafile_datadirs where datafile_id = ? order by position", file.ID)
+		if err != nil {
+			return nil, err
+		}
+		file.DataDirs = dirIDs
+		files = append(files, file)
+	}
+	return files, nil
+}
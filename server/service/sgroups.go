@@ -0,0 +1,159 @@
+package service
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// groupRow is a row in the usergroups table.
+type groupRow struct {
+	ID          string    `db:"id"`
+	Owner       string    `db:"owner"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Birthtime   time.Time `db:"birthtime"`
+	MTime       time.Time `db:"mtime"`
+	Access      string    `db:"access"`
+	Users       string    `db:"users"`
+}
+
+// group converts a row to a schema.Group.
+func (row groupRow) group() schema.Group {
+	g := schema.Group{
+		ID:          row.ID,
+		Owner:       row.Owner,
+		Name:        row.Name,
+		Description: row.Description,
+		Birthtime:   row.Birthtime,
+		MTime:       row.MTime,
+		Access:      row.Access,
+	}
+	fromJSON(row.Users, &g.Users)
+	return g
+}
+
+// sGroups implements the Groups interface for SQL databases
+type sGroups struct {
+	db *sqlx.DB
+}
+
+// newSGroups creates a new instance of sGroups
+func newSGroups(db *sqlx.DB) sGroups {
+	return sGroups{
+		db: db,
+	}
+}
+
+// ByID looks up a group by its primary key.
+func (g sGroups) ByID(id string) (*schema.Group, error) {
+	var row groupRow
+	if err := sqlGet(g.db, &row, "select * from usergroups where id = ?", id); err != nil {
+		return nil, err
+	}
+	group := row.group()
+	return &group, nil
+}
+
+// ByOwner returns the groups owned by owner.
+func (g sGroups) ByOwner(owner string) ([]schema.Group, error) {
+	return g.groups("select * from usergroups where owner = ?", owner)
+}
+
+// ByUser returns the groups that user is a member of. The users are stored
+// as JSON, so the query finds the candidates and the members are checked
+// here.
+func (g sGroups) ByUser(user string) ([]schema.Group, error) {
+	candidates, err := g.groups("select * from usergroups where users like ?", "%"+toJSON(user)+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []schema.Group
+	for _, group := range candidates {
+		for _, u := range group.Users {
+			if u == user {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	return groups, nil
+}
+
+// groups returns the groups selected by query.
+func (g sGroups) groups(query string, args ...interface{}) ([]schema.Group, error) {
+	var rows []groupRow
+	if err := sqlSelect(g.db, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	groups := make([]schema.Group, len(rows))
+	for i, row := range rows {
+		groups[i] = row.group()
+	}
+	return groups, nil
+}
+
+// Update updates an existing group.
+func (g sGroups) Update(group *schema.Group) error {
+	return sqlExec(g.db, `update usergroups set
+            owner = ?, name = ?, description = ?, birthtime = ?, mtime = ?, access = ?, users = ?
+            where id = ?`,
+		group.Owner, group.Name, group.Description, group.Birthtime, group.MTime,
+		group.Access, toJSON(group.Users), group.ID)
+}
+
+// Insert creates a new group.
+func (g sGroups) Insert(group *schema.Group) (*schema.Group, error) {
+	newGroup := *group
+	if newGroup.ID == "" {
+		newGroup.ID = newID()
+	}
+
+	err := sqlExec(g.db, `insert into usergroups
+            (id, owner, name, description, birthtime, mtime, access, users)
+            values (?, ?, ?, ?, ?, ?, ?, ?)`,
+		newGroup.ID, newGroup.Owner, newGroup.Name, newGroup.Description, newGroup.Birthtime,
+		newGroup.MTime, newGroup.Access, toJSON(newGroup.Users))
+	if err != nil {
+		return nil, err
+	}
+	return &newGroup, nil
+}
+
+// Delete deletes a group.
+func (g sGroups) Delete(id string) error {
+	return sqlExec(g.db, "delete from usergroups where id = ?", id)
+}
+
+// HasAccess checks to see if the user making the request has access to the
+// particular item. Access is determined the same way as for RethinkDB: the
+// user is the owner, is in the admin group, or is in one of the owner's groups.
+func (g sGroups) HasAccess(owner, user string) bool {
+	if user == owner || g.inGroup(user, "select * from usergroups where id = ?", AdminGroup) {
+		return true
+	}
+
+	return g.inGroup(user, "select * from usergroups where owner = ?", owner)
+}
+
+// inGroup returns true if user is in any of the groups returned by query.
+func (g sGroups) inGroup(user, query string, args ...interface{}) bool {
+	var rows []groupRow
+	if err := sqlSelect(g.db, &rows, query, args...); err != nil {
+		// Some sort of error occurred, assume no access
+		return false
+	}
+
+	for _, row := range rows {
+		for _, u := range row.group().Users {
+			if u == user {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// jobRow is a row in the jobs table.
+type jobRow struct {
+	ID        string    `db:"id"`
+	FileID    string    `db:"datafile_id"`
+	Processor string    `db:"processor"`
+	Status    string    `db:"status"`
+	Attempts  int       `db:"attempts"`
+	Result    string    `db:"result"`
+	Error     string    `db:"error"`
+	Birthtime time.Time `db:"birthtime"`
+	MTime     time.Time `db:"mtime"`
+	RunAfter  time.Time `db:"run_after"`
+}
+
+// job converts a row to a schema.Job.
+func (row jobRow) job() schema.Job {
+	return schema.Job{
+		ID:        row.ID,
+		FileID:    row.FileID,
+		Processor: row.Processor,
+		Status:    row.Status,
+		Attempts:  row.Attempts,
+		Result:    row.Result,
+		Error:     row.Error,
+		Birthtime: row.Birthtime,
+		MTime:     row.MTime,
+		RunAfter:  row.RunAfter,
+	}
+}
+
+// sJobs implements the Jobs interface for SQL databases
+type sJobs struct {
+	db *sqlx.DB
+}
+
+// newSJobs creates a new instance of sJobs
+func newSJobs(db *sqlx.DB) sJobs {
+	return sJobs{
+		db: db,
+	}
+}
+
+// ByID looks up a job by its primary key.
+func (j sJobs) ByID(id string) (*schema.Job, error) {
+	var row jobRow
+	if err := sqlGet(j.db, &row, "select * from jobs where id = ?", id); err != nil {
+		return nil, err
+	}
+	job := row.job()
+	return &job, nil
+}
+
+// ByFile returns all the jobs for a datafile, oldest first.
+func (j sJobs) ByFile(fileID string) ([]schema.Job, error) {
+	return j.jobs("select * from jobs where datafile_id = ? order by birthtime", fileID)
+}
+
+// ByStatus returns all the jobs in a given state, oldest first.
+func (j sJobs) ByStatus(status string) ([]schema.Job, error) {
+	return j.jobs("select * from jobs where status = ? order by birthtime", status)
+}
+
+// jobs runs a query that returns a list of jobs.
+func (j sJobs) jobs(query string, args ...interface{}) ([]schema.Job, error) {
+	var rows []jobRow
+	if err := sqlSelect(j.db, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	jobs := make([]schema.Job, 0, len(rows))
+	for _, row := range rows {
+		jobs = append(jobs, row.job())
+	}
+	return jobs, nil
+}
+
+// Insert creates a new job.
+func (j sJobs) Insert(job *schema.Job) (*schema.Job, error) {
+	newJob := *job
+	if newJob.ID == "" {
+		newJob.ID = newID()
+	}
+
+	err := sqlExec(j.db, `insert into jobs
+            (id, datafile_id, processor, status, attempts, result, error, birthtime, mtime, run_after)
+            values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		newJob.ID, newJob.FileID, newJob.Processor, newJob.Status, newJob.Attempts, newJob.Result,
+		newJob.Error, newJob.Birthtime, newJob.MTime, newJob.RunAfter)
+	if err != nil {
+		return nil, err
+	}
+	return &newJob, nil
+}
+
+// Update updates an existing job.
+func (j sJobs) Update(job *schema.Job) error {
+	return sqlExec(j.db, `update jobs set
+            datafile_id = ?, processor = ?, status = ?, attempts = ?, result = ?, error = ?,
+            birthtime = ?, mtime = ?, run_after = ?
+            where id = ?`,
+		job.FileID, job.Processor, job.Status, job.Attempts, job.Result, job.Error, job.Birthtime,
+		job.MTime, job.RunAfter, job.ID)
+}
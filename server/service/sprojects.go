@@ -0,0 +1,224 @@
+package service
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/mcfs/base/dir"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server"
+)
+
+// projectRow is a row in the projects table.
+type projectRow struct {
+	ID          string    `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	DataDir     string    `db:"datadir"`
+	Owner       string    `db:"owner"`
+	Birthtime   time.Time `db:"birthtime"`
+	MTime       time.Time `db:"mtime"`
+	Notes       string    `db:"notes"`
+	Tags        string    `db:"tags"`
+	Reviews     string    `db:"reviews"`
+	MyTags      string    `db:"mytags"`
+}
+
+// project converts a row to a schema.Project.
+func (row projectRow) project() schema.Project {
+	p := schema.Project{
+		ID:          row.ID,
+		Name:        row.Name,
+		Description: row.Description,
+		DataDir:     row.DataDir,
+		Owner:       row.Owner,
+		Birthtime:   row.Birthtime,
+		MTime:       row.MTime,
+	}
+	fromJSON(row.Notes, &p.Notes)
+	fromJSON(row.Tags, &p.Tags)
+	fromJSON(row.Reviews, &p.Reviews)
+	fromJSON(row.MyTags, &p.MyTags)
+	return p
+}
+
+// sProjects implements the Projects interface for SQL databases
+type sProjects struct {
+	db *sqlx.DB
+}
+
+// newSProjects creates a new instance of sProjects
+func newSProjects(db *sqlx.DB) sProjects {
+	return sProjects{
+		db: db,
+	}
+}
+
+// ByID looks up a project by its primary key.
+func (p sProjects) ByID(id string) (*schema.Project, error) {
+	return p.project("select * from projects where id = ?", id)
+}
+
+// ByName looks up a project by its name and owner.
+func (p sProjects) ByName(name, owner string) (*schema.Project, error) {
+	return p.project("select * from projects where name = ? and owner = ?", name, owner)
+}
+
+// ByOwner returns the projects owned by owner, sorted by name.
+func (p sProjects) ByOwner(owner string) ([]schema.Project, error) {
+	var rows []projectRow
+	if err := sqlSelect(p.db, &rows, "select * from projects where owner = ? order by name", owner); err != nil {
+		return nil, err
+	}
+
+	projects := make([]schema.Project, len(rows))
+	for i, row := range rows {
+		projects[i] = row.project()
+	}
+	return projects, nil
+}
+
+// project looks up a single project.
+func (p sProjects) project(query string, args ...interface{}) (*schema.Project, error) {
+	var row projectRow
+	if err := sqlGet(p.db, &row, query, args...); err != nil {
+		return nil, mcerr.ErrNotFound
+	}
+	project := row.project()
+	return &project, nil
+}
+
+// Files returns a flattened list of all the files and directories in a project.
+// Each entry has its full path starting from the project. The returned list is
+// in sorted (ascending) order.
+func (p sProjects) Files(projectID, base string) ([]dir.FileInfo, error) {
+	var dirs []dirRow
+	err := sqlSelect(p.db, &dirs, `select d.* from datadirs d
+            join project2datadir p2d on p2d.datadir_id = d.id
+            where p2d.project_id = ?`, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dirs) == 0 {
+		// Nothing was found, treat as invalid project.
+		return nil, mcerr.ErrNotFound
+	}
+
+	entries := make([]schema.DataDirDenorm, 0, len(dirs))
+	for _, d := range dirs {
+		var files []fileRow
+		err := sqlSelect(p.db, &files, `select f.* from datafiles f
+                join datadir_datafiles d2f on d2f.datafile_id = f.id
+                where d2f.datadir_id = ? order by d2f.position`, d.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := schema.DataDirDenorm{
+			ID:        d.ID,
+			Name:      d.Name,
+			Owner:     d.Owner,
+			Birthtime: d.Birthtime,
+			ProjectID: projectID,
+		}
+		fromJSON(d.Tags, &entry.Tags)
+		for _, f := range files {
+			fileEntry := schema.FileEntry{
+				ID:        f.ID,
+				Name:      f.Name,
+				Owner:     f.Owner,
+				Birthtime: f.Birthtime,
+				Checksum:  f.Checksum,
+				Size:      f.Size,
+				MediaType: f.Mime,
+			}
+			fromJSON(f.Tags, &fileEntry.Tags)
+			entry.DataFiles = append(entry.DataFiles, fileEntry)
+		}
+		entries = append(entries, entry)
+	}
+
+	dirlist := &dirList{}
+	return dirlist.build(entries, base), nil
+}
+
+// Update updates an existing project.
+func (p sProjects) Update(project *schema.Project) error {
+	return sqlExec(p.db, `update projects set
+            name = ?, description = ?, datadir = ?, owner = ?, birthtime = ?, mtime = ?,
+            notes = ?, tags = ?, reviews = ?, mytags = ?
+            where id = ?`,
+		project.Name, project.Description, project.DataDir, project.Owner, project.Birthtime,
+		project.MTime, toJSON(project.Notes), toJSON(project.Tags), toJSON(project.Reviews),
+		toJSON(project.MyTags), project.ID)
+}
+
+// Insert inserts a new project. This method creates the directory object
+// for the project. If a directory id is specified in the project then
+// the method will return ErrInvalid.
+func (p sProjects) Insert(project *schema.Project) (*schema.Project, error) {
+	if project.DataDir != "" {
+		return nil, mcerr.ErrInvalid
+	}
+
+	newProject := *project
+	if newProject.ID == "" {
+		newProject.ID = newID()
+	}
+
+	err := sqlExec(p.db, `insert into projects
+            (id, name, description, datadir, owner, birthtime, mtime, notes, tags, reviews, mytags)
+            values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		newProject.ID, newProject.Name, newProject.Description, newProject.DataDir, newProject.Owner,
+		newProject.Birthtime, newProject.MTime, toJSON(newProject.Notes), toJSON(newProject.Tags),
+		toJSON(newProject.Reviews), toJSON(newProject.MyTags))
+	if err != nil {
+		return nil, dbError(mcfs.ErrDBInsertFailed)
+	}
+
+	dir := schema.NewDirectory(project.Name, project.Owner, newProject.ID, "")
+	newDir, err := newSDirs(p.db).Insert(&dir)
+	if err != nil {
+		return nil, dbError(mcfs.ErrDBRelatedUpdateFailed)
+	}
+
+	newProject.DataDir = newDir.ID
+	if err = p.Update(&newProject); err != nil {
+		return &newProject, err
+	}
+
+	err = p.AddDirectories(&newProject, newDir.ID)
+
+	return &newProject, err
+}
+
+// AddDirectories adds new directories to the project.
+func (p sProjects) AddDirectories(project *schema.Project, directoryIDs ...string) error {
+	var rverror error
+	// Add each directory to the project2datadir table. If there are any errors,
+	// remember that we saw an error, but continue on.
+	for _, dirID := range directoryIDs {
+		existing, err := sqlStrings(p.db, "select datadir_id from project2datadir where project_id = ? and datadir_id = ?",
+			project.ID, dirID)
+		switch {
+		case err != nil:
+			rverror = dbError(mcfs.ErrDBRelatedUpdateFailed)
+			continue
+		case len(existing) != 0:
+			continue
+		}
+
+		p2d := schema.Project2DataDir{
+			ProjectID: project.ID,
+			DataDirID: dirID,
+		}
+		_, err = p.db.NamedExec("insert into project2datadir (project_id, datadir_id) values (:project_id, :datadir_id)", p2d)
+		if err != nil {
+			rverror = dbError(mcfs.ErrDBRelatedUpdateFailed)
+		}
+	}
+
+	return rverror
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// migration is a single step in building the SQL schema. Migrations are
+// applied in order and never changed once released. Schema changes are made
+// by adding a new migration to the end of the list.
+type migration struct {
+	description string
+	statements  []string
+}
+
+var migrations = []migration{
+	{
+		description: "Users Schema",
+		statements: []string{
+			`create table users (
+                id          varchar(255) primary key,
+                name        text,
+                email       text,
+                fullname    text,
+                password    text,
+                apikey      varchar(255),
+                birthtime   datetime,
+                mtime       datetime,
+                avatar      text,
+                description text,
+                affiliation text,
+                homepage    text,
+                notes       text
+            )`,
+			`create index users_apikey on users (apikey)`,
+		},
+	},
+	{
+		description: "Datafiles Schema",
+		statements: []string{
+			`create table datafiles (
+                id               varchar(40) primary key,
+                current          boolean,
+                name             text,
+                birthtime        datetime,
+                mtime            datetime,
+                atime            datetime,
+                description      text,
+                mime             text,
+                mime_description text,
+                owner            varchar(255),
+                checksum         varchar(32),
+                checksums        text,
+                size             bigint,
+                uploaded         bigint,
+                parent           varchar(40),
+                usesid           varchar(40),
+                tags             text
+            )`,
+			`create index datafiles_name on datafiles (name)`,
+			`create index datafiles_checksum on datafiles (checksum)`,
+			`create index datafiles_usesid on datafiles (usesid)`,
+			`create table datafile_checksums (
+                datafile_id varchar(40),
+                algorithm   varchar(16),
+                value       varchar(128),
+                primary key (datafile_id, algorithm)
+            )`,
+			`create index datafile_checksums_value on datafile_checksums (algorithm, value)`,
+			`create table datafile_datadirs (
+                datafile_id varchar(40),
+                datadir_id  varchar(40),
+                position    integer,
+                primary key (datafile_id, datadir_id)
+            )`,
+			`create index datafile_datadirs_datadir on datafile_datadirs (datadir_id)`,
+		},
+	},
+	{
+		description: "Datadirs Schema",
+		statements: []string{
+			`create table datadirs (
+                id        varchar(40) primary key,
+                owner     varchar(255),
+                name      text,
+                project   varchar(40),
+                parent    varchar(40),
+                birthtime datetime,
+                mtime     datetime,
+                atime     datetime
+            )`,
+			`create index datadirs_project on datadirs (project)`,
+			`create table datadir_datafiles (
+                datadir_id  varchar(40),
+                datafile_id varchar(40),
+                position    integer,
+                primary key (datadir_id, datafile_id)
+            )`,
+		},
+	},
+	{
+		description: "Projects Schema",
+		statements: []string{
+			`create table projects (
+                id          varchar(40) primary key,
+                name        text,
+                description text,
+                datadir     varchar(40),
+                owner       varchar(255),
+                birthtime   datetime,
+                mtime       datetime,
+                notes       text,
+                tags        text,
+                reviews     text,
+                mytags      text
+            )`,
+			`create index projects_owner on projects (owner)`,
+			`create table project2datadir (
+                project_id varchar(40),
+                datadir_id varchar(40),
+                primary key (project_id, datadir_id)
+            )`,
+		},
+	},
+	{
+		description: "Groups Schema",
+		statements: []string{
+			`create table usergroups (
+                id          varchar(255) primary key,
+                owner       varchar(255),
+                name        text,
+                description text,
+                birthtime   datetime,
+                mtime       datetime,
+                access      varchar(40),
+                users       text
+            )`,
+			`create index usergroups_owner on usergroups (owner)`,
+		},
+	},
+	{
+		description: "Datadir Tags",
+		statements: []string{
+			`alter table datadirs add column tags text not null default ''`,
+		},
+	},
+	{
+		description: "Jobs Schema",
+		statements: []string{
+			`create table jobs (
+                id          varchar(40) primary key,
+                datafile_id varchar(40),
+                processor   varchar(255),
+                status      varchar(40),
+                attempts    integer,
+                result      text,
+                error       text,
+                birthtime   datetime,
+                mtime       datetime,
+                run_after   datetime
+            )`,
+			`create index jobs_datafile on jobs (datafile_id)`,
+			`create index jobs_status on jobs (status)`,
+		},
+	},
+	{
+		description: "Share Links Schema",
+		statements: []string{
+			`create table sharelinks (
+                id            varchar(40) primary key,
+                owner         varchar(255),
+                datafile_id   varchar(40),
+                datadir_id    varchar(40),
+                birthtime     datetime,
+                expires       datetime,
+                max_downloads integer,
+                downloads     integer,
+                revoked       boolean
+            )`,
+			`create index sharelinks_owner on sharelinks (owner)`,
+		},
+	},
+	{
+		description: "Disabled Users",
+		statements: []string{
+			`alter table users add column disabled boolean not null default false`,
+		},
+	},
+}
+
+// migrate brings the database schema up to date. The schema_version table
+// records how many migrations have been applied, so migrate can be called
+// every time the database is opened.
+func migrate(db *sqlx.DB) error {
+	if _, err := db.Exec("create table if not exists schema_version (version integer)"); err != nil {
+		return err
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRow("select max(version) from schema_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := int(version.Int64); i < len(migrations); i++ {
+		m := migrations[i]
+		err := withTx(db, func(tx sqlTx) error {
+			for _, statement := range m.statements {
+				if _, err := tx.Exec(statement); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(tx.Rebind("insert into schema_version (version) values (?)"), i+1)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed on migration %d (%s): %s", i+1, m.description, err)
+		}
+	}
+
+	return nil
+}
+
+// sqlTx is a transaction that rebinds its queries for the database's driver.
+// sqlx.Tx isn't used because it holds a copy of the sql.Tx, which breaks the
+// bookkeeping database/sql does for open transactions.
+type sqlTx struct {
+	*sql.Tx
+	db *sqlx.DB
+}
+
+// Rebind converts the ? placeholders in query to the form the driver expects.
+func (tx sqlTx) Rebind(query string) string {
+	return tx.db.Rebind(query)
+}
+
+// withTx runs fn in a transaction, committing if fn succeeds and rolling back
+// if it doesn't.
+func withTx(db *sqlx.DB, fn func(tx sqlTx) error) error {
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	tx := sqlTx{Tx: t, db: db}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqlGet runs a query that returns a single row, translating a missing row
+// into mcerr.ErrNotFound.
+func sqlGet(q sqlx.Queryer, dest interface{}, query string, args ...interface{}) error {
+	err := sqlx.Get(q, dest, rebind(q, query), args...)
+	if err == sql.ErrNoRows {
+		return mcerr.ErrNotFound
+	}
+	return err
+}
+
+// sqlSelect runs a query that returns multiple rows.
+func sqlSelect(q sqlx.Queryer, dest interface{}, query string, args ...interface{}) error {
+	return sqlx.Select(q, dest, rebind(q, query), args...)
+}
+
+// sqlStrings runs a query that returns a single string column.
+func sqlStrings(q sqlx.Queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(rebind(q, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// sqlExec runs a statement that doesn't return rows.
+func sqlExec(e sqlx.Execer, query string, args ...interface{}) error {
+	_, err := e.Exec(rebind(e, query), args...)
+	return err
+}
+
+// rebind converts the ? placeholders in query to the form the driver expects.
+func rebind(q interface{}, query string) string {
+	if b, ok := q.(interface {
+		Rebind(string) string
+	}); ok {
+		return b.Rebind(query)
+	}
+	return query
+}
+
+// newID creates a new random (version 4) UUID for a primary key.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("Unable to generate id: %s", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// toJSON encodes the fields that are stored as JSON text.
+func toJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// fromJSON decodes a field stored as JSON text. Empty fields are left untouched.
+func fromJSON(s string, v interface{}) {
+	if s != "" {
+		json.Unmarshal([]byte(s), v)
+	}
+}
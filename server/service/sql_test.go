@@ -0,0 +1,57 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/db"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// newSQLService creates a SQL backed service on a new SQLite database. The
+// returned func removes the database.
+func newSQLService(t *testing.T) (*Service, func()) {
+	dir, err := ioutil.TempDir("", "mcfs-sql")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+
+	db.SetSQL("sqlite3", filepath.Join(dir, "mcfs.db"))
+	return New(SQL), func() {
+		db.SetSQL("", "")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSQLService(t *testing.T) {
+	svc, cleanup := newSQLService(t)
+	defer cleanup()
+
+	user := schema.NewUser("test", "test@mc.org", "password", "test")
+	if _, err := svc.User.Insert(&user); err != nil {
+		t.Fatalf("Unable to insert user: %s", err)
+	}
+
+	testServiceBehavior(t, svc, user)
+}
+
+func TestSQLMigrate(t *testing.T) {
+	_, cleanup := newSQLService(t)
+	defer cleanup()
+
+	sqldb, _ := db.SQLSession()
+	if err := migrate(sqldb); err != nil {
+		t.Fatalf("Migrating an up to date database failed: %s", err)
+	}
+
+	var version int
+	if err := sqldb.QueryRow("select max(version) from schema_version").Scan(&version); err != nil {
+		t.Fatalf("Unable to read schema version: %s", err)
+	}
+
+	if version != len(migrations) {
+		t.Fatalf("Expected schema version %d, got %d", len(migrations), version)
+	}
+}
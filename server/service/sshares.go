@@ -0,0 +1,100 @@
+package service
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// shareLinkRow is a row in the sharelinks table.
+type shareLinkRow struct {
+	ID           string    `db:"id"`
+	Owner        string    `db:"owner"`
+	FileID       string    `db:"datafile_id"`
+	DirID        string    `db:"datadir_id"`
+	Birthtime    time.Time `db:"birthtime"`
+	Expires      time.Time `db:"expires"`
+	MaxDownloads int       `db:"max_downloads"`
+	Downloads    int       `db:"downloads"`
+	Revoked      bool      `db:"revoked"`
+}
+
+// shareLink converts a row to a schema.ShareLink.
+func (row shareLinkRow) shareLink() schema.ShareLink {
+	return schema.ShareLink{
+		ID:           row.ID,
+		Owner:        row.Owner,
+		FileID:       row.FileID,
+		DirID:        row.DirID,
+		Birthtime:    row.Birthtime,
+		Expires:      row.Expires,
+		MaxDownloads: row.MaxDownloads,
+		Downloads:    row.Downloads,
+		Revoked:      row.Revoked,
+	}
+}
+
+// sShareLinks implements the ShareLinks interface for SQL databases
+type sShareLinks struct {
+	db *sqlx.DB
+}
+
+// newSShareLinks creates a new instance of sShareLinks
+func newSShareLinks(db *sqlx.DB) sShareLinks {
+	return sShareLinks{
+		db: db,
+	}
+}
+
+// ByID looks up a share link by its primary key.
+func (s sShareLinks) ByID(id string) (*schema.ShareLink, error) {
+	var row shareLinkRow
+	if err := sqlGet(s.db, &row, "select * from sharelinks where id = ?", id); err != nil {
+		return nil, err
+	}
+	link := row.shareLink()
+	return &link, nil
+}
+
+// ByOwner returns all the share links created by owner, oldest first.
+func (s sShareLinks) ByOwner(owner string) ([]schema.ShareLink, error) {
+	var rows []shareLinkRow
+	if err := sqlSelect(s.db, &rows, "select * from sharelinks where owner = ? order by birthtime", owner); err != nil {
+		return nil, err
+	}
+
+	links := make([]schema.ShareLink, 0, len(rows))
+	for _, row := range rows {
+		links = append(links, row.shareLink())
+	}
+	return links, nil
+}
+
+// Insert creates a new share link.
+func (s sShareLinks) Insert(link *schema.ShareLink) (*schema.ShareLink, error) {
+	newLink := *link
+	if newLink.ID == "" {
+		newLink.ID = newID()
+	}
+
+	err := sqlExec(s.db, `insert into sharelinks
+            (id, owner, datafile_id, datadir_id, birthtime, expires, max_downloads, downloads, revoked)
+            values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		newLink.ID, newLink.Owner, newLink.FileID, newLink.DirID, newLink.Birthtime, newLink.Expires,
+		newLink.MaxDownloads, newLink.Downloads, newLink.Revoked)
+	if err != nil {
+		return nil, err
+	}
+	return &newLink, nil
+}
+
+// Update updates an existing share link.
+func (s sShareLinks) Update(link *schema.ShareLink) error {
+	return sqlExec(s.db, `update sharelinks set
+            owner = ?, datafile_id = ?, datadir_id = ?, birthtime = ?, expires = ?,
+            max_downloads = ?, downloads = ?, revoked = ?
+            where id = ?`,
+		link.Owner, link.FileID, link.DirID, link.Birthtime, link.Expires, link.MaxDownloads,
+		link.Downloads, link.Revoked, link.ID)
+}
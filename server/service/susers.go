@@ -0,0 +1,132 @@
+package service
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+)
+
+// userRow is a row in the users table.
+type userRow struct {
+	ID          string    `db:"id"`
+	Name        string    `db:"name"`
+	Email       string    `db:"email"`
+	Fullname    string    `db:"fullname"`
+	Password    string    `db:"password"`
+	APIKey      string    `db:"apikey"`
+	Birthtime   time.Time `db:"birthtime"`
+	MTime       time.Time `db:"mtime"`
+	Avatar      string    `db:"avatar"`
+	Description string    `db:"description"`
+	Affiliation string    `db:"affiliation"`
+	HomePage    string    `db:"homepage"`
+	Notes       string    `db:"notes"`
+	Disabled    bool      `db:"disabled"`
+}
+
+// user converts a row to a schema.User.
+func (row userRow) user() schema.User {
+	u := schema.User{
+		ID:          row.ID,
+		Name:        row.Name,
+		Email:       row.Email,
+		Fullname:    row.Fullname,
+		Password:    row.Password,
+		APIKey:      row.APIKey,
+		Birthtime:   row.Birthtime,
+		MTime:       row.MTime,
+		Avatar:      row.Avatar,
+		Description: row.Description,
+		Affiliation: row.Affiliation,
+		HomePage:    row.HomePage,
+		Disabled:    row.Disabled,
+	}
+	fromJSON(row.Notes, &u.Notes)
+	return u
+}
+
+// sUsers implements the Users interface for SQL databases
+type sUsers struct {
+	db *sqlx.DB
+}
+
+// newSUsers creates a new instance of sUsers
+func newSUsers(db *sqlx.DB) sUsers {
+	return sUsers{
+		db: db,
+	}
+}
+
+// ByID looks up users by their primary key.
+func (u sUsers) ByID(id string) (*schema.User, error) {
+	var row userRow
+	if err := sqlGet(u.db, &row, "select * from users where id = ?", id); err != nil {
+		return nil, err
+	}
+	user := row.user()
+	return &user, nil
+}
+
+// ByAPIKey looks up users by their apikey. Disabled users aren't returned.
+func (u sUsers) ByAPIKey(apikey string) (*schema.User, error) {
+	if apikey == "" {
+		return nil, mcerr.ErrNotFound
+	}
+
+	var row userRow
+	if err := sqlGet(u.db, &row, "select * from users where apikey = ?", apikey); err != nil {
+		return nil, err
+	}
+	if row.Disabled {
+		return nil, mcerr.ErrNotFound
+	}
+	user := row.user()
+	return &user, nil
+}
+
+// All returns all the users in the database.
+func (u sUsers) All() ([]schema.User, error) {
+	var rows []userRow
+	if err := sqlSelect(u.db, &rows, "select * from users order by id"); err != nil {
+		return nil, err
+	}
+
+	users := make([]schema.User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, row.user())
+	}
+	return users, nil
+}
+
+// Update updates an existing user.
+func (u sUsers) Update(user *schema.User) error {
+	return sqlExec(u.db, `update users set
+            name = ?, email = ?, fullname = ?, password = ?, apikey = ?, birthtime = ?, mtime = ?,
+            avatar = ?, description = ?, affiliation = ?, homepage = ?, notes = ?, disabled = ?
+            where id = ?`,
+		user.Name, user.Email, user.Fullname, user.Password, user.APIKey, user.Birthtime, user.MTime,
+		user.Avatar, user.Description, user.Affiliation, user.HomePage, toJSON(user.Notes), user.Disabled,
+		user.ID)
+}
+
+// Insert creates a new user. Users are identified by their email, which is
+// used as the id when none is given.
+func (u sUsers) Insert(user *schema.User) (*schema.User, error) {
+	newUser := *user
+	if newUser.ID == "" {
+		newUser.ID = newUser.Email
+	}
+
+	err := sqlExec(u.db, `insert into users
+            (id, name, email, fullname, password, apikey, birthtime, mtime, avatar, description, affiliation, homepage, notes, disabled)
+            values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		newUser.ID, newUser.Name, newUser.Email, newUser.Fullname, newUser.Password, newUser.APIKey, newUser.Birthtime,
+		newUser.MTime, newUser.Avatar, newUser.Description, newUser.Affiliation, newUser.HomePage, toJSON(newUser.Notes),
+		newUser.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	return &newUser, nil
+}
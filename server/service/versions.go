@@ -0,0 +1,28 @@
+package service
+
+import "github.com/materials-commons/mcfs/base/schema"
+
+// Versions returns a file followed by the versions it replaced, newest first.
+// Each new version of a file points at the version it replaced through its
+// Parent field, so the history is found by following the Parent links back
+// to the first version. The walk stops early when a version has been deleted
+// or the links loop back on themselves.
+func Versions(files Files, file *schema.File) []schema.File {
+	var versions []schema.File
+	seen := make(map[string]bool)
+	for file != nil && !seen[file.ID] {
+		seen[file.ID] = true
+		versions = append(versions, *file)
+		if file.Parent == "" {
+			break
+		}
+
+		var err error
+		if file, err = files.ByID(file.Parent); err != nil {
+			// The rest of the history has been deleted.
+			break
+		}
+	}
+
+	return versions
+}
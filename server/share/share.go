@@ -0,0 +1,279 @@
+/*
+Package share creates and checks signed share links. A share link lets anyone
+holding its url download a file, or the files in a directory, without an
+apikey. The url carries the link id, its expiry and an HMAC signature of both,
+so neither can be altered:
+
+	/datafiles/static/<file-id>?share=<link-id>&expires=<unix-time>&sig=<hex>
+	/datadirs/archive/<dir-id>?share=<link-id>&expires=<unix-time>&sig=<hex>
+
+A directory link also works for every file and directory below the shared
+directory. Links are stored so their owner can list and revoke them, and so
+downloads can be counted against a link's limit.
+*/
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+const (
+	// DefaultDuration is how long a link lasts when no expiry is given.
+	DefaultDuration = 7 * 24 * time.Hour
+
+	// MaxDuration is the longest a link can last.
+	MaxDuration = 90 * 24 * time.Hour
+)
+
+// Query parameters in a share link url.
+const (
+	LinkParam    = "share"
+	ExpiresParam = "expires"
+	SigParam     = "sig"
+)
+
+// Use is how a request uses a share link.
+type Use int
+
+const (
+	// Download starts a download, which counts against the link's limit.
+	Download Use = iota
+
+	// Resume reads part of a file with a range request that doesn't start
+	// at the beginning. It continues a download, so it isn't counted, but
+	// a limited link must have been used for a download first.
+	Resume
+
+	// Peek reads only the headers, as a HEAD request does. It isn't counted.
+	Peek
+)
+
+// RequestUse returns how req uses a share link. Only GET requests starting at
+// the beginning of the file are counted as downloads.
+func RequestUse(req *http.Request) Use {
+	switch rng := req.Header.Get("Range"); {
+	case req.Method == "HEAD":
+		return Peek
+	case rng != "" && !strings.HasPrefix(rng, "bytes=0-"):
+		return Resume
+	default:
+		return Download
+	}
+}
+
+// Links creates and checks share links.
+type Links struct {
+	service *service.Service
+	secret  []byte
+
+	// mutex serializes checking and counting downloads, so a link's
+	// download limit can't be exceeded by concurrent requests.
+	mutex sync.Mutex
+}
+
+// New creates a new Links that signs links with secret. When secret is empty
+// a random secret is used, so links stop working when the server restarts.
+func New(svc *service.Service, secret []byte) *Links {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(fmt.Sprintf("Unable to create a share link secret: %s", err))
+		}
+	}
+
+	return &Links{
+		service: svc,
+		secret:  secret,
+	}
+}
+
+// Create creates a link to a file or a directory for owner, who must have
+// access to it. Exactly one of fileID and dirID must be set. A zero duration
+// uses DefaultDuration, and a zero maxDownloads allows any number of downloads.
+func (l *Links) Create(owner, fileID, dirID string, duration time.Duration, maxDownloads int) (*schema.ShareLink, error) {
+	switch {
+	case (fileID == "") == (dirID == ""):
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "A share link is for either a file or a directory")
+	case duration < 0 || duration > MaxDuration:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "A share link can last at most %s", MaxDuration)
+	case maxDownloads < 0:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Bad download limit %d", maxDownloads)
+	case duration == 0:
+		duration = DefaultDuration
+	}
+
+	var itemOwner string
+	if fileID != "" {
+		file, err := l.service.File.ByID(fileID)
+		if err != nil {
+			return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown file %s", fileID)
+		}
+		itemOwner = file.Owner
+	} else {
+		datadir, err := l.service.Dir.ByID(dirID)
+		if err != nil {
+			return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown directory %s", dirID)
+		}
+		itemOwner = datadir.Owner
+	}
+
+	if !l.service.Group.HasAccess(itemOwner, owner) {
+		return nil, mcerr.Errorf(mcerr.ErrNoAccess, "%s can't share items owned by %s", owner, itemOwner)
+	}
+
+	// Expiry times are sent in seconds, so drop anything finer.
+	expires := time.Now().Add(duration).Truncate(time.Second)
+	link := schema.NewShareLink(owner, fileID, dirID, expires, maxDownloads)
+	return l.service.Share.Insert(&link)
+}
+
+// List returns the links created by owner, oldest first.
+func (l *Links) List(owner string) ([]schema.ShareLink, error) {
+	return l.service.Share.ByOwner(owner)
+}
+
+// Revoke stops a link from being used. Only the link's owner can revoke it.
+func (l *Links) Revoke(owner, id string) (*schema.ShareLink, error) {
+	link, err := l.service.Share.ByID(id)
+	switch {
+	case err != nil:
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "Unknown share link %s", id)
+	case link.Owner != owner:
+		return nil, mcerr.Errorf(mcerr.ErrNoAccess, "Share link %s belongs to another user", id)
+	case link.Revoked:
+		return link, nil
+	}
+
+	link.Revoked = true
+	if err := l.service.Share.Update(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// URL returns the path and signed query for a link.
+func (l *Links) URL(link *schema.ShareLink) string {
+	path := "/datafiles/static/" + link.FileID
+	if link.DirID != "" {
+		path = "/datadirs/archive/" + link.DirID
+	}
+
+	expires := strconv.FormatInt(link.Expires.Unix(), 10)
+	values := url.Values{}
+	values.Set(LinkParam, link.ID)
+	values.Set(ExpiresParam, expires)
+	values.Set(SigParam, hex.EncodeToString(l.sign(link.ID, expires)))
+	return path + "?" + values.Encode()
+}
+
+// sign returns the signature of a link's id and expiry.
+func (l *Links) sign(id, expires string) []byte {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%s", id, expires)
+	return mac.Sum(nil)
+}
+
+// AuthorizeFile checks that the link in values allows downloading file, and
+// counts the download when use is Download.
+func (l *Links) AuthorizeFile(values url.Values, file *schema.File, use Use) error {
+	return l.authorize(values, use, func(link *schema.ShareLink) bool {
+		if link.FileID != "" {
+			return link.FileID == file.ID
+		}
+
+		for _, dirID := range file.DataDirs {
+			if l.inDir(dirID, link.DirID) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AuthorizeDir checks that the link in values allows downloading the directory
+// dirID, and counts the download when use is Download.
+func (l *Links) AuthorizeDir(values url.Values, dirID string, use Use) error {
+	return l.authorize(values, use, func(link *schema.ShareLink) bool {
+		return link.DirID != "" && l.inDir(dirID, link.DirID)
+	})
+}
+
+// authorize checks the signature, expiry, state and download count of the link
+// in values, and that covers accepts it. A Download is counted when the link
+// can be used.
+func (l *Links) authorize(values url.Values, use Use, covers func(link *schema.ShareLink) bool) error {
+	id, expires := values.Get(LinkParam), values.Get(ExpiresParam)
+	sig, err := hex.DecodeString(values.Get(SigParam))
+	if err != nil || !hmac.Equal(sig, l.sign(id, expires)) {
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Bad signature for share link %s", id)
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Share link %s has expired", id)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	link, err := l.service.Share.ByID(id)
+	switch {
+	case err != nil:
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Unknown share link %s", id)
+	case link.Revoked:
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Share link %s was revoked", id)
+	case link.Expires.Unix() != unix:
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Share link %s has the wrong expiry", id)
+	case use == Download && link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads:
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Share link %s has been used %d times", id, link.Downloads)
+	case use == Resume && link.MaxDownloads > 0 && link.Downloads == 0:
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Share link %s hasn't started a download to resume", id)
+	case !covers(link):
+		return mcerr.Errorf(mcerr.ErrNoAccess, "Share link %s doesn't cover the request", id)
+	case use != Download:
+		return nil
+	}
+
+	link.Downloads++
+	return l.service.Share.Update(link)
+}
+
+// inDir returns true if the directory dirID is the directory rootID or below it.
+func (l *Links) inDir(dirID, rootID string) bool {
+	if dirID == rootID {
+		return true
+	}
+
+	datadir, err := l.service.Dir.ByID(dirID)
+	if err != nil {
+		return false
+	}
+
+	root, err := l.service.Dir.ByID(rootID)
+	if err != nil {
+		return false
+	}
+
+	return datadir.Project == root.Project && strings.HasPrefix(toSlash(datadir.Name), toSlash(root.Name)+"/")
+}
+
+// toSlash turns the path separators in a directory name into /. Names are
+// stored as they were sent by the client, which may have been running on
+// Windows.
+func toSlash(p string) string {
+	return strings.Replace(p, "\\", "/", -1)
+}
@@ -0,0 +1,225 @@
+package share
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/schema"
+	"github.com/materials-commons/mcfs/server/service"
+)
+
+// testShare is a project with a file in a nested directory:
+//
+//	Proj/top.txt
+//	Proj/a/b/x.txt
+type testShare struct {
+	svc   *service.Service
+	links *Links
+	top   *schema.File
+	x     *schema.File
+	aID   string
+	bID   string
+}
+
+func newTestShare(t *testing.T) *testShare {
+	ts := &testShare{
+		svc: service.NewMemory(
+			schema.NewUser("test", "test@mc.org", "", "testkey"),
+			schema.NewUser("test2", "test2@mc.org", "", "test2key"),
+		),
+	}
+	ts.links = New(ts.svc, []byte("secret"))
+
+	proj := schema.NewProject("Proj", "", "test@mc.org")
+	p, err := ts.svc.Project.Insert(&proj)
+	if err != nil {
+		t.Fatalf("Unable to create project: %s", err)
+	}
+
+	ts.aID = ts.addDir(p, "Proj/a", p.DataDir)
+	ts.bID = ts.addDir(p, "Proj/a/b", ts.aID)
+	ts.top = ts.addFile("top.txt", p.DataDir)
+	ts.x = ts.addFile("x.txt", ts.bID)
+	return ts
+}
+
+func (ts *testShare) addDir(p *schema.Project, name, parent string) string {
+	d := schema.NewDirectory(name, p.Owner, p.ID, parent)
+	datadir, _ := ts.svc.Dir.Insert(&d)
+	ts.svc.Project.AddDirectories(p, datadir.ID)
+	return datadir.ID
+}
+
+func (ts *testShare) addFile(name, dirID string) *schema.File {
+	file := schema.NewFile(name, "test@mc.org")
+	file.DataDirs = []string{dirID}
+	f, _ := ts.svc.File.Insert(&file)
+	return f
+}
+
+// query returns the signed query of a link's url.
+func (ts *testShare) query(link *schema.ShareLink) url.Values {
+	u, _ := url.Parse(ts.links.URL(link))
+	return u.Query()
+}
+
+func TestCreate(t *testing.T) {
+	ts := newTestShare(t)
+
+	tests := []struct {
+		owner, fileID, dirID string
+		duration             time.Duration
+		maxDownloads         int
+		ok                   bool
+		comment              string
+	}{
+		{"test@mc.org", ts.x.ID, "", 0, 0, true, "File link"},
+		{"test@mc.org", "", ts.aID, time.Hour, 2, true, "Directory link"},
+		{"test@mc.org", ts.x.ID, ts.aID, 0, 0, false, "File and directory"},
+		{"test@mc.org", "", "", 0, 0, false, "Nothing shared"},
+		{"test@mc.org", ts.x.ID, "", MaxDuration + time.Hour, 0, false, "Too long"},
+		{"test@mc.org", ts.x.ID, "", 0, -1, false, "Bad limit"},
+		{"test@mc.org", "no-such-file", "", 0, 0, false, "Unknown file"},
+		{"test2@mc.org", ts.x.ID, "", 0, 0, false, "No access"},
+	}
+
+	for _, test := range tests {
+		link, err := ts.links.Create(test.owner, test.fileID, test.dirID, test.duration, test.maxDownloads)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%s: unexpected error %s", test.comment, err)
+		case !test.ok && err == nil:
+			t.Errorf("%s: expected an error, got %#v", test.comment, link)
+		}
+	}
+
+	link, _ := ts.links.Create("test@mc.org", ts.x.ID, "", 0, 0)
+	if expires := link.Expires.Sub(time.Now()); expires < DefaultDuration-time.Minute || expires > DefaultDuration {
+		t.Errorf("Expected the default duration, link expires in %s", expires)
+	}
+	if u := ts.links.URL(link); !strings.HasPrefix(u, "/datafiles/static/"+ts.x.ID+"?") {
+		t.Errorf("Wrong url for file link %s", u)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	ts := newTestShare(t)
+
+	fileLink, _ := ts.links.Create("test@mc.org", ts.x.ID, "", 0, 0)
+	if err := ts.links.AuthorizeFile(ts.query(fileLink), ts.x, Download); err != nil {
+		t.Fatalf("File link refused: %s", err)
+	}
+	if err := ts.links.AuthorizeFile(ts.query(fileLink), ts.top, Download); err == nil {
+		t.Errorf("File link accepted for a different file")
+	}
+	if err := ts.links.AuthorizeDir(ts.query(fileLink), ts.bID, Download); err == nil {
+		t.Errorf("File link accepted for a directory")
+	}
+
+	dirLink, _ := ts.links.Create("test@mc.org", "", ts.aID, 0, 0)
+	if err := ts.links.AuthorizeFile(ts.query(dirLink), ts.x, Download); err != nil {
+		t.Errorf("Directory link refused for a file below it: %s", err)
+	}
+	if err := ts.links.AuthorizeDir(ts.query(dirLink), ts.bID, Download); err != nil {
+		t.Errorf("Directory link refused for a directory below it: %s", err)
+	}
+	if err := ts.links.AuthorizeFile(ts.query(dirLink), ts.top, Download); err == nil {
+		t.Errorf("Directory link accepted for a file outside it")
+	}
+
+	// Altering any part of the url invalidates it.
+	q := ts.query(fileLink)
+	q.Set(ExpiresParam, q.Get(ExpiresParam)+"0")
+	if err := ts.links.AuthorizeFile(q, ts.x, Download); err == nil {
+		t.Errorf("Link with an altered expiry accepted")
+	}
+
+	q = ts.query(fileLink)
+	q.Set(SigParam, strings.Repeat("0", 64))
+	if err := ts.links.AuthorizeFile(q, ts.x, Download); err == nil {
+		t.Errorf("Link with a bad signature accepted")
+	}
+
+	other := New(ts.svc, []byte("another secret"))
+	if err := other.AuthorizeFile(ts.query(fileLink), ts.x, Download); err == nil {
+		t.Errorf("Link signed with a different secret accepted")
+	}
+
+	// Expired links are refused.
+	expired := schema.NewShareLink("test@mc.org", ts.x.ID, "", time.Now().Add(-time.Minute).Truncate(time.Second), 0)
+	e, _ := ts.svc.Share.Insert(&expired)
+	if err := ts.links.AuthorizeFile(ts.query(e), ts.x, Download); err == nil {
+		t.Errorf("Expired link accepted")
+	}
+}
+
+func TestDownloadLimitAndRevoke(t *testing.T) {
+	ts := newTestShare(t)
+
+	link, _ := ts.links.Create("test@mc.org", ts.x.ID, "", 0, 2)
+	q := ts.query(link)
+
+	// Only downloads are counted, and a download must be started before it
+	// can be resumed.
+	if err := ts.links.AuthorizeFile(q, ts.x, Peek); err != nil {
+		t.Fatalf("Peek refused: %s", err)
+	}
+	if err := ts.links.AuthorizeFile(q, ts.x, Resume); err == nil {
+		t.Errorf("Resume accepted before a download was started")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ts.links.AuthorizeFile(q, ts.x, Download); err != nil {
+			t.Fatalf("Download %d refused: %s", i+1, err)
+		}
+	}
+	if err := ts.links.AuthorizeFile(q, ts.x, Download); err == nil {
+		t.Errorf("Download past the limit accepted")
+	}
+	if err := ts.links.AuthorizeFile(q, ts.x, Resume); err != nil {
+		t.Errorf("Resuming the last download refused: %s", err)
+	}
+
+	links, _ := ts.links.List("test@mc.org")
+	if len(links) != 1 || links[0].Downloads != 2 {
+		t.Fatalf("Expected one link used twice, got %#v", links)
+	}
+
+	unlimited, _ := ts.links.Create("test@mc.org", ts.x.ID, "", 0, 0)
+	if _, err := ts.links.Revoke("test2@mc.org", unlimited.ID); err == nil {
+		t.Errorf("Another user revoked the link")
+	}
+	if _, err := ts.links.Revoke("test@mc.org", unlimited.ID); err != nil {
+		t.Fatalf("Unable to revoke link: %s", err)
+	}
+	if err := ts.links.AuthorizeFile(ts.query(unlimited), ts.x, Download); err == nil {
+		t.Errorf("Revoked link accepted")
+	}
+}
+
+func TestRequestUse(t *testing.T) {
+	tests := []struct {
+		method, rng string
+		use         Use
+	}{
+		{"GET", "", Download},
+		{"GET", "bytes=0-", Download},
+		{"GET", "bytes=0-99", Download},
+		{"GET", "bytes=100-", Resume},
+		{"GET", "bytes=-100", Resume},
+		{"HEAD", "", Peek},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, "/datafiles/static/id", nil)
+		if test.rng != "" {
+			req.Header.Set("Range", test.rng)
+		}
+		if use := RequestUse(req); use != test.use {
+			t.Errorf("%s with range %q: expected use %d, got %d", test.method, test.rng, test.use, use)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+
+	"github.com/materials-commons/mcfs/base/cdc"
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// Manifest lists, in order, the chunks that make up a file.
+type Manifest struct {
+	Chunks []cdc.Chunk
+}
+
+// Size returns the size of the file the manifest describes.
+func (m Manifest) Size() int64 {
+	var size int64
+	for _, chunk := range m.Chunks {
+		size += chunk.Size
+	}
+	return size
+}
+
+// ChunkStore adds chunk level deduplication on top of another Store. A file can
+// be stored either as a single object in the underlying store, or as a manifest
+// of chunks. Chunks are kept in the underlying store under their hash, so a
+// chunk shared by many files is only stored once. Reading a file stored as a
+// manifest reassembles it from its chunks, so readers don't need to know how a
+// file was stored.
+//
+// Each chunk has a count of the manifests that use it. When a manifest is
+// deleted or replaced the counts of its chunks go down, and chunks no manifest
+// uses anymore are removed. Chunks stored before they were counted have no
+// count, so they are never removed.
+type ChunkStore struct {
+	Store
+
+	// mutex serializes changes to manifests and chunk counts.
+	mutex sync.Mutex
+
+	// external is set when another process owns the chunk counts. Changes
+	// to manifests are refused.
+	external bool
+}
+
+// NewChunked creates a new ChunkStore on top of s. The chunk counts are only
+// kept consistent when a single ChunkStore changes the manifests in s.
+func NewChunked(s Store) *ChunkStore {
+	return &ChunkStore{Store: s}
+}
+
+// NewChunkedExternal creates a ChunkStore on top of s for use alongside a
+// server that owns s. Files stored as manifests can be read, but writing,
+// appending to, or deleting them fails.
+func NewChunkedExternal(s Store) *ChunkStore {
+	return &ChunkStore{Store: s, external: true}
+}
+
+// errExternal is returned when an external ChunkStore is asked to change the
+// manifest for id.
+func errExternal(id string) error {
+	return mcerr.Errorf(mcerr.ErrInvalid, "%s is stored as chunks, only the server can change it", id)
+}
+
+// chunkID returns the id of the object holding a chunk.
+func chunkID(hash string) string {
+	return "chunk-" + hash
+}
+
+// manifestID returns the id of the object holding the manifest for a file.
+func manifestID(id string) string {
+	return id + ".manifest"
+}
+
+// refsID returns the id of the object holding the number of manifests that
+// use a chunk.
+func refsID(hash string) string {
+	return chunkID(hash) + ".refs"
+}
+
+// hashes returns the hash of each distinct chunk in the manifest.
+func (m Manifest) hashes() []string {
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, chunk := range m.Chunks {
+		if !seen[chunk.Hash] {
+			seen[chunk.Hash] = true
+			hashes = append(hashes, chunk.Hash)
+		}
+	}
+	return hashes
+}
+
+// HasChunk returns true if the chunk is already stored.
+func (s *ChunkStore) HasChunk(chunk cdc.Chunk) bool {
+	info, err := s.Store.Stat(chunkID(chunk.Hash))
+	return err == nil && info.Size == chunk.Size
+}
+
+// MissingChunks returns the indexes of the chunks that aren't stored yet.
+func (s *ChunkStore) MissingChunks(chunks []cdc.Chunk) []int {
+	var missing []int
+	for i, chunk := range chunks {
+		if !s.HasChunk(chunk) {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// PutChunk stores a chunk after checking its bytes match its hash.
+func (s *ChunkStore) PutChunk(hash string, data []byte) error {
+	if cdc.Sum(data) != hash {
+		return mcerr.Errorf(mcerr.ErrInvalid, "Chunk bytes don't match hash %s", hash)
+	}
+
+	if s.HasChunk(cdc.Chunk{Hash: hash, Size: int64(len(data))}) {
+		return nil
+	}
+
+	return s.put(chunkID(hash), data)
+}
+
+// PutManifest stores the manifest for a file. All the chunks in the manifest
+// must already be stored. Any bytes stored for the file as a single object
+// are removed, as are the chunks of a manifest it replaces that no other
+// manifest uses.
+func (s *ChunkStore) PutManifest(id string, m Manifest) error {
+	if s.external {
+		return errExternal(id)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, err := s.Manifest(id)
+	switch {
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		old = Manifest{}
+	case err != nil:
+		return err
+	}
+
+	if missing := s.MissingChunks(m.Chunks); len(missing) != 0 {
+		return mcerr.Errorf(mcerr.ErrInvalid, "Manifest for %s has %d missing chunks", id, len(missing))
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// Count the new manifest's chunks before releasing the old ones, so the
+	// chunks they share are never removed.
+	if err := s.addRefs(m.hashes(), 1); err != nil {
+		return err
+	}
+
+	if err := s.put(manifestID(id), data); err != nil {
+		s.addRefs(m.hashes(), -1)
+		return err
+	}
+
+	if err := s.Store.Delete(id); err != nil && !mcerr.Is(err, mcerr.ErrNotFound) {
+		return err
+	}
+
+	return s.addRefs(old.hashes(), -1)
+}
+
+// refs returns the number of manifests that use a chunk.
+func (s *ChunkStore) refs(hash string) (int, error) {
+	r, err := s.Store.ReadRange(refsID(hash), 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(data))
+}
+
+// addRefs adds delta to the number of manifests that use each chunk in hashes.
+// Chunks that are no longer used are removed. The caller must hold the mutex.
+func (s *ChunkStore) addRefs(hashes []string, delta int) error {
+	for _, hash := range hashes {
+		count, err := s.refs(hash)
+		switch {
+		case mcerr.Is(err, mcerr.ErrNotFound) && delta < 0:
+			// The chunk was stored before chunks were counted, so
+			// there may be other manifests using it.
+			continue
+		case mcerr.Is(err, mcerr.ErrNotFound):
+			count = 0
+		case err != nil:
+			return err
+		}
+
+		if count += delta; count > 0 {
+			if err := s.put(refsID(hash), []byte(strconv.Itoa(count))); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.Store.Delete(chunkID(hash)); err != nil && !mcerr.Is(err, mcerr.ErrNotFound) {
+			return err
+		}
+		if err := s.Store.Delete(refsID(hash)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Manifest returns the manifest for a file. It returns mcerr.ErrNotFound if the
+// file isn't stored as a manifest.
+func (s *ChunkStore) Manifest(id string) (Manifest, error) {
+	var m Manifest
+	r, err := s.Store.ReadRange(manifestID(id), 0, -1)
+	if err != nil {
+		return m, err
+	}
+	defer r.Close()
+
+	err = json.NewDecoder(r).Decode(&m)
+	return m, err
+}
+
+// put writes an object in a single call.
+func (s *ChunkStore) put(id string, data []byte) error {
+	w, err := s.Store.Append(id, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// Append opens a file for writing as a single object. Writing from the start
+// of a file stored as a manifest replaces the manifest. Files stored as a
+// manifest can't be appended to.
+func (s *ChunkStore) Append(id string, offset int64) (io.WriteCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, err := s.Manifest(id)
+	switch {
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		return s.Store.Append(id, offset)
+	case err != nil:
+		return nil, err
+	case offset != 0:
+		return nil, mcerr.Errorf(mcerr.ErrInvalid, "Can't append at %d to %s, it is stored as %d chunks", offset, id, len(m.Chunks))
+	case s.external:
+		return nil, errExternal(id)
+	}
+
+	if err := s.Store.Delete(manifestID(id)); err != nil {
+		return nil, err
+	}
+
+	if err := s.addRefs(m.hashes(), -1); err != nil {
+		return nil, err
+	}
+	return s.Store.Append(id, 0)
+}
+
+// ReadRange reads a range of a file, reassembling it from its chunks if it is
+// stored as a manifest.
+func (s *ChunkStore) ReadRange(id string, offset, length int64) (io.ReadCloser, error) {
+	m, err := s.Manifest(id)
+	switch {
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		return s.Store.ReadRange(id, offset, length)
+	case err != nil:
+		return nil, err
+	}
+
+	r := &chunkReader{store: s.Store}
+	var start int64
+	for _, chunk := range m.Chunks {
+		end := start + chunk.Size
+		if length >= 0 && start >= offset+length {
+			break
+		}
+
+		if end > offset {
+			from := offset - start
+			if from < 0 {
+				from = 0
+			}
+
+			n := chunk.Size - from
+			if length >= 0 && start+from+n > offset+length {
+				n = offset + length - start - from
+			}
+			r.ranges = append(r.ranges, chunkRange{id: chunkID(chunk.Hash), offset: from, length: n})
+		}
+		start = end
+	}
+
+	return r, nil
+}
+
+// Stat returns information on a file. The size of a file stored as a manifest is
+// the size of all its chunks.
+func (s *ChunkStore) Stat(id string) (Info, error) {
+	m, err := s.Manifest(id)
+	switch {
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		return s.Store.Stat(id)
+	case err != nil:
+		return Info{}, err
+	}
+
+	info, err := s.Store.Stat(manifestID(id))
+	if err != nil {
+		return Info{}, err
+	}
+
+	info.ID = id
+	info.Size = m.Size()
+	return info, nil
+}
+
+// Delete removes a file, or its manifest along with the chunks no other
+// manifest uses.
+func (s *ChunkStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, err := s.Manifest(id)
+	switch {
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		return s.Store.Delete(id)
+	case err != nil:
+		return err
+	case s.external:
+		return errExternal(id)
+	}
+
+	if err := s.Store.Delete(manifestID(id)); err != nil {
+		return err
+	}
+	return s.addRefs(m.hashes(), -1)
+}
+
+// Hash computes the hash of a file, reassembling it if needed.
+func (s *ChunkStore) Hash(id string, h hash.Hash) (string, error) {
+	r, err := s.ReadRange(id, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// chunkRange is the part of a chunk that a chunkReader needs to read.
+type chunkRange struct {
+	id     string
+	offset int64
+	length int64
+}
+
+// chunkReader reads a sequence of chunk ranges, opening each in turn.
+type chunkReader struct {
+	store  Store
+	ranges []chunkRange
+	r      io.ReadCloser
+}
+
+// Read implements io.Reader.
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.r == nil {
+			if len(r.ranges) == 0 {
+				return 0, io.EOF
+			}
+
+			next := r.ranges[0]
+			r.ranges = r.ranges[1:]
+			if next.length == 0 {
+				r.r = ioutil.NopCloser(bytes.NewReader(nil))
+			} else {
+				rc, err := r.store.ReadRange(next.id, next.offset, next.length)
+				if err != nil {
+					return 0, err
+				}
+				r.r = rc
+			}
+		}
+
+		n, err := r.r.Read(p)
+		if err == io.EOF {
+			r.r.Close()
+			r.r = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close implements io.Closer.
+func (r *chunkReader) Close() error {
+	if r.r != nil {
+		return r.r.Close()
+	}
+	return nil
+}
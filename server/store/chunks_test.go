@@ -0,0 +1,203 @@
+package store
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/cdc"
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+func TestChunkStoreWithoutManifests(t *testing.T) {
+	testStore(t, NewChunked(NewMemory()))
+}
+
+func TestChunkStoreManifest(t *testing.T) {
+	s := NewChunked(NewMemory())
+	pieces := []string{"hello", " ", "chunked", " world"}
+
+	var m Manifest
+	for _, piece := range pieces {
+		m.Chunks = append(m.Chunks, cdc.Chunk{Hash: cdc.Sum([]byte(piece)), Size: int64(len(piece))})
+	}
+
+	if missing := s.MissingChunks(m.Chunks); len(missing) != len(pieces) {
+		t.Fatalf("Expected all chunks to be missing, got %v", missing)
+	}
+
+	if err := s.PutManifest(testID, m); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Expected manifest with missing chunks to fail, got %v", err)
+	}
+
+	if err := s.PutChunk(m.Chunks[0].Hash, []byte("bad")); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Expected chunk with wrong bytes to fail, got %v", err)
+	}
+
+	for i, piece := range pieces {
+		if err := s.PutChunk(m.Chunks[i].Hash, []byte(piece)); err != nil {
+			t.Fatalf("PutChunk failed: %s", err)
+		}
+	}
+
+	// A partial upload of the same file as a single object is replaced by the manifest.
+	write(t, s, 0, "hel")
+	if err := s.PutManifest(testID, m); err != nil {
+		t.Fatalf("PutManifest failed: %s", err)
+	}
+
+	info, err := s.Stat(testID)
+	if err != nil || info.Size != 19 {
+		t.Fatalf("Expected size 19, got %d (%v)", info.Size, err)
+	}
+
+	if got := readRange(t, s, 0, -1); got != "hello chunked world" {
+		t.Fatalf("Expected reassembled file, got '%s'", got)
+	}
+
+	if got := readRange(t, s, 3, 10); got != "lo chunked" {
+		t.Fatalf("Expected 'lo chunked', got '%s'", got)
+	}
+
+	if got := readRange(t, s, 14, -1); got != "world" {
+		t.Fatalf("Expected 'world', got '%s'", got)
+	}
+
+	checksum, _ := s.Hash(testID, md5.New())
+	if want := fmt.Sprintf("%x", md5.Sum([]byte("hello chunked world"))); checksum != want {
+		t.Fatalf("Expected checksum %s, got %s", want, checksum)
+	}
+
+	if _, err := s.Append(testID, 19); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Expected append to a manifest to fail, got %v", err)
+	}
+
+	// Rewriting the file replaces the manifest, and removes the chunks
+	// nothing else uses.
+	write(t, s, 0, "plain")
+	if got := readRange(t, s, 0, -1); got != "plain" {
+		t.Fatalf("Expected 'plain', got '%s'", got)
+	}
+
+	if missing := s.MissingChunks(m.Chunks); len(missing) != len(pieces) {
+		t.Fatalf("Expected unused chunks to be removed, missing %v", missing)
+	}
+}
+
+func TestChunkStoreDedup(t *testing.T) {
+	mem := NewMemory()
+	s := NewChunked(mem)
+	data := []byte("shared bytes")
+	chunk := cdc.Chunk{Hash: cdc.Sum(data), Size: int64(len(data))}
+
+	s.PutChunk(chunk.Hash, data)
+	s.PutManifest(testID, Manifest{Chunks: []cdc.Chunk{chunk, chunk}})
+
+	other := "2c4f1c2e-abcd-4e0f-9a1b-2c3d4e5f6a7b"
+	s.PutManifest(other, Manifest{Chunks: []cdc.Chunk{chunk}})
+
+	r, _ := s.ReadRange(testID, 0, -1)
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	if buf.String() != "shared bytesshared bytes" {
+		t.Fatalf("Unexpected contents '%s'", buf.String())
+	}
+
+	if err := s.Delete(testID); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+
+	if _, err := s.Stat(testID); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Expected deleted file to be gone, got %v", err)
+	}
+
+	if info, err := s.Stat(other); err != nil || info.Size != chunk.Size {
+		t.Fatalf("File sharing a chunk was affected by delete: %v %v", info, err)
+	}
+
+	// Once no manifest uses the chunk it is removed.
+	if err := s.Delete(other); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+
+	if s.HasChunk(chunk) {
+		t.Fatalf("Chunk no manifest uses wasn't removed")
+	}
+
+	if _, err := mem.Stat(refsID(chunk.Hash)); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Expected the chunk's count to be removed, got %v", err)
+	}
+}
+
+func TestChunkStoreReplaceManifest(t *testing.T) {
+	s := NewChunked(NewMemory())
+	var chunks []cdc.Chunk
+	for _, piece := range []string{"kept", "dropped"} {
+		chunk := cdc.Chunk{Hash: cdc.Sum([]byte(piece)), Size: int64(len(piece))}
+		s.PutChunk(chunk.Hash, []byte(piece))
+		chunks = append(chunks, chunk)
+	}
+
+	s.PutManifest(testID, Manifest{Chunks: chunks})
+	if err := s.PutManifest(testID, Manifest{Chunks: chunks[:1]}); err != nil {
+		t.Fatalf("PutManifest failed: %s", err)
+	}
+
+	if !s.HasChunk(chunks[0]) || s.HasChunk(chunks[1]) {
+		t.Fatalf("Expected only the chunk the new manifest uses to be kept")
+	}
+}
+
+func TestChunkStoreUncountedChunks(t *testing.T) {
+	mem := NewMemory()
+	s := NewChunked(mem)
+	data := []byte("stored before counting")
+	chunk := cdc.Chunk{Hash: cdc.Sum(data), Size: int64(len(data))}
+	s.PutChunk(chunk.Hash, data)
+
+	// A manifest written before chunks were counted.
+	manifest, _ := json.Marshal(Manifest{Chunks: []cdc.Chunk{chunk}})
+	w, _ := mem.Append(manifestID(testID), 0)
+	w.Write(manifest)
+	w.Close()
+
+	if err := s.Delete(testID); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+
+	if !s.HasChunk(chunk) {
+		t.Fatalf("Chunk that wasn't counted was removed")
+	}
+}
+
+func TestChunkStoreExternal(t *testing.T) {
+	mem := NewMemory()
+	s := NewChunked(mem)
+	data := []byte("owned by the server")
+	chunk := cdc.Chunk{Hash: cdc.Sum(data), Size: int64(len(data))}
+	s.PutChunk(chunk.Hash, data)
+	s.PutManifest(testID, Manifest{Chunks: []cdc.Chunk{chunk}})
+
+	external := NewChunkedExternal(mem)
+	if info, err := external.Stat(testID); err != nil || info.Size != chunk.Size {
+		t.Fatalf("Unable to stat a file stored as chunks: %v", err)
+	}
+
+	if err := external.Delete(testID); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Expected Delete of a file stored as chunks to fail, got %v", err)
+	}
+
+	if _, err := external.Append(testID, 0); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Expected Append to a file stored as chunks to fail, got %v", err)
+	}
+
+	if err := external.PutManifest(testID, Manifest{}); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Expected PutManifest to fail, got %v", err)
+	}
+
+	if !s.HasChunk(chunk) {
+		t.Fatalf("Chunk was removed by an external ChunkStore")
+	}
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/materials-commons/config"
+)
+
+// New creates the Store selected by MCFS_STORE. The supported values are:
+//
+//	mcdir - Files under MCDIR, this is the default.
+//	s3    - An S3 compatible object store described by the MCFS_S3_* settings.
+//
+// When MCFS_CHUNKS is true the store is wrapped in a ChunkStore so that
+// uploads can be deduplicated at the chunk level. The ChunkStore is shared by
+// every caller in the process, since it serializes the changes to chunk counts.
+func New() Store {
+	if config.GetBool("MCFS_CHUNKS") {
+		chunkedOnce.Do(func() {
+			chunked = NewChunked(newBase())
+		})
+		return chunked
+	}
+	return newBase()
+}
+
+// NewExternal creates the Store for a tool that runs alongside a server, such
+// as mcfsadmin. It is the same as New, except that the chunk counts are left
+// to the server: files stored as chunks can be read, but not changed or
+// removed.
+func NewExternal() Store {
+	if config.GetBool("MCFS_CHUNKS") {
+		return NewChunkedExternal(newBase())
+	}
+	return newBase()
+}
+
+// chunked is the ChunkStore returned by New.
+var chunked *ChunkStore
+var chunkedOnce sync.Once
+
+// newBase creates the Store selected by MCFS_STORE.
+func newBase() Store {
+	switch kind := config.GetString("MCFS_STORE"); kind {
+	case "", "mcdir":
+		return NewMCDir(config.GetString("MCDIR"))
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  config.GetString("MCFS_S3_ENDPOINT"),
+			Region:    config.GetString("MCFS_S3_REGION"),
+			Bucket:    config.GetString("MCFS_S3_BUCKET"),
+			Prefix:    config.GetString("MCFS_S3_PREFIX"),
+			AccessKey: config.GetString("MCFS_S3_ACCESS_KEY"),
+			SecretKey: config.GetString("MCFS_S3_SECRET_KEY"),
+			PartSize:  int64(config.GetInt("MCFS_S3_PART_SIZE")),
+		})
+	default:
+		panic(fmt.Sprintf("Unknown store type %s", kind))
+	}
+}
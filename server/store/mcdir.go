@@ -0,0 +1,128 @@
+package store
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/materials-commons/mcfs/base/mc"
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// mcdirStore stores objects as files in the sharded MCDIR layout
+// (see mc.FilePathFrom).
+type mcdirStore struct {
+	dir string
+}
+
+// NewMCDir creates a new Store rooted at dir.
+func NewMCDir(dir string) Store {
+	return &mcdirStore{dir: dir}
+}
+
+// path returns the full path to an object.
+func (s *mcdirStore) path(id string) string {
+	return mc.FilePathFrom(s.dir, id)
+}
+
+// Append opens the file for an object for writing. It takes care of creating the
+// directory structure if the file doesn't exist.
+func (s *mcdirStore) Append(id string, offset int64) (io.WriteCloser, error) {
+	if err := os.MkdirAll(mc.FileDirFrom(s.dir, id), 0777); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(s.path(id), os.O_WRONLY|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	finfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := checkOffset(id, offset, finfo.Size()); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if offset == 0 {
+		err = f.Truncate(0)
+	} else {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ReadRange opens the file for an object and positions it at offset.
+func (s *mcdirStore) ReadRange(id string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		return nil, notFound(id, err)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return f, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// Stat returns the size and modification time of the file for an object.
+func (s *mcdirStore) Stat(id string) (Info, error) {
+	finfo, err := os.Stat(s.path(id))
+	if err != nil {
+		return Info{}, notFound(id, err)
+	}
+
+	return Info{
+		ID:    id,
+		Size:  finfo.Size(),
+		MTime: finfo.ModTime(),
+	}, nil
+}
+
+// Delete removes the file for an object.
+func (s *mcdirStore) Delete(id string) error {
+	return notFound(id, os.Remove(s.path(id)))
+}
+
+// Hash computes the hash of the file for an object.
+func (s *mcdirStore) Hash(id string, h hash.Hash) (string, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		return "", notFound(id, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// notFound maps a file not existing to mcerr.ErrNotFound.
+func notFound(id string, err error) error {
+	if os.IsNotExist(err) {
+		return mcerr.Errorf(mcerr.ErrNotFound, "No object for %s", id)
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// memoryStore keeps all objects in memory. It is meant for tests.
+type memoryStore struct {
+	mutex   sync.RWMutex
+	objects map[string]*memoryObject
+}
+
+// memoryObject is a single object in a memoryStore.
+type memoryObject struct {
+	data  []byte
+	mtime time.Time
+}
+
+// NewMemory creates a new, empty, in memory Store.
+func NewMemory() Store {
+	return &memoryStore{
+		objects: make(map[string]*memoryObject),
+	}
+}
+
+// memoryWriter appends to an object in a memoryStore.
+type memoryWriter struct {
+	store *memoryStore
+	id    string
+}
+
+// Write implements io.Writer.
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	defer w.store.mutex.Unlock()
+	w.store.mutex.Lock()
+	obj, found := w.store.objects[w.id]
+	if !found {
+		return 0, mcerr.Errorf(mcerr.ErrNotFound, "Object %s was deleted", w.id)
+	}
+	obj.data = append(obj.data, p...)
+	obj.mtime = time.Now()
+	return len(p), nil
+}
+
+// Close implements io.Closer.
+func (w *memoryWriter) Close() error {
+	return nil
+}
+
+// Append opens an object for writing, creating it if needed.
+func (s *memoryStore) Append(id string, offset int64) (io.WriteCloser, error) {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	obj, found := s.objects[id]
+	if !found {
+		obj = &memoryObject{mtime: time.Now()}
+		s.objects[id] = obj
+	}
+
+	if err := checkOffset(id, offset, int64(len(obj.data))); err != nil {
+		return nil, err
+	}
+
+	if offset == 0 {
+		obj.data = nil
+	}
+
+	return &memoryWriter{store: s, id: id}, nil
+}
+
+// ReadRange returns a reader on a copy of the requested range.
+func (s *memoryStore) ReadRange(id string, offset, length int64) (io.ReadCloser, error) {
+	defer s.mutex.RUnlock()
+	s.mutex.RLock()
+	obj, err := s.object(id)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(obj.data))
+	if offset > size {
+		offset = size
+	}
+
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+
+	data := make([]byte, end-offset)
+	copy(data, obj.data[offset:end])
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Stat returns the size and modification time of an object.
+func (s *memoryStore) Stat(id string) (Info, error) {
+	defer s.mutex.RUnlock()
+	s.mutex.RLock()
+	obj, err := s.object(id)
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{
+		ID:    id,
+		Size:  int64(len(obj.data)),
+		MTime: obj.mtime,
+	}, nil
+}
+
+// Delete removes an object.
+func (s *memoryStore) Delete(id string) error {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	if _, err := s.object(id); err != nil {
+		return err
+	}
+	delete(s.objects, id)
+	return nil
+}
+
+// Hash computes the hash of an object.
+func (s *memoryStore) Hash(id string, h hash.Hash) (string, error) {
+	defer s.mutex.RUnlock()
+	s.mutex.RLock()
+	obj, err := s.object(id)
+	if err != nil {
+		return "", err
+	}
+
+	h.Write(obj.data)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// object looks up an object. The caller must hold the mutex.
+func (s *memoryStore) object(id string) (*memoryObject, error) {
+	obj, found := s.objects[id]
+	if !found {
+		return nil, mcerr.Errorf(mcerr.ErrNotFound, "No object for %s", id)
+	}
+	return obj, nil
+}
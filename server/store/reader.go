@@ -0,0 +1,93 @@
+package store
+
+import (
+	"errors"
+	"io"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// Reader reads an object in a Store. It implements io.ReadSeeker so that objects
+// can be served by http.ServeContent. Ranges are only requested from the store when
+// a Read happens, so seeking around an object is cheap.
+type Reader struct {
+	store  Store
+	id     string
+	size   int64
+	offset int64
+	r      io.ReadCloser
+}
+
+// NewReader creates a new Reader for an object.
+func NewReader(s Store, id string) (*Reader, error) {
+	info, err := s.Stat(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		store: s,
+		id:    id,
+		size:  info.Size,
+	}, nil
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.r == nil {
+		rc, err := r.store.ReadRange(r.id, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.r = rc
+	}
+
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("store.Reader.Seek: invalid whence")
+	}
+
+	if abs < 0 {
+		return 0, mcerr.Errorf(mcerr.ErrInvalid, "Negative position %d", abs)
+	}
+
+	if abs != r.offset {
+		r.closeRange()
+		r.offset = abs
+	}
+
+	return abs, nil
+}
+
+// Close implements io.Closer.
+func (r *Reader) Close() error {
+	return r.closeRange()
+}
+
+// closeRange closes the currently open range, if any.
+func (r *Reader) closeRange() error {
+	if r.r == nil {
+		return nil
+	}
+	err := r.r.Close()
+	r.r = nil
+	return err
+}
@@ -0,0 +1,607 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// minPartSize is the smallest part S3 will accept for any part but the last
+// one in a multipart upload.
+const minPartSize = 5 * 1024 * 1024
+
+// S3Config describes how to reach an S3 compatible object store.
+type S3Config struct {
+	Endpoint  string // Base URL of the store, eg https://s3.example.edu
+	Region    string // Region used for signing requests
+	Bucket    string // Bucket datafiles are stored in
+	Prefix    string // Optional prefix for all object keys
+	AccessKey string
+	SecretKey string
+	PartSize  int64        // Size of multipart upload parts, defaults to minPartSize
+	Client    *http.Client // Defaults to http.DefaultClient
+}
+
+// s3Store stores objects in an S3 compatible object store. Datafile ids map to
+// keys using the same sharding as the MCDIR layout. Objects too large for a
+// single PUT are written as a multipart upload. The upload is left open when
+// the writer is closed, so a later Append continues it instead of copying
+// what is already stored. It is completed the first time the object is read.
+type s3Store struct {
+	S3Config
+}
+
+// NewS3 creates a new Store backed by an S3 compatible object store.
+func NewS3(config S3Config) Store {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	if config.PartSize < minPartSize {
+		config.PartSize = minPartSize
+	}
+
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	return &s3Store{S3Config: config}
+}
+
+// key maps a datafile id to its object key.
+func (s *s3Store) key(id string) string {
+	pieces := strings.Split(id, "-")
+	if len(pieces) < 2 || len(pieces[1]) < 4 {
+		return path.Join(s.Prefix, id)
+	}
+	return path.Join(s.Prefix, pieces[1][0:2], pieces[1][2:4], id)
+}
+
+// url returns the path style URL for an object key and query.
+func (s *s3Store) url(key string, query url.Values) string {
+	u := s.Endpoint + "/" + s.Bucket + "/" + key
+	if len(query) != 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	return u
+}
+
+// do signs and sends a request, returning the response if its status is one of ok.
+func (s *s3Store) do(method, key string, query url.Values, headers map[string]string, body []byte, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url(key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	sum := sha256.Sum256(body)
+	signV4(req, hex.EncodeToString(sum[:]), s.Region, s.AccessKey, s.SecretKey, time.Now())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+
+	defer resp.Body.Close()
+	return nil, s3Error(key, resp)
+}
+
+// s3ErrorResponse is the body S3 returns for failed requests.
+type s3ErrorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// s3Error turns a failed response into an error. Missing objects are
+// mcerr.ErrNotFound.
+func s3Error(key string, resp *http.Response) error {
+	var e s3ErrorResponse
+	body, _ := ioutil.ReadAll(resp.Body)
+	xml.Unmarshal(body, &e)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey":
+		return mcerr.Errorf(mcerr.ErrNotFound, "No object for %s", key)
+	case resp.StatusCode == http.StatusForbidden:
+		return mcerr.Errorf(mcerr.ErrNoAccess, "%s: %s %s", key, e.Code, e.Message)
+	default:
+		return mcerr.Errorf(mcerr.ErrInternal, "%s: %s (%s %s)", key, resp.Status, e.Code, e.Message)
+	}
+}
+
+// s3Upload is an unfinished multipart upload. It is kept in an object next to
+// the object being uploaded, and the bytes written since its last part are kept
+// in another, so that a later Append can continue the upload.
+type s3Upload struct {
+	UploadID string
+	Parts    []s3Part
+	Tail     int64     // Number of bytes written since the last part.
+	MTime    time.Time `json:"-"`
+}
+
+// size returns the number of bytes written to the upload.
+func (u *s3Upload) size() int64 {
+	size := u.Tail
+	for _, part := range u.Parts {
+		size += part.Size
+	}
+	return size
+}
+
+// uploadKey returns the key of the object holding the unfinished upload for key.
+func uploadKey(key string) string {
+	return key + ".upload"
+}
+
+// tailKey returns the key of the object holding the bytes written since the
+// last part of the unfinished upload for key.
+func tailKey(key string) string {
+	return key + ".tail"
+}
+
+// pending returns the unfinished upload for an object key, or nil if there
+// isn't one.
+func (s *s3Store) pending(key string) (*s3Upload, error) {
+	resp, err := s.do("GET", uploadKey(key), nil, nil, nil, http.StatusOK)
+	switch {
+	case mcerr.Is(err, mcerr.ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var u s3Upload
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		return nil, err
+	}
+	u.MTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &u, nil
+}
+
+// resume creates a writer that continues an unfinished upload.
+func (s *s3Store) resume(key string, u *s3Upload) (*s3Writer, error) {
+	w := &s3Writer{store: s, key: key, uploadID: u.UploadID, parts: u.Parts}
+	if u.Tail == 0 {
+		return w, nil
+	}
+
+	resp, err := s.do("GET", tailKey(key), nil, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if _, err := w.buf.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// finish completes an unfinished upload, sending the bytes written since its
+// last part as the final part.
+func (s *s3Store) finish(key string, u *s3Upload) error {
+	w, err := s.resume(key, u)
+	if err != nil {
+		return err
+	}
+
+	if w.buf.Len() != 0 {
+		if err := w.uploadPart(w.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := w.complete(); err != nil {
+		return err
+	}
+	return s.removePending(key)
+}
+
+// abortPending throws away an unfinished upload.
+func (s *s3Store) abortPending(key string, u *s3Upload) error {
+	w := &s3Writer{store: s, key: key, uploadID: u.UploadID}
+	w.abort()
+	return s.removePending(key)
+}
+
+// removePending removes the objects kept for an unfinished upload.
+func (s *s3Store) removePending(key string) error {
+	for _, k := range []string{tailKey(key), uploadKey(key)} {
+		resp, err := s.do("DELETE", k, nil, nil, nil, http.StatusNoContent, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// put writes an object with a single PUT.
+func (s *s3Store) put(key string, data []byte) error {
+	resp, err := s.do("PUT", key, nil, nil, data, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Append opens an object for writing. Appending to an object with an unfinished
+// upload continues the upload. Otherwise when offset is not 0 the existing
+// object becomes the first part of a new upload, either by a server side copy
+// or, if it is too small to be a part, by reading it back in.
+func (s *s3Store) Append(id string, offset int64) (io.WriteCloser, error) {
+	key := s.key(id)
+	u, err := s.pending(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	if u != nil {
+		size = u.size()
+	} else {
+		info, err := s.Stat(id)
+		switch {
+		case err == nil:
+			size = info.Size
+		case !mcerr.Is(err, mcerr.ErrNotFound):
+			return nil, err
+		}
+	}
+
+	if err := checkOffset(id, offset, size); err != nil {
+		return nil, err
+	}
+
+	w := &s3Writer{store: s, key: key}
+	switch {
+	case offset == 0 && u != nil:
+		if err := s.abortPending(key, u); err != nil {
+			return nil, err
+		}
+	case offset == 0:
+		// Nothing to carry over
+	case u != nil:
+		if w, err = s.resume(key, u); err != nil {
+			return nil, err
+		}
+	case size < minPartSize:
+		r, err := s.ReadRange(id, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		if _, err := w.buf.ReadFrom(r); err != nil {
+			return nil, err
+		}
+	default:
+		if err := w.copyPart(size); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// ReadRange does a ranged GET on an object. An unfinished upload of the object
+// is completed first.
+func (s *s3Store) ReadRange(id string, offset, length int64) (io.ReadCloser, error) {
+	key := s.key(id)
+	u, err := s.pending(key)
+	switch {
+	case err != nil:
+		return nil, err
+	case u != nil:
+		if err := s.finish(key, u); err != nil {
+			return nil, err
+		}
+	}
+
+	if length == 0 {
+		if _, err := s.Stat(id); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	headers := map[string]string{}
+	switch {
+	case length > 0:
+		headers["Range"] = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	case offset > 0:
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	resp, err := s.do("GET", s.key(id), nil, headers, nil, http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// Reading past the end of an object.
+		resp.Body.Close()
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	return resp.Body, nil
+}
+
+// Stat does a HEAD on an object. The size of an object with an unfinished
+// upload is the number of bytes written to the upload.
+func (s *s3Store) Stat(id string) (Info, error) {
+	u, err := s.pending(s.key(id))
+	switch {
+	case err != nil:
+		return Info{}, err
+	case u != nil:
+		return Info{ID: id, Size: u.size(), MTime: u.MTime}, nil
+	}
+
+	resp, err := s.do("HEAD", s.key(id), nil, nil, nil, http.StatusOK)
+	if err != nil {
+		return Info{}, err
+	}
+	resp.Body.Close()
+
+	mtime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return Info{
+		ID:    id,
+		Size:  resp.ContentLength,
+		MTime: mtime,
+	}, nil
+}
+
+// Delete removes an object, and throws away any unfinished upload of it. S3
+// doesn't complain when deleting a missing key, so existence is checked first.
+func (s *s3Store) Delete(id string) error {
+	key := s.key(id)
+	u, err := s.pending(key)
+	switch {
+	case err != nil:
+		return err
+	case u != nil:
+		if err := s.abortPending(key, u); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.Stat(id); err != nil {
+		if u != nil && mcerr.Is(err, mcerr.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	resp, err := s.do("DELETE", key, nil, nil, nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Hash streams an object through h.
+func (s *s3Store) Hash(id string, h hash.Hash) (string, error) {
+	r, err := s.ReadRange(id, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// s3Writer writes an object as a multipart upload. Bytes are buffered until
+// there is enough for a part. The multipart upload is only started once the
+// first part needs to be sent, so small writes become a single PUT. Closing
+// the writer keeps an unfinished upload, along with the buffered bytes, so
+// that it can be continued.
+type s3Writer struct {
+	store    *s3Store
+	key      string
+	buf      bytes.Buffer
+	uploadID string
+	parts    []s3Part
+	err      error
+}
+
+// s3Part is a completed part of a multipart upload.
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"-"`
+}
+
+// Write implements io.Writer. The bytes of a part stay buffered until the
+// part has been sent, so when sending a part fails all of p is still kept
+// by Close.
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf.Write(p)
+	for int64(w.buf.Len()) >= w.store.PartSize {
+		if w.err = w.uploadPart(w.buf.Bytes()[:w.store.PartSize]); w.err != nil {
+			return len(p), w.err
+		}
+		w.buf.Next(int(w.store.PartSize))
+	}
+
+	return len(p), nil
+}
+
+// Close stores the buffered bytes. Without a multipart upload they become
+// the object. Otherwise the upload is kept so it can be continued, and is
+// completed when the object is next read. An error from an earlier Write is
+// returned once the bytes are stored.
+func (w *s3Writer) Close() error {
+	var err error
+	if w.uploadID == "" {
+		err = w.store.put(w.key, w.buf.Bytes())
+	} else {
+		err = w.save()
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+	return err
+}
+
+// save keeps the unfinished upload and the bytes written since its last part.
+func (w *s3Writer) save() error {
+	if err := w.store.put(tailKey(w.key), w.buf.Bytes()); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s3Upload{UploadID: w.uploadID, Parts: w.parts, Tail: int64(w.buf.Len())})
+	if err != nil {
+		return err
+	}
+	return w.store.put(uploadKey(w.key), data)
+}
+
+// start starts the multipart upload if it hasn't already been started.
+func (w *s3Writer) start() error {
+	if w.uploadID != "" {
+		return nil
+	}
+
+	resp, err := w.store.do("POST", w.key, url.Values{"uploads": {""}}, nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	w.uploadID = result.UploadID
+	return nil
+}
+
+// partQuery returns the query identifying the next part.
+func (w *s3Writer) partQuery() url.Values {
+	return url.Values{
+		"partNumber": {strconv.Itoa(len(w.parts) + 1)},
+		"uploadId":   {w.uploadID},
+	}
+}
+
+// uploadPart sends the next part.
+func (w *s3Writer) uploadPart(data []byte) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	resp, err := w.store.do("PUT", w.key, w.partQuery(), nil, data, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	w.parts = append(w.parts, s3Part{PartNumber: len(w.parts) + 1, ETag: resp.Header.Get("ETag"), Size: int64(len(data))})
+	return nil
+}
+
+// copyPart makes the existing object, which is size bytes, the next part.
+func (w *s3Writer) copyPart(size int64) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	source := map[string]string{"x-amz-copy-source": "/" + w.store.Bucket + "/" + w.key}
+	resp, err := w.store.do("PUT", w.key, w.partQuery(), source, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ETag string `xml:"ETag"`
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	w.parts = append(w.parts, s3Part{PartNumber: len(w.parts) + 1, ETag: result.ETag, Size: size})
+	return nil
+}
+
+// complete completes the multipart upload.
+func (w *s3Writer) complete() error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.store.do("POST", w.key, url.Values{"uploadId": {w.uploadID}}, nil, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// A complete can fail after S3 has sent back a 200.
+	data, _ := ioutil.ReadAll(resp.Body)
+	var e s3ErrorResponse
+	if xml.Unmarshal(data, &e) == nil {
+		return mcerr.Errorf(mcerr.ErrInternal, "%s: %s %s", w.key, e.Code, e.Message)
+	}
+
+	return nil
+}
+
+// abort throws away the multipart upload, if one was started.
+func (w *s3Writer) abort() {
+	if w.uploadID == "" {
+		return
+	}
+
+	resp, err := w.store.do("DELETE", w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil, http.StatusNoContent, http.StatusOK)
+	if err == nil {
+		resp.Body.Close()
+	}
+	w.uploadID = ""
+}
@@ -0,0 +1,55 @@
+/*
+Package store provides access to the physical bytes behind a datafile. All reads
+and writes of datafile contents go through the Store interface so that the
+location and format of the bytes can be changed without touching the upload
+and download paths. The default implementation is the sharded MCDIR layout
+on a local filesystem.
+*/
+package store
+
+import (
+	"hash"
+	"io"
+	"time"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// Info describes a stored object.
+type Info struct {
+	ID    string    // ID of the datafile the object holds the bytes for.
+	Size  int64     // Number of bytes stored.
+	MTime time.Time // Last time the object was written to.
+}
+
+// Store is the API to the physical storage of datafiles. Objects are identified by
+// their datafile id. Operations on an object that doesn't exist return
+// mcerr.ErrNotFound.
+type Store interface {
+	// Append opens an object for writing. Offset must be either 0, in which
+	// case any existing bytes are discarded, or the current size of the object.
+	// The object is created if it doesn't exist.
+	Append(id string, offset int64) (io.WriteCloser, error)
+
+	// ReadRange opens an object for reading length bytes starting at offset.
+	// A negative length reads to the end of the object.
+	ReadRange(id string, offset, length int64) (io.ReadCloser, error)
+
+	// Stat returns information on an object.
+	Stat(id string) (Info, error)
+
+	// Delete removes an object.
+	Delete(id string) error
+
+	// Hash computes the hex encoded hash of an object's bytes using h.
+	Hash(id string, h hash.Hash) (string, error)
+}
+
+// checkOffset validates an offset passed to Append against the current size of
+// an object.
+func checkOffset(id string, offset, size int64) error {
+	if offset != 0 && offset != size {
+		return mcerr.Errorf(mcerr.ErrInvalid, "Offset %d for %s doesn't match its size %d", offset, id, size)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/materials-commons/mcfs/base/mcerr"
+)
+
+// Ids need to look like datafile ids for the MCDIR layout.
+const testID = "1b4f1c2e-abcd-4e0f-9a1b-2c3d4e5f6a7b"
+
+func TestMCDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcdir")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	testStore(t, NewMCDir(dir))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+// testStore runs the behavior every Store implementation must have.
+func testStore(t *testing.T, s Store) {
+	if _, err := s.Stat(testID); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for missing object, got %v", err)
+	}
+
+	if _, err := s.ReadRange(testID, 0, -1); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound reading missing object, got %v", err)
+	}
+
+	write(t, s, 0, "hello")
+
+	if _, err := s.Append(testID, 3); !mcerr.Is(err, mcerr.ErrInvalid) {
+		t.Fatalf("Expected ErrInvalid appending at bad offset, got %v", err)
+	}
+
+	write(t, s, 5, " world")
+
+	info, err := s.Stat(testID)
+	if err != nil || info.Size != 11 {
+		t.Fatalf("Expected size 11, got %d (%v)", info.Size, err)
+	}
+
+	if got := readRange(t, s, 0, -1); got != "hello world" {
+		t.Fatalf("Expected 'hello world', got '%s'", got)
+	}
+
+	if got := readRange(t, s, 6, 3); got != "wor" {
+		t.Fatalf("Expected 'wor', got '%s'", got)
+	}
+
+	checksum, err := s.Hash(testID, md5.New())
+	if expected := fmt.Sprintf("%x", md5.Sum([]byte("hello world"))); err != nil || checksum != expected {
+		t.Fatalf("Expected checksum %s, got %s (%v)", expected, checksum, err)
+	}
+
+	r, err := NewReader(s, testID)
+	if err != nil {
+		t.Fatalf("NewReader failed: %s", err)
+	}
+	r.Seek(-5, io.SeekEnd)
+	if b, _ := ioutil.ReadAll(r); string(b) != "world" {
+		t.Fatalf("Expected 'world' after seek, got '%s'", b)
+	}
+	r.Close()
+
+	// Appending at offset 0 replaces the existing bytes.
+	write(t, s, 0, "bye")
+	if got := readRange(t, s, 0, -1); got != "bye" {
+		t.Fatalf("Expected 'bye', got '%s'", got)
+	}
+
+	if err := s.Delete(testID); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+
+	if err := s.Delete(testID); !mcerr.Is(err, mcerr.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound deleting missing object, got %v", err)
+	}
+}
+
+func write(t *testing.T, s Store, offset int64, data string) {
+	w, err := s.Append(testID, offset)
+	if err != nil {
+		t.Fatalf("Append at %d failed: %s", offset, err)
+	}
+	defer w.Close()
+
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+}
+
+func readRange(t *testing.T, s Store, offset, length int64) string {
+	r, err := s.ReadRange(testID, offset, length)
+	if err != nil {
+		t.Fatalf("ReadRange(%d, %d) failed: %s", offset, length, err)
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	return string(b)
+}